@@ -0,0 +1,223 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+const (
+	// ABIReportRoot is where the install root to report on is placed.
+	ABIReportRoot = "/hostRoot/ABIReport/install"
+
+	// ABIReportOutput is where we always mount the output directory.
+	ABIReportOutput = "/hostRoot/ABIReport/output"
+
+	// eopkgInstallArchive is the archive of installed files within an eopkg.
+	eopkgInstallArchive = "install.tar.xz"
+)
+
+// ErrABIReportInput is returned when the ABI report is asked for anything
+// other than a single install root or some .eopkg files.
+var ErrABIReportInput = errors.New("ABI report requires an install root directory or .eopkg files")
+
+// runABIWizard will generate the ABI report of the install root within the
+// chroot, writing the abi_* files into outputDir. All ABI reports, whether
+// part of a build or not, are generated here.
+func runABIWizard(notif PidNotifier, root, outputDir, installRoot string) error {
+	cmd := fmt.Sprintf("cd %s; abi-wizard %s", outputDir, installRoot)
+	err := ChrootExec(notif, root, "abi report", cmd)
+
+	notif.SetActivePID(0)
+
+	return err
+}
+
+// GenerateABIReport will take care of generating the abireport of the build
+// using abi-wizard, alongside the built packages.
+func (p *Package) GenerateABIReport(notif PidNotifier, overlay *Overlay) error {
+	installRoot := filepath.Join(BuildUserHome, "YPKG", "root", p.Name, "install")
+
+	return runABIWizard(notif, overlay.MountPoint, p.GetWorkDirInternal(), installRoot)
+}
+
+// ExtractInstallArchive will copy the archive of installed files out of the
+// .eopkg to the given path.
+func ExtractInstallArchive(pkg, dest string) error {
+	zr, err := zip.OpenReader(pkg)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != eopkgInstallArchive {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		_, err = io.Copy(out, r)
+
+		return err
+	}
+
+	return fmt.Errorf("%s is missing from %s", eopkgInstallArchive, pkg)
+}
+
+// validateABIReportInput ensures the paths are either a single directory, or
+// only .eopkg files.
+func validateABIReportInput(paths []string) (bool, error) {
+	if len(paths) == 0 {
+		return false, ErrABIReportInput
+	}
+
+	if st, err := os.Stat(paths[0]); err == nil && st.IsDir() {
+		if len(paths) > 1 {
+			return false, ErrABIReportInput
+		}
+
+		return true, nil
+	}
+
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".eopkg") || !PathExists(path) {
+			return false, fmt.Errorf("%w: %s", ErrABIReportInput, path)
+		}
+	}
+
+	return false, nil
+}
+
+// ABIReport will generate the ABI report of an existing install root, or of
+// the files installed by the given .eopkg files, into the output directory.
+func (p *Package) ABIReport(notif PidNotifier, paths []string, outputDir string, overlay *Overlay) error {
+	slog.Debug("Beginning ABI report", "profile", overlay.Back.Name)
+
+	isDir, err := validateABIReportInput(paths)
+	if err != nil {
+		return err
+	}
+
+	mman := disk.GetMountManager()
+
+	ChrootEnvironment = SaneEnvironment("root", "/root")
+
+	if err := overlay.CleanExisting(); err != nil {
+		return err
+	}
+
+	if err := p.ActivateRoot(overlay); err != nil {
+		return err
+	}
+
+	if !PathExists(filepath.Join(overlay.MountPoint, "usr/bin/abi-wizard")) {
+		return errors.New("abi-wizard is missing from the image, please update it")
+	}
+
+	root := filepath.Join(overlay.MountPoint, ABIReportRoot[1:])
+	if err := os.MkdirAll(root, 0o0755); err != nil {
+		return fmt.Errorf("Failed to create install root, reason: %w\n", err)
+	}
+
+	if isDir {
+		slog.Debug("Bind mounting install root", "dir", paths[0])
+
+		if err := mman.BindMount(paths[0], root, "ro"); err != nil {
+			return fmt.Errorf("Failed to bind mount install root, reason: %w\n", err)
+		}
+
+		overlay.ExtraMounts = append(overlay.ExtraMounts, root)
+	} else if err := p.unpackABIReportInput(notif, paths, overlay); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outputDir, 0o0755); err != nil {
+		return fmt.Errorf("Failed to create output directory, reason: %w\n", err)
+	}
+
+	output := filepath.Join(overlay.MountPoint, ABIReportOutput[1:])
+	if err := os.MkdirAll(output, 0o0755); err != nil {
+		return fmt.Errorf("Failed to create output directory, reason: %w\n", err)
+	}
+
+	if err := mman.BindMount(outputDir, output); err != nil {
+		return fmt.Errorf("Failed to bind mount output directory, reason: %w\n", err)
+	}
+
+	overlay.ExtraMounts = append(overlay.ExtraMounts, output)
+
+	slog.Info("Generating ABI report")
+
+	if err := runABIWizard(notif, overlay.MountPoint, ABIReportOutput, ABIReportRoot); err != nil {
+		return fmt.Errorf("Failed to generate ABI report, reason: %w\n", err)
+	}
+
+	usr := GetUserInfo()
+	reports, _ := filepath.Glob(filepath.Join(outputDir, "abi_*"))
+
+	for _, report := range reports {
+		if err := os.Chown(report, usr.UID, usr.GID); err != nil {
+			slog.Error("Error in restoring file ownership", "path", report, "reason", err)
+		}
+	}
+
+	slog.Info("Generated ABI report", "files", len(reports), "dir", outputDir)
+
+	return nil
+}
+
+// unpackABIReportInput will unpack the installed files of each .eopkg into
+// the install root.
+func (p *Package) unpackABIReportInput(notif PidNotifier, paths []string, overlay *Overlay) error {
+	for i, path := range paths {
+		slog.Debug("Unpacking package", "path", path)
+
+		archive := filepath.Join(filepath.Dir(ABIReportRoot), fmt.Sprintf("%d-%s", i, eopkgInstallArchive))
+		if err := ExtractInstallArchive(path, filepath.Join(overlay.MountPoint, archive[1:])); err != nil {
+			return fmt.Errorf("Failed to read %s, reason: %w\n", path, err)
+		}
+
+		cmd := fmt.Sprintf("tar -xJf %s -C %s", archive, ABIReportRoot)
+		if err := ChrootExec(notif, overlay.MountPoint, "unpack", cmd); err != nil {
+			return fmt.Errorf("Failed to unpack %s, reason: %w\n", path, err)
+		}
+
+		notif.SetActivePID(0)
+	}
+
+	return nil
+}
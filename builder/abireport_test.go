@@ -0,0 +1,47 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestExtractInstallArchive(t *testing.T) {
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "nano-8.0-180-1-x86_64.eopkg")
+	dest := filepath.Join(dir, "install.tar.xz")
+
+	writePackage(t, pkg, "metadata.xml", "files.xml", "install.tar.xz")
+
+	if err := builder.ExtractInstallArchive(pkg, dest); err != nil {
+		t.Fatalf("Failed to extract install archive: %v", err)
+	}
+
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatalf("Install archive was not extracted: %v", err)
+	}
+
+	writePackage(t, pkg, "metadata.xml", "files.xml")
+
+	if err := builder.ExtractInstallArchive(pkg, dest); err == nil {
+		t.Fatal("Extracted install archive from a package without one")
+	}
+}
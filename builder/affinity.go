@@ -0,0 +1,177 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCPUList is returned when a list of CPUs or NUMA nodes is malformed.
+var ErrInvalidCPUList = errors.New("Invalid CPU list")
+
+var (
+	// CPUAffinity is the set of CPUs that build commands are pinned to, or
+	// empty to run them on any CPU.
+	CPUAffinity []int
+
+	// SysCPUDir is where the kernel describes the CPUs of the host.
+	SysCPUDir = "/sys/devices/system/cpu"
+
+	// SysNodeDir is where the kernel describes the NUMA nodes of the host.
+	SysNodeDir = "/sys/devices/system/node"
+)
+
+// ParseCPUList will parse a list in the kernel's cpulist format, such as
+// "0-3,8,10-11", into a sorted set of numbers.
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+
+	for _, field := range strings.Split(strings.TrimSpace(list), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(field, "-")
+
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCPUList, list)
+		}
+
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidCPUList, list)
+			}
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	slices.Sort(cpus)
+
+	return slices.Compact(cpus), nil
+}
+
+// FormatCPUList will format a sorted set of numbers in the kernel's cpulist
+// format, collapsing consecutive numbers into ranges.
+func FormatCPUList(cpus []int) string {
+	var fields []string
+
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+
+		if i == j {
+			fields = append(fields, strconv.Itoa(cpus[i]))
+		} else {
+			fields = append(fields, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// readCPUList will parse a cpulist file provided by the kernel.
+func readCPUList(path string) ([]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCPUList(string(data))
+}
+
+// ResolveAffinity will find the CPUs to pin builds to from the given CPU and
+// NUMA node lists, either of which may be empty. When both are given, only
+// the listed CPUs within the listed nodes are used. Every CPU must be online.
+func ResolveAffinity(cpuList, nodeList string) ([]int, error) {
+	cpus, err := ParseCPUList(cpuList)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := ParseCPUList(nodeList)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cpus) == 0 && len(nodes) == 0 {
+		return nil, nil
+	}
+
+	online, err := readCPUList(filepath.Join(SysCPUDir, "online"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find online CPUs, reason: %w", err)
+	}
+
+	for _, cpu := range cpus {
+		if !slices.Contains(online, cpu) {
+			return nil, fmt.Errorf("CPU %d is not online, expected one of %s", cpu, FormatCPUList(online))
+		}
+	}
+
+	if len(nodes) > 0 {
+		var nodeCPUs []int
+
+		for _, node := range nodes {
+			found, err := readCPUList(filepath.Join(SysNodeDir, fmt.Sprintf("node%d", node), "cpulist"))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to find CPUs of NUMA node %d, reason: %w", node, err)
+			}
+
+			nodeCPUs = append(nodeCPUs, found...)
+		}
+
+		if len(cpus) > 0 {
+			nodeCPUs = slices.DeleteFunc(nodeCPUs, func(cpu int) bool { return !slices.Contains(cpus, cpu) })
+		}
+
+		cpus = slices.DeleteFunc(nodeCPUs, func(cpu int) bool { return !slices.Contains(online, cpu) })
+		slices.Sort(cpus)
+	}
+
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("No online CPUs within NUMA nodes %s", FormatCPUList(nodes))
+	}
+
+	return cpus, nil
+}
+
+// pinnedCommand will create the command so that it, and every process it
+// starts, only runs on the CPUs in CPUAffinity.
+func pinnedCommand(name string, args ...string) *exec.Cmd {
+	if len(CPUAffinity) == 0 {
+		return exec.Command(name, args...)
+	}
+
+	return exec.Command("taskset", append([]string{"--cpu-list", FormatCPUList(CPUAffinity), name}, args...)...)
+}
@@ -0,0 +1,108 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := builder.ParseCPUList("8, 0-3,2,10-11\n")
+	if err != nil {
+		t.Fatalf("Failed to parse CPU list: %v", err)
+	}
+
+	if !slices.Equal(cpus, []int{0, 1, 2, 3, 8, 10, 11}) {
+		t.Fatalf("Unexpected CPUs: %v", cpus)
+	}
+
+	if list := builder.FormatCPUList(cpus); list != "0-3,8,10-11" {
+		t.Fatalf("Unexpected CPU list: %s", list)
+	}
+
+	for _, list := range []string{"a", "3-1", "-1", "1-"} {
+		if _, err = builder.ParseCPUList(list); !errors.Is(err, builder.ErrInvalidCPUList) {
+			t.Fatalf("Expected ErrInvalidCPUList for %q, got: %v", list, err)
+		}
+	}
+}
+
+func TestResolveAffinity(t *testing.T) {
+	sys := t.TempDir()
+	files := map[string]string{
+		"cpu/online":         "0-7\n",
+		"node/node0/cpulist": "0-3\n",
+		"node/node1/cpulist": "4-7,8-11\n",
+		"node/node2/cpulist": "\n",
+	}
+
+	for path, content := range files {
+		full := filepath.Join(sys, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	cpuDir, nodeDir := builder.SysCPUDir, builder.SysNodeDir
+	builder.SysCPUDir, builder.SysNodeDir = filepath.Join(sys, "cpu"), filepath.Join(sys, "node")
+
+	t.Cleanup(func() { builder.SysCPUDir, builder.SysNodeDir = cpuDir, nodeDir })
+
+	tests := []struct {
+		cpus, nodes string
+		expected    []int
+		fails       bool
+	}{
+		{"", "", nil, false},
+		{"2-3", "", []int{2, 3}, false},
+		{"", "1", []int{4, 5, 6, 7}, false},
+		{"0,5-6", "1", []int{5, 6}, false},
+		{"8", "", nil, true},
+		{"0", "1", nil, true},
+		{"", "2", nil, true},
+		{"", "3", nil, true},
+	}
+
+	for _, test := range tests {
+		cpus, err := builder.ResolveAffinity(test.cpus, test.nodes)
+		if test.fails {
+			if err == nil {
+				t.Fatalf("Expected cpus %q and nodes %q to fail, got: %v", test.cpus, test.nodes, cpus)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to resolve cpus %q and nodes %q: %v", test.cpus, test.nodes, err)
+		}
+
+		if !slices.Equal(cpus, test.expected) {
+			t.Fatalf("Expected %v for cpus %q and nodes %q, got: %v", test.expected, test.cpus, test.nodes, cpus)
+		}
+	}
+}
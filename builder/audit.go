@@ -0,0 +1,383 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// AuditLogPath is where the audit log of operations changing the state of
+// solbuild is kept.
+var AuditLogPath = "/var/log/solbuild/audit.log"
+
+// ErrAuditTampered is returned when the audit log does not match its chain
+// of hashes.
+var ErrAuditTampered = errors.New("Audit log has been tampered with")
+
+// ErrAuditTorn is returned when the audit log ends with an incomplete
+// record, such as when solbuild was killed while writing it. It may be
+// removed with RepairAudit.
+var ErrAuditTorn = errors.New("Audit log ends with an incomplete record, run solbuild audit --repair")
+
+// auditChunkSize is how much of the audit log is read at a time when
+// looking for its final record.
+const auditChunkSize = 4096
+
+// Operations recorded in the audit log.
+const (
+	AuditBuild       = "build"
+	AuditUpdate      = "update"
+	AuditDeleteCache = "delete-cache"
+	AuditPrune       = "prune"
+)
+
+// CollectedArtifacts are the artifacts collected into OutputDir by the
+// last build.
+var CollectedArtifacts []string
+
+// An AuditRecord is a single operation in the audit log. Each record holds
+// the hash of the one before it, so that changing or removing a record
+// breaks the chain.
+type AuditRecord struct {
+	User      string            `json:"user"`
+	UID       int               `json:"uid"`
+	Operation string            `json:"operation"`
+	Package   string            `json:"package,omitempty"`
+	Profile   string            `json:"profile,omitempty"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Result    string            `json:"result"` // Either success or failure
+	Error     string            `json:"error,omitempty"`
+	Artifacts map[string]string `json:"artifacts,omitempty"` // SHA256 sums of the artifacts by name
+	Paths     []string          `json:"paths,omitempty"`     // Paths removed by the operation
+	Prev      string            `json:"prev"`
+	Hash      string            `json:"hash"`
+}
+
+// NewAuditRecord will create a record of the operation, started at start
+// and finishing now, by the user who invoked solbuild.
+func NewAuditRecord(operation string, start time.Time, err error) *AuditRecord {
+	rec := &AuditRecord{
+		User:      auditUser(),
+		UID:       os.Getuid(),
+		Operation: operation,
+		Start:     start.UTC(),
+		End:       time.Now().UTC(),
+		Result:    "success",
+	}
+
+	if sudoUID, e := strconv.Atoi(os.Getenv("SUDO_UID")); e == nil {
+		rec.UID = sudoUID
+	}
+
+	if err != nil {
+		rec.Result = "failure"
+		rec.Error = err.Error()
+	}
+
+	return rec
+}
+
+// auditUser finds the name of the user who invoked solbuild, through sudo
+// if need be.
+func auditUser() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+
+	if usr, err := user.Current(); err == nil {
+		return usr.Username
+	}
+
+	return strconv.Itoa(os.Getuid())
+}
+
+// AddArtifacts will record the SHA256 sums of the artifacts.
+func (r *AuditRecord) AddArtifacts(paths []string) {
+	for _, path := range paths {
+		sum, err := FileSha256sum(path)
+		if err != nil {
+			continue
+		}
+
+		if r.Artifacts == nil {
+			r.Artifacts = make(map[string]string)
+		}
+
+		r.Artifacts[filepath.Base(path)] = sum
+	}
+}
+
+// sum computes the hash of the record, covering every field but the hash.
+func (r *AuditRecord) sum() (string, error) {
+	rec := *r
+	rec.Hash = ""
+
+	data, err := json.Marshal(&rec)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AppendAudit will chain the record onto the end of the audit log at path.
+func AppendAudit(path string, r *AuditRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to create audit log directory, reason: %w\n", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("Failed to open audit log, reason: %w\n", err)
+	}
+	defer f.Close()
+
+	// Concurrent solbuild instances must chain onto each other in turn
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("Failed to lock audit log, reason: %w\n", err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN) //nolint:errcheck // released on close regardless
+
+	last, err := lastAuditRecord(f)
+	if err != nil {
+		return err
+	}
+
+	if last != nil {
+		r.Prev = last.Hash
+	}
+
+	if r.Hash, err = r.sum(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write audit log, reason: %w\n", err)
+	}
+
+	return f.Sync()
+}
+
+// lastLineStart finds the offset of the final line of the file of the given
+// size, reading backwards from the end so that the whole file is not read.
+// The last byte of the file is taken to end the final line.
+func lastLineStart(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, auditChunkSize)
+
+	for end := size - 1; end > 0; {
+		n := min(end, auditChunkSize)
+
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return 0, fmt.Errorf("Failed to read audit log, reason: %w\n", err)
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return end - n + int64(i) + 1, nil
+		}
+
+		end -= n
+	}
+
+	return 0, nil
+}
+
+// lastAuditRecord reads the final record of the audit log. Every record is
+// terminated by a newline, so a final record without one was torn while it
+// was being written.
+func lastAuditRecord(f *os.File) (*AuditRecord, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read audit log, reason: %w\n", err)
+	}
+
+	size := st.Size()
+	if size == 0 {
+		return nil, nil
+	}
+
+	start, err := lastLineStart(f, size)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size-start)
+	if _, err = f.ReadAt(data, start); err != nil {
+		return nil, fmt.Errorf("Failed to read audit log, reason: %w\n", err)
+	}
+
+	if data[len(data)-1] != '\n' {
+		return nil, ErrAuditTorn
+	}
+
+	var last AuditRecord
+	if err = json.Unmarshal(data, &last); err != nil {
+		return nil, fmt.Errorf("%w: unreadable final record", ErrAuditTampered)
+	}
+
+	return &last, nil
+}
+
+// RepairAudit will remove an incomplete final record from the audit log at
+// path, returning the number of bytes removed. Complete records are never
+// removed, so a log that has been tampered with still fails verification.
+func RepairAudit(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open audit log, reason: %w\n", err)
+	}
+	defer f.Close()
+
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return 0, fmt.Errorf("Failed to lock audit log, reason: %w\n", err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN) //nolint:errcheck // released on close regardless
+
+	if _, err = lastAuditRecord(f); !errors.Is(err, ErrAuditTorn) {
+		return 0, err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	start, err := lastLineStart(f, st.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	// Only the newline was lost, so the record is kept
+	data := make([]byte, st.Size()-start)
+	if _, err = f.ReadAt(data, start); err != nil {
+		return 0, fmt.Errorf("Failed to read audit log, reason: %w\n", err)
+	}
+
+	var rec AuditRecord
+	if json.Unmarshal(data, &rec) == nil {
+		if _, err = f.WriteAt([]byte("\n"), st.Size()); err != nil {
+			return 0, fmt.Errorf("Failed to repair audit log, reason: %w\n", err)
+		}
+
+		return 0, f.Sync()
+	}
+
+	if err = f.Truncate(start); err != nil {
+		return 0, fmt.Errorf("Failed to repair audit log, reason: %w\n", err)
+	}
+
+	return st.Size() - start, f.Sync()
+}
+
+// ReadAudit will read every record of the audit log at path, verifying the
+// chain of hashes. The records up to the first broken link are returned
+// along with ErrAuditTampered.
+func ReadAudit(path string) ([]*AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		records []*AuditRecord
+		prev    string
+		line    int
+	)
+
+	// A torn final record is reported as such, rather than as tampering
+	_, tornErr := lastAuditRecord(f)
+	torn := errors.Is(tornErr, ErrAuditTorn)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line++
+
+		var rec AuditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			if torn && !scanner.Scan() {
+				return records, ErrAuditTorn
+			}
+
+			return records, fmt.Errorf("%w: unreadable record on line %d", ErrAuditTampered, line)
+		}
+
+		sum, err := rec.sum()
+		if err != nil {
+			return records, err
+		}
+
+		if rec.Prev != prev || rec.Hash != sum {
+			return records, fmt.Errorf("%w: chain broken on line %d", ErrAuditTampered, line)
+		}
+
+		prev = rec.Hash
+		records = append(records, &rec)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return records, err
+	}
+
+	if torn {
+		return records, ErrAuditTorn
+	}
+
+	return records, nil
+}
+
+// Audit will complete the record with the profile, and append it to the
+// audit log if enabled. An operation that cannot be recorded is an error,
+// as the audit log would otherwise silently stop growing.
+func (m *Manager) Audit(rec *AuditRecord) error {
+	if !m.Config.AuditLog {
+		return nil
+	}
+
+	if profile := m.GetProfile(); profile != nil {
+		rec.Profile = profile.Name
+	}
+
+	if err := AppendAudit(AuditLogPath, rec); err != nil {
+		slog.Error("Failed to write audit log", "path", AuditLogPath, "err", err)
+		return fmt.Errorf("Failed to record %s in the audit log, reason: %w", rec.Operation, err)
+	}
+
+	return nil
+}
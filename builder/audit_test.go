@@ -0,0 +1,157 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestAuditChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for _, op := range []string{builder.AuditUpdate, builder.AuditBuild, builder.AuditDeleteCache} {
+		rec := builder.NewAuditRecord(op, time.Now(), nil)
+		rec.Package = "nano-8.0-1"
+
+		if err := builder.AppendAudit(path, rec); err != nil {
+			t.Fatalf("Failed to append audit record: %v", err)
+		}
+	}
+
+	records, err := builder.ReadAudit(path)
+	if err != nil {
+		t.Fatalf("Failed to verify audit log: %v", err)
+	}
+
+	if len(records) != 3 || records[0].Prev != "" || records[1].Prev != records[0].Hash {
+		t.Fatalf("Audit records were not chained: %+v", records)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+
+	// Rewriting a record breaks the chain at that record
+	tampered := strings.Replace(lines[1], `"result":"success"`, `"result":"failure"`, 1)
+	if err = os.WriteFile(path, []byte(lines[0]+tampered+lines[2]), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if records, err = builder.ReadAudit(path); !errors.Is(err, builder.ErrAuditTampered) || len(records) != 1 {
+		t.Fatalf("Rewritten record was not detected: %v", err)
+	}
+
+	// As does removing a record
+	if err = os.WriteFile(path, []byte(lines[0]+lines[2]), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = builder.ReadAudit(path); !errors.Is(err, builder.ErrAuditTampered) {
+		t.Fatalf("Removed record was not detected: %v", err)
+	}
+
+	rec := builder.NewAuditRecord(builder.AuditBuild, time.Now(), errors.New("oops"))
+	if rec.Result != "failure" || rec.Error != "oops" {
+		t.Fatalf("Failed operation was not recorded: %+v", rec)
+	}
+}
+
+func TestAuditTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for range 3 {
+		if err := builder.AppendAudit(path, builder.NewAuditRecord(builder.AuditBuild, time.Now(), nil)); err != nil {
+			t.Fatalf("Failed to append audit record: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate solbuild being killed part way through writing a record
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.WriteString(`{"user":"root","uid":0,"oper`); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+
+	if records, err := builder.ReadAudit(path); !errors.Is(err, builder.ErrAuditTorn) || len(records) != 3 {
+		t.Fatalf("Expected the torn record to be reported after 3 records, got %d: %v", len(records), err)
+	}
+
+	if err = builder.AppendAudit(path, builder.NewAuditRecord(builder.AuditBuild, time.Now(), nil)); !errors.Is(err, builder.ErrAuditTorn) {
+		t.Fatalf("Expected appending after a torn record to fail, got %v", err)
+	}
+
+	removed, err := builder.RepairAudit(path)
+	if err != nil || removed == 0 {
+		t.Fatalf("Failed to repair audit log, removed %d: %v", removed, err)
+	}
+
+	if repaired, _ := os.ReadFile(path); string(repaired) != string(data) {
+		t.Fatal("Repair changed the complete records")
+	}
+
+	if err = builder.AppendAudit(path, builder.NewAuditRecord(builder.AuditUpdate, time.Now(), nil)); err != nil {
+		t.Fatalf("Failed to append audit record after repair: %v", err)
+	}
+
+	records, err := builder.ReadAudit(path)
+	if err != nil || len(records) != 4 {
+		t.Fatalf("Expected 4 verified records after repair, got %d: %v", len(records), err)
+	}
+
+	// Complete records are never repaired away
+	if removed, err = builder.RepairAudit(path); err != nil || removed != 0 {
+		t.Fatalf("Expected nothing to repair, removed %d: %v", removed, err)
+	}
+}
+
+func TestAuditLastRecordLongLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	// Records larger than the chunks read from the end are still chained
+	for i := range 10 {
+		rec := builder.NewAuditRecord(builder.AuditDeleteCache, time.Now(), nil)
+		rec.Paths = []string{strings.Repeat("x", 3000*i)}
+
+		if err := builder.AppendAudit(path, rec); err != nil {
+			t.Fatalf("Failed to append audit record: %v", err)
+		}
+	}
+
+	if records, err := builder.ReadAudit(path); err != nil || len(records) != 10 {
+		t.Fatalf("Expected 10 verified records, got %d: %v", len(records), err)
+	}
+}
@@ -0,0 +1,190 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// CurrentGeneration identifies the image itself among its generations.
+const CurrentGeneration = "current"
+
+var (
+	// ErrBisectNoFailure is returned when the package builds with the image,
+	// so there is no failure to bisect.
+	ErrBisectNoFailure = errors.New("The package builds with the current image, there is nothing to bisect")
+
+	// ErrBisectNoSuccess is returned when the package fails to build with
+	// the oldest generation too.
+	ErrBisectNoSuccess = errors.New("The package fails to build with every stored image generation")
+)
+
+// Bisect will find the first of the candidates, ordered oldest first, with
+// which build fails, returning the index of the last candidate the package
+// built with and the first it failed with. The newest candidate must fail,
+// and the oldest succeed, for there to be anything to bisect.
+func Bisect(candidates []string, build func(id string) error) (good, bad int, err error) {
+	if len(candidates) < 2 {
+		return 0, 0, ErrBisectNoSuccess
+	}
+
+	good, bad = 0, len(candidates)-1
+
+	if build(candidates[bad]) == nil {
+		return 0, 0, ErrBisectNoFailure
+	}
+
+	if build(candidates[good]) != nil {
+		return 0, 0, ErrBisectNoSuccess
+	}
+
+	for bad-good > 1 {
+		mid := (good + bad) / 2
+
+		if build(candidates[mid]) == nil {
+			good = mid
+		} else {
+			bad = mid
+		}
+	}
+
+	return good, bad, nil
+}
+
+// BisectBuilder returns a function building the package against the given
+// generation of the image of the profile, in a separate solbuild process as
+// with BuildMatrix. The artifacts of each build are collected beneath
+// outputDir. Global flags, such as to disable colours, are passed through.
+func BisectBuilder(profile, pkgPath, outputDir string, global []string) (func(id string) error, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(id string) error {
+		args := []string{"build", "-p", profile, "--output-dir", filepath.Join(outputDir, id)}
+		args = append(args, global...)
+
+		if id != CurrentGeneration {
+			args = append(args, "--image-generation", id)
+		}
+
+		args = append(args, pkgPath)
+
+		slog.Info("Building with image generation", "generation", id)
+
+		c := exec.Command(exe, args...)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+
+		if err := c.Run(); err != nil {
+			slog.Warn("Build failed with image generation", "generation", id, "err", err)
+			return err
+		}
+
+		slog.Info("Build succeeded with image generation", "generation", id)
+
+		return nil
+	}, nil
+}
+
+// A BisectReport identifies the image update which broke the build of a
+// package, and the packages it changed.
+type BisectReport struct {
+	Image string          `json:"image"`
+	Good  string          `json:"good"` // Last generation the package built with
+	Bad   string          `json:"bad"`  // First generation the package failed with
+	Delta []PackageChange `json:"delta"`
+}
+
+// NewBisectReport will find the packages which differ between the good and
+// bad generations of the image.
+func NewBisectReport(image *BackingImage, good, bad string) (*BisectReport, error) {
+	report := &BisectReport{Image: image.Name, Good: good, Bad: bad}
+
+	before, err := generationPackages(image, good)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := generationPackages(image, bad)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Delta = PackageDelta(before, after)
+
+	return report, nil
+}
+
+// generationPackages finds the packages installed in the given generation
+// of the image.
+func generationPackages(image *BackingImage, id string) (map[string]string, error) {
+	if id != CurrentGeneration {
+		gen, err := image.Generation(id)
+		if err != nil {
+			return nil, err
+		}
+
+		image = gen
+	}
+
+	pkgs, err := image.ImagePackages()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list packages of image generation %s, reason: %w\n", id, err)
+	}
+
+	return pkgs, nil
+}
+
+// Write will write the report as a table of the changed packages.
+func (r *BisectReport) Write(w io.Writer) error {
+	fmt.Fprintf(w, "Last built with generation %s, first failed with %s\n", r.Good, r.Bad)
+
+	if len(r.Delta) == 0 {
+		fmt.Fprintln(w, "No packages changed between the generations")
+		return nil
+	}
+
+	fmt.Fprintf(w, "%d packages changed between the generations:\n\n", len(r.Delta))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tBEFORE\tAFTER")
+
+	for _, change := range r.Delta {
+		before, after := change.Old, change.New
+		if before == "" {
+			before = "-"
+		}
+
+		if after == "" {
+			after = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", change.Name, before, after)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,166 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestBisect(t *testing.T) {
+	candidates := []string{"gen1", "gen2", "gen3", "gen4", "gen5", builder.CurrentGeneration}
+	broken := map[string]bool{"gen4": true, "gen5": true, builder.CurrentGeneration: true}
+	built := 0
+
+	build := func(id string) error {
+		built++
+
+		if broken[id] {
+			return errors.New("build failed")
+		}
+
+		return nil
+	}
+
+	good, bad, err := builder.Bisect(candidates, build)
+	if err != nil {
+		t.Fatalf("Failed to bisect: %v", err)
+	}
+
+	if candidates[good] != "gen3" || candidates[bad] != "gen4" {
+		t.Fatalf("Wrong generations found: %s..%s", candidates[good], candidates[bad])
+	}
+
+	if built >= len(candidates) {
+		t.Fatalf("Bisecting built every generation: %d builds", built)
+	}
+
+	if _, _, err = builder.Bisect(candidates, func(string) error { return nil }); !errors.Is(err, builder.ErrBisectNoFailure) {
+		t.Fatalf("Expected no failure to bisect, got %v", err)
+	}
+
+	failing := func(string) error { return errors.New("build failed") }
+	if _, _, err = builder.Bisect(candidates, failing); !errors.Is(err, builder.ErrBisectNoSuccess) {
+		t.Fatalf("Expected no success to bisect from, got %v", err)
+	}
+}
+
+func TestPackageDelta(t *testing.T) {
+	before := map[string]string{"glibc": "2.40-120", "gcc": "14.2.0-300", "nano": "8.0-1"}
+	after := map[string]string{"glibc": "2.41-121", "gcc": "14.2.0-300", "zstd": "1.5.6-30"}
+
+	delta := builder.PackageDelta(before, after)
+	expected := []builder.PackageChange{
+		{Name: "glibc", Old: "2.40-120", New: "2.41-121"},
+		{Name: "nano", Old: "8.0-1"},
+		{Name: "zstd", New: "1.5.6-30"},
+	}
+
+	if len(delta) != len(expected) {
+		t.Fatalf("Wrong delta: %+v", delta)
+	}
+
+	for i := range expected {
+		if delta[i] != expected[i] {
+			t.Fatalf("Wrong change %d: %+v vs expected %+v", i, delta[i], expected[i])
+		}
+	}
+}
+
+func TestImageGenerations(t *testing.T) {
+	builder.ApplyDirectories(&builder.Config{ImagesDir: t.TempDir()})
+	t.Cleanup(func() { builder.ApplyDirectories(&builder.Config{}) })
+
+	image := builder.NewBackingImage("main-x86_64")
+
+	for _, id := range []string{"20260301T120000", "20260101T120000", "not-a-generation"} {
+		path := filepath.Join(image.GenerationsDir(), id+builder.ImageSuffix)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gens, err := image.Generations()
+	if err != nil {
+		t.Fatalf("Failed to list generations: %v", err)
+	}
+
+	if len(gens) != 2 || gens[0].ID != "20260101T120000" || gens[1].ID != "20260301T120000" {
+		t.Fatalf("Wrong generations listed: %+v", gens)
+	}
+
+	gen, err := image.Generation("20260101T120000")
+	if err != nil {
+		t.Fatalf("Failed to find generation: %v", err)
+	}
+
+	if gen.ImagePath != gens[0].Path || gen.Name != image.Name {
+		t.Fatalf("Wrong image for generation: %+v", gen)
+	}
+
+	for _, id := range []string{"20250101T120000", "../main-x86_64"} {
+		if _, err = image.Generation(id); !errors.Is(err, builder.ErrNoGeneration) {
+			t.Fatalf("Found missing generation %s: %v", id, err)
+		}
+	}
+}
+
+func TestCommitUpdateKeepsGeneration(t *testing.T) {
+	builder.ApplyDirectories(&builder.Config{ImagesDir: t.TempDir()})
+	builder.ImageGenerations = 2
+
+	t.Cleanup(func() {
+		builder.ApplyDirectories(&builder.Config{})
+		builder.ImageGenerations = 0
+	})
+
+	image := builder.NewBackingImage("main-x86_64")
+
+	if err := os.WriteFile(image.ImagePath, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(image.UpdatePath(), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := image.CommitUpdate(); err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+
+	gens, err := image.Generations()
+	if err != nil || len(gens) != 1 {
+		t.Fatalf("Expected a generation to be kept: %+v, %v", gens, err)
+	}
+
+	if data, _ := os.ReadFile(gens[0].Path); string(data) != "old" {
+		t.Fatalf("Generation does not hold the previous image: %q", data)
+	}
+
+	if data, _ := os.ReadFile(image.ImagePath); string(data) != "new" {
+		t.Fatalf("Image was not updated: %q", data)
+	}
+}
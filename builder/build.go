@@ -17,11 +17,13 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/getsolus/libosdev/disk"
 )
@@ -34,7 +36,7 @@ func (p *Package) CreateDirs(o *Overlay) error {
 	}
 
 	for _, p := range dirs {
-		if err := os.MkdirAll(p, 0o0755); err != nil {
+		if _, err := o.secureDir(p, 0o0755); err != nil {
 			return fmt.Errorf("Failed to create required directory %s. Reason: %w", p, err)
 		}
 	}
@@ -43,10 +45,10 @@ func (p *Package) CreateDirs(o *Overlay) error {
 	if p.Type == PackageTypeYpkg {
 		for _, cache := range Caches {
 			inRootCacheDir := filepath.Join(o.MountPoint, cache.CacheDir[1:])
-			hostCacheDir := filepath.Join(CacheDirectory, cache.Name)
+			hostCacheDir := p.GetCacheSource(cache)
 
 			// Cache directories in build root.
-			if err := os.MkdirAll(inRootCacheDir, 0o0755); err != nil {
+			if _, err := o.secureDir(inRootCacheDir, 0o0755); err != nil {
 				return fmt.Errorf("Failed to create cache directory %s in build root, reason: %w", inRootCacheDir, err)
 			}
 
@@ -55,11 +57,6 @@ func (p *Package) CreateDirs(o *Overlay) error {
 			if err := os.MkdirAll(hostCacheDir, 0o0755); err != nil {
 				return fmt.Errorf("Failed to create cache directory %s for %s, reason: %w", cache.CacheDir, cache.Name, err)
 			}
-
-			// Ensure the build user can write to the cache directories.
-			if err := os.Chown(hostCacheDir, BuildUserID, BuildUserGID); err != nil {
-				return fmt.Errorf("Failed to chown cache directory %s in build root, reason: %w", inRootCacheDir, err)
-			}
 		}
 	}
 
@@ -67,62 +64,114 @@ func (p *Package) CreateDirs(o *Overlay) error {
 }
 
 // FetchSources will attempt to fetch the sources from the network
-// if necessary.
-func (p *Package) FetchSources(o *Overlay) error {
+// if necessary. Cancelling ctx will abandon the fetch.
+func (p *Package) FetchSources(ctx context.Context, o *Overlay) error {
+	if !p.HasSources() {
+		slog.Debug("Package has no sources, skipping fetch", "name", p.Name)
+		return nil
+	}
+
+	lock, err := LoadSourceLock(p.SourceLockPath())
+	if err != nil {
+		return fmt.Errorf("Failed to load source lock, reason: %w\n", err)
+	}
+
+	p.applySourceLock(lock)
+
+	// Nothing may be fetched from a branch that is not locked
+	if LockedSources {
+		if err = p.CheckSourceLock(ctx, lock); err != nil {
+			return fmt.Errorf("Failed to check source lock, reason: %w\n", err)
+		}
+	}
+
+	// Report the git remotes contacted, even when a fetch fails
+	clearRemotes()
+
+	defer reportRemotes()
+
+	accepted := false
+
 	for _, source := range p.Sources {
 		// Already fetched, skip it
 		if source.IsFetched() {
+			BuildCacheUsage.recordSource(source, true)
 			continue
 		}
 
-		if err := source.Fetch(); err != nil {
-			return fmt.Errorf("Failed to fetch source %s, reason: %w\n", source.GetIdentifier(), err)
+		BuildCacheUsage.recordSource(source, false)
+
+		if err = source.Fetch(ctx); err != nil {
+			if err = p.handleMismatch(err); err != nil {
+				return fmt.Errorf("Failed to fetch source %s, reason: %w\n", source.GetIdentifier(), err)
+			}
+
+			accepted = true
+		}
+	}
+
+	// The recipe copied into the root still has the hashes just replaced
+	if accepted {
+		if err = CopyAll(p.Path, p.GetWorkDir(o)); err != nil {
+			return fmt.Errorf("Failed to copy updated recipe, reason: %w\n", err)
 		}
 	}
 
+	if err = p.updateSourceLock(lock); err != nil {
+		return fmt.Errorf("Failed to lock sources, reason: %w\n", err)
+	}
+
 	return nil
 }
 
 // BindSources will make the sources available to the chroot by bind mounting
 // them into place.
 func (p *Package) BindSources(o *Overlay) error {
+	if !p.HasSources() {
+		slog.Debug("Package has no sources, skipping bind", "name", p.Name)
+		return nil
+	}
+
 	mountMan := disk.GetMountManager()
 
+	// Ensure sources tree exists
+	sourceDir, err := o.secureDir(p.GetSourceDir(o), 0o0755)
+	if err != nil {
+		return fmt.Errorf("Failed to create source directory, reason: %w\n", err)
+	}
+
 	for _, source := range p.Sources {
-		sourceDir := p.GetSourceDir(o)
 		bindConfig := source.GetBindConfiguration(sourceDir)
-
-		// Ensure sources tree exists
-		if !PathExists(sourceDir) {
-			if err := os.MkdirAll(sourceDir, 0o0755); err != nil {
-				return fmt.Errorf("Failed to create source directory %s, reason: %w\n", sourceDir, err)
-			}
-		}
+		target := bindConfig.BindTarget
 
 		// Find the target path in the chroot
-		slog.Debug("Exposing source to container", "source", bindConfig.BindSource, "target", bindConfig.BindTarget)
+		slog.Debug("Exposing source to container", "source", bindConfig.BindSource, "target", target)
 
 		if st, err := os.Stat(bindConfig.BindSource); err == nil && st != nil {
+			// An earlier phase may have planted symlinks in the root
 			if st.IsDir() {
-				if err := os.MkdirAll(bindConfig.BindTarget, 0o0755); err != nil {
-					slog.Error("Failed to create bind mount", "target", bindConfig.BindTarget, "reason", err)
-					return nil
-				}
+				target, err = SecureMkdirAll(o.MountPoint, target, 0o0755)
 			} else {
-				if err := TouchFile(bindConfig.BindTarget); err != nil {
-					slog.Error("Failed to create bind mount target", "target", bindConfig.BindTarget, "reason", err)
-					return nil
-				}
+				target, err = SecureTouchFile(o.MountPoint, target)
+			}
+
+			if err != nil {
+				return fmt.Errorf("Failed to create bind mount target %s, reason: %w\n", bindConfig.BindTarget, err)
 			}
 		}
 
+		// The build user sees its sources as its own when idmapped, as git requires
+		if p.Type == PackageTypeYpkg && o.bindMapped(bindConfig.BindSource, target, true) {
+			continue
+		}
+
 		// Bind mount local source into chroot
-		if err := mountMan.BindMount(bindConfig.BindSource, bindConfig.BindTarget, "ro"); err != nil {
-			return fmt.Errorf("Failed to bind mount source %s, reason: %w\n", bindConfig.BindTarget, err)
+		if err := mountMan.BindMount(bindConfig.BindSource, target, "ro"); err != nil {
+			return fmt.Errorf("Failed to bind mount source %s, reason: %w\n", target, err)
 		}
 
 		// Account for these to help cleanups
-		o.ExtraMounts = append(o.ExtraMounts, bindConfig.BindTarget)
+		o.ExtraMounts = append(o.ExtraMounts, target)
 	}
 
 	return nil
@@ -136,12 +185,30 @@ func (p *Package) BindCaches(o *Overlay) error {
 
 	mountMan := disk.GetMountManager()
 
+	if p.Overrides.IsolateCaches {
+		slog.Info("Using compiler caches isolated to this package", "package", p.Name)
+	}
+
 	for _, c := range Caches {
-		cacheSource := filepath.Join(CacheDirectory, c.Name)
-		cacheDir := filepath.Join(o.MountPoint, c.CacheDir[1:])
+		cacheSource := p.GetCacheSource(c)
+
+		cacheDir, err := o.secureDir(filepath.Join(o.MountPoint, c.CacheDir[1:]), 0o0755)
+		if err != nil {
+			return err
+		}
 
 		slog.Debug("Exposing cache to build", "cache", c.Name, "source", cacheSource, "target", cacheDir)
 
+		// Root owned caches appear to be owned by the build user when idmapped
+		if o.bindMapped(cacheSource, cacheDir, false) {
+			continue
+		}
+
+		// Ensure the build user can write to the cache directories.
+		if err := os.Chown(cacheSource, BuildUserID, BuildUserGID); err != nil {
+			return fmt.Errorf("Failed to chown cache directory %s, reason: %w", cacheSource, err)
+		}
+
 		// Bind mount local ccache into chroot
 		if err := mountMan.BindMount(cacheSource, cacheDir); err != nil {
 			return fmt.Errorf("Failed to bind mount %s %s, reason: %w\n", c.Name, cacheDir, err)
@@ -230,7 +297,7 @@ func (p *Package) CopyAssets(h *PackageHistory, o *Overlay) error {
 }
 
 // PrepYpkg will do the initial leg work of preparing us for a ypkg build.
-func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager, overlay *Overlay, h *PackageHistory) error {
+func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman PackageManager, overlay *Overlay, h *PackageHistory) error {
 	slog.Debug("Writing packager file")
 
 	fp := filepath.Join(overlay.MountPoint, BuildUserHome, ".config", "solus", "packager")
@@ -249,41 +316,42 @@ func (p *Package) PrepYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager,
 	wdir := p.GetWorkDirInternal()
 	ymlFile := filepath.Join(wdir, filepath.Base(p.Path))
 
-	cmd := fmt.Sprintf("ypkg-install-deps --eopkg-cmd='%s' -f %s", installCommand, ymlFile)
-	if DisableColors {
-		cmd += " -n"
+	cmd, err := pman.InstallDepsCommand(ymlFile)
+	if err != nil {
+		return err
+	}
+
+	if err := pman.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %w\n", err)
 	}
 
 	// Install build dependencies
 	slog.Debug("Installing build dependencies", "file", ymlFile)
 
-	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
-		return fmt.Errorf("Failed to install build dependencies %s, reason: %w\n", ymlFile, err)
-	}
+	depsErr := ChrootExecProgress(notif, overlay.MountPoint, "deps install", cmd)
 
 	notif.SetActivePID(0)
 
-	// Cleanup now
-	slog.Debug("Stopping D-BUS")
-
+	// Cleanup now, unless dbus is being kept for the whole build
 	if err := pman.StopDBUS(); err != nil {
 		return fmt.Errorf("Failed to stop d-bus, reason: %w\n", err)
 	}
 
-	// Chwn the directory before bringing up sources
-	cmd = fmt.Sprintf("chown -R %s:%s %s", BuildUser, BuildUser, BuildUserHome)
-	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
-		return fmt.Errorf("Failed to set home directory permissions, reason: %w\n", err)
+	if depsErr != nil {
+		return fmt.Errorf("Failed to install build dependencies %s, reason: %w\n", ymlFile, depsErr)
 	}
 
-	notif.SetActivePID(0)
+	// Chown the directory before bringing up sources
+	if err := overlay.chownHome(); err != nil {
+		return fmt.Errorf("Failed to set home directory permissions, reason: %w\n", err)
+	}
 
 	return nil
 }
 
 // BuildYpkg will take care of the ypkg specific build process and is called only
 // by Build().
-func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager, overlay *Overlay, h *PackageHistory) error {
+func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman PackageManager, overlay *Overlay, h *PackageHistory, secrets []*Secret) error {
 	if err := p.PrepYpkg(notif, usr, pman, overlay, h); err != nil {
 		return err
 	}
@@ -298,8 +366,10 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 		if err := overlay.ConfigureNetworking(); err != nil {
 			return err
 		}
-	} else {
-		slog.Warn("Package has explicitly requested networking, sandboxing disabled")
+	} else if reason := p.Overrides.NetworkingReason; reason != "" {
+		slog.Info("Package has explicitly requested networking, sandboxing disabled", "reason", reason)
+	} else if err := strictWarn("Package has explicitly requested networking without a reason, sandboxing disabled"); err != nil {
+		return err
 	}
 
 	// Bring up sources
@@ -317,6 +387,14 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 		return err
 	}
 
+	if err := p.BindState(overlay); err != nil {
+		return err
+	}
+
+	if err := p.BindToolchain(overlay); err != nil {
+		return err
+	}
+
 	// Now recopy the assets prior to build
 	if err := pman.CopyAssets(); err != nil {
 		return err
@@ -341,19 +419,44 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 		StartSccache(overlay.MountPoint)
 	}
 
+	// Secrets are only available for the duration of the build itself
+	if err := p.MountSecrets(overlay, secrets); err != nil {
+		return err
+	}
+
+	// The environment of the package only applies to the build itself
+	base := ChrootEnvironment
+	ChrootEnvironment = append(slices.Clone(base), p.Environment...)
+
+	p.recordSandbox(overlay, p.CanNetwork)
+
 	slog.Info("Now starting build", "package", p.Name)
 
-	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
-		return fmt.Errorf("Failed to start build of package, reason: %w\n", err)
+	buildErr := ChrootExec(notif, overlay.MountPoint, "ypkg-build", cmd)
+
+	ChrootEnvironment = base
+
+	p.UnmountSecrets(overlay, secrets)
+
+	if buildErr != nil {
+		return fmt.Errorf("Failed to start build of package, reason: %w\n", buildErr)
 	}
 
+	installDir := filepath.Join(overlay.MountPoint, BuildUserHome[1:], "YPKG", "root", p.Name, "install")
+	if err := CheckSecretLeaks(installDir, secrets); err != nil {
+		return err
+	}
+
+	p.ReportLicenses(overlay)
+
 	// Generate ABI Report
 	if !DisableABIReport {
 		slog.Debug("Attempting to generate ABI report")
 
 		if err := p.GenerateABIReport(notif, overlay); err != nil {
-			slog.Warn("Failed to generate ABI report", "reason", err)
-			return nil
+			if err = strictWarn("Failed to generate ABI report", "reason", err); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -365,7 +468,7 @@ func (p *Package) BuildYpkg(notif PidNotifier, usr *UserInfo, pman *EopkgManager
 // BuildXML will take care of building the legacy pspec.xml format, and is called only
 // by Build().
 // NOTE: Change eopkgCommand to use eopkg.py3 for epoch.
-func (p *Package) BuildXML(notif PidNotifier, pman *EopkgManager, overlay *Overlay) error {
+func (p *Package) BuildXML(notif PidNotifier, pman PackageManager, overlay *Overlay) error {
 	// Just straight up build it with eopkg
 	slog.Warn("Full sandboxing is not possible with legacy format")
 
@@ -377,6 +480,10 @@ func (p *Package) BuildXML(notif PidNotifier, pman *EopkgManager, overlay *Overl
 		return fmt.Errorf("Cannot continue without sources.\n")
 	}
 
+	if err := p.BindToolchain(overlay); err != nil {
+		return err
+	}
+
 	// Now recopy the assets prior to build
 	if err := pman.CopyAssets(); err != nil {
 		return err
@@ -388,46 +495,50 @@ func (p *Package) BuildXML(notif PidNotifier, pman *EopkgManager, overlay *Overl
 	cmd := eopkgCommand(fmt.Sprintf("%s build --ignore-sandbox --yes-all -O %s %s",
 		xmlBuildCommand, wdir, xmlFile))
 
+	// eopkg installs the build dependencies itself
+	if err := pman.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %w\n", err)
+	}
+
+	p.recordSandbox(overlay, true)
+
 	slog.Info("Now starting build", "package", p.Name)
 
-	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
-		return fmt.Errorf("Failed to start build of package.\n")
-	}
+	buildErr := ChrootExec(notif, overlay.MountPoint, "eopkg build", cmd)
 
 	notif.SetActivePID(0)
 
-	// Now we can stop dbus...
-	slog.Debug("Stopping D-BUS")
-
+	// Now we can stop dbus, unless it is being kept for the whole build
 	if err := pman.StopDBUS(); err != nil {
 		return fmt.Errorf("Failed to stop d-bus, reason: %w\n", err)
 	}
 
-	notif.SetActivePID(0)
-
-	return nil
-}
-
-// GenerateABIReport will take care of generating the abireport using abi-wizard.
-func (p *Package) GenerateABIReport(notif PidNotifier, overlay *Overlay) error {
-	wdir := p.GetWorkDirInternal()
-
-	cmd := fmt.Sprintf("cd %s; abi-wizard %s/YPKG/root/%s/install", wdir, BuildUserHome, p.Name)
-	if err := ChrootExec(notif, overlay.MountPoint, cmd); err != nil {
-		slog.Warn("Failed to generate abi report", "reason", err)
-		return nil
+	if buildErr != nil {
+		return fmt.Errorf("Failed to start build of package.\n")
 	}
 
-	notif.SetActivePID(0)
-
 	return nil
 }
 
 // CollectAssets will search for the build files and copy them back to the
-// users current directory. If solbuild was invoked via sudo, solbuild will
-// then attempt to set the owner as the original user.
-func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget string) error {
+// OutputDir, by default the users current directory, as laid out by
+// CollectLayout. If solbuild was invoked via sudo, solbuild will then attempt
+// to set the owner as the original user.
+func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, profile *Profile, manifestTarget string, secrets []*Secret) error {
 	collectionDir := p.GetWorkDir(overlay)
+	outputDir := CollectLayout.ArtifactDir(OutputDir, profile.Name)
+
+	// Name the artifacts as they are collected, before anything refers to them
+	var built []string
+
+	for _, pattern := range []string{"*.eopkg", "abi_*", "pspec_*.xml"} {
+		matches, _ := filepath.Glob(filepath.Join(collectionDir, pattern))
+		built = append(built, matches...)
+	}
+
+	if _, err := nameArtifacts(collectionDir, profile.Name, built); err != nil {
+		return err
+	}
 
 	collections, _ := filepath.Glob(filepath.Join(collectionDir, "*.eopkg"))
 	if len(collections) < 1 {
@@ -435,19 +546,47 @@ func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget
 		return errors.New("internal error: .eopkg files are missing")
 	}
 
+	// Sign the packages first, so the manifest can list the signatures
+	var signatures []string
+
+	if ArtifactSigner != nil && !QuickBuild {
+		for _, p := range collections {
+			sig, err := SignArtifact(ArtifactSigner, p)
+			if err != nil {
+				return err
+			}
+
+			signatures = append(signatures, sig)
+		}
+
+		slog.Info("Signed packages", "count", len(signatures))
+	}
+
+	// Collect files from abireport
+	abireportfiles, _ := filepath.Glob(filepath.Join(collectionDir, "abi_*"))
+
 	// Prior to blitting the files out, let's grab the manifest if requested
-	if manifestTarget != "" {
+	if manifestTarget != "" && !QuickBuild {
 		tram := NewTransitManifest(manifestTarget)
+		tram.Manifest.Profile = profile.Name
+
 		for _, p := range collections {
 			if err := tram.AddFile(p); err != nil {
 				return fmt.Errorf("Failed to collect eopkg asset for transit manifest %s, reason: %w\n", p, err)
 			}
 		}
 
-		// $source-$version-$release.tram
-		// We omit arch for *now*, Solus isn't multiple architecture yet.
-		tramFile := fmt.Sprintf("%s-%s-%d%s", p.Name, p.Version, p.Release, TransitManifestSuffix)
-		tramPath := filepath.Join(collectionDir, tramFile)
+		if err := tram.AddABIReport(abireportfiles); err != nil {
+			return fmt.Errorf("Failed to checksum ABI report for transit manifest, reason: %w\n", err)
+		}
+
+		// $source-$version-$release.tram unless manifest_name is set
+		tramFile, err := tram.Filename(ManifestName, p)
+		if err != nil {
+			return err
+		}
+
+		tramPath := filepath.Join(collectionDir, CollectLayout.ArtifactName(tramFile, profile.Name))
 
 		// Try to write manifest
 		if err := tram.Write(tramPath); err != nil {
@@ -458,19 +597,58 @@ func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget
 		collections = append(collections, tramPath)
 	}
 
-	// Collect files from abireport
-	abireportfiles, _ := filepath.Glob(filepath.Join(collectionDir, "abi_*"))
+	collections = append(collections, signatures...)
 	collections = append(collections, abireportfiles...)
 
 	if p.Type == PackageTypeYpkg {
 		pspecs, _ := filepath.Glob(filepath.Join(collectionDir, "pspec_*.xml"))
+		if len(pspecs) < 1 && !QuickBuild {
+			if err := strictWarn("Expected pspec file was not produced by the build", "package", p.Name); err != nil {
+				return err
+			}
+		}
+
 		collections = append(collections, pspecs...)
 	}
 
+	if QuickBuild {
+		marker, err := p.writeQuickMarker(collectionDir)
+		if err != nil {
+			return err
+		}
+
+		named, err := nameArtifacts(collectionDir, profile.Name, []string{marker})
+		if err != nil {
+			return err
+		}
+
+		collections = append(collections, named...)
+	}
+
 	slog.Debug("Collecting files", "len", len(collections))
 
+	for _, dir := range []string{OutputDir, outputDir} {
+		if PathExists(dir) {
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0o0755); err != nil {
+			return fmt.Errorf("Unable to create output directory, reason: %w\n", err)
+		}
+
+		if err := os.Chown(dir, usr.UID, usr.GID); err != nil {
+			slog.Error("Error in restoring file ownership", "path", dir, "reason", err)
+		}
+	}
+
 	for _, p := range collections {
-		tgt, err := filepath.Abs(filepath.Join(".", filepath.Base(p)))
+		if ext := filepath.Ext(p); ext != ".eopkg" && ext != ArtifactSignatureSuffix {
+			if err := RedactSecrets(p, secrets); err != nil {
+				return fmt.Errorf("Unable to scrub build file, reason: %w\n", err)
+			}
+		}
+
+		tgt, err := filepath.Abs(filepath.Join(outputDir, filepath.Base(p)))
 		if err != nil {
 			return fmt.Errorf("Unable to find working directory, reason: %w\n", err)
 		}
@@ -486,13 +664,16 @@ func (p *Package) CollectAssets(overlay *Overlay, usr *UserInfo, manifestTarget
 		if err = os.Chown(tgt, usr.UID, usr.GID); err != nil {
 			slog.Error("Error in restoring file ownership", "path", filepath.Base(p), "reason", err)
 		}
+
+		CollectedArtifacts = append(CollectedArtifacts, tgt)
 	}
 
 	return nil
 }
 
 // Build will attempt to build the package in the overlayfs system.
-func (p *Package) Build(notif PidNotifier, history *PackageHistory, profile *Profile, pman *EopkgManager, overlay *Overlay, manifestTarget string) error {
+// Cancelling ctx will abandon any fetch in progress.
+func (p *Package) Build(ctx context.Context, notif PidNotifier, history *PackageHistory, profile *Profile, pman PackageManager, overlay *Overlay, manifestTarget string, secrets []*Secret) error {
 	slog.Debug("Building package", "name", p.Name, "version", p.Version, "release", p.Release, "type", p.Type,
 		"profile", overlay.Back.Name)
 
@@ -512,19 +693,57 @@ func (p *Package) Build(notif PidNotifier, history *PackageHistory, profile *Pro
 		return err
 	}
 
+	// Take a root with the base already upgraded from the pool if possible
+	if overlay.Pool != nil && !overlay.EnableTmpfs && overlay.DiskQuota == "" {
+		claimed, err := overlay.Pool.Claim(overlay)
+		if err != nil {
+			return err
+		}
+
+		if claimed {
+			slog.Info("Using a pre-provisioned root from the pool")
+		}
+
+		overlay.FromPool = claimed
+	}
+
 	// Bring up the root
 	if err := p.ActivateRoot(overlay); err != nil {
 		return err
 	}
 
+	// A fresh home must be in place before anything is copied into it
+	if IsolateHome && p.Type == PackageTypeYpkg {
+		if err := overlay.MountHome(); err != nil {
+			return err
+		}
+	}
+
+	if CheckImage {
+		if err := CheckImageSanity(overlay.MountPoint, p.Type); err != nil {
+			return err
+		}
+	}
+
 	// Ensure source assets are in place
 	if err := p.CopyAssets(history, overlay); err != nil {
 		return fmt.Errorf("Failed to copy required source assets, reason: %w\n", err)
 	}
 
+	if QuickBuild && p.Type == PackageTypeYpkg {
+		if err := StripCheck(filepath.Join(p.GetWorkDir(overlay), filepath.Base(p.Path))); err != nil {
+			return err
+		}
+	}
+
 	slog.Debug("Validating sources")
 
-	if err := p.FetchSources(overlay); err != nil {
+	if err := p.FetchSources(ctx, overlay); err != nil {
+		return err
+	}
+
+	// Catch broken patches before the root is prepared for the build
+	if err := p.ValidatePatches(); err != nil {
 		return err
 	}
 
@@ -533,22 +752,35 @@ func (p *Package) Build(notif PidNotifier, history *PackageHistory, profile *Pro
 		return err
 	}
 
-	// Bring up dbus to do Things
+	// Bring up dbus to do Things, sharing the one instance between each
+	// phase needing it
 	slog.Debug("Starting D-BUS")
 
 	if err := pman.StartDBUS(); err != nil {
 		return fmt.Errorf("Failed to start d-bus, reason: %w\n", err)
 	}
 
+	dbusHeld := true
+
+	defer func() {
+		if dbusHeld {
+			pman.StopDBUS()
+		}
+	}()
+
 	// Get the repos in place before asserting anything
 	if err := p.ConfigureRepos(notif, overlay, pman, profile); err != nil {
 		return fmt.Errorf("Configuring repositories failed, reason: %w\n", err)
 	}
 
-	slog.Debug("Upgrading system base")
+	if QuickBuild {
+		slog.Warn("Not upgrading the system base for a quick build")
+	} else {
+		slog.Debug("Upgrading system base")
 
-	if err := pman.Upgrade(); err != nil {
-		return fmt.Errorf("Failed to upgrade rootfs, reason: %w\n", err)
+		if err := pman.Upgrade(); err != nil {
+			return fmt.Errorf("Failed to upgrade rootfs, reason: %w\n", err)
+		}
 	}
 
 	slog.Debug("Asserting system.devel component installation")
@@ -557,21 +789,52 @@ func (p *Package) Build(notif PidNotifier, history *PackageHistory, profile *Pro
 		return fmt.Errorf("Failed to assert system.devel, reason: %w\n", err)
 	}
 
+	// The repo indexes are fresh once the root has been upgraded
+	if CheckReleases {
+		if err := p.CheckRelease(overlay.MountPoint, profile); err != nil {
+			return err
+		}
+	}
+
+	if err := p.EnsureLocale(notif, overlay); err != nil {
+		return err
+	}
+
 	// Ensure all directories are in place
 	if err := p.CreateDirs(overlay); err != nil {
 		return err
 	}
 
+	// Without keeping dbus, the build phases bring it up as they need it
+	if !KeepDBUS {
+		dbusHeld = false
+
+		if err := pman.StopDBUS(); err != nil {
+			return fmt.Errorf("Failed to stop d-bus, reason: %w\n", err)
+		}
+	}
+
+	// Persistent state is kept per profile, for package.yml builds opting in
+	if p.Type == PackageTypeYpkg && p.Overrides.PersistentState {
+		overlay.StateSource = p.GetStateSource(profile.Name)
+	}
+
 	// Call the relevant build function
 	if p.Type == PackageTypeYpkg {
-		if err := p.BuildYpkg(notif, usr, pman, overlay, history); err != nil {
+		if err := p.BuildYpkg(notif, usr, pman, overlay, history, secrets); err != nil {
 			return err
 		}
 	} else {
+		if len(secrets) > 0 {
+			slog.Warn("Secrets are not supported with legacy format, ignoring")
+
+			secrets = nil
+		}
+
 		if err := p.BuildXML(notif, pman, overlay); err != nil {
 			return err
 		}
 	}
 
-	return p.CollectAssets(overlay, usr, manifestTarget)
+	return p.CollectAssets(overlay, usr, profile, manifestTarget, secrets)
 }
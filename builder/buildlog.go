@@ -0,0 +1,208 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BuildLogDir is where the output of each build is kept.
+var BuildLogDir = "/var/log/solbuild"
+
+const (
+	// BuildLogSuffix is the suffix of all build logs.
+	BuildLogSuffix = ".log"
+
+	// buildLogTimeFormat is used for the timestamp in log names, so that they
+	// sort chronologically.
+	buildLogTimeFormat = "20060102T150405"
+)
+
+// BuildOutput is where the output of commands run within the chroot is sent.
+// During a build this also writes to the build log.
+var BuildOutput io.Writer = os.Stdout
+
+// buildLogOutput writes to the build log alone, and is io.Discard when no
+// build log is open.
+var buildLogOutput io.Writer = io.Discard
+
+// buildTermOutput writes to stdout alone, with secrets redacted during a
+// build.
+var buildTermOutput io.Writer = os.Stdout
+
+// A BuildLog is the recorded output of a single past build.
+type BuildLog struct {
+	Package string    `json:"package"`
+	Path    string    `json:"path"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+}
+
+// OpenBuildLog will create a new log for a build of the package, and direct
+// all build output to it, in addition to stdout. The path of the log is
+// returned, along with a function that must be called once the build has
+// finished.
+func OpenBuildLog(pkg *Package, secrets []*Secret) (string, func(), error) {
+	dir := filepath.Join(BuildLogDir, pkg.Name)
+	if err := os.MkdirAll(dir, 0o0755); err != nil {
+		return "", nil, fmt.Errorf("Failed to create build log directory %s, reason: %w\n", dir, err)
+	}
+
+	name := fmt.Sprintf("%s-%s-%d-%s%s", pkg.Name, pkg.Version, pkg.Release,
+		time.Now().UTC().Format(buildLogTimeFormat), BuildLogSuffix)
+	path := filepath.Join(dir, name)
+
+	// The log may hold anything the build printed, so it is not for others to read
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o0600)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to create build log %s, reason: %w\n", path, err)
+	}
+
+	slog.Debug("Writing build log", "path", path)
+
+	// Secrets are scrubbed as the build runs, so they never reach the log
+	// or the terminal
+	termOutput := newRedactingWriter(os.Stdout, secrets)
+	logOutput := newRedactingWriter(f, secrets)
+
+	BuildOutput = io.MultiWriter(termOutput, logOutput)
+	buildLogOutput = logOutput
+	buildTermOutput = termOutput
+
+	return path, func() {
+		BuildOutput = os.Stdout
+		buildLogOutput = io.Discard
+		buildTermOutput = os.Stdout
+
+		termOutput.Flush()
+		logOutput.Flush()
+
+		f.Close()
+	}, nil
+}
+
+// ListBuildLogs returns the logs of past builds, newest first. If name is
+// not empty, only the logs of that package are returned.
+func ListBuildLogs(name string) ([]BuildLog, error) {
+	pattern := filepath.Join(BuildLogDir, "*", "*"+BuildLogSuffix)
+	if name != "" {
+		pattern = filepath.Join(BuildLogDir, name, "*"+BuildLogSuffix)
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]BuildLog, 0, len(paths))
+
+	for _, path := range paths {
+		st, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		logs = append(logs, BuildLog{
+			Package: filepath.Base(filepath.Dir(path)),
+			Path:    path,
+			Time:    buildLogTime(path, st),
+			Size:    st.Size(),
+		})
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.After(logs[j].Time)
+	})
+
+	return logs, nil
+}
+
+// buildLogTime returns when the build started, from the log name, falling
+// back to the modification time.
+func buildLogTime(path string, st os.FileInfo) time.Time {
+	base := strings.TrimSuffix(filepath.Base(path), BuildLogSuffix)
+
+	if i := strings.LastIndex(base, "-"); i >= 0 {
+		if t, err := time.Parse(buildLogTimeFormat, base[i+1:]); err == nil {
+			return t
+		}
+	}
+
+	return st.ModTime()
+}
+
+// EnforceLogRetention will remove build logs older than the configured
+// maximum age, and then the oldest logs until their total size is within the
+// configured maximum size.
+func EnforceLogRetention(config *Config) error {
+	if config.LogMaxAge == 0 && config.LogMaxSize == "" {
+		return nil
+	}
+
+	var maxSize int64
+
+	if config.LogMaxSize != "" {
+		size, err := ParseByteSize(config.LogMaxSize)
+		if err != nil {
+			return fmt.Errorf("Invalid log_max_size, reason: %w", err)
+		}
+
+		maxSize = size
+	}
+
+	logs, err := ListBuildLogs("")
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -config.LogMaxAge)
+
+	var total int64
+
+	// Newest first, so everything past the limits is removed
+	for _, entry := range logs {
+		expired := config.LogMaxAge > 0 && entry.Time.Before(cutoff)
+		oversize := maxSize > 0 && total+entry.Size > maxSize
+
+		if !expired && !oversize {
+			total += entry.Size
+			continue
+		}
+
+		slog.Debug("Removing old build log", "path", entry.Path)
+
+		if err = os.Remove(entry.Path); err != nil {
+			slog.Warn("Failed to remove build log", "path", entry.Path, "err", err)
+		}
+
+		base := strings.TrimSuffix(entry.Path, BuildLogSuffix)
+		os.Remove(base + TimingsSuffix)
+		os.Remove(base + SandboxSuffix)
+		os.Remove(base + TestResultsSuffix)
+		os.RemoveAll(base + TestLogsSuffix)
+		os.Remove(base + HomeArchiveSuffix)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// writeBuildLog creates a fake build log of the given size and age.
+func writeBuildLog(t *testing.T, name string, size int, age time.Duration) string {
+	t.Helper()
+
+	stamp := time.Now().Add(-age).UTC().Format("20060102T150405")
+	path := filepath.Join(builder.BuildLogDir, name, name+"-1.0-1-"+stamp+builder.BuildLogSuffix)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestListBuildLogs(t *testing.T) {
+	builder.BuildLogDir = t.TempDir()
+
+	older := writeBuildLog(t, "nano", 10, 2*time.Hour)
+	newer := writeBuildLog(t, "nano", 10, time.Hour)
+	writeBuildLog(t, "vim", 10, 0)
+
+	logs, err := builder.ListBuildLogs("nano")
+	if err != nil {
+		t.Fatalf("Failed to list build logs: %v", err)
+	}
+
+	if len(logs) != 2 || logs[0].Path != newer || logs[1].Path != older {
+		t.Fatalf("Expected the nano logs newest first, got %v", logs)
+	}
+
+	if logs, _ = builder.ListBuildLogs(""); len(logs) != 3 {
+		t.Fatalf("Expected 3 build logs in total, got %d", len(logs))
+	}
+}
+
+func TestEnforceLogRetention(t *testing.T) {
+	builder.BuildLogDir = t.TempDir()
+
+	expired := writeBuildLog(t, "nano", 10, 48*time.Hour)
+	oldest := writeBuildLog(t, "nano", 10, 3*time.Hour)
+	kept := writeBuildLog(t, "vim", 10, time.Hour)
+	newest := writeBuildLog(t, "nano", 10, 0)
+
+	config := &builder.Config{LogMaxAge: 1, LogMaxSize: "25"}
+	if err := builder.EnforceLogRetention(config); err != nil {
+		t.Fatalf("Failed to enforce log retention: %v", err)
+	}
+
+	for _, path := range []string{expired, oldest} {
+		if builder.PathExists(path) {
+			t.Fatalf("Build log %s should have been removed", path)
+		}
+	}
+
+	for _, path := range []string{kept, newest} {
+		if !builder.PathExists(path) {
+			t.Fatalf("Build log %s should have been kept", path)
+		}
+	}
+}
+
+func TestParseTestResults(t *testing.T) {
+	results, err := builder.ReadTestResults("testdata/tests/build.log")
+	if err != nil {
+		t.Fatalf("Failed to read test results: %v", err)
+	}
+
+	expected := []builder.TestResult{
+		{Harness: "automake", Passed: 10, Failed: 1, Skipped: 1},
+		{Harness: "ctest", Passed: 42, Failed: 0, Skipped: 0},
+		{Harness: "meson", Passed: 3, Failed: 0, Skipped: 2},
+		{Harness: "pytest", Passed: 58, Failed: 1, Skipped: 3},
+	}
+
+	if !slices.Equal(results, expected) {
+		t.Fatalf("Unexpected test results: %v", results)
+	}
+}
+
+func TestKeepTestLogs(t *testing.T) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "build", "tests")
+
+	if err := os.MkdirAll(logDir, 0o0755); err != nil {
+		t.Fatalf("Failed to create build tree: %v", err)
+	}
+
+	for _, name := range []string{"test-suite.log", "unrelated.log"} {
+		if err := os.WriteFile(filepath.Join(logDir, name), []byte(name), 0o0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dir := filepath.Join(t.TempDir(), "example"+builder.TestLogsSuffix)
+
+	kept, err := builder.KeepTestLogs(root, dir)
+	if err != nil || kept != 1 {
+		t.Fatalf("Expected one test log kept, got %d (%v)", kept, err)
+	}
+
+	if !builder.PathExists(filepath.Join(dir, "build", "tests", "test-suite.log")) {
+		t.Fatal("Test log was not kept at its relative path")
+	}
+}
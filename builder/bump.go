@@ -0,0 +1,182 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrNoRelease is returned when a recipe has no release line to bump.
+	ErrNoRelease = errors.New("Unable to find the release field in package.yml")
+
+	// ErrNoSource is returned when a recipe has no source entry to replace.
+	ErrNoSource = errors.New("Unable to find a source entry in package.yml")
+
+	releaseRegex = regexp.MustCompile(`(?m)^(release\s*:\s*)(\d+)`)
+	versionRegex = regexp.MustCompile(`(?m)^(version\s*:\s*)(\S+)`)
+	sourceRegex  = regexp.MustCompile(`(?m)^(source\s*:\s*\n\s*-\s*)(\S+)(\s*:\s*)(\S+)`)
+)
+
+// A Bump describes a change to apply to a package.yml recipe.
+type Bump struct {
+	Source  string // New source URL, if the version is being updated
+	Version string // New version, guessed from Source if empty
+}
+
+// BumpResult is the outcome of a successful bump.
+type BumpResult struct {
+	Package *Package // The package as it is after the bump
+	Message string   // A commit message for the change
+}
+
+// BumpRecipe will increment the release of the package.yml at path, and
+// optionally update the version and primary source. The file is edited in
+// place so that formatting and comments are preserved.
+func BumpRecipe(recipe string, bump *Bump) (*BumpResult, error) {
+	by, err := os.ReadFile(recipe)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := NewYmlPackageFromBytes(by)
+	if err != nil {
+		return nil, err
+	}
+
+	if !releaseRegex.Match(by) {
+		return nil, ErrNoRelease
+	}
+
+	by = releaseRegex.ReplaceAll(by, []byte(fmt.Sprintf("${1}%d", old.Release+1)))
+
+	if bump.Source != "" {
+		if by, err = bumpSource(by, bump); err != nil {
+			return nil, err
+		}
+	}
+
+	pkg, err := NewYmlPackageFromBytes(by)
+	if err != nil {
+		return nil, fmt.Errorf("Bumped recipe is no longer valid, reason: %w", err)
+	}
+
+	pkg.Path = recipe
+
+	if err := os.WriteFile(recipe, by, 0o0644); err != nil {
+		return nil, err
+	}
+
+	msg := fmt.Sprintf("%s: Bump release", pkg.Name)
+	if pkg.Version != old.Version {
+		msg = fmt.Sprintf("%s: Update to v%s", pkg.Name, pkg.Version)
+	}
+
+	return &BumpResult{Package: pkg, Message: msg}, nil
+}
+
+// bumpSource replaces the first source entry and the version.
+func bumpSource(by []byte, bump *Bump) ([]byte, error) {
+	uri, err := url.Parse(bump.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sourceRegex.Match(by) {
+		return nil, ErrNoSource
+	}
+
+	version := bump.Version
+	if version == "" {
+		if _, version = GuessNameVersion(uri); version == "" {
+			return nil, fmt.Errorf("Unable to guess version from %s, please specify it", bump.Source)
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "solbuild-bump-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, path.Base(uri.Path))
+
+	slog.Info("Downloading source", "uri", bump.Source)
+
+	if err := downloadFile(bump.Source, archive); err != nil {
+		return nil, fmt.Errorf("Failed to download source %s, reason: %w", bump.Source, err)
+	}
+
+	hash, err := FileSha256sum(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	by = sourceRegex.ReplaceAll(by, []byte("${1}"+escapeTemplate(bump.Source)+"${3}"+hash))
+	by = versionRegex.ReplaceAll(by, []byte("${1}"+escapeTemplate(version)))
+
+	return by, nil
+}
+
+// ReplaceSourceHash will replace the hash of a source in the package.yml at
+// path, editing it in place so that formatting and comments are preserved.
+func ReplaceSourceHash(recipe, old, hash string) error {
+	by, err := os.ReadFile(recipe)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Contains(by, []byte(old)) {
+		return fmt.Errorf("%w: no source with hash %s", ErrNoSource, old)
+	}
+
+	by = bytes.Replace(by, []byte(old), []byte(hash), 1)
+
+	if _, err := NewYmlPackageFromBytes(by); err != nil {
+		return fmt.Errorf("Edited recipe is no longer valid, reason: %w", err)
+	}
+
+	return os.WriteFile(recipe, by, 0o0644)
+}
+
+// escapeTemplate protects s from regexp template expansion.
+func escapeTemplate(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// CommitRecipe will create a git commit for the recipe with the given message.
+func CommitRecipe(recipe, message string) error {
+	dir := filepath.Dir(recipe)
+	base := filepath.Base(recipe)
+
+	if _, err := execGit("-C", dir, "add", "--", base); err != nil {
+		return err
+	}
+
+	_, err := execGit("-C", dir, "commit", "-m", message, "--", base)
+
+	return err
+}
@@ -0,0 +1,99 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+const (
+	PackageTestFile = "testdata/package.yml"
+)
+
+func TestBumpRecipe(t *testing.T) {
+	orig, err := os.ReadFile(PackageTestFile)
+	if err != nil {
+		t.Fatalf("Failed to read test package: %v", err)
+	}
+
+	recipe := filepath.Join(t.TempDir(), "package.yml")
+	if err = os.WriteFile(recipe, orig, 0o0644); err != nil {
+		t.Fatalf("Failed to write test package: %v", err)
+	}
+
+	res, err := builder.BumpRecipe(recipe, &builder.Bump{})
+	if err != nil {
+		t.Fatalf("Failed to bump known good package: %v", err)
+	}
+
+	if res.Package.Release != 164 {
+		t.Fatalf("Wrong release after bump: %d vs expected 164", res.Package.Release)
+	}
+
+	if res.Message != "nano: Bump release" {
+		t.Fatalf("Wrong commit message: %s", res.Message)
+	}
+
+	bumped, err := os.ReadFile(recipe)
+	if err != nil {
+		t.Fatalf("Failed to read bumped package: %v", err)
+	}
+
+	// Only the release line should have been touched
+	want := strings.Replace(string(orig), "release    : 163", "release    : 164", 1)
+	if string(bumped) != want {
+		t.Fatalf("Unexpected changes to recipe:\n%s", bumped)
+	}
+}
+
+func TestReplaceSourceHash(t *testing.T) {
+	orig, err := os.ReadFile(PackageTestFile)
+	if err != nil {
+		t.Fatalf("Failed to read test package: %v", err)
+	}
+
+	recipe := filepath.Join(t.TempDir(), "package.yml")
+	if err = os.WriteFile(recipe, orig, 0o0644); err != nil {
+		t.Fatalf("Failed to write test package: %v", err)
+	}
+
+	old := "86f3442768bd2873cec693f83cdf80b4b444ad3cc14760b74361474fc87a4526"
+	hash := strings.Repeat("ab", 32)
+
+	if err = builder.ReplaceSourceHash(recipe, old, hash); err != nil {
+		t.Fatalf("Failed to replace source hash: %v", err)
+	}
+
+	pkg, err := builder.NewPackage(recipe)
+	if err != nil {
+		t.Fatalf("Failed to load edited package: %v", err)
+	}
+
+	if id := pkg.Sources[0].GetBindConfiguration("").BindSource; !strings.Contains(id, hash) {
+		t.Fatalf("Source hash was not replaced: %s", id)
+	}
+
+	if err = builder.ReplaceSourceHash(recipe, old, hash); !errors.Is(err, builder.ErrNoSource) {
+		t.Fatalf("Expected a missing hash to fail, got %v", err)
+	}
+}
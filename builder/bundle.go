@@ -0,0 +1,436 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/getsolus/solbuild/builder/source"
+	"github.com/getsolus/solbuild/util"
+)
+
+// BundleRoot is the directory holding all of the state that may be bundled,
+// which paths within a bundle are relative to. It follows LibDirectory.
+var BundleRoot = LibDirectory
+
+const (
+	// BundleManifestName is the name of the manifest within a bundle.
+	BundleManifestName = "solbuild-state.json"
+
+	// bundleVersion is the version of the bundle format.
+	bundleVersion = 1
+)
+
+// ErrBundleCorrupt is returned when a bundle fails verification.
+var ErrBundleCorrupt = errors.New("State bundle failed verification")
+
+// BundleParts maps the parts of the state that may be bundled to their
+// directories.
+var BundleParts = bundleParts()
+
+// bundleParts maps the parts of the state to their current directories.
+func bundleParts() map[string]string {
+	return map[string]string{
+		"caches":   CacheDirectory,
+		"images":   ImagesDir,
+		"packages": PackageCacheDirectory,
+		"sources":  source.SourceDir,
+	}
+}
+
+// A BundleFile is a file within a bundle, with its path relative to the root.
+type BundleFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// A BundleManifest describes the contents of a bundle, so that it can be
+// verified before it is imported.
+type BundleManifest struct {
+	Version  int          `json:"version"`
+	Created  time.Time    `json:"created"`
+	Solbuild string       `json:"solbuild"`
+	Parts    []string     `json:"parts"` // Directories within the bundle
+	Files    []BundleFile `json:"files"`
+}
+
+// ParseBundleParts will find the directories, relative to root, of the
+// comma separated parts. Every part is used when none are given.
+func ParseBundleParts(root, names string) ([]string, error) {
+	var wanted []string
+
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted = append(wanted, name)
+		}
+	}
+
+	if len(wanted) == 0 {
+		for name := range BundleParts {
+			wanted = append(wanted, name)
+		}
+	}
+
+	var parts []string
+
+	for _, name := range wanted {
+		dir, ok := BundleParts[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown part %s, expected one of caches, images, packages or sources", name)
+		}
+
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("Part %s is not within %s", name, root)
+		}
+
+		if !slices.Contains(parts, rel) {
+			parts = append(parts, rel)
+		}
+	}
+
+	sort.Strings(parts)
+
+	return parts, nil
+}
+
+// IsBundleArchive determines whether the bundle at path is a tarball, rather
+// than a directory tree.
+func IsBundleArchive(path string) bool {
+	return strings.Contains(filepath.Base(path), ".tar")
+}
+
+// excludedFromBundle determines whether a file is transient, and so is left
+// out of bundles.
+func excludedFromBundle(name string) bool {
+	for _, suffix := range []string{".lock", partialSuffix, updateSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walkBundle calls fn with the path relative to root of each regular file
+// within the parts that belongs in a bundle.
+func walkBundle(root string, parts []string, fn func(rel string) error) error {
+	for _, part := range parts {
+		err := filepath.WalkDir(filepath.Join(root, part), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+
+				return err
+			}
+
+			if !d.Type().IsRegular() || excludedFromBundle(d.Name()) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+
+			return fn(rel)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newBundleManifest returns an empty manifest for the given parts.
+func newBundleManifest(parts []string) *BundleManifest {
+	return &BundleManifest{
+		Version:  bundleVersion,
+		Created:  time.Now().UTC(),
+		Solbuild: util.SolbuildVersion,
+		Parts:    parts,
+	}
+}
+
+// write stores the manifest at path.
+func (m *BundleManifest) write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o0644)
+}
+
+// ReadBundleManifest will read the manifest of the bundle tree at dir.
+func ReadBundleManifest(dir string) (*BundleManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to read manifest, reason: %w", ErrBundleCorrupt, err)
+	}
+
+	var manifest BundleManifest
+
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest, reason: %w", ErrBundleCorrupt, err)
+	}
+
+	if manifest.Version != bundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBundleCorrupt, manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// Verify will check that every file of the manifest is present within the
+// bundle tree at dir, and matches its recorded size and hash.
+func (m *BundleManifest) Verify(dir string) error {
+	for _, file := range m.Files {
+		clean := filepath.Clean(file.Path)
+		if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") ||
+			!slices.ContainsFunc(m.Parts, func(part string) bool { return strings.HasPrefix(clean, part+"/") }) {
+			return fmt.Errorf("%w: %s is outside of the bundled parts", ErrBundleCorrupt, file.Path)
+		}
+
+		path := filepath.Join(dir, clean)
+
+		st, err := os.Lstat(path)
+		if err != nil || !st.Mode().IsRegular() || st.Size() != file.Size {
+			return fmt.Errorf("%w: %s is missing or truncated", ErrBundleCorrupt, file.Path)
+		}
+
+		sum, err := FileSha256sum(path)
+		if err != nil || sum != file.SHA256 {
+			return fmt.Errorf("%w: %s does not match its hash", ErrBundleCorrupt, file.Path)
+		}
+	}
+
+	return nil
+}
+
+// copyBundleFile copies src to dst, keeping its mode and ownership so that
+// caches remain writable by the build user, and returns its hash.
+func copyBundleFile(src, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	st, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0o0755); err != nil {
+		return "", err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, st.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+
+	if _, err = io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		return "", err
+	}
+
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		if err = out.Chown(int(sys.Uid), int(sys.Gid)); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), out.Close()
+}
+
+// ExportState will bundle the parts of the state beneath root into dest,
+// along with a manifest to verify it by. A dest naming a tarball, such as
+// state.tar.zst, is compressed according to its suffix, otherwise a tree
+// suitable for rsync is written. Builds should not be running meanwhile.
+func ExportState(root, dest string, parts []string) (*BundleManifest, error) {
+	manifest := newBundleManifest(parts)
+	archive := IsBundleArchive(dest)
+
+	slog.Info("Exporting state", "parts", strings.Join(parts, ", "), "dest", dest)
+
+	err := walkBundle(root, parts, func(rel string) error {
+		path := filepath.Join(root, rel)
+
+		var sum string
+
+		var err error
+
+		if archive {
+			sum, err = FileSha256sum(path)
+		} else {
+			sum, err = copyBundleFile(path, filepath.Join(dest, rel))
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to export %s, reason: %w", rel, err)
+		}
+
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, BundleFile{Path: rel, Size: st.Size(), SHA256: sum})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !archive {
+		if err = manifest.write(filepath.Join(dest, BundleManifestName)); err != nil {
+			return nil, fmt.Errorf("Failed to write bundle manifest, reason: %w\n", err)
+		}
+
+		return manifest, nil
+	}
+
+	return manifest, writeBundleArchive(root, dest, manifest)
+}
+
+// writeBundleArchive will write the files of the manifest, and the manifest
+// itself, into the tarball at dest.
+func writeBundleArchive(root, dest string, manifest *BundleManifest) error {
+	dir, err := os.MkdirTemp("", "solbuild-state-")
+	if err != nil {
+		return fmt.Errorf("Failed to create export directory, reason: %w\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err = manifest.write(filepath.Join(dir, BundleManifestName)); err != nil {
+		return fmt.Errorf("Failed to write bundle manifest, reason: %w\n", err)
+	}
+
+	var list strings.Builder
+
+	for _, file := range manifest.Files {
+		list.WriteString(file.Path + "\x00")
+	}
+
+	listPath := filepath.Join(dir, "files")
+	if err = os.WriteFile(listPath, []byte(list.String()), 0o0644); err != nil {
+		return err
+	}
+
+	out, err := exec.Command("tar", "--numeric-owner", "-a", "-cf", dest,
+		"-C", dir, BundleManifestName, "-C", root, "--null", "-T", listPath).CombinedOutput()
+	if err != nil {
+		os.Remove(dest)
+
+		return fmt.Errorf("Failed to create bundle %s, reason: %w: %s\n", dest, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// ImportState will verify the bundle at src, a tarball or tree written by
+// ExportState, and copy its files beneath root. Files already present are
+// kept as they are, so importing only ever seeds missing state. The number
+// of files imported is returned.
+func ImportState(root, src string) (int, error) {
+	tree := src
+
+	if IsBundleArchive(src) {
+		if err := os.MkdirAll(root, 0o0755); err != nil {
+			return 0, err
+		}
+
+		// Extract beside the state, so files can be moved into place
+		dir, err := os.MkdirTemp(root, ".import-")
+		if err != nil {
+			return 0, fmt.Errorf("Failed to create import directory, reason: %w\n", err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		out, err := exec.Command("tar", "--numeric-owner", "-xf", src, "-C", dir).CombinedOutput()
+		if err != nil {
+			return 0, fmt.Errorf("Failed to extract bundle %s, reason: %w: %s\n", src, err, strings.TrimSpace(string(out)))
+		}
+
+		tree = dir
+	}
+
+	manifest, err := ReadBundleManifest(tree)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("Verifying state bundle", "files", len(manifest.Files))
+
+	if err = manifest.Verify(tree); err != nil {
+		return 0, err
+	}
+
+	imported := 0
+
+	for _, file := range manifest.Files {
+		target := filepath.Join(root, file.Path)
+		if PathExists(target) {
+			continue
+		}
+
+		source := filepath.Join(tree, file.Path)
+
+		if tree != src {
+			if err = os.MkdirAll(filepath.Dir(target), 0o0755); err != nil {
+				return imported, err
+			}
+
+			err = os.Rename(source, target)
+		} else {
+			_, err = copyBundleFile(source, target)
+		}
+
+		if err != nil {
+			return imported, fmt.Errorf("Failed to import %s, reason: %w", file.Path, err)
+		}
+
+		imported++
+	}
+
+	return imported, nil
+}
@@ -0,0 +1,145 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func writeTestState(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	files := map[string]string{
+		"cache/ccache/0/entry":        "ccache entry",
+		"images/main-x86_64.img":      "image",
+		"images/main-x86_64.img.meta": "hash = \"abc\"",
+		"images/main-x86_64.lock":     "1234",
+		"packages/nano.eopkg":         "package",
+	}
+
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	return root
+}
+
+func TestParseBundleParts(t *testing.T) {
+	parts, err := builder.ParseBundleParts(builder.BundleRoot, "images, caches")
+	if err != nil {
+		t.Fatalf("Failed to parse parts: %v", err)
+	}
+
+	if !slices.Equal(parts, []string{"cache", "images"}) {
+		t.Fatalf("Expected cache and images, got: %v", parts)
+	}
+
+	if parts, _ = builder.ParseBundleParts(builder.BundleRoot, ""); len(parts) != len(builder.BundleParts) {
+		t.Fatalf("Expected every part by default, got: %v", parts)
+	}
+
+	if _, err = builder.ParseBundleParts(builder.BundleRoot, "layers"); err == nil {
+		t.Fatal("Parsed unknown part")
+	}
+}
+
+func TestExportImportState(t *testing.T) {
+	root := writeTestState(t)
+	parts := []string{"cache", "images"}
+
+	for _, name := range []string{"tree", "state.tar.gz"} {
+		dest := filepath.Join(t.TempDir(), name)
+
+		manifest, err := builder.ExportState(root, dest, parts)
+		if err != nil {
+			t.Fatalf("Failed to export %s: %v", name, err)
+		}
+
+		if len(manifest.Files) != 3 {
+			t.Fatalf("Expected 3 files without the lock file, got: %v", manifest.Files)
+		}
+
+		target := t.TempDir()
+		if err = os.MkdirAll(filepath.Join(target, "images"), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		// Existing state is never replaced
+		if err = os.WriteFile(filepath.Join(target, "images", "main-x86_64.img"), []byte("local"), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		imported, err := builder.ImportState(target, dest)
+		if err != nil {
+			t.Fatalf("Failed to import %s: %v", name, err)
+		}
+
+		if imported != 2 {
+			t.Fatalf("Expected 2 files imported from %s, got: %d", name, imported)
+		}
+
+		if data, _ := os.ReadFile(filepath.Join(target, "cache", "ccache", "0", "entry")); string(data) != "ccache entry" {
+			t.Fatalf("Expected cache to be imported from %s, got: %q", name, data)
+		}
+
+		if data, _ := os.ReadFile(filepath.Join(target, "images", "main-x86_64.img")); string(data) != "local" {
+			t.Fatalf("Expected existing image to be kept, got: %q", data)
+		}
+
+		if entries, _ := filepath.Glob(filepath.Join(target, ".import-*")); len(entries) != 0 {
+			t.Fatalf("Expected import directory to be removed, got: %v", entries)
+		}
+	}
+}
+
+func TestImportStateCorrupt(t *testing.T) {
+	root := writeTestState(t)
+	dest := filepath.Join(t.TempDir(), "tree")
+
+	if _, err := builder.ExportState(root, dest, []string{"packages"}); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dest, "packages", "nano.eopkg"), []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	target := t.TempDir()
+
+	if _, err := builder.ImportState(target, dest); !errors.Is(err, builder.ErrBundleCorrupt) {
+		t.Fatalf("Expected ErrBundleCorrupt, got: %v", err)
+	}
+
+	if builder.PathExists(filepath.Join(target, "packages", "nano.eopkg")) {
+		t.Fatal("Imported files from a corrupt bundle")
+	}
+}
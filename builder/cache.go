@@ -2,8 +2,13 @@ package builder
 
 import (
 	"path"
+	"path/filepath"
 )
 
+// IsolatedCacheDir is the directory within CacheDirectory holding the caches
+// of packages that don't use the shared caches.
+const IsolatedCacheDir = "isolated"
+
 var (
 	Ccache = Cache{
 		Name:     "ccache",
@@ -32,3 +37,13 @@ type Cache struct {
 	Name     string
 	CacheDir string // CacheDir is the chroot-internal cache directory.
 }
+
+// GetCacheSource returns the host directory of the cache for this package,
+// which is shared between all packages unless the package isolates its caches.
+func (p *Package) GetCacheSource(c Cache) string {
+	if p.Overrides.IsolateCaches {
+		return filepath.Join(CacheDirectory, IsolatedCacheDir, p.Name, c.Name)
+	}
+
+	return filepath.Join(CacheDirectory, c.Name)
+}
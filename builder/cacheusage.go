@@ -0,0 +1,144 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// maxCacheHints is the most hints given after a build, so that they are
+// read rather than skimmed.
+const maxCacheHints = 2
+
+// CacheUsage records what a build could reuse from the host caches, so that
+// hints to speed up the next build can be given.
+type CacheUsage struct {
+	SourcesCached      int      // Sources already fetched by an earlier build
+	SourcesFetched     int      // Sources downloaded for this build
+	SourcesChanged     []string // Sources downloaded again as their hash changed
+	PackagesDownloaded int      // Packages missing from the package cache
+
+	lock sync.Mutex
+}
+
+// BuildCacheUsage holds the cache usage of the current build.
+var BuildCacheUsage = &CacheUsage{}
+
+// recordSource will count the source as cached, or as fetched for this build.
+// A fetched file is noted as changed when a copy of it with another hash is
+// cached, as the hash was then most likely changed in the recipe.
+func (u *CacheUsage) recordSource(src source.Source, cached bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if cached {
+		u.SourcesCached++
+		return
+	}
+
+	u.SourcesFetched++
+
+	simple, ok := src.(*source.SimpleSource)
+	if !ok {
+		return
+	}
+
+	copies, _ := filepath.Glob(filepath.Join(source.SourceDir, "*", simple.File))
+	for _, path := range copies {
+		if path != simple.GetBindConfiguration("").BindSource {
+			u.SourcesChanged = append(u.SourcesChanged, simple.File)
+			return
+		}
+	}
+}
+
+// recordPackages will count packages downloaded as they were missing from
+// the package cache.
+func (u *CacheUsage) recordPackages(count int) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.PackagesDownloaded += count
+}
+
+// CacheHints returns the most useful hints for speeding up the next build of
+// the package, given the cache usage of this build, in order of importance.
+func CacheHints(usage *CacheUsage, pkg *Package, overlay *Overlay, config *Config) []string {
+	var hints []string
+
+	for _, file := range usage.SourcesChanged {
+		hints = append(hints, fmt.Sprintf("Source %s was downloaded again as its hash changed, "+
+			"so the cached copy could not be used", file))
+	}
+
+	if pkg != nil && pkg.Type == PackageTypeYpkg && !pkg.CanCCache {
+		hints = append(hints, "ccache and sccache are disabled by 'ccache: no' in package.yml, "+
+			"remove it if the build works with them to speed up rebuilds")
+	}
+
+	if usage.PackagesDownloaded > 0 {
+		hints = append(hints, fmt.Sprintf("%d packages were missing from the package cache, "+
+			"run 'solbuild update' so the image has fewer to download", usage.PackagesDownloaded))
+	}
+
+	switch {
+	case overlay == nil || overlay.EnableTmpfs || overlay.DiskQuota != "":
+		// Pooled roots are not used for these builds
+	case config.PoolSize == 0:
+		hints = append(hints, "Set pool_size in solbuild.conf to keep build roots pre-provisioned, "+
+			"skipping their setup")
+	case !overlay.FromPool:
+		hints = append(hints, "No pre-provisioned root was ready, raise pool_size in solbuild.conf "+
+			"if builds often follow each other")
+	}
+
+	if len(hints) > maxCacheHints {
+		hints = hints[:maxCacheHints]
+	}
+
+	return hints
+}
+
+// reportCacheUsage will summarise what the build reused from the caches,
+// along with hints for speeding up the next build.
+func (m *Manager) reportCacheUsage() {
+	if !m.didStart {
+		return
+	}
+
+	usage := BuildCacheUsage
+
+	pool := "off"
+	if m.overlay.Pool != nil {
+		pool = "miss"
+		if m.overlay.FromPool {
+			pool = "hit"
+		}
+	}
+
+	slog.Info("Cache usage", "sources-cached", usage.SourcesCached, "sources-fetched", usage.SourcesFetched,
+		"packages-downloaded", usage.PackagesDownloaded, "ccache", m.pkg.CanCCache, "pool", pool)
+
+	for _, hint := range CacheHints(usage, m.pkg, m.overlay, m.Config) {
+		slog.Info("Hint: " + hint)
+	}
+}
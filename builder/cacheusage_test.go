@@ -0,0 +1,65 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestCacheHints(t *testing.T) {
+	pkg := &builder.Package{Type: builder.PackageTypeYpkg, CanCCache: true}
+	overlay := &builder.Overlay{}
+	config := &builder.Config{PoolSize: 2}
+
+	// Everything was reused from a pooled root
+	overlay.FromPool = true
+
+	if hints := builder.CacheHints(&builder.CacheUsage{SourcesCached: 2}, pkg, overlay, config); len(hints) != 0 {
+		t.Fatalf("Expected no hints, got %q", hints)
+	}
+
+	overlay.FromPool = false
+
+	hints := builder.CacheHints(&builder.CacheUsage{}, pkg, overlay, config)
+	if len(hints) != 1 || !strings.Contains(hints[0], "raise pool_size") {
+		t.Fatalf("Expected a hint to raise the pool size, got %q", hints)
+	}
+
+	// Only the most important hints are given
+	pkg.CanCCache = false
+	usage := &builder.CacheUsage{SourcesChanged: []string{"nano-8.0.tar.xz"}, PackagesDownloaded: 12}
+
+	hints = builder.CacheHints(usage, pkg, overlay, &builder.Config{})
+	if len(hints) != 2 {
+		t.Fatalf("Expected 2 hints, got %q", hints)
+	}
+
+	if !strings.Contains(hints[0], "nano-8.0.tar.xz") || !strings.Contains(hints[1], "ccache: no") {
+		t.Fatalf("Hints are not in order of importance: %q", hints)
+	}
+
+	// Pooled roots are never used for tmpfs builds
+	pkg.CanCCache = true
+	overlay.EnableTmpfs = true
+
+	if hints = builder.CacheHints(&builder.CacheUsage{}, pkg, overlay, &builder.Config{}); len(hints) != 0 {
+		t.Fatalf("Expected no pool hint for a tmpfs build, got %q", hints)
+	}
+}
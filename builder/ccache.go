@@ -0,0 +1,66 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// CcacheDependMode controls whether ccache uses depend mode within the
+// chroot, skipping the preprocessor for compilers generating dependency
+// files.
+var CcacheDependMode = true
+
+// ManagedCcacheConf will return the given host ccache.conf with the settings
+// managed by solbuild applied, replacing any the host sets. The compiler is
+// identified by its content rather than its mtime, which changes with every
+// image update, and the inode cache is disabled as inodes are not stable
+// across overlayfs mounts.
+func ManagedCcacheConf(conf []byte) []byte {
+	values := map[string]string{
+		"compiler_check": "content",
+		"depend_mode":    fmt.Sprintf("%t", CcacheDependMode),
+		"inode_cache":    "false",
+	}
+	order := []string{"compiler_check", "depend_mode", "inode_cache"}
+
+	var out bytes.Buffer
+
+	out.WriteString("# Managed by solbuild, settings below are replaced on each build\n")
+
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if key, _, found := strings.Cut(line, "="); found {
+			if _, ok := values[strings.TrimSpace(key)]; ok {
+				continue
+			}
+		}
+
+		out.WriteString(line + "\n")
+	}
+
+	for _, key := range order {
+		fmt.Fprintf(&out, "%s = %s\n", key, values[key])
+	}
+
+	return out.Bytes()
+}
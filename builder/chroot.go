@@ -17,7 +17,6 @@
 package builder
 
 import (
-	"fmt"
 	"log/slog"
 	"os"
 
@@ -29,7 +28,7 @@ func init() {
 }
 
 // Chroot will attempt to spawn a chroot in the overlayfs system.
-func (p *Package) Chroot(notif PidNotifier, pman *EopkgManager, overlay *Overlay) error {
+func (p *Package) Chroot(notif PidNotifier, pman PackageManager, overlay *Overlay) error {
 	slog.Debug("Beginning chroot", "profile", overlay.Back.Name, "version", p.Version,
 		"package", p.Name, "type", p.Type, "release", p.Release)
 
@@ -46,6 +45,10 @@ func (p *Package) Chroot(notif PidNotifier, pman *EopkgManager, overlay *Overlay
 		return err
 	}
 
+	if err := p.BindToolchain(overlay); err != nil {
+		return err
+	}
+
 	// Now kill networking
 	if p.Type == PackageTypeYpkg {
 		if !p.CanNetwork {
@@ -63,11 +66,10 @@ func (p *Package) Chroot(notif PidNotifier, pman *EopkgManager, overlay *Overlay
 	}
 
 	slog.Debug("Spawning login shell")
-	// Allow bash to work
+	// Allow the shell to work
 	commands.SetStdin(os.Stdin)
 
-	loginCommand := fmt.Sprintf("/bin/su - root -s %s", BuildUserShell)
-	err := ChrootShell(notif, overlay.MountPoint, loginCommand, BuildUserHome)
+	err := ChrootShell(notif, overlay.MountPoint, LoginShell, BuildUserHome)
 
 	commands.SetStdin(nil)
 	notif.SetActivePID(0)
@@ -0,0 +1,217 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ComponentCacheDirectory is where the packages of each component are
+// cached, keyed by the checksum of the repo index they were read from, set
+// from components_dir in the configuration.
+var ComponentCacheDirectory = DefaultComponentCacheDirectory
+
+const (
+	// DefaultComponentCacheDirectory is where components are cached unless
+	// configured otherwise.
+	DefaultComponentCacheDirectory = "/var/lib/solbuild/components"
+
+	// ComponentCacheMaxAge is how long an unused cached component is kept.
+	ComponentCacheMaxAge = 7 * 24 * time.Hour
+)
+
+// indexComponentPackage is the part of a package in an eopkg index needed
+// to find the component it belongs to.
+type indexComponentPackage struct {
+	Name   string `xml:"Name"`
+	PartOf string `xml:"PartOf"`
+}
+
+// ComponentPackages will find the packages of the component, and of its
+// sub-components, in the given eopkg index, as eopkg would install them.
+func ComponentPackages(r io.Reader, comp string) ([]string, error) {
+	var ret []string
+
+	dec := xml.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return ret, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Package" {
+			continue
+		}
+
+		var pkg indexComponentPackage
+		if err = dec.DecodeElement(&pkg, &start); err != nil {
+			return nil, err
+		}
+
+		if pkg.PartOf == comp || strings.HasPrefix(pkg.PartOf, comp+".") {
+			ret = append(ret, pkg.Name)
+		}
+	}
+}
+
+// InstalledPackages will find the names of the packages within the installed
+// database of eopkg in the root.
+func InstalledPackages(root string) (map[string]bool, error) {
+	versions, err := InstalledVersions(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]bool, len(versions))
+	for name := range versions {
+		ret[name] = true
+	}
+
+	return ret, nil
+}
+
+// InstalledVersions will find the packages within the installed database of
+// eopkg in the root, mapped to their $version-$release.
+func InstalledVersions(root string) (map[string]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "var/lib/eopkg/package"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]string, len(entries))
+
+	for _, entry := range entries {
+		// Entries are named $name-$version-$release
+		fields := strings.Split(entry.Name(), "-")
+		if !entry.IsDir() || len(fields) < 3 {
+			continue
+		}
+
+		ret[strings.Join(fields[:len(fields)-2], "-")] = strings.Join(fields[len(fields)-2:], "-")
+	}
+
+	return ret, nil
+}
+
+// ComponentInstalled determines whether every package of the component, as
+// listed by the repo indexes within the root, is already installed. This is
+// far cheaper than having eopkg resolve the component again.
+func ComponentInstalled(root, comp string) (bool, error) {
+	installed, err := InstalledPackages(root)
+	if err != nil {
+		return false, err
+	}
+
+	indexes, _ := filepath.Glob(filepath.Join(root, "var/lib/eopkg/index/*/eopkg-index.xml"))
+	found := false
+
+	for _, index := range indexes {
+		pkgs, err := cachedComponentPackages(index, comp)
+		if err != nil {
+			return false, err
+		}
+
+		for _, pkg := range pkgs {
+			if !installed[pkg] {
+				slog.Debug("Component package is not installed", "component", comp, "package", pkg)
+				return false, nil
+			}
+
+			found = true
+		}
+	}
+
+	return found, nil
+}
+
+// cachedComponentPackages will find the packages of the component in the
+// index, reusing the packages found the last time the same index was read.
+func cachedComponentPackages(index, comp string) ([]string, error) {
+	f, err := os.Open(index)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	cachePath := filepath.Join(ComponentCacheDirectory, comp+"-"+hex.EncodeToString(h.Sum(nil))+".json")
+
+	var pkgs []string
+
+	if b, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(b, &pkgs) == nil {
+		now := time.Now()
+		os.Chtimes(cachePath, now, now)
+
+		return pkgs, nil
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if pkgs, err = ComponentPackages(f, comp); err != nil {
+		return nil, err
+	}
+
+	if err = writeComponentCache(cachePath, pkgs); err != nil {
+		slog.Debug("Failed to cache component packages", "path", cachePath, "err", err)
+	}
+
+	return pkgs, nil
+}
+
+// writeComponentCache will store the packages of a component, pruning any
+// cached components that have not been used recently.
+func writeComponentCache(path string, pkgs []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o0755); err != nil {
+		return err
+	}
+
+	old, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.json"))
+	for _, p := range old {
+		if st, err := os.Stat(p); err == nil && time.Since(st.ModTime()) > ComponentCacheMaxAge {
+			os.Remove(p)
+		}
+	}
+
+	b, err := json.Marshal(pkgs)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o0644)
+}
@@ -0,0 +1,56 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CompressionFast is the compression level for quick local builds.
+	CompressionFast = 1
+
+	// CompressionMax is the compression level for the smallest packages,
+	// such as for release builds.
+	CompressionMax = 9
+)
+
+// CompressionLevel is the xz compression level of the packages produced by
+// eopkg, or -1 to use the level configured in the image.
+var CompressionLevel = -1
+
+// ParseCompression will parse a compression setting, which is "fast", "max",
+// a level from 0 to 9, or empty for the level configured in the image.
+func ParseCompression(value string) (int, error) {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "", "default":
+		return -1, nil
+	case "fast":
+		return CompressionFast, nil
+	case "max":
+		return CompressionMax, nil
+	}
+
+	level, err := strconv.Atoi(value)
+	if err != nil || level < 0 || level > CompressionMax {
+		return -1, fmt.Errorf("Invalid compression %s, expected fast, max or a level from 0 to %d", value, CompressionMax)
+	}
+
+	return level, nil
+}
@@ -21,17 +21,74 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/getsolus/solbuild/builder/source"
 )
 
 // Config defines the global defaults for solbuild.
 type Config struct {
-	DefaultProfile string `toml:"default_profile"`  // Name of the default profile to use
-	EnableHistory  bool   `toml:"enable_history"`   // Whether to enable history generation or not
-	EnableTmpfs    bool   `toml:"enable_tmpfs"`     // Whether to enable tmpfs builds or
-	OverlayRootDir string `toml:"overlay_root_dir"` // Custom Overlay Root Dir
-	TmpfsSize      string `toml:"tmpfs_size"`       // Bounding size on the tmpfs
+	AllowLegacy         bool     `toml:"allow_legacy"`          // Whether to build legacy pspec.xml packages
+	ArtifactLayout      string   `toml:"artifact_layout"`       // Layout of the collected artifacts: flat, profile-dir or profile-suffix
+	AuditLog            bool     `toml:"audit_log"`             // Whether to record operations changing state in the audit log
+	CacheBudget         string   `toml:"cache_budget"`          // Maximum disk usage before pruning, empty to disable
+	CacheDir            string   `toml:"cache_dir"`             // Directory holding the build caches
+	CcacheDependMode    bool     `toml:"ccache_depend_mode"`    // Whether ccache uses depend mode within the chroot
+	CheckImage          bool     `toml:"check_image"`           // Whether to sanity check the image before building
+	CheckRelease        bool     `toml:"check_release"`         // Whether to ensure the release is newer than the published one
+	CheckUpdate         bool     `toml:"check_update"`          // Whether to check an updated image before it replaces the image
+	ChrootShell         string   `toml:"chroot_shell"`          // Login shell for solbuild chroot, falling back to /bin/sh if missing
+	ComponentsDir       string   `toml:"components_dir"`        // Directory caching the packages of each component
+	Compression         string   `toml:"compression"`           // Compression of produced packages: fast, max or 0-9, empty for the image default
+	ContainerMode       string   `toml:"container_mode"`        // Whether to adapt to running in a container: auto, always or never
+	CPUs                string   `toml:"cpus"`                  // CPUs to pin builds to, e.g. 0-7,16-23, empty for any CPU
+	DefaultProfile      string   `toml:"default_profile"`       // Name of the default profile to use
+	DiskQuota           string   `toml:"disk_quota"`            // Maximum scratch space a single build may use, empty for no limit
+	DNSServers          []string `toml:"dns_servers"`           // Nameservers used within the build, empty for the host nameservers
+	EnableHistory       bool     `toml:"enable_history"`        // Whether to enable history generation or not
+	EnableTmpfs         bool     `toml:"enable_tmpfs"`          // Whether to enable tmpfs builds or
+	GitRemoteAllow      []string `toml:"git_remote_allow"`      // Domains git remotes may be fetched from, empty for any domain
+	GitRemoteDeny       []string `toml:"git_remote_deny"`       // Domains git remotes may never be fetched from
+	GitRemotePolicy     string   `toml:"git_remote_policy"`     // Policy for disallowed git remotes: warn, enforce or off
+	HTTPSources         string   `toml:"http_sources"`          // Policy for plain HTTP sources: warn, deny or allow
+	IDMappedMounts      bool     `toml:"idmapped_mounts"`       // Whether to expose sources and caches with idmapped mounts when supported
+	ImageGenerations    int      `toml:"image_generations"`     // Number of previous images to keep when updating, 0 to keep none
+	ImageMirrors        []string `toml:"image_mirrors"`         // Base URIs to fetch images from, in order, before the official server
+	ImageVerifyInterval int      `toml:"image_verify_interval"` // Days between verifying the image hash, 0 to only verify on request
+	ImagesDir           string   `toml:"images_dir"`            // Directory holding the images of the profiles
+	InhibitShutdown     bool     `toml:"inhibit_shutdown"`      // Whether to prevent the host shutting down during builds
+	IsolateHome         bool     `toml:"isolate_home"`          // Whether to give the build user a fresh tmpfs home
+	KeepDBUS            bool     `toml:"keep_dbus"`             // Whether to keep dbus running for the whole build
+	KeepTestLogs        bool     `toml:"keep_test_logs"`        // Whether to keep the logs of test harnesses alongside the build log
+	LibDir              string   `toml:"lib_dir"`               // Directory holding the records of solbuild, such as remembered settings
+	Locale              string   `toml:"locale"`                // Locale used within the build
+	LogMaxAge           int      `toml:"log_max_age"`           // Days to keep build logs for, 0 to keep them forever
+	LogMaxSize          string   `toml:"log_max_size"`          // Maximum total size of build logs, empty for no limit
+	LowMemory           bool     `toml:"lowmem"`                // Whether to tune builds for hosts with little memory
+	ManifestName        string   `toml:"manifest_name"`         // Template of the transit manifest filename
+	NUMANodes           string   `toml:"numa_nodes"`            // NUMA nodes to pin builds to, e.g. 1, empty for any node
+	OverlayMetacopy     bool     `toml:"overlay_metacopy"`      // Whether to enable overlayfs metacopy when the kernel supports it
+	OverlayRootDir      string   `toml:"overlay_root_dir"`      // Custom Overlay Root Dir
+	PackageCacheDir     string   `toml:"package_cache_dir"`     // Directory holding the packages shared between builds
+	PoolSize            int      `toml:"pool_size"`             // Number of pre-provisioned roots to keep ready, 0 to disable
+	ProfileDirs         []string `toml:"profile_dirs"`          // Extra directories to load profiles from, before the system paths
+	RememberSettings    bool     `toml:"remember_settings"`     // Whether to reuse the settings of the last successful build of a package
+	RootsDir            string   `toml:"roots_dir"`             // Directory where images are updated
+	SigningKey          string   `toml:"signing_key"`           // Private key file to sign packages with
+	SigningURL          string   `toml:"signing_url"`           // Signing service to sign packages with
+	SourcesDir          string   `toml:"sources_dir"`           // Directory holding the fetched sources
+	StateDir            string   `toml:"state_dir"`             // Directory holding the persistent state of packages
+	StateMaxSize        string   `toml:"state_max_size"`        // Size the persistent state of a package may reach before being discarded
+	StallKill           string   `toml:"stall_kill"`            // Time a command may make no progress before it is killed, empty to never kill
+	StallWarn           string   `toml:"stall_warn"`            // Time a command may make no progress before a warning, empty to never warn
+	Strict              bool     `toml:"strict"`                // Whether to fail builds on warnings that CI should enforce
+	TmpfsSize           string   `toml:"tmpfs_size"`            // Bounding size on the tmpfs
+	Timezone            string   `toml:"timezone"`              // Timezone used within the build, empty for the image default
+	UpgradeHTTP         bool     `toml:"upgrade_http_sources"`  // Whether to try plain HTTP sources over HTTPS first
+
+	Proxy ProxyConfig `toml:"proxy"` // Proxies for downloads, used instead of those in the environment
 }
 
 var (
@@ -50,11 +107,63 @@ var (
 func NewConfig() (*Config, error) {
 	// Set up some sane defaults just in case someone mangles the configs
 	config := &Config{
-		DefaultProfile: "main-x86_64",
-		EnableHistory:  false,
-		EnableTmpfs:    false,
-		OverlayRootDir: "/var/cache/solbuild",
-		TmpfsSize:      "",
+		AllowLegacy:         true,
+		ArtifactLayout:      string(LayoutFlat),
+		AuditLog:            true,
+		CacheBudget:         "",
+		CacheDir:            DefaultCacheDirectory,
+		CcacheDependMode:    true,
+		CheckImage:          false,
+		CheckRelease:        true,
+		CheckUpdate:         true,
+		ChrootShell:         BuildUserShell,
+		ComponentsDir:       DefaultComponentCacheDirectory,
+		Compression:         "",
+		ContainerMode:       string(ContainerAuto),
+		CPUs:                "",
+		DefaultProfile:      "main-x86_64",
+		DiskQuota:           "",
+		DNSServers:          nil,
+		EnableHistory:       false,
+		EnableTmpfs:         false,
+		GitRemoteAllow:      nil,
+		GitRemoteDeny:       nil,
+		GitRemotePolicy:     string(source.RemoteWarn),
+		HTTPSources:         string(source.InsecureWarn),
+		IDMappedMounts:      true,
+		ImageGenerations:    0,
+		ImageMirrors:        nil,
+		ImageVerifyInterval: 7,
+		ImagesDir:           DefaultImagesDir,
+		InhibitShutdown:     true,
+		IsolateHome:         false,
+		KeepDBUS:            false,
+		KeepTestLogs:        false,
+		LibDir:              DefaultLibDirectory,
+		Locale:              DefaultLocale,
+		LogMaxAge:           0,
+		LogMaxSize:          "",
+		LowMemory:           false,
+		ManifestName:        DefaultManifestName,
+		NUMANodes:           "",
+		OverlayMetacopy:     true,
+		OverlayRootDir:      "/var/cache/solbuild",
+		PackageCacheDir:     DefaultPackageCacheDirectory,
+		PoolSize:            0,
+		ProfileDirs:         nil,
+		RememberSettings:    true,
+		RootsDir:            DefaultImageRootsDir,
+		SigningKey:          "",
+		SigningURL:          "",
+		SourcesDir:          source.DefaultSourceDir,
+		StateDir:            DefaultStateDirectory,
+		StateMaxSize:        "10G",
+		StallKill:           "",
+		StallWarn:           "30m",
+		Strict:              false,
+		TmpfsSize:           "",
+		Timezone:            "",
+		UpgradeHTTP:         true,
 	}
 
 	// Reverse because /etc takes precedence in stateless
@@ -92,3 +201,156 @@ func NewConfig() (*Config, error) {
 
 	return config, nil
 }
+
+// Validate will check the configuration for problems that would otherwise
+// only surface part way through a build.
+func (c *Config) Validate() error {
+	if err := validateDirs(c); err != nil {
+		return err
+	}
+
+	if c.TmpfsSize != "" && !ValidMemSize(c.TmpfsSize) {
+		return fmt.Errorf("Invalid tmpfs_size: %s", c.TmpfsSize)
+	}
+
+	if c.StateMaxSize != "" {
+		if _, err := ParseByteSize(c.StateMaxSize); err != nil {
+			return fmt.Errorf("Invalid state_max_size, reason: %w", err)
+		}
+	}
+
+	if c.DiskQuota != "" {
+		if _, err := ParseByteSize(c.DiskQuota); err != nil {
+			return fmt.Errorf("Invalid disk_quota, reason: %w", err)
+		}
+	}
+
+	if err := validateDuration("stall_warn", c.StallWarn); err != nil {
+		return err
+	}
+
+	if err := validateDuration("stall_kill", c.StallKill); err != nil {
+		return err
+	}
+
+	if _, err := ParseCompression(c.Compression); err != nil {
+		return err
+	}
+
+	if c.ManifestName != "" {
+		if err := ValidateManifestName(c.ManifestName); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ResolveAffinity(c.CPUs, c.NUMANodes); err != nil {
+		return fmt.Errorf("Invalid cpus or numa_nodes, reason: %w", err)
+	}
+
+	if c.CacheBudget != "" {
+		if _, err := ParseByteSize(c.CacheBudget); err != nil {
+			return fmt.Errorf("Invalid cache_budget, reason: %w", err)
+		}
+	}
+
+	if err := ValidateMirrors(c.ImageMirrors); err != nil {
+		return err
+	}
+
+	if c.ImageGenerations < 0 {
+		return fmt.Errorf("Invalid image_generations: %d", c.ImageGenerations)
+	}
+
+	if c.ImageVerifyInterval < 0 {
+		return fmt.Errorf("Invalid image_verify_interval: %d", c.ImageVerifyInterval)
+	}
+
+	for _, dir := range c.ProfileDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("Invalid profile_dirs, must be absolute paths: %s", dir)
+		}
+	}
+
+	if c.PoolSize < 0 {
+		return fmt.Errorf("Invalid pool_size: %d", c.PoolSize)
+	}
+
+	if c.LogMaxAge < 0 {
+		return fmt.Errorf("Invalid log_max_age: %d", c.LogMaxAge)
+	}
+
+	if c.LogMaxSize != "" {
+		if _, err := ParseByteSize(c.LogMaxSize); err != nil {
+			return fmt.Errorf("Invalid log_max_size, reason: %w", err)
+		}
+	}
+
+	if c.ChrootShell != "" && !filepath.IsAbs(c.ChrootShell) {
+		return fmt.Errorf("Invalid chroot_shell, must be an absolute path: %s", c.ChrootShell)
+	}
+
+	if err := ValidateLocale(c.Locale); err != nil {
+		return err
+	}
+
+	if err := ValidateTimezone(c.Timezone); err != nil {
+		return err
+	}
+
+	if err := ValidateDNSServers(c.DNSServers); err != nil {
+		return err
+	}
+
+	if err := c.Proxy.Validate(); err != nil {
+		return err
+	}
+
+	if _, err := source.ParseInsecurePolicy(c.HTTPSources); err != nil {
+		return err
+	}
+
+	if _, err := source.ParseRemotePolicy(c.GitRemotePolicy); err != nil {
+		return err
+	}
+
+	if _, err := ParseContainerSetting(c.ContainerMode); err != nil {
+		return err
+	}
+
+	if _, err := ParseArtifactLayout(c.ArtifactLayout); err != nil {
+		return err
+	}
+
+	if c.SigningKey != "" && c.SigningURL != "" {
+		return fmt.Errorf("Only one of signing_key and signing_url may be set")
+	}
+
+	// The upper layer lives in memory with tmpfs builds, which low memory
+	// mode never uses
+	if !c.EnableTmpfs || c.LowMemory {
+		return CheckOverlaySupport(c.OverlayRootDir)
+	}
+
+	return nil
+}
+
+// validateDuration ensures an optional duration setting is valid.
+func validateDuration(name, value string) error {
+	_, err := parseDuration(name, value)
+
+	return err
+}
+
+// parseDuration parses the named duration setting, which is zero when empty.
+func parseDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid %s, must be a duration such as 30m: %s", name, value)
+	}
+
+	return d, nil
+}
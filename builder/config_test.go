@@ -0,0 +1,219 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":   512,
+		"4K":    4 << 10,
+		"500M":  500 << 20,
+		"1.5G":  3 << 29,
+		"200gb": 200 << 30,
+	}
+
+	for in, expected := range tests {
+		size, err := builder.ParseByteSize(in)
+		if err != nil {
+			t.Fatalf("Failed to parse valid size %s: %v", in, err)
+		}
+
+		if size != expected {
+			t.Fatalf("Wrong size for %s: %d vs expected %d", in, size, expected)
+		}
+	}
+
+	for _, in := range []string{"", "G", "-1G", "tenG"} {
+		if _, err := builder.ParseByteSize(in); err == nil {
+			t.Fatalf("Parsed invalid size %q", in)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	config := &builder.Config{EnableTmpfs: true, TmpfsSize: "4G", CacheBudget: "200G"}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Failed to validate good config: %v", err)
+	}
+
+	config.TmpfsSize = "4Q"
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated invalid tmpfs_size")
+	}
+
+	config.TmpfsSize = ""
+	config.CacheBudget = "lots"
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated invalid cache_budget")
+	}
+
+	config.CacheBudget = ""
+	config.DiskQuota = "100X"
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated invalid disk_quota")
+	}
+
+	config.DiskQuota = ""
+	config.StateMaxSize = "big"
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated invalid state_max_size")
+	}
+
+	config.StateMaxSize = ""
+	config.Proxy.HTTPS = "proxy:3128"
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated proxy without a scheme")
+	}
+
+	config.Proxy.HTTPS = ""
+	config.StallKill = "forever"
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated invalid stall_kill")
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	for _, locale := range []string{"", "C", "C.UTF-8", "en_US.UTF-8", "de_DE.ISO-8859-1", "sr_RS@latin", "tr_TR"} {
+		if err := builder.ValidateLocale(locale); err != nil {
+			t.Fatalf("Failed to validate locale %s: %v", locale, err)
+		}
+	}
+
+	for _, locale := range []string{"en_US.UTF-8; rm -rf /", "'", "en US"} {
+		if err := builder.ValidateLocale(locale); err == nil {
+			t.Fatalf("Validated invalid locale %q", locale)
+		}
+	}
+
+	for _, timezone := range []string{"", "UTC", "Europe/Berlin", "America/Argentina/Buenos_Aires", "Etc/GMT+5"} {
+		if err := builder.ValidateTimezone(timezone); err != nil {
+			t.Fatalf("Failed to validate timezone %s: %v", timezone, err)
+		}
+	}
+
+	for _, timezone := range []string{"../etc/passwd", "/UTC", "Europe//Berlin"} {
+		if err := builder.ValidateTimezone(timezone); err == nil {
+			t.Fatalf("Validated invalid timezone %q", timezone)
+		}
+	}
+}
+
+func TestTuneEopkgConf(t *testing.T) {
+	conf := "[general]\ndestinationdirectory = /\n\n[build]\njobs = -j16\nbuildhelper = None\n\n[directories]\ntmp_dir = /tmp\n"
+	expected := "[general]\ndestinationdirectory = /\n\n[build]\njobs = -j2\nbuildhelper = None\ncompressionlevel = 1\n\n[directories]\ntmp_dir = /tmp\n"
+
+	if tuned := string(builder.TuneEopkgConf([]byte(conf))); tuned != expected {
+		t.Fatalf("Unexpected tuned configuration:\n%s", tuned)
+	}
+
+	if tuned := string(builder.TuneEopkgConf(nil)); tuned != "\n[build]\njobs = -j2\ncompressionlevel = 1\n" {
+		t.Fatalf("Expected a [build] section to be added, got:\n%s", tuned)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	tests := map[string]int{"": -1, "default": -1, "fast": builder.CompressionFast, " MAX": builder.CompressionMax, "0": 0, "6": 6}
+
+	for value, expected := range tests {
+		level, err := builder.ParseCompression(value)
+		if err != nil {
+			t.Fatalf("Failed to parse compression %q: %v", value, err)
+		}
+
+		if level != expected {
+			t.Fatalf("Expected level %d for %q, got: %d", expected, value, level)
+		}
+	}
+
+	for _, value := range []string{"zstd", "10", "-1"} {
+		if _, err := builder.ParseCompression(value); err == nil {
+			t.Fatalf("Parsed invalid compression %q", value)
+		}
+	}
+
+	lowMemory, compression := builder.LowMemory, builder.CompressionLevel
+	builder.LowMemory, builder.CompressionLevel = true, builder.CompressionMax
+
+	t.Cleanup(func() { builder.LowMemory, builder.CompressionLevel = lowMemory, compression })
+
+	conf := "[build]\njobs = -j16\ncompressionlevel = 3\n"
+	if tuned := string(builder.SetEopkgBuildOptions([]byte(conf), builder.EopkgBuildOptions()...)); tuned != "[build]\njobs = -j2\ncompressionlevel = 9\n" {
+		t.Fatalf("Expected the compression level to replace that of low memory mode, got:\n%s", tuned)
+	}
+
+	builder.LowMemory, builder.CompressionLevel = false, -1
+	if options := builder.EopkgBuildOptions(); len(options) != 0 {
+		t.Fatalf("Expected eopkg.conf to be left alone, got: %v", options)
+	}
+}
+
+func TestManagedCcacheConf(t *testing.T) {
+	conf := "max_size = 10G\ncompiler_check = mtime\n# keep this\ninode_cache=true\n"
+	expected := "# Managed by solbuild, settings below are replaced on each build\nmax_size = 10G\n# keep this\n" +
+		"compiler_check = content\ndepend_mode = true\ninode_cache = false\n"
+
+	if managed := string(builder.ManagedCcacheConf([]byte(conf))); managed != expected {
+		t.Fatalf("Unexpected managed configuration:\n%s", managed)
+	}
+
+	builder.CcacheDependMode = false
+	defer func() { builder.CcacheDependMode = true }()
+
+	if managed := string(builder.ManagedCcacheConf(nil)); !strings.Contains(managed, "depend_mode = false\n") {
+		t.Fatalf("Expected depend mode to be disabled, got:\n%s", managed)
+	}
+}
+
+func TestContainerMode(t *testing.T) {
+	if setting, err := builder.ParseContainerSetting(""); err != nil || setting != builder.ContainerAuto {
+		t.Fatalf("Expected auto by default, got %q (%v)", setting, err)
+	}
+
+	if _, err := builder.ParseContainerSetting("sometimes"); err == nil {
+		t.Fatal("Expected an invalid container mode to be rejected")
+	}
+
+	if !builder.UseContainerMode("always") {
+		t.Fatal("Expected container mode to be forced on")
+	}
+
+	if builder.UseContainerMode("never") {
+		t.Fatal("Expected container mode to be forced off")
+	}
+}
+
+func TestDisabledInhibitor(t *testing.T) {
+	lock, err := builder.NewInhibitor(false).Inhibit("Testing")
+	if err != nil {
+		t.Fatalf("Expected a disabled inhibitor to do nothing, got %v", err)
+	}
+
+	if err = lock.Close(); err != nil {
+		t.Fatalf("Failed to release inhibitor lock: %v", err)
+	}
+}
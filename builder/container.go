@@ -0,0 +1,225 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// A ContainerSetting decides whether solbuild adapts to running within a
+// container, such as Docker or Podman in CI.
+type ContainerSetting string
+
+const (
+	// ContainerAuto adapts only when a container is detected.
+	ContainerAuto ContainerSetting = "auto"
+
+	// ContainerAlways always adapts, for containers that cannot be detected.
+	ContainerAlways ContainerSetting = "always"
+
+	// ContainerNever never adapts.
+	ContainerNever ContainerSetting = "never"
+)
+
+// ErrContainerPrivileges is returned when solbuild is running within a
+// container lacking the privileges to build.
+var ErrContainerPrivileges = errors.New("container lacks the privileges to build, run it with --privileged")
+
+// ContainerMode is set when solbuild is running within a container. The /dev
+// nodes of the chroot are bind mounted from the host rather than from a
+// devtmpfs, which is not namespaced, and systemd-logind is not used.
+var ContainerMode = false
+
+// containerCapabilities are required to set up the chroot, by bit number.
+var containerCapabilities = map[uint]string{
+	18: "CAP_SYS_CHROOT",
+	21: "CAP_SYS_ADMIN",
+}
+
+// containerDevNodes are bind mounted into /dev in container mode.
+var containerDevNodes = []string{
+	"full",
+	"null",
+	"random",
+	"tty",
+	"urandom",
+	"zero",
+}
+
+// containerDevLinks are created in /dev in container mode.
+var containerDevLinks = map[string]string{
+	"fd":     "/proc/self/fd",
+	"stdin":  "/proc/self/fd/0",
+	"stdout": "/proc/self/fd/1",
+	"stderr": "/proc/self/fd/2",
+	"ptmx":   "pts/ptmx",
+}
+
+// ParseContainerSetting will return the setting with the given name. An empty
+// name is the default, ContainerAuto.
+func ParseContainerSetting(name string) (ContainerSetting, error) {
+	switch setting := ContainerSetting(name); setting {
+	case "":
+		return ContainerAuto, nil
+	case ContainerAuto, ContainerAlways, ContainerNever:
+		return setting, nil
+	default:
+		return "", fmt.Errorf("Invalid container mode: %s (expected auto, always or never)", name)
+	}
+}
+
+// UseContainerMode determines whether container mode applies with the given
+// setting, detecting a container if needed.
+func UseContainerMode(name string) bool {
+	setting, err := ParseContainerSetting(name)
+	if err != nil {
+		return false
+	}
+
+	switch setting {
+	case ContainerAlways:
+		return true
+	case ContainerNever:
+		return false
+	default:
+		return InContainer()
+	}
+}
+
+// InContainer determines whether solbuild is running within a container.
+func InContainer() bool {
+	// Docker and Podman respectively
+	if PathExists("/.dockerenv") || PathExists("/run/.containerenv") {
+		return true
+	}
+
+	// Set by systemd-nspawn, LXC and Podman
+	if os.Getenv("container") != "" {
+		return true
+	}
+
+	cgroup, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+
+	for _, runtime := range []string{"docker", "kubepods", "libpod", "containerd"} {
+		if strings.Contains(string(cgroup), runtime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckContainerPrivileges will ensure the container grants the capabilities
+// needed to set up the chroot, rather than failing part way through.
+func CheckContainerPrivileges() error {
+	caps, err := effectiveCapabilities()
+	if err != nil {
+		return fmt.Errorf("Failed to read capabilities, reason: %w\n", err)
+	}
+
+	var missing []string
+
+	for bit, name := range containerCapabilities {
+		if caps&(1<<bit) == 0 {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrContainerPrivileges, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// effectiveCapabilities returns the effective capability set of solbuild.
+func effectiveCapabilities() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "CapEff:"); found {
+			return strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("no effective capabilities found")
+}
+
+// bindDevNodes will populate the /dev of the chroot with nodes bind mounted
+// from the host, for containers where devtmpfs cannot be used.
+func (o *Overlay) bindDevNodes(dev string) error {
+	mountMan := disk.GetMountManager()
+
+	if err := mountMan.Mount("tmpfs-dev", dev, "tmpfs", "nosuid", "mode=755"); err != nil {
+		return fmt.Errorf("Failed to mount /dev, reason: %w\n", err)
+	}
+
+	for _, node := range containerDevNodes {
+		source := filepath.Join("/dev", node)
+		target := filepath.Join(dev, node)
+
+		if !PathExists(source) {
+			slog.Warn("Device node is missing from the container", "node", source)
+			continue
+		}
+
+		if err := TouchFile(target); err != nil {
+			return fmt.Errorf("Failed to create device node %s, reason: %w\n", target, err)
+		}
+
+		if err := mountMan.BindMount(source, target); err != nil {
+			return fmt.Errorf("Failed to bind mount device node %s, reason: %w\n", source, err)
+		}
+
+		o.ExtraMounts = append(o.ExtraMounts, target)
+	}
+
+	for name, target := range containerDevLinks {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return fmt.Errorf("Failed to create /dev/%s, reason: %w\n", name, err)
+		}
+	}
+
+	for _, dir := range []string{"pts", "shm"} {
+		if err := os.MkdirAll(filepath.Join(dev, dir), 0o0755); err != nil {
+			return fmt.Errorf("Failed to create /dev/%s, reason: %w\n", dir, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,421 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ActionsFile is the name of the build script alongside a pspec.xml.
+const ActionsFile = "actions.py"
+
+// convertTODO marks everything in a converted recipe that must be reviewed.
+const convertTODO = "UPDATE-ME"
+
+// actionSteps maps the functions of actions.py to package.yml steps.
+var actionSteps = []struct {
+	Function string
+	Step     string
+}{
+	{"setup", "setup"},
+	{"build", "build"},
+	{"install", "install"},
+	{"check", "check"},
+}
+
+var (
+	// actionsFuncRegex matches the start of a function in actions.py.
+	actionsFuncRegex = regexp.MustCompile(`^def\s+(\w+)\s*\(.*\)\s*:`)
+
+	// actionsCallRegex splits a call such as autotools.make("-j1").
+	actionsCallRegex = regexp.MustCompile(`^(\w+\.\w+)\s*\((.*)\)$`)
+
+	// actionsStringRegex matches a plain string literal argument.
+	actionsStringRegex = regexp.MustCompile(`^(?:"([^"\\]*)"|'([^'\\]*)')$`)
+
+	// actionsMacros maps actions.py helpers to ypkg macros or commands. The
+	// arguments are appended when they are a plain string literal. Anything
+	// else, such as the pisitools helpers, needs manual conversion.
+	actionsMacros = map[string]string{
+		"autotools.aclocal":      "aclocal",
+		"autotools.autoconf":     "autoconf",
+		"autotools.automake":     "automake",
+		"autotools.autoreconf":   "autoreconf",
+		"autotools.configure":    "%configure",
+		"autotools.install":      "%make_install",
+		"autotools.make":         "%make",
+		"autotools.rawConfigure": "./configure",
+		"autotools.rawInstall":   "%make_install",
+		"cmaketools.configure":   "%cmake .",
+		"cmaketools.install":     "%make_install",
+		"cmaketools.make":        "%make",
+		"cmaketools.rawInstall":  "%make_install",
+		"pythonmodules.compile":  "%python_setup",
+		"pythonmodules.install":  "%python_install",
+		"shelltools.cd":          "cd",
+		"shelltools.export":      "export",
+		"shelltools.makedirs":    "mkdir -p",
+		"shelltools.system":      "",
+	}
+)
+
+const convertTemplate = `# Converted from pspec.xml by solbuild. This is a best-effort starting point:
+# review every TODO and UPDATE-ME before building.
+name       : {{ .Name }}
+version    : {{ .Version }}
+release    : {{ .Release }}
+source     :
+{{- range .Sources }}
+    - {{ . }}
+{{- end }}
+homepage   : {{ .Homepage }}
+license    :
+{{- range .Licenses }}
+    - {{ . }}
+{{- end }}
+component  : {{ .Component }}
+summary    : {{ .Summary }}
+description: |
+    {{ .Description }}
+{{- if .BuildDeps }}
+builddeps  :
+{{- range .BuildDeps }}
+    - {{ . }}
+{{- end }}
+{{- end }}
+{{- if .RunDeps }}
+rundeps    :
+{{- range .RunDeps }}
+    - {{ . }}
+{{- end }}
+{{- end }}
+{{- range .Steps }}
+{{ printf "%-11s" .Name }}: |
+{{- range .Lines }}
+    {{ . }}
+{{- end }}
+{{- end }}
+`
+
+// A convertStep is a build step of the converted recipe.
+type convertStep struct {
+	Name  string
+	Lines []string
+}
+
+// A Conversion is a package.yml generated from a pspec.xml, along with
+// everything that could not be converted.
+type Conversion struct {
+	Recipe []byte   // The generated package.yml
+	TODOs  []string // Everything needing manual attention
+}
+
+// ConvertPspec will produce a best-effort package.yml from the pspec.xml at
+// path and the actions.py alongside it. Anything that cannot be converted is
+// marked with a TODO in the recipe, and listed in the Conversion.
+func ConvertPspec(path string) (*Conversion, error) {
+	by, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	xpkg := &XMLPackage{}
+	if err = xml.Unmarshal(by, xpkg); err != nil {
+		return nil, err
+	}
+
+	if len(xpkg.History) < 1 {
+		return nil, errors.New("xml: Malformed pspec file")
+	}
+
+	conv := &Conversion{}
+	src := xpkg.Source
+	upd := xpkg.History[0]
+
+	data := map[string]any{
+		"Name":        conv.orTODO("name", src.Name),
+		"Version":     conv.orTODO("version", upd.Version),
+		"Release":     upd.Release,
+		"Homepage":    conv.orTODO("homepage", src.Homepage),
+		"Component":   conv.orTODO("component", src.PartOf),
+		"Summary":     conv.orTODO("summary", src.Summary),
+		"Description": conv.orTODO("description", strings.Join(strings.Fields(src.Description), " ")),
+		"Sources":     conv.sources(src.Archive),
+		"Licenses":    conv.licenses(src.License),
+		"BuildDeps":   trimAll(src.BuildDependencies),
+		"RunDeps":     conv.runDeps(xpkg),
+	}
+
+	steps, err := conv.actions(filepath.Join(filepath.Dir(path), ActionsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	// Patches are applied before anything else
+	if patches := conv.patches(src.Patches); len(patches) > 0 {
+		if len(steps) == 0 || steps[0].Name != "setup" {
+			steps = append([]convertStep{{Name: "setup"}}, steps...)
+		}
+
+		steps[0].Lines = append(patches, steps[0].Lines...)
+	}
+
+	data["Steps"] = steps
+
+	var buf bytes.Buffer
+
+	tmpl := template.Must(template.New("package.yml").Parse(convertTemplate))
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	conv.Recipe = buf.Bytes()
+
+	return conv, nil
+}
+
+// todo records something that needs manual attention.
+func (c *Conversion) todo(format string, args ...any) {
+	c.TODOs = append(c.TODOs, fmt.Sprintf(format, args...))
+}
+
+// orTODO returns the value, or a placeholder if it is empty.
+func (c *Conversion) orTODO(field, value string) string {
+	if value = strings.TrimSpace(value); value != "" {
+		return value
+	}
+
+	c.todo("%s is missing from the pspec.xml", field)
+
+	return convertTODO
+}
+
+// trimAll returns the non-empty values with whitespace removed.
+func trimAll(values []string) []string {
+	var ret []string
+
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			ret = append(ret, value)
+		}
+	}
+
+	return ret
+}
+
+// sources converts the archives, which need a sha256sum in package.yml.
+func (c *Conversion) sources(archives []XMLArchive) []string {
+	var ret []string
+
+	for _, archive := range archives {
+		uri := strings.TrimSpace(archive.URI)
+		if uri == "" {
+			continue
+		}
+
+		if name := strings.TrimSpace(archive.Name); name != "" && !strings.Contains(uri, "#") {
+			uri += "#" + name
+		}
+
+		if archive.SHA256Sum != "" {
+			ret = append(ret, fmt.Sprintf("%s : %s", uri, strings.TrimSpace(archive.SHA256Sum)))
+			continue
+		}
+
+		c.todo("sha256sum of %s, only its sha1sum is known", uri)
+		ret = append(ret, fmt.Sprintf("%s : %s # TODO: sha256sum, was sha1sum %s", uri, convertTODO,
+			strings.TrimSpace(archive.SHA1Sum)))
+	}
+
+	return ret
+}
+
+// licenses returns the declared licenses, which should be SPDX identifiers.
+func (c *Conversion) licenses(licenses []string) []string {
+	ret := trimAll(licenses)
+	if len(ret) == 0 {
+		c.todo("license is missing from the pspec.xml")
+		return []string{convertTODO + " # Use SPDX identifiers"}
+	}
+
+	return ret
+}
+
+// runDeps returns the runtime dependencies of the main package. Those of
+// any other packages need patterns, which cannot be converted.
+func (c *Conversion) runDeps(xpkg *XMLPackage) []string {
+	var ret []string
+
+	name := strings.TrimSpace(xpkg.Source.Name)
+
+	for _, pkg := range xpkg.Packages {
+		if pkgName := strings.TrimSpace(pkg.Name); pkgName != name {
+			c.todo("subpackage %s needs patterns and rundeps", pkgName)
+			continue
+		}
+
+		ret = append(ret, trimAll(pkg.RuntimeDependencies)...)
+	}
+
+	return ret
+}
+
+// patches converts the patches into setup commands.
+func (c *Conversion) patches(patches []XMLPatch) []string {
+	ret := make([]string, 0, len(patches))
+
+	for _, patch := range patches {
+		if name := strings.TrimSpace(patch.Name); name != "" {
+			ret = append(ret, fmt.Sprintf("%%patch -p%d -i $pkgfiles/%s", patch.Level, name))
+		}
+	}
+
+	return ret
+}
+
+// actions converts the functions of the actions.py into build steps.
+func (c *Conversion) actions(path string) ([]convertStep, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.todo("no %s was found, the build steps must be written", ActionsFile)
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	funcs := make(map[string][]string)
+
+	var current, pending string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if m := actionsFuncRegex.FindStringSubmatch(line); m != nil {
+			current = m[1]
+			continue
+		}
+
+		// Only statements within a function body are of interest
+		trimmed := strings.TrimSpace(line)
+		if current == "" || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			current = ""
+			continue
+		}
+
+		// Join calls spanning multiple lines
+		pending = strings.TrimSpace(pending + " " + strings.TrimSuffix(trimmed, "\\"))
+		if strings.Count(pending, "(") > strings.Count(pending, ")") {
+			continue
+		}
+
+		funcs[current] = append(funcs[current], pending)
+		pending = ""
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var steps []convertStep
+
+	for _, step := range actionSteps {
+		statements, ok := funcs[step.Function]
+		if !ok {
+			continue
+		}
+
+		lines := make([]string, 0, len(statements))
+		for _, statement := range statements {
+			lines = append(lines, c.convertStatement(step.Function, statement))
+		}
+
+		steps = append(steps, convertStep{Name: step.Step, Lines: lines})
+	}
+
+	return steps, nil
+}
+
+// convertStatement maps a single actions.py statement onto a shell command,
+// or a TODO comment if that is not possible.
+func (c *Conversion) convertStatement(function, statement string) string {
+	m := actionsCallRegex.FindStringSubmatch(statement)
+	if m == nil {
+		return c.unconverted(function, statement)
+	}
+
+	macro, known := actionsMacros[m[1]]
+	if !known {
+		return c.unconverted(function, statement)
+	}
+
+	args := strings.TrimSpace(m[2])
+
+	// Installing to the install directory is implied by the macro
+	if strings.HasSuffix(macro, "_install") && strings.Contains(args, "get.installDIR()") {
+		return macro
+	}
+
+	if args == "" {
+		if macro == "" {
+			return c.unconverted(function, statement)
+		}
+
+		return macro
+	}
+
+	literal := actionsStringRegex.FindStringSubmatch(args)
+	if literal == nil {
+		return c.unconverted(function, statement)
+	}
+
+	value := strings.Join(strings.Fields(literal[1]+literal[2]), " ")
+
+	return strings.TrimSpace(macro + " " + value)
+}
+
+// unconverted records a statement that needs manual conversion.
+func (c *Conversion) unconverted(function, statement string) string {
+	c.todo("%s(): %s", function, statement)
+	return "# TODO: unconverted: " + statement
+}
+
+// Write will emit the converted package.yml into dir.
+func (c *Conversion) Write(dir string) error {
+	recipe := filepath.Join(dir, "package.yml")
+	if PathExists(recipe) {
+		return ErrRecipeExists
+	}
+
+	return os.WriteFile(recipe, c.Recipe, 0o0644)
+}
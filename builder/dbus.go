@@ -0,0 +1,157 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/getsolus/libosdev/commands"
+)
+
+// KeepDBUS will keep the dbus instance running from the start of a build
+// until it is finished, rather than for each phase needing it.
+var KeepDBUS = false
+
+var (
+	dbusServices     = make(map[string]*dbusService)
+	dbusServicesLock sync.Mutex
+)
+
+// dbusService is a reference counted dbus instance within a root. Each phase
+// needing dbus holds a reference, so that consecutive phases share the one
+// instance and it is only torn down once the last of them is done.
+type dbusService struct {
+	root    string
+	pidFile string
+	refs    int
+	active  bool
+	lock    sync.Mutex
+}
+
+// getDBUSService will return the dbus service for the given root, creating
+// it if needed.
+func getDBUSService(root string) *dbusService {
+	dbusServicesLock.Lock()
+	defer dbusServicesLock.Unlock()
+
+	if d, ok := dbusServices[root]; ok {
+		return d
+	}
+
+	d := &dbusService{
+		root:    root,
+		pidFile: filepath.Join(root, "var/run/dbus/pid"),
+	}
+	dbusServices[root] = d
+
+	return d
+}
+
+// Acquire will take a reference on the service, starting dbus if this is the
+// first reference.
+func (d *dbusService) Acquire(notif PidNotifier) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.active {
+		if err := d.start(notif); err != nil {
+			return err
+		}
+	}
+
+	d.refs++
+
+	return nil
+}
+
+// Release will drop a reference on the service, stopping dbus once there are
+// none left.
+func (d *dbusService) Release() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.refs == 0 {
+		return nil
+	}
+
+	d.refs--
+	if d.refs > 0 {
+		return nil
+	}
+
+	return d.stop()
+}
+
+// Stop will tear down dbus regardless of any remaining references.
+func (d *dbusService) Stop() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.refs = 0
+
+	return d.stop()
+}
+
+// start will bring up dbus within the chroot.
+func (d *dbusService) start(notif PidNotifier) error {
+	dbusDir := filepath.Join(d.root, "run", "dbus")
+	if err := os.MkdirAll(dbusDir, 0o0755); err != nil {
+		return err
+	}
+
+	if err := ChrootExec(notif, d.root, "dbus", "dbus-uuidgen --ensure"); err != nil {
+		return err
+	}
+
+	notif.SetActivePID(0)
+
+	if err := ChrootExec(notif, d.root, "dbus", "dbus-daemon --system"); err != nil {
+		return err
+	}
+
+	notif.SetActivePID(0)
+	d.active = true
+
+	return nil
+}
+
+// stop will kill the dbus daemon within the chroot. The service is marked as
+// stopped even if this fails, so that the next Acquire starts it afresh.
+func (d *dbusService) stop() error {
+	// No sense killing dbus twice
+	if !d.active {
+		return nil
+	}
+
+	defer func() {
+		os.Remove(d.pidFile)
+		d.active = false
+		d.refs = 0
+	}()
+
+	b, err := os.ReadFile(d.pidFile)
+	if err != nil {
+		return err
+	}
+
+	pid := strings.Split(string(b), "\n")[0]
+
+	return commands.ExecStdoutArgs("kill", []string{"-9", pid})
+}
@@ -0,0 +1,46 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDBUSStopMissingPidFile(t *testing.T) {
+	root := t.TempDir()
+
+	d := &dbusService{
+		root:    root,
+		pidFile: filepath.Join(root, "var/run/dbus/pid"),
+		refs:    2,
+		active:  true,
+	}
+
+	if err := d.Stop(); err == nil {
+		t.Fatal("Expected the missing pid file to be reported")
+	}
+
+	if d.active || d.refs != 0 {
+		t.Fatalf("Expected dbus to be marked as stopped, got active=%v refs=%d", d.active, d.refs)
+	}
+
+	// A release with no references left must not try to stop it again
+	if err := d.Release(); err != nil {
+		t.Fatalf("Unexpected error releasing a stopped service: %v", err)
+	}
+}
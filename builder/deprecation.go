@@ -0,0 +1,145 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// DeprecationKind is the sort of thing that has been deprecated.
+type DeprecationKind string
+
+const (
+	// DeprecatedFlag is a command line flag.
+	DeprecatedFlag DeprecationKind = "flag"
+
+	// DeprecatedConfig is a configuration or profile key.
+	DeprecatedConfig DeprecationKind = "config"
+
+	// DeprecatedPath is a location on disk no longer used by solbuild.
+	DeprecatedPath DeprecationKind = "path"
+
+	// DeprecatedRecipe is a package recipe format.
+	DeprecatedRecipe DeprecationKind = "recipe"
+)
+
+// A Deprecation describes behaviour that will change or be removed in a
+// future release, and what to use instead.
+type Deprecation struct {
+	ID          string          `json:"id"`
+	Kind        DeprecationKind `json:"kind"`
+	Subject     string          `json:"subject"`
+	Replacement string          `json:"replacement"`
+	Paths       []string        `json:"paths,omitempty"` // Locations which indicate the deprecation is in use
+}
+
+// Identifiers of the known deprecations.
+const (
+	DeprecationCacheSizes     = "delete-cache-sizes"
+	DeprecationObsoleteCaches = "obsolete-cache-dirs"
+	DeprecationLegacyRecipe   = "legacy-pspec"
+)
+
+// Deprecations are all of the deprecations known to solbuild.
+var Deprecations = []Deprecation{
+	{
+		ID:          DeprecationCacheSizes,
+		Kind:        DeprecatedFlag,
+		Subject:     "delete-cache --sizes",
+		Replacement: "solbuild show-cache",
+	},
+	{
+		ID:          DeprecationObsoleteCaches,
+		Kind:        DeprecatedPath,
+		Subject:     "per-profile ccache and sccache directories",
+		Replacement: "solbuild migrate-cache",
+		Paths: []string{
+			ObsoleteCcacheDirectory,
+			ObsoleteLegacyCcacheDirectory,
+			ObsoleteSccacheDirectory,
+			ObsoleteLegacySccacheDirectory,
+		},
+	},
+	{
+		ID:          DeprecationLegacyRecipe,
+		Kind:        DeprecatedRecipe,
+		Subject:     "legacy pspec.xml builds",
+		Replacement: "solbuild convert",
+	},
+}
+
+var (
+	warnedDeprecations = make(map[string]bool)
+	deprecationLock    sync.Mutex
+)
+
+// LookupDeprecation returns the deprecation with the given ID.
+func LookupDeprecation(id string) (Deprecation, bool) {
+	for _, dep := range Deprecations {
+		if dep.ID == id {
+			return dep, true
+		}
+	}
+
+	return Deprecation{}, false
+}
+
+// WarnDeprecated warns that the deprecation with the given ID is in use.
+// Each deprecation is only warned about once per invocation, so callers
+// need not track whether they have already warned.
+func WarnDeprecated(id string, args ...any) {
+	dep, ok := LookupDeprecation(id)
+	if !ok {
+		return
+	}
+
+	deprecationLock.Lock()
+	warned := warnedDeprecations[id]
+	warnedDeprecations[id] = true
+	deprecationLock.Unlock()
+
+	if warned {
+		return
+	}
+
+	args = append([]any{"deprecation", dep.ID, "replacement", dep.Replacement}, args...)
+	slog.Warn("Deprecated: "+dep.Subject, args...)
+}
+
+// ActiveDeprecations returns the deprecations which can be detected as in
+// use on this host, i.e. those with a deprecated path still present.
+func ActiveDeprecations() (active []Deprecation) {
+	for _, dep := range Deprecations {
+		for _, path := range dep.Paths {
+			if PathExists(path) {
+				active = append(active, dep)
+
+				break
+			}
+		}
+	}
+
+	return active
+}
+
+// WarnActiveDeprecations warns about every deprecation in use on this host.
+func WarnActiveDeprecations() {
+	for _, dep := range ActiveDeprecations() {
+		WarnDeprecated(dep.ID)
+	}
+}
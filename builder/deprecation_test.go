@@ -0,0 +1,58 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestDeprecations(t *testing.T) {
+	seen := make(map[string]bool)
+
+	for _, dep := range builder.Deprecations {
+		if seen[dep.ID] {
+			t.Errorf("Duplicate deprecation %s", dep.ID)
+		}
+
+		seen[dep.ID] = true
+
+		if dep.Subject == "" || dep.Replacement == "" {
+			t.Errorf("Deprecation %s is missing a subject or replacement", dep.ID)
+		}
+	}
+
+	for _, id := range []string{
+		builder.DeprecationCacheSizes,
+		builder.DeprecationObsoleteCaches,
+		builder.DeprecationLegacyRecipe,
+	} {
+		if _, ok := builder.LookupDeprecation(id); !ok {
+			t.Errorf("Deprecation %s is not registered", id)
+		}
+	}
+
+	if _, ok := builder.LookupDeprecation("no-such-deprecation"); ok {
+		t.Error("Unknown deprecation was found")
+	}
+
+	// Unknown deprecations are ignored, and warnings are only given once
+	builder.WarnDeprecated("no-such-deprecation")
+	builder.WarnDeprecated(builder.DeprecationCacheSizes)
+	builder.WarnDeprecated(builder.DeprecationCacheSizes)
+}
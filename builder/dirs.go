@@ -0,0 +1,145 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// A Relocation is a state directory which has been configured away from
+// its default location, while the default still holds the old state.
+type Relocation struct {
+	Key  string // Configuration key of the directory
+	From string // Default location, still holding state
+	To   string // Configured location
+}
+
+// configDirs pairs the configuration keys of the state directories with
+// their defaults and configured locations. Unset directories are left at
+// their defaults.
+func configDirs(c *Config) []Relocation {
+	dirs := []Relocation{
+		{"cache_dir", DefaultCacheDirectory, c.CacheDir},
+		{"components_dir", DefaultComponentCacheDirectory, c.ComponentsDir},
+		{"images_dir", DefaultImagesDir, c.ImagesDir},
+		{"lib_dir", DefaultLibDirectory, c.LibDir},
+		{"package_cache_dir", DefaultPackageCacheDirectory, c.PackageCacheDir},
+		{"roots_dir", DefaultImageRootsDir, c.RootsDir},
+		{"sources_dir", source.DefaultSourceDir, c.SourcesDir},
+		{"state_dir", DefaultStateDirectory, c.StateDir},
+	}
+
+	for i := range dirs {
+		if dirs[i].To == "" {
+			dirs[i].To = dirs[i].From
+		}
+	}
+
+	return dirs
+}
+
+// validateDirs ensures every state directory is an absolute path.
+func validateDirs(c *Config) error {
+	for _, dir := range configDirs(c) {
+		if !filepath.IsAbs(dir.To) {
+			return fmt.Errorf("Invalid %s, must be an absolute path: %q", dir.Key, dir.To)
+		}
+	}
+
+	return nil
+}
+
+// ApplyDirectories relocates the state of solbuild to the directories in
+// the configuration.
+func ApplyDirectories(c *Config) {
+	dirs := configDirs(c)
+
+	CacheDirectory = filepath.Clean(dirs[0].To)
+	ComponentCacheDirectory = filepath.Clean(dirs[1].To)
+	ImagesDir = filepath.Clean(dirs[2].To)
+	LibDirectory = filepath.Clean(dirs[3].To)
+	PackageCacheDirectory = filepath.Clean(dirs[4].To)
+	ImageRootsDir = filepath.Clean(dirs[5].To)
+	source.SetSourceDir(filepath.Clean(dirs[6].To))
+	StateDirectory = filepath.Clean(dirs[7].To)
+
+	// Refresh anything derived from the directories
+	BuildDurationsFile = buildDurationsFile()
+	BuildSettingsFile = buildSettingsFile()
+	BundleParts = bundleParts()
+	BundleRoot = LibDirectory
+	CacheMigrations = cacheMigrations()
+	LegacyStatsFile = legacyStatsFile()
+}
+
+// PendingRelocations finds the state directories configured away from their
+// defaults, where the default still holds state and the new location does
+// not, so the state would otherwise be silently abandoned.
+func PendingRelocations(c *Config) (pending []Relocation) {
+	for _, dir := range configDirs(c) {
+		if filepath.Clean(dir.To) == dir.From {
+			continue
+		}
+
+		if dirEmpty(dir.From) || !dirEmpty(dir.To) {
+			continue
+		}
+
+		pending = append(pending, dir)
+	}
+
+	return pending
+}
+
+// dirEmpty determines whether the directory is missing or has no entries.
+func dirEmpty(path string) bool {
+	entries, err := os.ReadDir(path)
+
+	return err != nil || len(entries) == 0
+}
+
+// warnRelocations warns about state left behind in the default locations.
+func warnRelocations(c *Config) {
+	for _, dir := range PendingRelocations(c) {
+		slog.Warn("State remains in the default location, move it to keep using it",
+			"key", dir.Key, "from", dir.From, "to", dir.To)
+	}
+}
+
+// LoadDirectories applies the configured state directories. It is called
+// once before any command runs, so that every command agrees on where the
+// state of solbuild is kept.
+func LoadDirectories() error {
+	config, err := NewConfig()
+	if err != nil {
+		return err
+	}
+
+	if err = validateDirs(config); err != nil {
+		return err
+	}
+
+	ApplyDirectories(config)
+	warnRelocations(config)
+
+	return nil
+}
@@ -0,0 +1,90 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+func TestApplyDirectories(t *testing.T) {
+	root := t.TempDir()
+	config := &builder.Config{
+		CacheDir:        filepath.Join(root, "cache"),
+		ComponentsDir:   filepath.Join(root, "components"),
+		ImagesDir:       filepath.Join(root, "images"),
+		LibDir:          root,
+		PackageCacheDir: filepath.Join(root, "packages"),
+		RootsDir:        filepath.Join(root, "roots"),
+		SourcesDir:      filepath.Join(root, "sources"),
+		StateDir:        filepath.Join(root, "state"),
+	}
+
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Failed to validate relocated directories: %v", err)
+	}
+
+	builder.ApplyDirectories(config)
+	t.Cleanup(func() { builder.ApplyDirectories(&builder.Config{}) })
+
+	if builder.CacheDirectory != config.CacheDir || builder.ImagesDir != config.ImagesDir ||
+		builder.PackageCacheDirectory != config.PackageCacheDir || builder.StateDirectory != config.StateDir ||
+		builder.ComponentCacheDirectory != config.ComponentsDir || builder.ImageRootsDir != config.RootsDir {
+		t.Fatal("State directories were not relocated")
+	}
+
+	if builder.BundleRoot != root || filepath.Dir(builder.BuildSettingsFile) != root ||
+		filepath.Dir(builder.LegacyStatsFile) != root || filepath.Dir(builder.BuildDurationsFile) != root {
+		t.Fatal("Records of solbuild were not relocated")
+	}
+
+	if img := builder.NewBackingImage("unstable-x86_64"); filepath.Dir(img.RootDir) != config.RootsDir {
+		t.Fatalf("Image roots were not relocated: %s", img.RootDir)
+	}
+
+	if source.GitSourceDir != filepath.Join(config.SourcesDir, "git") {
+		t.Fatalf("Git sources were not relocated: %s", source.GitSourceDir)
+	}
+
+	if builder.BundleParts["caches"] != config.CacheDir {
+		t.Fatalf("Bundle parts were not relocated: %s", builder.BundleParts["caches"])
+	}
+
+	if to := builder.CacheMigrations[0].To; filepath.Dir(to) != config.CacheDir {
+		t.Fatalf("Cache migrations were not relocated: %s", to)
+	}
+
+	// Unset directories are left at their defaults
+	builder.ApplyDirectories(&builder.Config{})
+
+	if builder.ImagesDir != builder.DefaultImagesDir || source.SourceDir != source.DefaultSourceDir ||
+		builder.BundleRoot != builder.DefaultLibDirectory {
+		t.Fatal("Unset directories did not use their defaults")
+	}
+
+	if pending := builder.PendingRelocations(config); len(pending) != 0 {
+		t.Fatalf("Unexpected pending relocations: %v", pending)
+	}
+
+	config.StateDir = "state"
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validated relative state_dir")
+	}
+}
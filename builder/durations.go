@@ -0,0 +1,164 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// maxBuildDurations is the number of successful builds of each package whose
+// durations are kept.
+const maxBuildDurations = 10
+
+// BuildDurationsFile is where the durations of successful builds on this
+// host are kept, for schedulers and to estimate when a build will finish,
+// within LibDirectory.
+var BuildDurationsFile = buildDurationsFile()
+
+// buildDurationsFile returns the path of the build durations within the
+// current LibDirectory.
+func buildDurationsFile() string {
+	return filepath.Join(LibDirectory, "build-durations.toml")
+}
+
+// A BuildDuration is how long a successful build of a package took.
+type BuildDuration struct {
+	Version  string    `toml:"version"  json:"version"`
+	Release  int       `toml:"release"  json:"release"`
+	Profile  string    `toml:"profile"  json:"profile"`
+	Seconds  int64     `toml:"seconds"  json:"seconds"`  // Time from the start of the build until it succeeded
+	Finished time.Time `toml:"finished" json:"finished"` // When the build succeeded
+}
+
+// Duration returns how long the build took.
+func (d BuildDuration) Duration() time.Duration {
+	return time.Duration(d.Seconds) * time.Second
+}
+
+// LoadBuildDurations will return the durations of the recent successful
+// builds of every package, oldest first.
+func LoadBuildDurations() (map[string][]BuildDuration, error) {
+	durations := make(map[string][]BuildDuration)
+
+	if _, err := toml.DecodeFile(BuildDurationsFile, &durations); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return durations, nil
+		}
+
+		return nil, fmt.Errorf("Failed to read build durations %s, reason: %w\n", BuildDurationsFile, err)
+	}
+
+	return durations, nil
+}
+
+// RecordBuildDuration will store the duration of a successful build of the
+// named package, keeping only the most recent builds.
+func RecordBuildDuration(name string, duration BuildDuration) error {
+	durations, err := LoadBuildDurations()
+	if err != nil {
+		return err
+	}
+
+	recent := append(durations[name], duration)
+	if len(recent) > maxBuildDurations {
+		recent = recent[len(recent)-maxBuildDurations:]
+	}
+
+	durations[name] = recent
+
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by solbuild, durations of the recent successful builds of each package\n")
+
+	if err = toml.NewEncoder(&buf).Encode(durations); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(BuildDurationsFile), 0o0755); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(BuildDurationsFile, buf.Bytes(), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write build durations %s, reason: %w\n", BuildDurationsFile, err)
+	}
+
+	return nil
+}
+
+// ExpectedBuildTime returns the last successful build of the named package
+// on this host, preferring one with the given profile, and whether there was
+// any. Schedulers may use it to order their queues.
+func ExpectedBuildTime(name, profile string) (BuildDuration, bool, error) {
+	durations, err := LoadBuildDurations()
+	if err != nil {
+		return BuildDuration{}, false, err
+	}
+
+	recent := durations[name]
+	if len(recent) == 0 {
+		return BuildDuration{}, false, nil
+	}
+
+	for i := len(recent) - 1; i >= 0; i-- {
+		if recent[i].Profile == profile {
+			return recent[i], true, nil
+		}
+	}
+
+	return recent[len(recent)-1], true, nil
+}
+
+// reportExpectedTime will print how long the last build of the package took
+// on this host, and so when this build might finish.
+func (m *Manager) reportExpectedTime(start time.Time) {
+	last, ok, err := ExpectedBuildTime(m.pkg.Name, m.profile.Name)
+	if err != nil {
+		slog.Warn("Failed to load build durations", "err", err)
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	slog.Info(fmt.Sprintf("Last build of this package took %s on this host", last.Duration()),
+		"version", last.Version, "release", last.Release, "profile", last.Profile,
+		"eta", start.Add(last.Duration()).Format(time.Kitchen))
+}
+
+// recordDuration will store how long the successful build took.
+func (m *Manager) recordDuration(start time.Time) {
+	duration := BuildDuration{
+		Version:  m.pkg.Version,
+		Release:  m.pkg.Release,
+		Profile:  m.profile.Name,
+		Seconds:  int64(time.Since(start).Round(time.Second) / time.Second),
+		Finished: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := RecordBuildDuration(m.pkg.Name, duration); err != nil {
+		slog.Warn("Failed to record build duration", "err", err)
+	}
+}
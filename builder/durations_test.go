@@ -0,0 +1,77 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestBuildDurations(t *testing.T) {
+	original := builder.BuildDurationsFile
+	builder.BuildDurationsFile = filepath.Join(t.TempDir(), "build-durations.toml")
+
+	t.Cleanup(func() { builder.BuildDurationsFile = original })
+
+	if _, ok, err := builder.ExpectedBuildTime("nano", "main-x86_64"); ok || err != nil {
+		t.Fatalf("Expected no build durations, got: %t %v", ok, err)
+	}
+
+	for release := 1; release <= 12; release++ {
+		profile := "unstable-x86_64"
+		if release == 5 {
+			profile = "main-x86_64"
+		}
+
+		duration := builder.BuildDuration{
+			Version:  "8.0",
+			Release:  release,
+			Profile:  profile,
+			Seconds:  int64(60 * release),
+			Finished: time.Date(2024, 1, release, 0, 0, 0, 0, time.UTC),
+		}
+
+		if err := builder.RecordBuildDuration("nano", duration); err != nil {
+			t.Fatalf("Failed to record build duration: %v", err)
+		}
+	}
+
+	durations, err := builder.LoadBuildDurations()
+	if err != nil {
+		t.Fatalf("Failed to load build durations: %v", err)
+	}
+
+	if recent := durations["nano"]; len(recent) != 10 || recent[0].Release != 3 || recent[9].Release != 12 {
+		t.Fatalf("Expected the 10 most recent builds, got: %+v", recent)
+	}
+
+	last, ok, err := builder.ExpectedBuildTime("nano", "main-x86_64")
+	if err != nil || !ok {
+		t.Fatalf("Expected a build duration, got: %t %v", ok, err)
+	}
+
+	if last.Release != 5 || last.Duration() != 5*time.Minute {
+		t.Fatalf("Expected the last build with the profile, got: %+v", last)
+	}
+
+	if last, _, _ = builder.ExpectedBuildTime("nano", "main-i686"); last.Release != 12 {
+		t.Fatalf("Expected the last build with any profile, got: %+v", last)
+	}
+}
@@ -0,0 +1,133 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidEnvironment is returned when a package declares an environment
+// variable that may not be set for the build.
+var ErrInvalidEnvironment = errors.New("ypkg: Invalid environment variable")
+
+// environmentName matches the names of variables that may be declared.
+var environmentName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// deniedEnvironment are variables a package may not set, as they would
+// change how the build is run rather than what it builds. Variables set by
+// solbuild itself are also denied.
+var deniedEnvironment = map[string]bool{
+	"BASH_ENV":    true,
+	"CCACHE_DIR":  true,
+	"ENV":         true,
+	"HOME":        true,
+	"IFS":         true,
+	"LANG":        true,
+	"LC_ALL":      true,
+	"PATH":        true,
+	"SCCACHE_DIR": true,
+	"SHELL":       true,
+	"TERM":        true,
+	"TZ":          true,
+	"USER":        true,
+	"USERNAME":    true,
+	"http_proxy":  true,
+	"https_proxy": true,
+	"no_proxy":    true,
+	"ftp_proxy":   true,
+	"HTTP_PROXY":  true,
+	"HTTPS_PROXY": true,
+	"NO_PROXY":    true,
+	"FTP_PROXY":   true,
+	"GCONV_PATH":  true,
+}
+
+// A RecipeEnvironment holds the variables a package.yml requires for its
+// build. ypkg also accepts a script as the environment, which it handles
+// itself, so a scalar is ignored.
+type RecipeEnvironment map[string]string
+
+// UnmarshalYAML accepts a mapping of variables, ignoring a ypkg script.
+func (e *RecipeEnvironment) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return nil
+	}
+
+	var vars map[string]string
+	if err := value.Decode(&vars); err != nil {
+		return err
+	}
+
+	*e = vars
+
+	return nil
+}
+
+// ValidateEnvironmentVariable ensures the package may set the variable.
+func ValidateEnvironmentVariable(name, value string) error {
+	switch {
+	case !environmentName.MatchString(name):
+		return fmt.Errorf("%w: %q is not a valid name", ErrInvalidEnvironment, name)
+	case deniedEnvironment[name], strings.HasPrefix(name, "LD_"):
+		return fmt.Errorf("%w: %s may not be set by the package", ErrInvalidEnvironment, name)
+	case strings.ContainsRune(value, 0):
+		return fmt.Errorf("%w: %s contains a NUL byte", ErrInvalidEnvironment, name)
+	}
+
+	return nil
+}
+
+// Environment will validate the variables, returning them sorted in the
+// NAME=value form.
+func (e RecipeEnvironment) Environment() ([]string, error) {
+	ret := make([]string, 0, len(e))
+
+	for name, value := range e {
+		if err := ValidateEnvironmentVariable(name, value); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, name+"="+value)
+	}
+
+	sort.Strings(ret)
+
+	return ret, nil
+}
+
+// RedactEnvironment returns a copy of the environment safe to record, with
+// the values of proxy variables, which may hold credentials, removed.
+func RedactEnvironment(env []string) []string {
+	ret := make([]string, 0, len(env))
+
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if strings.HasSuffix(strings.ToLower(name), "_proxy") {
+			entry = name + "=<redacted>"
+		}
+
+		ret = append(ret, entry)
+	}
+
+	return ret
+}
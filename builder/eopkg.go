@@ -24,7 +24,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/getsolus/libosdev/commands"
 	"github.com/getsolus/libosdev/disk"
 )
 
@@ -46,19 +45,19 @@ func eopkgCommand(c string) string {
 
 // An EopkgRepo is a simplistic representation of a repo found in any given
 // chroot.
-type EopkgRepo struct {
-	ID  string
-	URI string
-}
+//
+// Deprecated: Use RootRepo, which is not specific to eopkg.
+type EopkgRepo = RootRepo
 
 // EopkgManager is our own very shorted version of libosdev EopkgManager, to
 // enable extremely simple operations.
 type EopkgManager struct {
-	dbusActive  bool
-	root        string
-	cacheSource string
-	cacheTarget string
-	dbusPid     string
+	dbus         *dbusService
+	root         string
+	cacheSource  string
+	cacheTarget  string
+	cacheScratch string
+	cacheOverlay bool
 
 	notif PidNotifier
 }
@@ -66,12 +65,12 @@ type EopkgManager struct {
 // NewEopkgManager will return a new eopkg manager.
 func NewEopkgManager(notif PidNotifier, root string) *EopkgManager {
 	return &EopkgManager{
-		dbusActive:  false,
-		root:        root,
-		cacheSource: PackageCacheDirectory,
-		cacheTarget: filepath.Join(root, "var/cache/eopkg/packages"),
-		dbusPid:     filepath.Join(root, "var/run/dbus/pid"),
-		notif:       notif,
+		dbus:         getDBUSService(root),
+		root:         root,
+		cacheSource:  PackageCacheDirectory,
+		cacheTarget:  filepath.Join(root, "var/cache/eopkg/packages"),
+		cacheScratch: root + PackageCacheScratchSuffix,
+		notif:        notif,
 	}
 }
 
@@ -80,9 +79,7 @@ func NewEopkgManager(notif PidNotifier, root string) *EopkgManager {
 // or installing deps, prior to building, could clobber the files.
 func (e *EopkgManager) CopyAssets() error {
 	assets := map[string]string{
-		"/etc/resolv.conf":        filepath.Join(e.root, "etc/resolv.conf"),
-		"/etc/eopkg/eopkg.conf":   filepath.Join(e.root, "etc/eopkg/eopkg.conf"),
-		"/etc/ccache/ccache.conf": filepath.Join(e.root, "etc/ccache/ccache.conf"),
+		"/etc/eopkg/eopkg.conf": filepath.Join(e.root, "etc/eopkg/eopkg.conf"),
 	}
 
 	for key, value := range assets {
@@ -106,101 +103,129 @@ func (e *EopkgManager) CopyAssets() error {
 		}
 	}
 
-	return nil
-}
-
-// Init will do some basic preparation of the chroot.
-func (e *EopkgManager) Init() error {
-	// Ensure dbus pid is gone
-	if PathExists(e.dbusPid) {
-		if err := os.Remove(e.dbusPid); err != nil {
+	if options := EopkgBuildOptions(); len(options) > 0 {
+		if err := e.tuneConf(options); err != nil {
 			return err
 		}
 	}
 
-	if err := e.CopyAssets(); err != nil {
+	if err := e.writeCcacheConf(); err != nil {
 		return err
 	}
 
-	// Ensure system wide cache exists
-	if !PathExists(e.cacheSource) {
-		slog.Debug("Creating system-wide package cache", "path", e.cacheSource)
+	// Never copy the host resolv.conf, it may carry VPN search domains
+	resolvConf := filepath.Join(e.root, "etc/resolv.conf")
 
-		if err := os.MkdirAll(e.cacheSource, 0o0755); err != nil {
-			return fmt.Errorf("Failed to create package cache %s, reason: %w\n", e.cacheSource, err)
-		}
+	// Replace rather than follow any symlink in the image
+	if err := os.Remove(resolvConf); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove %s, reason: %w\n", resolvConf, err)
 	}
 
-	if err := os.MkdirAll(e.cacheTarget, 0o0755); err != nil {
-		return err
+	if err := os.WriteFile(resolvConf, GenerateResolvConf(DNSServers), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write %s, reason: %w\n", resolvConf, err)
 	}
 
-	return disk.GetMountManager().BindMount(e.cacheSource, e.cacheTarget)
+	return nil
 }
 
-// StartDBUS will bring up dbus within the chroot.
-func (e *EopkgManager) StartDBUS() error {
-	if e.dbusActive {
-		return nil
+// tuneConf will set the options in the eopkg.conf within the root.
+func (e *EopkgManager) tuneConf(options []EopkgOption) error {
+	confPath := filepath.Join(e.root, "etc/eopkg/eopkg.conf")
+
+	conf, err := os.ReadFile(confPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read %s, reason: %w\n", confPath, err)
 	}
 
-	dbusDir := filepath.Join(e.root, "run", "dbus")
-	if err := os.MkdirAll(dbusDir, 0o0755); err != nil {
-		return err
+	if err = os.MkdirAll(filepath.Dir(confPath), 0o0755); err != nil {
+		return fmt.Errorf("Failed to create required asset directory %s, reason %w\n", filepath.Dir(confPath), err)
 	}
 
-	if err := ChrootExec(e.notif, e.root, "dbus-uuidgen --ensure"); err != nil {
-		return err
+	if err = os.WriteFile(confPath, SetEopkgBuildOptions(conf, options...), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write %s, reason: %w\n", confPath, err)
 	}
 
-	e.notif.SetActivePID(0)
+	return nil
+}
 
-	if err := ChrootExec(e.notif, e.root, "dbus-daemon --system"); err != nil {
-		return err
+// writeCcacheConf will write the host ccache.conf into the root, with the
+// settings managed by solbuild applied.
+func (e *EopkgManager) writeCcacheConf() error {
+	confPath := filepath.Join(e.root, "etc/ccache/ccache.conf")
+
+	conf, err := os.ReadFile("/etc/ccache/ccache.conf")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read host ccache.conf, reason: %w\n", err)
 	}
 
-	e.notif.SetActivePID(0)
-	e.dbusActive = true
+	if err = os.MkdirAll(filepath.Dir(confPath), 0o0755); err != nil {
+		return fmt.Errorf("Failed to create required asset directory %s, reason %w\n", filepath.Dir(confPath), err)
+	}
+
+	if err = os.WriteFile(confPath, ManagedCcacheConf(conf), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write %s, reason: %w\n", confPath, err)
+	}
 
 	return nil
 }
 
-// StopDBUS will tear down dbus.
-func (e *EopkgManager) StopDBUS() error {
-	// No sense killing dbus twice
-	if !e.dbusActive {
-		return nil
+// Init will do some basic preparation of the chroot.
+func (e *EopkgManager) Init() error {
+	// Ensure dbus pid is gone
+	if PathExists(e.dbus.pidFile) {
+		if err := os.Remove(e.dbus.pidFile); err != nil {
+			return err
+		}
 	}
 
-	var b []byte
+	if err := e.CopyAssets(); err != nil {
+		return err
+	}
 
-	var err error
+	// Ensure system wide cache exists
+	if !PathExists(e.cacheSource) {
+		slog.Debug("Creating system-wide package cache", "path", e.cacheSource)
 
-	var f *os.File
+		if err := os.MkdirAll(e.cacheSource, 0o0755); err != nil {
+			return fmt.Errorf("Failed to create package cache %s, reason: %w\n", e.cacheSource, err)
+		}
+	}
 
-	if f, err = os.Open(e.dbusPid); err != nil {
+	if err := os.MkdirAll(e.cacheTarget, 0o0755); err != nil {
 		return err
 	}
 
-	defer func() {
-		f.Close()
-		os.Remove(e.dbusPid)
-		e.dbusActive = false
-	}()
+	// Protect the shared cache from misbehaving builds
+	if err := e.mountCache(); err != nil {
+		slog.Warn("Unable to mount the package cache read-only, falling back to a read-write bind mount", "err", err)
 
-	if b, err = io.ReadAll(f); err != nil {
-		return err
+		return disk.GetMountManager().BindMount(e.cacheSource, e.cacheTarget)
 	}
 
-	pid := strings.Split(string(b), "\n")[0]
+	return nil
+}
+
+// StartDBUS will bring up dbus within the chroot, or take another reference
+// on the instance if it is already running.
+func (e *EopkgManager) StartDBUS() error {
+	return e.dbus.Acquire(e.notif)
+}
 
-	return commands.ExecStdoutArgs("kill", []string{"-9", pid})
+// StopDBUS will drop a reference on dbus, tearing it down once no phase
+// needs it any longer.
+func (e *EopkgManager) StopDBUS() error {
+	return e.dbus.Release()
 }
 
 // Cleanup will take care of any work we've already done before.
 func (e *EopkgManager) Cleanup() {
-	e.StopDBUS()
+	e.dbus.Stop()
 	disk.GetMountManager().Unmount(e.cacheTarget)
+
+	if e.cacheOverlay {
+		e.cacheOverlay = false
+		e.mergeCache()
+	}
 }
 
 // Upgrade will perform an eopkg upgrade inside the chroot.
@@ -213,73 +238,44 @@ func (e *EopkgManager) Upgrade() error {
 		"sccache",
 	}
 
-	if err := ChrootExec(e.notif, e.root, eopkgCommand(installCommand+" upgrade -y")); err != nil {
+	if err := e.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %w\n", err)
+	}
+	defer e.StopDBUS()
+
+	if err := ChrootExecProgress(e.notif, e.root, "upgrade", eopkgCommand(installCommand+" upgrade -y")); err != nil {
 		return err
 	}
 
 	e.notif.SetActivePID(0)
-	err := ChrootExec(e.notif, e.root, eopkgCommand(fmt.Sprintf("%s install -y %s",
+	err := ChrootExecProgress(e.notif, e.root, "upgrade", eopkgCommand(fmt.Sprintf("%s install -y %s",
 		installCommand, strings.Join(newReqs, " "))))
 
 	return err
 }
 
-// InstallComponent will install the named component inside the chroot.
+// InstallComponent will install the named component inside the chroot, unless
+// it is already installed.
 func (e *EopkgManager) InstallComponent(comp string) error {
-	err := ChrootExec(e.notif, e.root,
-		eopkgCommand(fmt.Sprintf("%s install -y -c %v", installCommand, comp)))
-
-	e.notif.SetActivePID(0)
-
-	return err
-}
-
-// EnsureEopkgLayout will enforce changes to the filesystem to make sure that
-// it works as expected.
-func EnsureEopkgLayout(root string) error {
-	// Ensures we don't end up with /var/lock vs /run/lock nonsense
-	reqDirs := []string{
-		"run/lock",
-		"var",
-		// Enables our bind mounting for caching
-		"var/cache/eopkg/packages",
-	}
-
-	// Now we must nuke /run if it exists inside the chroot!
-	runPath := filepath.Join(root, "run")
-	if PathExists(runPath) {
-		if err := os.RemoveAll(runPath); err != nil {
-			return fmt.Errorf("Failed to clean stale /run, reason: %w\n", err)
-		}
-	}
-
-	if err := os.MkdirAll(runPath, 0o0755); err != nil {
-		return fmt.Errorf("Failed to clean stale /run, reason: %w\n", err)
+	// Skip resolving the component again when it is already satisfied
+	if ok, err := ComponentInstalled(e.root, comp); err != nil {
+		slog.Debug("Unable to check component installation", "component", comp, "err", err)
+	} else if ok {
+		slog.Debug("Component is already installed", "component", comp)
+		return nil
 	}
 
-	// Construct the required directories in the tree
-	for _, dir := range reqDirs {
-		dirPath := filepath.Join(root, dir)
-		if err := os.MkdirAll(dirPath, 0o0755); err != nil {
-			return err
-		}
+	if err := e.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %w\n", err)
 	}
+	defer e.StopDBUS()
 
-	lockTgt := filepath.Join(root, "var", "lock")
-	if !PathExists(lockTgt) {
-		if err := os.Symlink("../run/lock", lockTgt); err != nil {
-			return err
-		}
-	}
+	err := ChrootExecProgress(e.notif, e.root, "component install",
+		eopkgCommand(fmt.Sprintf("%s install -y -c %v", installCommand, comp)))
 
-	runTgt := filepath.Join(root, "var", "run")
-	if !PathExists(runTgt) {
-		if err := os.Symlink("../run", filepath.Join(root, "var", "run")); err != nil {
-			return err
-		}
-	}
+	e.notif.SetActivePID(0)
 
-	return nil
+	return err
 }
 
 // Read the given plaintext URI file to find the target.
@@ -298,8 +294,25 @@ func readURIFile(path string) (string, error) {
 	return string(contents), nil
 }
 
+// InstallDepsCommand will return the ypkg-install-deps command installing
+// the build dependencies of the recipe with eopkg.
+func (e *EopkgManager) InstallDepsCommand(recipe string) (string, error) {
+	cmd := fmt.Sprintf("ypkg-install-deps --eopkg-cmd='%s' -f %s", installCommand, recipe)
+	if DisableColors {
+		cmd += " -n"
+	}
+
+	return cmd, nil
+}
+
+// IndexCommand will return the command generating an unsigned eopkg index
+// of the directory.
+func (e *EopkgManager) IndexCommand(dir string) (string, error) {
+	return fmt.Sprintf("cd %s; %s", dir, eopkgCommand(installCommand+" index --skip-signing .")), nil
+}
+
 // GetRepos will attempt to discover all the repos on the target filesystem.
-func (e *EopkgManager) GetRepos() ([]*EopkgRepo, error) {
+func (e *EopkgManager) GetRepos() ([]*RootRepo, error) {
 	globPat := filepath.Join(e.root, "var", "lib", "eopkg", "index", "*", "uri")
 
 	var repoFiles []string
@@ -312,7 +325,7 @@ func (e *EopkgManager) GetRepos() ([]*EopkgRepo, error) {
 		return nil, nil
 	}
 
-	repos := make([]*EopkgRepo, 0, len(repoFiles))
+	repos := make([]*RootRepo, 0, len(repoFiles))
 
 	for _, repo := range repoFiles {
 		uri, err := readURIFile(repo)
@@ -322,7 +335,7 @@ func (e *EopkgManager) GetRepos() ([]*EopkgRepo, error) {
 		}
 
 		repoName := filepath.Base(filepath.Dir(repo))
-		repos = append(repos, &EopkgRepo{
+		repos = append(repos, &RootRepo{
 			ID:  repoName,
 			URI: uri,
 		})
@@ -334,13 +347,13 @@ func (e *EopkgManager) GetRepos() ([]*EopkgRepo, error) {
 // AddRepo will attempt to add a repo to the filesystem.
 func (e *EopkgManager) AddRepo(id, source string) error {
 	e.notif.SetActivePID(0)
-	return ChrootExec(e.notif, e.root,
+	return ChrootExec(e.notif, e.root, "repos",
 		eopkgCommand(fmt.Sprintf("%s add-repo '%s' '%s'", installCommand, id, source)))
 }
 
 // RemoveRepo will attempt to remove a named repo from the filesystem.
 func (e *EopkgManager) RemoveRepo(id string) error {
 	e.notif.SetActivePID(0)
-	return ChrootExec(e.notif, e.root,
+	return ChrootExec(e.notif, e.root, "repos",
 		eopkgCommand(fmt.Sprintf("%s remove-repo '%s'", installCommand, id)))
 }
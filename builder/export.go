@@ -0,0 +1,162 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/getsolus/solbuild/util"
+)
+
+// A ConfigSnapshot is a normalized record of the effective configuration of
+// solbuild on a host, so that two build machines can be compared to explain
+// why their results differ. Keys follow the names used in the config files.
+type ConfigSnapshot struct {
+	Solbuild *util.VersionInfo          `json:"solbuild"`
+	Config   map[string]any             `json:"config"`
+	Profiles map[string]ProfileSnapshot `json:"profiles"`
+}
+
+// A ProfileSnapshot is the effective state of a single profile.
+type ProfileSnapshot struct {
+	Settings map[string]any `json:"settings"`
+	Image    ImageSnapshot  `json:"image"`
+}
+
+// An ImageSnapshot records which backing image a profile uses, and the hash
+// of the installed copy when known.
+type ImageSnapshot struct {
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"`
+	Hash      string `json:"hash,omitempty"`
+	Source    string `json:"source,omitempty"`
+}
+
+// NewConfigSnapshot will record the given configuration and profiles, along
+// with the state of the images they use. Credentials within proxies are
+// redacted.
+func NewConfigSnapshot(config *Config, profiles map[string]*Profile) *ConfigSnapshot {
+	snapshot := &ConfigSnapshot{
+		Solbuild: util.GetVersionInfo(),
+		Profiles: make(map[string]ProfileSnapshot),
+	}
+
+	c := *config
+	c.Proxy = c.Proxy.redacted()
+	snapshot.Config = snapshotValue(reflect.ValueOf(c)).(map[string]any) //nolint:forcetypeassert // always a struct.
+
+	for name, profile := range profiles {
+		p := *profile
+		if p.Proxy != nil {
+			proxy := p.Proxy.redacted()
+			p.Proxy = &proxy
+		}
+
+		image := NewBackingImage(p.Image)
+		state := ImageSnapshot{
+			Name:      p.Image,
+			Installed: image.IsInstalled(),
+		}
+
+		if meta, err := image.ReadMetadata(); err == nil && meta != nil {
+			state.Hash = meta.Hash
+			state.Source = meta.Source
+		}
+
+		snapshot.Profiles[name] = ProfileSnapshot{
+			Settings: snapshotValue(reflect.ValueOf(p)).(map[string]any), //nolint:forcetypeassert // always a struct.
+			Image:    state,
+		}
+	}
+
+	return snapshot
+}
+
+// ExportConfig will snapshot the effective configuration along with every
+// profile that can be found.
+func (m *Manager) ExportConfig() (*ConfigSnapshot, error) {
+	profiles, err := GetProfilesFromDirs(m.profileSearchDirs())
+	if err != nil {
+		return nil, err
+	}
+
+	return NewConfigSnapshot(m.Config, profiles), nil
+}
+
+// redacted returns a copy of the proxies with any passwords hidden.
+func (p ProxyConfig) redacted() ProxyConfig {
+	redact := func(proxy string) string {
+		if u, err := url.Parse(proxy); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+
+		return proxy
+	}
+
+	p.HTTP = redact(p.HTTP)
+	p.HTTPS = redact(p.HTTPS)
+	p.FTP = redact(p.FTP)
+
+	return p
+}
+
+// snapshotValue converts v to plain values keyed by their toml names, so it
+// encodes the same way however it was configured. Empty lists and tables are
+// kept rather than omitted, so that unset values still show up in a diff.
+func snapshotValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return snapshotValue(v.Elem())
+	case reflect.Struct:
+		ret := make(map[string]any)
+
+		for i := range v.NumField() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("toml"), ",")
+			if name == "" || name == "-" || !v.Type().Field(i).IsExported() {
+				continue
+			}
+
+			ret[name] = snapshotValue(v.Field(i))
+		}
+
+		return ret
+	case reflect.Map:
+		ret := make(map[string]any)
+
+		for _, key := range v.MapKeys() {
+			ret[key.String()] = snapshotValue(v.MapIndex(key))
+		}
+
+		return ret
+	case reflect.Slice, reflect.Array:
+		ret := make([]any, 0, v.Len())
+
+		for i := range v.Len() {
+			ret = append(ret, snapshotValue(v.Index(i)))
+		}
+
+		return ret
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,70 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+)
+
+// ErrOverlayUnsupported is returned when the overlay root is on a filesystem
+// that cannot be used as the upper or work directory of an overlayfs.
+var ErrOverlayUnsupported = errors.New("Filesystem cannot be used for overlayfs")
+
+// overlayUnsupportedFilesystems maps the statfs magic of filesystems known
+// to be unusable as an overlayfs upper layer to a human readable name.
+var overlayUnsupportedFilesystems = map[int64]string{
+	0x2fc12fc1: "zfs",
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x794c7630: "overlayfs",
+	0xf15f:     "ecryptfs",
+}
+
+// existingParent returns the closest ancestor of path that exists, as the
+// overlay root may not have been created yet.
+func existingParent(path string) string {
+	path = filepath.Clean(path)
+
+	for !PathExists(path) && path != "/" {
+		path = filepath.Dir(path)
+	}
+
+	return path
+}
+
+// CheckOverlaySupport will determine whether dir can host the upper and work
+// directories of an overlayfs mount, and explain the alternatives if not.
+func CheckOverlaySupport(dir string) error {
+	var st syscall.Statfs_t
+
+	if err := syscall.Statfs(existingParent(dir), &st); err != nil {
+		return fmt.Errorf("Failed to determine filesystem of %s, reason: %w", dir, err)
+	}
+
+	name, ok := overlayUnsupportedFilesystems[int64(st.Type)] //nolint:unconvert // Type differs per arch
+	if !ok {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s is on %s. Set overlay_root_dir in solbuild.conf(5) to a directory "+
+		"on a local filesystem such as ext4, xfs or btrfs, or build in memory with --tmpfs", ErrOverlayUnsupported, dir, name)
+}
@@ -0,0 +1,203 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImageGenerations is how many previous images to keep as generations when
+// an image is updated, so that builds can be retried against them.
+var ImageGenerations int
+
+// ErrNoGeneration is returned when an image generation does not exist.
+var ErrNoGeneration = errors.New("No such image generation")
+
+// An ImageGeneration is a previous image, kept when it was updated.
+type ImageGeneration struct {
+	ID   string    `json:"id"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"` // When the image was replaced
+}
+
+// GenerationsDir returns the directory holding the generations of the image.
+func (b *BackingImage) GenerationsDir() string {
+	return filepath.Join(ImagesDir, "generations", b.Name)
+}
+
+// Generations will list the stored generations of the image, oldest first.
+func (b *BackingImage) Generations() ([]*ImageGeneration, error) {
+	paths, err := filepath.Glob(filepath.Join(b.GenerationsDir(), "*"+ImageSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	gens := make([]*ImageGeneration, 0, len(paths))
+
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ImageSuffix)
+
+		stamp, err := time.ParseInLocation(buildLogTimeFormat, id, time.UTC)
+		if err != nil {
+			continue
+		}
+
+		gens = append(gens, &ImageGeneration{ID: id, Path: path, Time: stamp})
+	}
+
+	sort.Slice(gens, func(i, j int) bool { return gens[i].Time.Before(gens[j].Time) })
+
+	return gens, nil
+}
+
+// Generation returns the image as it was in the given generation, for use
+// in place of the image itself.
+func (b *BackingImage) Generation(id string) (*BackingImage, error) {
+	path := filepath.Join(b.GenerationsDir(), id+ImageSuffix)
+	if filepath.Base(path) != id+ImageSuffix || !PathExists(path) {
+		return nil, fmt.Errorf("%w: %s of %s", ErrNoGeneration, id, b.Name)
+	}
+
+	gen := *b
+	gen.ImagePath = path
+
+	return &gen, nil
+}
+
+// keepGeneration will keep the current image as a generation, before it is
+// replaced by an update, pruning the oldest beyond ImageGenerations. The
+// image is hard linked, so keeping it costs nothing until it is replaced.
+func (b *BackingImage) keepGeneration() error {
+	if ImageGenerations <= 0 || !b.IsInstalled() {
+		return nil
+	}
+
+	if err := os.MkdirAll(b.GenerationsDir(), 0o755); err != nil {
+		return fmt.Errorf("Failed to create image generations directory, reason: %w\n", err)
+	}
+
+	id := time.Now().UTC().Format(buildLogTimeFormat)
+	path := filepath.Join(b.GenerationsDir(), id+ImageSuffix)
+
+	// Updated twice within a second, so the older image is already kept
+	if PathExists(path) {
+		return nil
+	}
+
+	if err := os.Link(b.ImagePath, path); err != nil {
+		return fmt.Errorf("Failed to keep image generation %s, reason: %w\n", path, err)
+	}
+
+	// Carry the hash over, so the generation need not be hashed again
+	if meta, err := os.ReadFile(b.MetadataPath()); err == nil {
+		if err = os.WriteFile(path+ImageMetadataSuffix, meta, 0o644); err != nil {
+			slog.Warn("Failed to keep image generation metadata", "path", path, "err", err)
+		}
+	}
+
+	slog.Info("Kept previous image as a generation", "image", b.Name, "generation", id)
+
+	gens, err := b.Generations()
+	if err != nil {
+		return err
+	}
+
+	for len(gens) > ImageGenerations {
+		slog.Debug("Removing old image generation", "path", gens[0].Path)
+
+		if err = os.Remove(gens[0].Path); err != nil {
+			return fmt.Errorf("Failed to remove image generation %s, reason: %w\n", gens[0].Path, err)
+		}
+
+		os.Remove(gens[0].Path + ImageMetadataSuffix)
+
+		gens = gens[1:]
+	}
+
+	return nil
+}
+
+// ImagePackages will find the packages installed within the image, mapped
+// to their version and release.
+func (b *BackingImage) ImagePackages() (pkgs map[string]string, err error) {
+	err = b.MountReadOnly(func(root string) error {
+		pkgs, err = InstalledVersions(root)
+		return err
+	})
+
+	return pkgs, err
+}
+
+// A PackageChange is a package which differs between two images. Old is
+// empty for added packages, and New for removed packages.
+type PackageChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// PackageDelta will find the packages which differ between two images, as
+// returned by ImagePackages, sorted by name.
+func PackageDelta(before, after map[string]string) []PackageChange {
+	var delta []PackageChange
+
+	for name, old := range before {
+		if current := after[name]; current != old {
+			delta = append(delta, PackageChange{name, old, current})
+		}
+	}
+
+	for name, current := range after {
+		if _, ok := before[name]; !ok {
+			delta = append(delta, PackageChange{Name: name, New: current})
+		}
+	}
+
+	sort.Slice(delta, func(i, j int) bool { return delta[i].Name < delta[j].Name })
+
+	return delta
+}
+
+// UseImageGeneration will build against a previous generation of the image,
+// rather than the image itself. It must be called before SetPackage.
+func (m *Manager) UseImageGeneration(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.image == nil {
+		return ErrInvalidProfile
+	}
+
+	gen, err := m.image.Generation(id)
+	if err != nil {
+		return err
+	}
+
+	m.image = gen
+
+	// Pooled roots are only ever provisioned from the image itself
+	m.Config.PoolSize = 0
+
+	return nil
+}
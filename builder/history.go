@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -29,6 +30,7 @@ import (
 	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-git/go-billy/v5/helper/chroot"
 	"github.com/go-git/go-git/v5"
@@ -85,6 +87,7 @@ type PackageUpdate struct {
 	Body        string        // The associated message of the commit
 	Time        time.Time     // When the update took place
 	ObjectID    string        // OID stored in string form
+	Order       int           // Position in topological order, 0 is the most recent
 	Package     *Package      // Associated parsed package
 	IsSecurity  bool          // Whether this is a security update
 }
@@ -165,13 +168,14 @@ func NewPackageHistory(repo *git.Repository, pkgfile string) (*PackageHistory, e
 
 	updates := make(map[string]*PackageUpdate)
 
-	for _, ref := range refs {
+	for i, ref := range refs {
 		commit, err := repo.CommitObject(plumbing.NewHash(ref))
 		if err != nil {
 			return nil, fmt.Errorf("unable to resolve commit %q: %w", ref, err)
 		}
 
 		updates[ref] = NewPackageUpdate(commit, ref)
+		updates[ref].Order = i
 	}
 
 	ret := &PackageHistory{pkgfile: rel(repoDir, pkgfile)}
@@ -185,6 +189,47 @@ func NewPackageHistory(repo *git.Repository, pkgfile string) (*PackageHistory, e
 	return ret, nil
 }
 
+// NewPackageHistoryFromFile will load a pre-generated history.xml, such as
+// one produced by a build server's own changelog tooling. The file is
+// validated and normalised so that it is emitted in the same form as a
+// history generated from git.
+func NewPackageHistoryFromFile(path string) (*PackageHistory, error) {
+	by, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ypkg, err := ParseYPKG(by)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load history file %s: %w", path, err)
+	}
+
+	ret := &PackageHistory{pkgfile: path}
+
+	for _, yUpdate := range ypkg.History {
+		when, _ := time.Parse(UpdateDateFormat, yUpdate.Date)
+
+		ret.Updates = append(ret.Updates, &PackageUpdate{
+			Author:      strings.TrimSpace(yUpdate.Name.Value),
+			AuthorEmail: strings.TrimSpace(yUpdate.Email),
+			Body:        yUpdate.Comment.Value,
+			Time:        when,
+			Package: &Package{
+				Version: strings.TrimSpace(yUpdate.Version),
+				Release: yUpdate.Release,
+				Type:    PackageTypeYpkg,
+			},
+			IsSecurity: yUpdate.Type == "security",
+		})
+	}
+
+	if len(ret.Updates) > MaxChangelogEntries {
+		ret.Updates = ret.Updates[:MaxChangelogEntries]
+	}
+
+	return ret, nil
+}
+
 func repoRootDir(repo *git.Repository) string {
 	storer, ok := repo.Storer.(*filesystem.Storage)
 	if !ok {
@@ -213,7 +258,8 @@ func execGit(args ...string) (string, error) {
 }
 
 func gitLog(path string) ([]string, error) {
-	out, err := execGit("-C", path, "log", "--pretty=format:%H", path)
+	// Topological order isn't thrown off by rebased or cherry-picked commits
+	out, err := execGit("-C", path, "log", "--topo-order", "--pretty=format:%H", path)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get Git history: %w", err)
 	}
@@ -252,6 +298,21 @@ func (a SortUpdatesByRelease) Less(i, j int) bool {
 	return a[i].Package.Release < a[j].Package.Release
 }
 
+// TimestampAnomalies returns the updates, ordered newest release first, that
+// have a commit time newer than the update before them, such as rebased or
+// cherry-picked commits with odd timestamps.
+func TimestampAnomalies(updates []*PackageUpdate) []*PackageUpdate {
+	var ret []*PackageUpdate
+
+	for i := 1; i < len(updates); i++ {
+		if updates[i].Time.After(updates[i-1].Time) {
+			ret = append(ret, updates[i])
+		}
+	}
+
+	return ret
+}
+
 // scanUpdates will go back through the collected, "ok" tags, and analyze
 // them to be more useful.
 func (p *PackageHistory) scanUpdates(repo *git.Repository, updates map[string]*PackageUpdate) {
@@ -270,7 +331,9 @@ func (p *PackageHistory) scanUpdates(repo *git.Repository, updates map[string]*P
 			continue
 		}
 
-		if u, ok := updateSet[pkg.Release]; ok && u.Time.Before(update.Time) {
+		// The release is introduced by the topologically oldest commit, as
+		// commit timestamps can't be trusted
+		if u, ok := updateSet[pkg.Release]; ok && u.Order > update.Order {
 			continue
 		}
 
@@ -286,6 +349,15 @@ func (p *PackageHistory) scanUpdates(repo *git.Repository, updates map[string]*P
 
 	sort.Sort(sort.Reverse(updateList))
 
+	if anomalies := TimestampAnomalies(updateList); len(anomalies) > 0 {
+		for _, update := range anomalies {
+			slog.Warn("Commit timestamp is newer than that of a later release", "release", update.Package.Release,
+				"commit", update.ObjectID, "time", update.Time.Format(time.RFC3339))
+		}
+
+		slog.Warn("Changelog is ordered by release, which differs from ordering by commit time")
+	}
+
 	if len(updateList) >= MaxChangelogEntries {
 		p.Updates = updateList[:MaxChangelogEntries]
 	} else {
@@ -313,26 +385,22 @@ type YPKGUpdate struct {
 	Email string `xml:"Email"`
 }
 
-// WriteXML will attempt to dump the update history to an XML file
-// in order for ypkg to merge it into the package build.
-func (p *PackageHistory) WriteXML(path string) error {
-	ypkgUpdates := make([]*YPKGUpdate, 0, len(p.Updates))
+// ErrInvalidHistory is returned when a history.xml would not be accepted by ypkg.
+var ErrInvalidHistory = errors.New("Invalid package history")
 
-	fi, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer fi.Close()
+// ToYPKG will convert the update history into the ypkg history.xml structure.
+func (p *PackageHistory) ToYPKG() *YPKG {
+	ypkgUpdates := make([]*YPKGUpdate, 0, len(p.Updates))
 
 	for _, update := range p.Updates {
 		yUpdate := &YPKGUpdate{
 			Release: update.Package.Release,
-			Version: update.Package.Version,
-			Email:   update.AuthorEmail,
+			Version: sanitizeXMLText(update.Package.Version),
+			Email:   sanitizeXMLText(update.AuthorEmail),
 			Date:    update.Time.Format(UpdateDateFormat),
 		}
-		yUpdate.Comment.Value = update.Body
-		yUpdate.Name.Value = update.Author
+		yUpdate.Comment.Value = sanitizeXMLText(update.Body)
+		yUpdate.Name.Value = sanitizeXMLText(update.Author)
 
 		if update.IsSecurity {
 			yUpdate.Type = "security"
@@ -341,17 +409,108 @@ func (p *PackageHistory) WriteXML(path string) error {
 		ypkgUpdates = append(ypkgUpdates, yUpdate)
 	}
 
-	ypkg := &YPKG{History: ypkgUpdates}
+	return &YPKG{History: ypkgUpdates}
+}
+
+// sanitizeXMLText will ensure s is valid UTF-8 and only contains characters
+// permitted in an XML document. Legitimate Unicode is preserved as-is.
+func sanitizeXMLText(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == 0x09 || r == 0x0A || r == 0x0D:
+			return r
+		case r >= 0x20 && r <= 0xD7FF:
+			return r
+		case r >= 0xE000 && r <= 0xFFFD:
+			return r
+		case r >= 0x10000 && r <= 0x10FFFF:
+			return r
+		default:
+			return -1
+		}
+	}, s)
+}
+
+// Validate will check the history against the invariants that ypkg relies
+// upon when merging it into the package build.
+func (y *YPKG) Validate() error {
+	if len(y.History) < 1 {
+		return fmt.Errorf("%w: no updates", ErrInvalidHistory)
+	}
+
+	for i, update := range y.History {
+		if update.Release < 1 {
+			return fmt.Errorf("%w: update %d has invalid release %d", ErrInvalidHistory, i, update.Release)
+		}
+
+		if i > 0 && update.Release >= y.History[i-1].Release {
+			return fmt.Errorf("%w: release %d is not lower than preceding release %d", ErrInvalidHistory,
+				update.Release, y.History[i-1].Release)
+		}
+
+		if update.Type != "" && update.Type != "security" {
+			return fmt.Errorf("%w: release %d has unknown type %q", ErrInvalidHistory, update.Release, update.Type)
+		}
+
+		if _, err := time.Parse(UpdateDateFormat, update.Date); err != nil {
+			return fmt.Errorf("%w: release %d has invalid date %q", ErrInvalidHistory, update.Release, update.Date)
+		}
+
+		if strings.TrimSpace(update.Version) == "" {
+			return fmt.Errorf("%w: release %d is missing a version", ErrInvalidHistory, update.Release)
+		}
+
+		if strings.TrimSpace(update.Name.Value) == "" {
+			return fmt.Errorf("%w: release %d is missing an author name", ErrInvalidHistory, update.Release)
+		}
+
+		if !utf8.ValidString(update.Comment.Value) || !utf8.ValidString(update.Name.Value) {
+			return fmt.Errorf("%w: release %d contains invalid UTF-8", ErrInvalidHistory, update.Release)
+		}
+	}
+
+	return nil
+}
+
+// Bytes will validate and serialise the history into a UTF-8 history.xml.
+func (y *YPKG) Bytes() ([]byte, error) {
+	if err := y.Validate(); err != nil {
+		return nil, err
+	}
+
+	bytes, err := xml.MarshalIndent(y, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), bytes...), nil
+}
+
+// ParseYPKG will parse and validate an existing history.xml.
+func ParseYPKG(by []byte) (*YPKG, error) {
+	ypkg := &YPKG{}
+	if err := xml.Unmarshal(by, ypkg); err != nil {
+		return nil, err
+	}
 
-	bytes, err := xml.MarshalIndent(ypkg, "", "    ")
+	if err := ypkg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return ypkg, nil
+}
+
+// WriteXML will attempt to dump the update history to an XML file
+// in order for ypkg to merge it into the package build.
+func (p *PackageHistory) WriteXML(path string) error {
+	bytes, err := p.ToYPKG().Bytes()
 	if err != nil {
 		return err
 	}
 
-	// Dump it to the file
-	_, err = fi.Write(bytes)
-
-	return err
+	return os.WriteFile(path, bytes, 0o0644)
 }
 
 // GetLastVersionTimestamp will return a timestamp appropriate for us within
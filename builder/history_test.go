@@ -0,0 +1,227 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+const (
+	HistoryTestFile = "testdata/history.xml"
+)
+
+func testHistory() *builder.PackageHistory {
+	return &builder.PackageHistory{
+		Updates: []*builder.PackageUpdate{
+			{
+				Author:      "Jérôme Ångström",
+				AuthorEmail: "jerome@example.com",
+				// The BEL control character is not permitted in XML and must be dropped
+				Body:       "Fix CVE-2024-1234 in the ]]> parser\a\n\nReported by 李小龍",
+				Time:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				Package:    &builder.Package{Release: 3, Version: "1.2.0"},
+				IsSecurity: true,
+			},
+			{
+				Author:      "Jane Doe",
+				AuthorEmail: "jane@example.com",
+				Body:        "Rebuild against <new> libfoo & friends",
+				Time:        time.Date(2024, 4, 12, 12, 0, 0, 0, time.UTC),
+				Package:     &builder.Package{Release: 2, Version: "1.2.0"},
+			},
+		},
+	}
+}
+
+func TestHistoryGolden(t *testing.T) {
+	golden, err := os.ReadFile(HistoryTestFile)
+	if err != nil {
+		t.Fatalf("Failed to read golden history: %v", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "history.xml")
+	if err = testHistory().WriteXML(out); err != nil {
+		t.Fatalf("Failed to write known good history: %v", err)
+	}
+
+	written, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read written history: %v", err)
+	}
+
+	if !bytes.Equal(bytes.TrimSpace(written), bytes.TrimSpace(golden)) {
+		t.Fatalf("history.xml does not match golden file:\n%s", written)
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	want := testHistory().ToYPKG()
+
+	by, err := want.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to serialise known good history: %v", err)
+	}
+
+	got, err := builder.ParseYPKG(by)
+	if err != nil {
+		t.Fatalf("Failed to parse serialised history: %v", err)
+	}
+
+	if len(got.History) != len(want.History) {
+		t.Fatalf("Wrong number of updates: %d vs expected %d", len(got.History), len(want.History))
+	}
+
+	for i := range want.History {
+		if *got.History[i] != *want.History[i] {
+			t.Fatalf("Update %d did not survive round trip: %+v vs expected %+v", i, got.History[i], want.History[i])
+		}
+	}
+
+	if name := got.History[0].Name.Value; name != "Jérôme Ångström" {
+		t.Fatalf("Unicode author name was mangled: %s", name)
+	}
+}
+
+func TestHistoryValidate(t *testing.T) {
+	ypkg := testHistory().ToYPKG()
+	ypkg.History[1].Release = 3
+
+	if err := ypkg.Validate(); !errors.Is(err, builder.ErrInvalidHistory) {
+		t.Fatalf("Should not accept non-decreasing releases: %v", err)
+	}
+
+	ypkg = testHistory().ToYPKG()
+	ypkg.History[0].Date = "01/05/2024"
+
+	if err := ypkg.Validate(); !errors.Is(err, builder.ErrInvalidHistory) {
+		t.Fatalf("Should not accept malformed dates: %v", err)
+	}
+}
+
+func TestHistoryFromFile(t *testing.T) {
+	history, err := builder.NewPackageHistoryFromFile(HistoryTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load known good history file: %v", err)
+	}
+
+	if len(history.Updates) != 2 {
+		t.Fatalf("Invalid number of updates: %d vs expected 2", len(history.Updates))
+	}
+
+	if !history.Updates[0].IsSecurity || history.Updates[1].IsSecurity {
+		t.Fatal("Security updates not preserved")
+	}
+
+	// The loaded history must be emitted unchanged
+	out := filepath.Join(t.TempDir(), "history.xml")
+	if err = history.WriteXML(out); err != nil {
+		t.Fatalf("Failed to write loaded history: %v", err)
+	}
+
+	golden, _ := os.ReadFile(HistoryTestFile)
+	written, _ := os.ReadFile(out)
+
+	if !bytes.Equal(bytes.TrimSpace(written), bytes.TrimSpace(golden)) {
+		t.Fatalf("Loaded history was not normalised to golden file:\n%s", written)
+	}
+}
+
+func TestTimestampAnomalies(t *testing.T) {
+	updates := testHistory().Updates
+	if anomalies := builder.TimestampAnomalies(updates); len(anomalies) != 0 {
+		t.Fatalf("Expected no anomalies, got %d", len(anomalies))
+	}
+
+	// A rebased commit for an older release carrying a newer timestamp
+	updates[1].Time = updates[0].Time.Add(time.Hour)
+
+	if anomalies := builder.TimestampAnomalies(updates); len(anomalies) != 1 || anomalies[0] != updates[1] {
+		t.Fatalf("Expected the older release to be flagged, got %v", anomalies)
+	}
+}
+
+// commitRelease commits a package.yml with the given release and author date.
+func commitRelease(t *testing.T, dir string, release int, comment, date string) {
+	t.Helper()
+
+	recipe := fmt.Sprintf("name: skew\nversion: 1.0\nrelease: %d\n# %s\n", release, comment)
+	if err := os.WriteFile(filepath.Join(dir, "package.yml"), []byte(recipe), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"add", "package.yml"}, {"commit", "-q", "-m", comment}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date,
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+}
+
+func TestHistoryClockSkew(t *testing.T) {
+	dir := t.TempDir()
+
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, out)
+	}
+
+	commitRelease(t, dir, 1, "Initial release", "2024-01-01T12:00:00Z")
+	commitRelease(t, dir, 2, "Update to 1.0", "2024-03-01T12:00:00Z")
+	// Cherry-picked with an old timestamp, but doesn't bump the release
+	commitRelease(t, dir, 2, "Fix a typo", "2023-06-01T12:00:00Z")
+	commitRelease(t, dir, 3, "Rebuild", "2024-04-01T12:00:00Z")
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("Failed to open repo: %v", err)
+	}
+
+	history, err := builder.NewPackageHistory(repo, filepath.Join(dir, "package.yml"))
+	if err != nil {
+		t.Fatalf("Failed to generate history: %v", err)
+	}
+
+	var releases []int
+	for _, update := range history.Updates {
+		releases = append(releases, update.Package.Release)
+	}
+
+	if fmt.Sprint(releases) != "[3 2 1]" {
+		t.Fatalf("Expected history ordered by release, got %v", releases)
+	}
+
+	// The release is introduced by the first commit for it, not the oldest timestamp
+	if body := strings.TrimSpace(history.Updates[1].Body); body != "Update to 1.0" {
+		t.Fatalf("Expected release 2 from the commit introducing it, got %q", body)
+	}
+}
@@ -0,0 +1,163 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// HomeArchiveSuffix is appended to the build log path, minus its extension,
+// to name the archive of the build user's home captured on failure.
+const HomeArchiveSuffix = ".home.tar.gz"
+
+var (
+	// IsolateHome will give the build user a fresh tmpfs home, so that
+	// nothing written there by the image or earlier steps leaks into the build.
+	IsolateHome = false
+
+	// CaptureHome will archive the build user's home alongside the build log
+	// when a build fails, for inspection.
+	CaptureHome = false
+)
+
+// homeDir returns the build user's home within the root.
+func (o *Overlay) homeDir() string {
+	return filepath.Join(o.MountPoint, BuildUserHome[1:])
+}
+
+// MountHome will mount a fresh tmpfs over the build user's home. This must be
+// done before anything is placed there, as the caches, state and sources are
+// bound on top of it later. The tmpfs is bounded by the tmpfs size, if set.
+func (o *Overlay) MountHome() error {
+	target, err := o.secureDir(o.homeDir(), 0o0755)
+	if err != nil {
+		return fmt.Errorf("Failed to create home directory %s, reason: %w\n", target, err)
+	}
+
+	var options []string
+	if o.TmpfsSize != "" {
+		options = append(options, fmt.Sprintf("size=%s", o.TmpfsSize))
+	}
+
+	options = append(options,
+		"mode=0755",
+		fmt.Sprintf("uid=%d", BuildUserID),
+		fmt.Sprintf("gid=%d", BuildUserGID))
+
+	slog.Debug("Mounting home tmpfs", "dir", target, "size", o.TmpfsSize)
+
+	if err := disk.GetMountManager().Mount("tmpfs-home", target, "tmpfs", options...); err != nil {
+		return fmt.Errorf("Failed to mount home tmpfs, reason: %w\n", err)
+	}
+
+	o.ExtraMounts = append(o.ExtraMounts, target)
+	o.mountedHome = true
+
+	return nil
+}
+
+// ArchiveHome will store the build user's home as a compressed tarball at
+// path. Only the home itself is archived, leaving out the caches, state and
+// sources bound into it.
+func (o *Overlay) ArchiveHome(path string) error {
+	out, err := exec.Command("tar", "--one-file-system", "-C", o.homeDir(), "-czf", path, ".").CombinedOutput()
+	if err != nil {
+		os.Remove(path)
+
+		return fmt.Errorf("Failed to archive home directory, reason: %w: %s\n", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// ChownTree will give the build user ownership of everything beneath root,
+// returning how many entries were changed. Unlike chown -R, entries already
+// owned by the build user are left untouched, so that overlayfs need not
+// copy them up, and other filesystems mounted within, such as the caches,
+// keep the ownership of their contents. Symbolic links are never followed.
+func ChownTree(root string) (int, error) {
+	st, err := os.Lstat(root)
+	if err != nil {
+		return 0, err
+	}
+
+	rootStat, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("Unable to find the filesystem of %s", root)
+	}
+
+	changed := 0
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("Unable to find the owner of %s", path)
+		}
+
+		if int(stat.Uid) != BuildUserID || int(stat.Gid) != BuildUserGID {
+			if err = os.Lchown(path, BuildUserID, BuildUserGID); err != nil {
+				return err
+			}
+
+			changed++
+		}
+
+		// Only the root of another filesystem is changed
+		if d.IsDir() && stat.Dev != rootStat.Dev {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// chownHome will give the build user ownership of its home, before the
+// sources are brought up.
+func (o *Overlay) chownHome() error {
+	started := time.Now()
+	defer func() { Timings.Record("chown home", time.Since(started)) }()
+
+	changed, err := ChownTree(o.homeDir())
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Set home directory ownership", "changed", changed)
+
+	return nil
+}
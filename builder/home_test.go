@@ -0,0 +1,124 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestArchiveHome(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, builder.BuildUserHome[1:])
+
+	if err := os.MkdirAll(filepath.Join(home, ".config"), 0o755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".config", "junk"), []byte("junk"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	overlay := &builder.Overlay{MountPoint: root}
+	archive := filepath.Join(t.TempDir(), "nano"+builder.HomeArchiveSuffix)
+
+	if err := overlay.ArchiveHome(archive); err != nil {
+		t.Fatalf("Failed to archive home: %v", err)
+	}
+
+	out, err := exec.Command("tar", "-tzf", archive).Output()
+	if err != nil {
+		t.Fatalf("Failed to list archive: %v", err)
+	}
+
+	if !strings.Contains(string(out), "./.config/junk") {
+		t.Fatalf("Expected home contents in archive, got: %s", out)
+	}
+
+	overlay.MountPoint = filepath.Join(root, "missing")
+	if err = overlay.ArchiveHome(archive); err == nil {
+		t.Fatal("Archived a missing home")
+	}
+
+	if _, err = os.Stat(archive); !os.IsNotExist(err) {
+		t.Fatalf("Expected failed archive to be removed, got: %v", err)
+	}
+}
+
+func TestChownTree(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Changing ownership requires root")
+	}
+
+	outside := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(outside, []byte("root"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, "work", "files"), 0o755); err != nil {
+		t.Fatalf("Failed to create home: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, "work", "files", "fix.patch"), []byte("patch"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := os.Symlink(outside, filepath.Join(home, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	changed, err := builder.ChownTree(home)
+	if err != nil {
+		t.Fatalf("Failed to chown home: %v", err)
+	}
+
+	if changed != 5 {
+		t.Fatalf("Expected 5 entries to be changed, got: %d", changed)
+	}
+
+	owner := func(path string) uint32 {
+		st, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", path, err)
+		}
+
+		if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+			return sys.Uid
+		}
+
+		return 0
+	}
+
+	if owner(filepath.Join(home, "work", "files", "fix.patch")) != uint32(builder.BuildUserID) {
+		t.Fatal("Expected file to be owned by the build user")
+	}
+
+	if owner(outside) != 0 {
+		t.Fatal("Followed a symbolic link out of the home")
+	}
+
+	if changed, err = builder.ChownTree(home); err != nil || changed != 0 {
+		t.Fatalf("Expected nothing to change the second time, got: %d %v", changed, err)
+	}
+}
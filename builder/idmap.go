@@ -0,0 +1,138 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// UseIDMap will expose the sources and caches to the build with idmapped
+// mounts when the kernel supports them, so that the build user sees them as
+// its own without the host directories being chowned.
+var UseIDMap = true
+
+// ErrIDMapUnsupported is returned when idmapped mounts cannot be used.
+var ErrIDMapUnsupported = errors.New("idmapped mounts are not supported")
+
+// buildUserNamespace will create a user namespace mapping root within it to
+// the build user, held open by the returned file. An idmapped mount treats
+// the owners on disk as IDs within the namespace, so files owned by root on
+// the host appear to be owned by the build user.
+func buildUserNamespace() (*os.File, error) {
+	c := exec.Command("sleep", "infinity")
+	c.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: BuildUserID, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: BuildUserGID, Size: 1}},
+	}
+
+	if err := c.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to create user namespace, reason: %w", err)
+	}
+
+	defer func() {
+		_ = c.Process.Kill()
+		_ = c.Wait()
+	}()
+
+	return os.Open(fmt.Sprintf("/proc/%d/ns/user", c.Process.Pid))
+}
+
+// IDMapBindMount will bind mount source at target, with the files owned by
+// root on the host appearing to be owned by the build user, and the files
+// created by the build user being owned by root on the host.
+func IDMapBindMount(source, target string, readOnly bool) error {
+	if !UseIDMap || !Probe().IDMappedMounts {
+		return ErrIDMapUnsupported
+	}
+
+	userns, err := buildUserNamespace()
+	if err != nil {
+		return err
+	}
+	defer userns.Close()
+
+	tree, err := unix.OpenTree(unix.AT_FDCWD, source, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("Failed to clone mount of %s, reason: %w", source, err)
+	}
+	defer unix.Close(tree)
+
+	attr := &unix.MountAttr{
+		Attr_set:  unix.MOUNT_ATTR_IDMAP,
+		Userns_fd: uint64(userns.Fd()),
+	}
+
+	if readOnly {
+		attr.Attr_set |= unix.MOUNT_ATTR_RDONLY
+	}
+
+	if err = unix.MountSetattr(tree, "", unix.AT_EMPTY_PATH, attr); err != nil {
+		return fmt.Errorf("Failed to idmap mount of %s, reason: %w", source, err)
+	}
+
+	if err = unix.MoveMount(tree, "", unix.AT_FDCWD, target, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+		return fmt.Errorf("Failed to attach mount at %s, reason: %w", target, err)
+	}
+
+	return nil
+}
+
+// unmountMapped will detach an idmapped mount, which is unknown to the mount
+// manager.
+func unmountMapped(target string) {
+	if err := unix.Unmount(target, 0); err != nil {
+		if err = unix.Unmount(target, unix.MNT_DETACH); err != nil {
+			slog.Warn("Failed to unmount", "target", target, "err", err)
+		}
+	}
+}
+
+// bindMapped will try to bind mount source at target with an idmapped
+// mount, returning whether it was mounted. Sources not owned by root on the
+// host are never idmapped, as they would not appear to be owned by the build
+// user, and the caller falls back to a plain bind mount.
+func (o *Overlay) bindMapped(source, target string, readOnly bool) bool {
+	st, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+
+	if sys, ok := st.Sys().(*syscall.Stat_t); !ok || sys.Uid != 0 {
+		return false
+	}
+
+	if err = IDMapBindMount(source, target, readOnly); err != nil {
+		if !errors.Is(err, ErrIDMapUnsupported) {
+			slog.Debug("Falling back to a plain bind mount", "target", target, "err", err)
+		}
+
+		return false
+	}
+
+	o.ExtraMounts = append(o.ExtraMounts, target)
+	o.mappedMounts = append(o.mappedMounts, target)
+
+	return true
+}
@@ -0,0 +1,71 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestIDMapBindMount(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Mounting requires root")
+	}
+
+	source := t.TempDir()
+	target := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(source, "nano.tar.xz"), []byte("source"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := builder.IDMapBindMount(source, target, true); err != nil {
+		if errors.Is(err, builder.ErrIDMapUnsupported) {
+			t.Skip("Idmapped mounts are not supported")
+		}
+
+		t.Fatalf("Failed to mount: %v", err)
+	}
+
+	t.Cleanup(func() { _ = syscall.Unmount(target, syscall.MNT_DETACH) })
+
+	st, err := os.Stat(filepath.Join(target, "nano.tar.xz"))
+	if err != nil {
+		t.Fatalf("Failed to stat mounted file: %v", err)
+	}
+
+	if sys, ok := st.Sys().(*syscall.Stat_t); !ok || sys.Uid != uint32(builder.BuildUserID) || sys.Gid != uint32(builder.BuildUserGID) {
+		t.Fatalf("Expected file to be owned by the build user, got: %+v", st.Sys())
+	}
+
+	if err = os.WriteFile(filepath.Join(target, "new"), nil, 0o644); err == nil {
+		t.Fatal("Wrote to a read-only mount")
+	}
+
+	builder.UseIDMap = false
+
+	t.Cleanup(func() { builder.UseIDMap = true })
+
+	if err = builder.IDMapBindMount(source, t.TempDir(), true); !errors.Is(err, builder.ErrIDMapUnsupported) {
+		t.Fatalf("Expected ErrIDMapUnsupported when disabled, got: %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/cheggaaa/pb/v3"
+
+	"github.com/getsolus/solbuild/util"
+)
+
+const (
+	// partialSuffix marks a download or decompression that hasn't completed.
+	partialSuffix = ".part"
+
+	// checksumSuffix is appended to the image URI to find its sha256sum.
+	checksumSuffix = ".sha256sum"
+
+	// updateSuffix marks the copy of an image being updated.
+	updateSuffix = ".update"
+
+	// sourceSuffix is appended to the compressed image to record the URI it
+	// was fetched from, until it is installed.
+	sourceSuffix = ".source"
+)
+
+// ErrImageCorrupt is returned when a fetched image fails verification.
+var ErrImageCorrupt = errors.New("Image failed verification")
+
+// ErrImageUnverified is returned when an image fetched from a mirror cannot
+// be checked against the checksum published by ImageURI.
+var ErrImageUnverified = errors.New("Image from mirror cannot be verified without the checksum of its origin")
+
+// partialPath returns the in-progress path for the given file.
+func partialPath(path string) string {
+	return path + partialSuffix
+}
+
+// ValidateMirrors will ensure each of the image mirrors is an HTTP or HTTPS
+// URL.
+func ValidateMirrors(mirrors []string) error {
+	for _, mirror := range mirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid image mirror %q, must be a URL such as https://mirror.example.com/solbuild", mirror)
+		}
+	}
+
+	return nil
+}
+
+// SetMirrors will fetch the image from each of the mirrors in turn, before
+// falling back to ImageURI. Each mirror is the base URI of a directory
+// laid out the same as ImageBaseURI.
+func (b *BackingImage) SetMirrors(mirrors []string) {
+	b.Mirrors = nil
+
+	for _, mirror := range mirrors {
+		b.Mirrors = append(b.Mirrors, fmt.Sprintf("%s/%s%s", strings.TrimSuffix(mirror, "/"), b.Name, ImageCompressedSuffix))
+	}
+}
+
+// FetchURIs returns the URIs the image may be fetched from, in the order
+// they are tried.
+func (b *BackingImage) FetchURIs() []string {
+	return append(slices.Clone(b.Mirrors), b.ImageURI)
+}
+
+// fetchImageChecksum will fetch the published sha256sum of the image, if
+// there is one.
+func fetchImageChecksum(ctx context.Context, uri string) string {
+	resp, err := httpGetContext(ctx, uri+checksumSuffix)
+	if err != nil {
+		slog.Debug("No checksum published for image", "uri", uri, "reason", err)
+		return ""
+	}
+	defer resp.Body.Close()
+
+	by, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return ""
+	}
+
+	// Same format as sha256sum(1), the hash followed by the file name
+	if fields := strings.Fields(string(by)); len(fields) > 0 && sha256Regex.MatchString(fields[0]) {
+		return strings.ToLower(fields[0])
+	}
+
+	return ""
+}
+
+// Fetch will download the compressed image from the first of its mirrors
+// that serves it, resuming a previously interrupted download if possible.
+// The image is only moved into place once it has been fully downloaded and
+// verified, and the URI it was fetched from is recorded in its metadata.
+// Cancelling ctx will abandon the download, which may later be resumed.
+func (b *BackingImage) Fetch(ctx context.Context) error {
+	var errs []error
+
+	for _, uri := range b.FetchURIs() {
+		err := b.fetchFrom(ctx, uri)
+		if err == nil {
+			slog.Info("Fetched image", "image", b.Name, "uri", uri)
+
+			if err = os.WriteFile(b.ImagePathXZ+sourceSuffix, []byte(uri), 0o0644); err != nil {
+				slog.Warn("Failed to record image source", "err", err)
+			}
+
+			return nil
+		}
+
+		if uri != b.ImageURI {
+			slog.Warn("Failed to fetch image from mirror", "uri", uri, "err", err)
+		}
+
+		errs = append(errs, err)
+
+		// No sense trying the next mirror
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// fetchFrom will download the compressed image from the given URI.
+func (b *BackingImage) fetchFrom(ctx context.Context, uri string) error {
+	part := partialPath(b.ImagePathXZ)
+
+	var offset int64
+	if st, err := os.Stat(part); err == nil {
+		offset = st.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", "solbuild/"+util.SolbuildVersion)
+
+	if offset > 0 {
+		slog.Info("Resuming interrupted image download", "offset", offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch image %s, reason: %w", uri, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Server doesn't support resuming, start over
+		flags |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Already have the whole file
+		return b.completeFetch(ctx, part, uri)
+	default:
+		return fmt.Errorf("Failed to fetch image %s, unexpected status: %s", uri, resp.Status)
+	}
+
+	file, err := os.OpenFile(part, flags, 0o0644)
+	if err != nil {
+		return fmt.Errorf("Failed to create file %s, reason: %w", part, err)
+	}
+	defer file.Close()
+
+	bar := pb.New64(offset+resp.ContentLength).Set(pb.Bytes, true)
+	bar.SetCurrent(offset)
+	bar.Start()
+
+	_, err = io.Copy(file, bar.NewProxyReader(resp.Body))
+
+	bar.Finish()
+
+	if err != nil {
+		return fmt.Errorf("Failed to fetch image %s, reason: %w. Run init again to resume", uri, err)
+	}
+
+	if resp.ContentLength >= 0 {
+		if st, statErr := file.Stat(); statErr == nil && st.Size() != offset+resp.ContentLength {
+			return fmt.Errorf("Incomplete image download, got %d of %d bytes. Run init again to resume",
+				st.Size(), offset+resp.ContentLength)
+		}
+	}
+
+	return b.completeFetch(ctx, part, uri)
+}
+
+// completeFetch verifies the image downloaded from uri and moves it into
+// place.
+func (b *BackingImage) completeFetch(ctx context.Context, part, uri string) error {
+	if err := b.verifyImage(ctx, part, uri); err != nil {
+		os.Remove(part)
+		return err
+	}
+
+	return os.Rename(part, b.ImagePathXZ)
+}
+
+// verifyImage will check the compressed image fetched from uri against the
+// checksum published alongside ImageURI, never that of a mirror, which could
+// simply publish the checksum of whatever it serves. Only images fetched
+// from ImageURI itself fall back to an integrity test of the archive.
+func (b *BackingImage) verifyImage(ctx context.Context, path, uri string) error {
+	if expected := fetchImageChecksum(ctx, b.ImageURI); expected != "" {
+		sum, err := FileSha256sum(path)
+		if err != nil {
+			return err
+		}
+
+		if sum != expected {
+			return fmt.Errorf("%w: checksum %s does not match %s", ErrImageCorrupt, sum, expected)
+		}
+
+		return nil
+	}
+
+	if uri != b.ImageURI {
+		return fmt.Errorf("%w: %s", ErrImageUnverified, b.ImageURI+checksumSuffix)
+	}
+
+	slog.Debug("Testing image integrity", "path", path)
+
+	if out, err := exec.Command("xz", "-t", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", ErrImageCorrupt, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Decompress will decompress the fetched image into place. The compressed
+// image is only removed once decompression has completed, so that an
+// interrupted decompression can simply be retried.
+func (b *BackingImage) Decompress() error {
+	part := partialPath(b.ImagePath)
+
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := exec.Command("xz", "-d", "-c", "-T0", b.ImagePathXZ)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stdout
+
+	if err = cmd.Run(); err != nil {
+		os.Remove(part)
+
+		// Most likely a corrupt download, so fetch it again next time
+		os.Remove(b.ImagePathXZ)
+
+		return fmt.Errorf("%w: failed to decompress %s, reason: %w. Run init again to refetch it",
+			ErrImageCorrupt, b.ImagePathXZ, err)
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(part, b.ImagePath); err != nil {
+		return err
+	}
+
+	if err = os.Remove(b.ImagePathXZ); err != nil {
+		return err
+	}
+
+	if err = b.RecordHash(); err != nil {
+		return err
+	}
+
+	os.Remove(b.ImagePathXZ + sourceSuffix)
+
+	return nil
+}
@@ -0,0 +1,297 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// serveImage serves an image and its checksum, supporting range requests.
+func serveImage(t *testing.T, image []byte, checksum string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha256sum") {
+			w.Write([]byte(checksum + "  test.img.xz\n"))
+			return
+		}
+
+		http.ServeContent(w, r, "test.img.xz", time.Time{}, bytes.NewReader(image))
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func testImage(t *testing.T, uri string) *builder.BackingImage {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	return &builder.BackingImage{
+		Name:        "test",
+		ImagePath:   filepath.Join(dir, "test.img"),
+		ImagePathXZ: filepath.Join(dir, "test.img.xz"),
+		ImageURI:    uri + "/test.img.xz",
+	}
+}
+
+func TestImageFetchResume(t *testing.T) {
+	image := bytes.Repeat([]byte("solbuild"), 4096)
+	sum := sha256.Sum256(image)
+	srv := serveImage(t, image, hex.EncodeToString(sum[:]))
+	bk := testImage(t, srv.URL)
+
+	// Simulate an interrupted download
+	if err := os.WriteFile(bk.ImagePathXZ+".part", image[:1000], 0o0644); err != nil {
+		t.Fatalf("Failed to write partial image: %v", err)
+	}
+
+	if bk.IsFetched() {
+		t.Fatal("Partial image should not count as fetched")
+	}
+
+	if err := bk.Fetch(context.Background()); err != nil {
+		t.Fatalf("Failed to resume image download: %v", err)
+	}
+
+	got, err := os.ReadFile(bk.ImagePathXZ)
+	if err != nil {
+		t.Fatalf("Failed to read fetched image: %v", err)
+	}
+
+	if !bytes.Equal(got, image) {
+		t.Fatalf("Resumed image is corrupt, got %d bytes", len(got))
+	}
+
+	if builder.PathExists(bk.ImagePathXZ + ".part") {
+		t.Fatal("Partial image left behind")
+	}
+}
+
+func TestImageFetchCorrupt(t *testing.T) {
+	image := bytes.Repeat([]byte("solbuild"), 4096)
+	srv := serveImage(t, image, strings.Repeat("0", 64))
+	bk := testImage(t, srv.URL)
+
+	if err := bk.Fetch(context.Background()); !errors.Is(err, builder.ErrImageCorrupt) {
+		t.Fatalf("Fetched image with wrong checksum: %v", err)
+	}
+
+	if bk.IsFetched() || builder.PathExists(bk.ImagePathXZ+".part") {
+		t.Fatal("Corrupt image left behind")
+	}
+}
+
+func TestImageDecompressCorrupt(t *testing.T) {
+	bk := testImage(t, "")
+
+	if err := os.WriteFile(bk.ImagePathXZ, []byte("not an xz archive"), 0o0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	if err := bk.Decompress(); !errors.Is(err, builder.ErrImageCorrupt) {
+		t.Fatalf("Decompressed corrupt image: %v", err)
+	}
+
+	if bk.IsInstalled() || bk.IsFetched() {
+		t.Fatal("Corrupt image left behind")
+	}
+}
+
+func TestImageVerify(t *testing.T) {
+	bk := testImage(t, "")
+
+	if err := os.WriteFile(bk.ImagePath, bytes.Repeat([]byte("solbuild"), 4096), 0o0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	// Images without a recorded hash are trusted as they are
+	if err := bk.Verify(0, true); err != nil {
+		t.Fatalf("Failed to record hash of existing image: %v", err)
+	}
+
+	if meta, err := bk.ReadMetadata(); err != nil || meta == nil || meta.Hash == "" {
+		t.Fatalf("Image hash was not recorded: %v", err)
+	}
+
+	if err := bk.Verify(0, true); err != nil {
+		t.Fatalf("Failed to verify intact image: %v", err)
+	}
+
+	// Damage the image in place
+	f, err := os.OpenFile(bk.ImagePath, os.O_WRONLY, 0o0644)
+	if err != nil {
+		t.Fatalf("Failed to open image: %v", err)
+	}
+
+	f.WriteAt([]byte("rot"), 100)
+	f.Close()
+
+	if err = bk.Verify(time.Hour, false); err != nil {
+		t.Fatalf("Verified image before it was due: %v", err)
+	}
+
+	if err = bk.Verify(0, true); !errors.Is(err, builder.ErrImageCorrupt) {
+		t.Fatalf("Expected damaged image to fail verification, got %v", err)
+	}
+}
+
+func TestImageFetchMirrors(t *testing.T) {
+	image := bytes.Repeat([]byte("solbuild"), 4096)
+	sum := sha256.Sum256(image)
+	checksum := hex.EncodeToString(sum[:])
+	srv := serveImage(t, image, checksum)
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(missing.Close)
+
+	// The origin publishes the checksum, but cannot serve the image itself
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".sha256sum") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(checksum + "  test.img.xz\n"))
+	}))
+	t.Cleanup(origin.Close)
+
+	bk := testImage(t, origin.URL)
+	bk.SetMirrors([]string{missing.URL + "/", srv.URL})
+
+	if uris := bk.FetchURIs(); len(uris) != 3 || uris[1] != srv.URL+"/test.img.xz" || uris[2] != bk.ImageURI {
+		t.Fatalf("Unexpected fetch order: %v", uris)
+	}
+
+	if err := bk.Fetch(context.Background()); err != nil {
+		t.Fatalf("Failed to fetch image from mirror: %v", err)
+	}
+
+	// Stand in for decompressing the image
+	if err := os.WriteFile(bk.ImagePath, image, 0o0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	if err := bk.RecordHash(); err != nil {
+		t.Fatalf("Failed to record hash: %v", err)
+	}
+
+	meta, err := bk.ReadMetadata()
+	if err != nil || meta == nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+
+	if meta.Source != srv.URL+"/test.img.xz" {
+		t.Fatalf("Wrong image source recorded: %q", meta.Source)
+	}
+
+	// The source survives the image being updated once installed
+	os.Remove(bk.ImagePathXZ + ".source")
+
+	if err = bk.RecordHash(); err != nil {
+		t.Fatalf("Failed to record hash: %v", err)
+	}
+
+	if meta, _ = bk.ReadMetadata(); meta.Source != srv.URL+"/test.img.xz" {
+		t.Fatalf("Image source was lost: %q", meta.Source)
+	}
+
+	bk.SetMirrors(nil)
+
+	if err = bk.Fetch(context.Background()); err == nil {
+		t.Fatal("Fetched image from a missing server")
+	}
+
+	// A mirror publishing the checksum of a tampered image is not trusted
+	tampered := bytes.Repeat([]byte("tampered"), 4096)
+	tamperedSum := sha256.Sum256(tampered)
+	evil := serveImage(t, tampered, hex.EncodeToString(tamperedSum[:]))
+
+	bk = testImage(t, origin.URL)
+	bk.SetMirrors([]string{evil.URL})
+
+	if err = bk.Fetch(context.Background()); !errors.Is(err, builder.ErrImageCorrupt) {
+		t.Fatalf("Expected a tampered mirror to fail verification, got %v", err)
+	}
+
+	// Nor is a mirror when the origin publishes no checksum at all
+	bk = testImage(t, missing.URL)
+	bk.SetMirrors([]string{srv.URL})
+
+	if err = bk.Fetch(context.Background()); !errors.Is(err, builder.ErrImageUnverified) {
+		t.Fatalf("Expected an unverifiable mirror to be refused, got %v", err)
+	}
+
+	if err = builder.ValidateMirrors([]string{"https://mirror.example.com/solbuild"}); err != nil {
+		t.Fatalf("Valid mirror was refused: %v", err)
+	}
+
+	if err = builder.ValidateMirrors([]string{"mirror.example.com"}); err == nil {
+		t.Fatal("Mirror without a scheme should not be accepted")
+	}
+}
+
+func TestImageFetchCancel(t *testing.T) {
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+
+		// Stall part way through, as a dying mirror would
+		<-r.Context().Done()
+	}))
+	defer stalled.Close()
+
+	contacted := false
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted = true
+	}))
+	defer origin.Close()
+
+	bk := testImage(t, origin.URL)
+	bk.SetMirrors([]string{stalled.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := bk.Fetch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the download to be cancelled, got %v", err)
+	}
+
+	if contacted {
+		t.Fatal("The next mirror was tried after the download was cancelled")
+	}
+
+	if bk.IsFetched() {
+		t.Fatal("Cancelled download was moved into place")
+	}
+}
@@ -0,0 +1,161 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ImageMetadataSuffix is appended to the image path to find its metadata.
+const ImageMetadataSuffix = ".meta"
+
+// VerifyImage forces the image to be verified before the next build,
+// regardless of when it was last verified.
+var VerifyImage = false
+
+// ImageMetadata records the content hash of an installed image, so that
+// damage to it can be detected before it causes mysterious build failures.
+type ImageMetadata struct {
+	Hash     string    `toml:"hash"`     // sha256 of the image contents
+	Recorded time.Time `toml:"recorded"` // When the image was last changed
+	Verified time.Time `toml:"verified"` // When the hash was last verified
+	Source   string    `toml:"source"`   // URI the image was fetched from
+}
+
+// MetadataPath returns the path of the metadata for this image.
+func (b *BackingImage) MetadataPath() string {
+	return b.ImagePath + ImageMetadataSuffix
+}
+
+// ReadMetadata will read the metadata of the image. A nil metadata is
+// returned for images installed before it was recorded.
+func (b *BackingImage) ReadMetadata() (*ImageMetadata, error) {
+	var meta ImageMetadata
+
+	if _, err := toml.DecodeFile(b.MetadataPath(), &meta); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("Failed to read image metadata %s, reason: %w\n", b.MetadataPath(), err)
+	}
+
+	return &meta, nil
+}
+
+// writeMetadata will store the metadata of the image.
+func (b *BackingImage) writeMetadata(meta *ImageMetadata) error {
+	var buf bytes.Buffer
+
+	if err := toml.NewEncoder(&buf).Encode(meta); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(b.MetadataPath(), buf.Bytes(), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write image metadata %s, reason: %w\n", b.MetadataPath(), err)
+	}
+
+	return nil
+}
+
+// RecordHash will store the content hash of the image. This must be called
+// whenever the image is changed, once it is no longer mounted.
+func (b *BackingImage) RecordHash() error {
+	meta, err := b.hashImage(b.ImagePath)
+	if err != nil {
+		return err
+	}
+
+	// A freshly fetched image records where it came from
+	if source, err := os.ReadFile(b.ImagePathXZ + sourceSuffix); err == nil {
+		meta.Source = strings.TrimSpace(string(source))
+	}
+
+	return b.writeMetadata(meta)
+}
+
+// hashImage will return fresh metadata for the image at the given path,
+// keeping the source of the previous metadata.
+func (b *BackingImage) hashImage(path string) (*ImageMetadata, error) {
+	slog.Info("Recording image hash", "image", b.Name)
+
+	hash, err := FileSha256sum(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to hash image %s, reason: %w\n", path, err)
+	}
+
+	now := time.Now().UTC()
+	meta := &ImageMetadata{
+		Hash:     hash,
+		Recorded: now,
+		Verified: now,
+	}
+
+	if previous, err := b.ReadMetadata(); err == nil && previous != nil {
+		meta.Source = previous.Source
+	}
+
+	return meta, nil
+}
+
+// Verify will check the image against its recorded hash, if it was last
+// verified longer ago than the given interval or force is set. A zero
+// interval only verifies when forced.
+func (b *BackingImage) Verify(interval time.Duration, force bool) error {
+	meta, err := b.ReadMetadata()
+	if err != nil {
+		return err
+	}
+
+	// Images installed before hashes were recorded are trusted as they are
+	if meta == nil {
+		return b.RecordHash()
+	}
+
+	if !force && (interval <= 0 || time.Since(meta.Verified) < interval) {
+		return nil
+	}
+
+	slog.Info("Verifying image", "image", b.Name)
+
+	hash, err := FileSha256sum(b.ImagePath)
+	if err != nil {
+		return fmt.Errorf("Failed to hash image %s, reason: %w\n", b.ImagePath, err)
+	}
+
+	// The image may have been replaced by an update while it was hashed
+	if hash != meta.Hash {
+		if latest, readErr := b.ReadMetadata(); readErr == nil && latest != nil && latest.Hash == hash {
+			return nil
+		}
+
+		return fmt.Errorf("%w: %s has changed since it was last updated. Remove it and run 'solbuild init -p %s' "+
+			"to reinitialise it", ErrImageCorrupt, b.ImagePath, b.Name)
+	}
+
+	meta.Verified = time.Now().UTC()
+
+	return b.writeMetadata(meta)
+}
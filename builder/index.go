@@ -18,9 +18,7 @@ package builder
 
 import (
 	"errors"
-	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
 
 	"github.com/getsolus/libosdev/disk"
@@ -35,7 +33,7 @@ var (
 )
 
 // Index will attempt to index the given directory.
-func (p *Package) Index(notif PidNotifier, dir string, overlay *Overlay) error {
+func (p *Package) Index(notif PidNotifier, dir string, overlay *Overlay, pman PackageManager) error {
 	slog.Debug("Beginning indexer", "profile", overlay.Back.Name)
 
 	mman := disk.GetMountManager()
@@ -58,8 +56,8 @@ func (p *Package) Index(notif PidNotifier, dir string, overlay *Overlay) error {
 	}
 
 	// Create the target
-	target := filepath.Join(overlay.MountPoint, IndexBindTarget[1:])
-	if err := os.MkdirAll(target, 0o0755); err != nil {
+	target, err := overlay.secureDir(filepath.Join(overlay.MountPoint, IndexBindTarget[1:]), 0o0755)
+	if err != nil {
 		slog.Error("Cannot create bind target", "target", target, "err", err)
 		return err
 	}
@@ -76,8 +74,12 @@ func (p *Package) Index(notif PidNotifier, dir string, overlay *Overlay) error {
 
 	slog.Debug("Now indexing")
 
-	command := fmt.Sprintf("cd %s; %s", IndexBindTarget, eopkgCommand(installCommand+" index --skip-signing ."))
-	if err := ChrootExec(notif, overlay.MountPoint, command); err != nil {
+	command, err := pman.IndexCommand(IndexBindTarget)
+	if err != nil {
+		return err
+	}
+
+	if err := ChrootExec(notif, overlay.MountPoint, "index", command); err != nil {
 		slog.Error("Indexing failed", "dir", dir, "err", err)
 		return err
 	}
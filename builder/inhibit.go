@@ -0,0 +1,67 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io"
+	"log/slog"
+
+	login "github.com/coreos/go-systemd/v22/login1"
+)
+
+// An Inhibitor prevents the host from shutting down or sleeping while a build
+// is in progress.
+type Inhibitor interface {
+	// Inhibit takes the lock, giving the reason for it. The lock is held
+	// until the returned io.Closer is closed.
+	Inhibit(why string) (io.Closer, error)
+}
+
+// NewInhibitor will return an Inhibitor using systemd-logind. If it is not
+// enabled, or there is no system bus to reach systemd-logind over, as within
+// containers and on minimal hosts, an Inhibitor doing nothing is returned.
+func NewInhibitor(enabled bool) Inhibitor {
+	if !enabled {
+		return noopInhibitor{}
+	}
+
+	conn, err := login.New()
+	if err != nil || !conn.Connected() {
+		slog.Debug("org.freedesktop.login1: Not available, builds will not inhibit shutdown", "err", err)
+		return noopInhibitor{}
+	}
+
+	return &loginInhibitor{conn: conn}
+}
+
+// loginInhibitor takes inhibitor locks through systemd-logind.
+type loginInhibitor struct {
+	conn *login.Conn
+}
+
+// Inhibit implements Inhibitor.
+func (l *loginInhibitor) Inhibit(why string) (io.Closer, error) {
+	return l.conn.Inhibit("shutdown:idle:sleep", "solbuild", why, "block")
+}
+
+// noopInhibitor does nothing.
+type noopInhibitor struct{}
+
+// Inhibit implements Inhibitor.
+func (noopInhibitor) Inhibit(string) (io.Closer, error) {
+	return io.NopCloser(nil), nil
+}
@@ -0,0 +1,198 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// maxSymlinkHops bounds how many symlinks are followed when resolving a path
+// inside an image, so that link loops cannot hang an inspection.
+const maxSymlinkHops = 40
+
+// ErrInspectPath is returned when a path cannot be resolved inside an image.
+var ErrInspectPath = errors.New("Invalid path inside image")
+
+// MountReadOnly loop-mounts the backing image read-only at a temporary
+// location, calls fn with that location and unmounts it again afterwards.
+func (b *BackingImage) MountReadOnly(fn func(root string) error) error {
+	mountMan := disk.GetMountManager()
+
+	root, err := os.MkdirTemp("", "solbuild-inspect-")
+	if err != nil {
+		return fmt.Errorf("Failed to create required directories, reason: %w\n", err)
+	}
+
+	defer os.Remove(root)
+
+	slog.Debug("Mounting rootfs read-only", "image_path", b.ImagePath, "root_dir", root)
+
+	if err := mountMan.Mount(b.ImagePath, root, "auto", "loop", "ro"); err != nil {
+		return fmt.Errorf("Failed to mount rootfs %s, reason: %w\n", b.ImagePath, err)
+	}
+
+	defer mountMan.Unmount(root)
+
+	return fn(root)
+}
+
+// ResolveImagePath maps an absolute path inside the image mounted at root
+// onto the host. Symlinks in the leading components are followed relative to
+// root, so an absolute link in the image never escapes onto the host. The
+// final component is left alone, letting callers report links as links.
+func ResolveImagePath(root, path string) (string, error) {
+	parts := strings.Split(strings.Trim(filepath.Clean("/"+path), "/"), "/")
+	if len(parts) == 1 && parts[0] == "" {
+		return root, nil
+	}
+
+	resolved := "/"
+	hops := 0
+
+	for i := 0; i < len(parts); i++ {
+		part := parts[i]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+
+		if i == len(parts)-1 {
+			resolved = next
+
+			break
+		}
+
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			resolved = next
+
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops {
+			return "", fmt.Errorf("%w: too many levels of symbolic links in %s", ErrInspectPath, path)
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+
+		rest := strings.Split(strings.Trim(filepath.Clean(target), "/"), "/")
+		parts = append(rest, parts[i+1:]...)
+		resolved = "/"
+		i = -1
+	}
+
+	return filepath.Join(root, resolved), nil
+}
+
+// InspectPath writes a description of path inside the image mounted at root
+// to w. Directories are listed, symlinks show their target and regular files
+// have their contents copied out.
+func InspectPath(w io.Writer, root, path string) error {
+	host, err := ResolveImagePath(root, path)
+	if err != nil {
+		return err
+	}
+
+	st, err := os.Lstat(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s does not exist in the image", ErrInspectPath, path)
+	}
+
+	switch {
+	case st.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(host)
+		if err != nil {
+			return fmt.Errorf("Failed to read link %s, reason: %w\n", path, err)
+		}
+
+		fmt.Fprintf(w, "%s -> %s\n", path, target)
+	case st.IsDir():
+		entries, err := os.ReadDir(host)
+		if err != nil {
+			return fmt.Errorf("Failed to list %s, reason: %w\n", path, err)
+		}
+
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			line := fmt.Sprintf("%s %10d %s", info.Mode(), info.Size(), entry.Name())
+
+			if info.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Readlink(filepath.Join(host, entry.Name())); err == nil {
+					line += " -> " + target
+				}
+			}
+
+			fmt.Fprintln(w, line)
+		}
+	case st.Mode().IsRegular():
+		f, err := os.Open(host)
+		if err != nil {
+			return fmt.Errorf("Failed to open %s, reason: %w\n", path, err)
+		}
+		defer f.Close()
+
+		if _, err = io.Copy(w, f); err != nil {
+			return fmt.Errorf("Failed to read %s, reason: %w\n", path, err)
+		}
+	default:
+		fmt.Fprintf(w, "%s %s\n", st.Mode(), path)
+	}
+
+	return nil
+}
+
+// InspectImage mounts the profile's backing image read-only and hands the
+// mounted root to fn, without constructing an overlay or entering a chroot.
+func (m *Manager) InspectImage(fn func(root string) error) error {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+
+	if !m.image.IsInstalled() {
+		return ErrProfileNotInstalled
+	}
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "inspecting"); err != nil {
+		return err
+	}
+
+	return m.image.MountReadOnly(fn)
+}
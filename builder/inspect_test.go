@@ -0,0 +1,114 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func writeTestImageRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "usr", "bin"), 0o755); err != nil {
+		t.Fatalf("Failed to create image root: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "usr", "bin", "nano"), []byte("nano binary\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Absolute links must resolve within the image, not on the host.
+	if err := os.Symlink("/usr/bin", filepath.Join(root, "bin")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := os.Symlink("nano", filepath.Join(root, "usr", "bin", "editor")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	return root
+}
+
+func TestResolveImagePath(t *testing.T) {
+	root := writeTestImageRoot(t)
+
+	tests := map[string]string{
+		"/":               root,
+		"/bin/nano":       filepath.Join(root, "usr", "bin", "nano"),
+		"/bin/editor":     filepath.Join(root, "usr", "bin", "editor"),
+		"/../../bin/nano": filepath.Join(root, "usr", "bin", "nano"),
+		"usr/bin":         filepath.Join(root, "usr", "bin"),
+	}
+
+	for path, expected := range tests {
+		resolved, err := builder.ResolveImagePath(root, path)
+		if err != nil {
+			t.Fatalf("Failed to resolve %s: %v", path, err)
+		}
+
+		if resolved != expected {
+			t.Fatalf("Expected %s to resolve to %s, got: %s", path, expected, resolved)
+		}
+	}
+}
+
+func TestInspectPath(t *testing.T) {
+	root := writeTestImageRoot(t)
+
+	var buf bytes.Buffer
+
+	if err := builder.InspectPath(&buf, root, "/bin/nano"); err != nil {
+		t.Fatalf("Failed to inspect file: %v", err)
+	}
+
+	if buf.String() != "nano binary\n" {
+		t.Fatalf("Expected file contents, got: %q", buf.String())
+	}
+
+	buf.Reset()
+
+	if err := builder.InspectPath(&buf, root, "/usr/bin"); err != nil {
+		t.Fatalf("Failed to inspect directory: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "editor -> nano") || !strings.Contains(buf.String(), " nano\n") {
+		t.Fatalf("Expected directory listing, got: %q", buf.String())
+	}
+
+	buf.Reset()
+
+	if err := builder.InspectPath(&buf, root, "/bin"); err != nil {
+		t.Fatalf("Failed to inspect symlink: %v", err)
+	}
+
+	if buf.String() != "/bin -> /usr/bin\n" {
+		t.Fatalf("Expected symlink target, got: %q", buf.String())
+	}
+
+	if err := builder.InspectPath(&buf, root, "/usr/bin/vim"); !errors.Is(err, builder.ErrInspectPath) {
+		t.Fatalf("Expected ErrInspectPath for a missing path, got: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An ArtifactLayout decides how the artifacts of a build are laid out in the
+// output directory, so that builds of a recipe for several profiles may
+// share it.
+type ArtifactLayout string
+
+const (
+	// LayoutFlat collects the artifacts as they are named by the build.
+	LayoutFlat ArtifactLayout = "flat"
+
+	// LayoutProfileDir collects the artifacts into a directory named for the
+	// profile within the output directory.
+	LayoutProfileDir ArtifactLayout = "profile-dir"
+
+	// LayoutProfileSuffix adds the name of the profile to each artifact,
+	// before its extension, i.e. nano-8.0-12-1-x86_64.main-x86_64.eopkg.
+	LayoutProfileSuffix ArtifactLayout = "profile-suffix"
+)
+
+// CollectLayout is the layout artifacts are collected with.
+var CollectLayout = LayoutFlat
+
+// artifactExtensions are the extensions kept at the end of an artifact
+// name, longest first.
+var artifactExtensions = []string{
+	".eopkg" + ArtifactSignatureSuffix,
+	".eopkg",
+	TransitManifestSuffix,
+	QuickBuildSuffix,
+	".xml",
+}
+
+// ParseArtifactLayout will parse an artifact layout, where an empty name is
+// the default, LayoutFlat.
+func ParseArtifactLayout(name string) (ArtifactLayout, error) {
+	switch layout := ArtifactLayout(name); layout {
+	case "":
+		return LayoutFlat, nil
+	case LayoutFlat, LayoutProfileDir, LayoutProfileSuffix:
+		return layout, nil
+	default:
+		return "", fmt.Errorf("Invalid artifact layout: %s (expected flat, profile-dir or profile-suffix)", name)
+	}
+}
+
+// ArtifactDir returns the directory the artifacts of a build with the
+// profile are collected into.
+func (l ArtifactLayout) ArtifactDir(outputDir, profile string) string {
+	if l == LayoutProfileDir {
+		return filepath.Join(outputDir, profile)
+	}
+
+	return outputDir
+}
+
+// ArtifactName returns the name an artifact of a build with the profile is
+// collected as.
+func (l ArtifactLayout) ArtifactName(name, profile string) string {
+	if l != LayoutProfileSuffix {
+		return name
+	}
+
+	for _, ext := range artifactExtensions {
+		if stem, ok := strings.CutSuffix(name, ext); ok && stem != "" {
+			return stem + "." + profile + ext
+		}
+	}
+
+	return name + "." + profile
+}
+
+// trimArtifactSuffix removes the profile added to an artifact name by
+// LayoutProfileSuffix, if any.
+func trimArtifactSuffix(name, profile string) string {
+	if profile == "" {
+		return name
+	}
+
+	for _, ext := range artifactExtensions {
+		if stem, ok := strings.CutSuffix(name, "."+profile+ext); ok {
+			return stem + ext
+		}
+	}
+
+	return name
+}
+
+// nameArtifacts will rename the artifacts in dir as they are to be
+// collected, so that signatures and the transit manifest refer to them by
+// their collected names.
+func nameArtifacts(dir, profile string, paths []string) ([]string, error) {
+	renamed := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		name := CollectLayout.ArtifactName(filepath.Base(path), profile)
+		if name == filepath.Base(path) {
+			renamed = append(renamed, path)
+
+			continue
+		}
+
+		target := filepath.Join(dir, name)
+		if err := os.Rename(path, target); err != nil {
+			return nil, fmt.Errorf("Failed to name artifact %s, reason: %w\n", filepath.Base(path), err)
+		}
+
+		renamed = append(renamed, target)
+	}
+
+	return renamed, nil
+}
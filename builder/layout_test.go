@@ -0,0 +1,109 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParseArtifactLayout(t *testing.T) {
+	for name, expected := range map[string]builder.ArtifactLayout{
+		"":               builder.LayoutFlat,
+		"flat":           builder.LayoutFlat,
+		"profile-dir":    builder.LayoutProfileDir,
+		"profile-suffix": builder.LayoutProfileSuffix,
+	} {
+		layout, err := builder.ParseArtifactLayout(name)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", name, err)
+		}
+
+		if layout != expected {
+			t.Fatalf("Expected %q for %q, got: %q", expected, name, layout)
+		}
+	}
+
+	if _, err := builder.ParseArtifactLayout("per-arch"); err == nil {
+		t.Fatal("Expected an unknown layout to be rejected")
+	}
+}
+
+func TestArtifactLayout(t *testing.T) {
+	const profile = "unstable-x86_64"
+
+	names := []string{
+		"nano-8.0-12-1-x86_64.eopkg",
+		"nano-8.0-12-1-x86_64.eopkg.sig",
+		"nano-8.0-12.tram",
+		"nano-8.0-12.quick-build",
+		"pspec_x86_64.xml",
+		"abi_symbols",
+	}
+
+	suffixed := []string{
+		"nano-8.0-12-1-x86_64.unstable-x86_64.eopkg",
+		"nano-8.0-12-1-x86_64.unstable-x86_64.eopkg.sig",
+		"nano-8.0-12.unstable-x86_64.tram",
+		"nano-8.0-12.unstable-x86_64.quick-build",
+		"pspec_x86_64.unstable-x86_64.xml",
+		"abi_symbols.unstable-x86_64",
+	}
+
+	for i, name := range names {
+		for _, layout := range []builder.ArtifactLayout{builder.LayoutFlat, builder.LayoutProfileDir} {
+			if got := layout.ArtifactName(name, profile); got != name {
+				t.Fatalf("Expected %s to keep %s, got: %s", layout, name, got)
+			}
+		}
+
+		if got := builder.LayoutProfileSuffix.ArtifactName(name, profile); got != suffixed[i] {
+			t.Fatalf("Expected %s, got: %s", suffixed[i], got)
+		}
+	}
+
+	if got := builder.LayoutProfileDir.ArtifactDir("out", profile); got != filepath.Join("out", profile) {
+		t.Fatalf("Expected a directory for the profile, got: %s", got)
+	}
+
+	for _, layout := range []builder.ArtifactLayout{builder.LayoutFlat, builder.LayoutProfileSuffix} {
+		if got := layout.ArtifactDir("out", profile); got != "out" {
+			t.Fatalf("Expected %s to collect into the output directory, got: %s", layout, got)
+		}
+	}
+}
+
+func TestTransitManifestProfileSuffix(t *testing.T) {
+	paths := writeFiles(t, t.TempDir(), "nano-8.0-12-1-x86_64.unstable-x86_64.eopkg")
+
+	tram := builder.NewTransitManifest("unstable")
+	tram.Manifest.Profile = "unstable-x86_64"
+
+	if err := tram.AddFile(paths[0]); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+
+	if tram.Manifest.Arch != "x86_64" {
+		t.Fatalf("Expected the arch without the profile suffix, got: %q", tram.Manifest.Arch)
+	}
+
+	if tram.File[0].Path != "nano-8.0-12-1-x86_64.unstable-x86_64.eopkg" {
+		t.Fatalf("Expected the manifest to list the collected name, got: %s", tram.File[0].Path)
+	}
+}
@@ -0,0 +1,157 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ErrLegacyDisabled is returned when a pspec.xml is built with allow_legacy
+// disabled.
+var ErrLegacyDisabled = errors.New("Legacy pspec.xml builds are disabled by allow_legacy")
+
+// LegacyStatsFile is where the legacy builds on this host are counted, to
+// find the packages still to be converted to package.yml, within
+// LibDirectory.
+var LegacyStatsFile = legacyStatsFile()
+
+// legacyStatsFile returns the path of the legacy build counts within the
+// current LibDirectory.
+func legacyStatsFile() string {
+	return filepath.Join(LibDirectory, "legacy-builds.toml")
+}
+
+// LegacyBuildStats counts the attempts to build a pspec.xml package.
+type LegacyBuildStats struct {
+	Builds    int       `toml:"builds"     json:"builds"`     // Builds started
+	Refused   int       `toml:"refused"    json:"refused"`    // Builds refused by allow_legacy
+	LastBuild time.Time `toml:"last_build" json:"last_build"` // When a build was last attempted
+}
+
+// LegacyPackage is the name of a pspec.xml package with its build counts.
+type LegacyPackage struct {
+	Name string `json:"name"`
+	LegacyBuildStats
+}
+
+// LoadLegacyStats will return the legacy build counts of every package.
+func LoadLegacyStats() (map[string]LegacyBuildStats, error) {
+	stats := make(map[string]LegacyBuildStats)
+
+	if _, err := toml.DecodeFile(LegacyStatsFile, &stats); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return stats, nil
+		}
+
+		return nil, fmt.Errorf("Failed to read legacy build stats %s, reason: %w\n", LegacyStatsFile, err)
+	}
+
+	return stats, nil
+}
+
+// SortedLegacyStats will return the legacy build counts of every package,
+// with the most built first.
+func SortedLegacyStats() ([]LegacyPackage, error) {
+	stats, err := LoadLegacyStats()
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]LegacyPackage, 0, len(stats))
+	for name, counts := range stats {
+		packages = append(packages, LegacyPackage{Name: name, LegacyBuildStats: counts})
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Builds+packages[i].Refused != packages[j].Builds+packages[j].Refused {
+			return packages[i].Builds+packages[i].Refused > packages[j].Builds+packages[j].Refused
+		}
+
+		return packages[i].Name < packages[j].Name
+	})
+
+	return packages, nil
+}
+
+// RecordLegacyBuild will count an attempt to build the named pspec.xml
+// package, and whether it was refused.
+func RecordLegacyBuild(name string, refused bool) error {
+	stats, err := LoadLegacyStats()
+	if err != nil {
+		return err
+	}
+
+	counts := stats[name]
+	if refused {
+		counts.Refused++
+	} else {
+		counts.Builds++
+	}
+
+	counts.LastBuild = time.Now().UTC().Truncate(time.Second)
+	stats[name] = counts
+
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by solbuild, legacy pspec.xml builds of each package\n")
+
+	if err = toml.NewEncoder(&buf).Encode(stats); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(LegacyStatsFile), 0o0755); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(LegacyStatsFile, buf.Bytes(), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write legacy build stats %s, reason: %w\n", LegacyStatsFile, err)
+	}
+
+	return nil
+}
+
+// checkLegacy will refuse to build a pspec.xml package unless allow_legacy
+// is set, counting the attempt either way.
+func (m *Manager) checkLegacy() error {
+	if m.pkg.Type != PackageTypeXML {
+		return nil
+	}
+
+	refused := !m.Config.AllowLegacy
+
+	if err := RecordLegacyBuild(m.pkg.Name, refused); err != nil {
+		slog.Warn("Failed to record legacy build", "err", err)
+	}
+
+	if refused {
+		return fmt.Errorf("%w: convert %s to a package.yml with 'solbuild convert', see solbuild(1)",
+			ErrLegacyDisabled, m.pkg.Path)
+	}
+
+	WarnDeprecated(DeprecationLegacyRecipe, "package", m.pkg.Name)
+
+	return nil
+}
@@ -0,0 +1,63 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestLegacyStats(t *testing.T) {
+	original := builder.LegacyStatsFile
+	builder.LegacyStatsFile = filepath.Join(t.TempDir(), "legacy-builds.toml")
+
+	t.Cleanup(func() { builder.LegacyStatsFile = original })
+
+	packages, err := builder.SortedLegacyStats()
+	if err != nil || len(packages) != 0 {
+		t.Fatalf("Expected no legacy builds, got: %v %v", packages, err)
+	}
+
+	for _, build := range []struct {
+		name    string
+		refused bool
+	}{
+		{"nano", false},
+		{"zlib", false},
+		{"zlib", false},
+		{"zlib", true},
+		{"attr", true},
+	} {
+		if err = builder.RecordLegacyBuild(build.name, build.refused); err != nil {
+			t.Fatalf("Failed to record legacy build: %v", err)
+		}
+	}
+
+	if packages, err = builder.SortedLegacyStats(); err != nil {
+		t.Fatalf("Failed to load legacy builds: %v", err)
+	}
+
+	if len(packages) != 3 || packages[0].Name != "zlib" || packages[1].Name != "attr" || packages[2].Name != "nano" {
+		t.Fatalf("Expected zlib, attr and nano, got: %v", packages)
+	}
+
+	if packages[0].Builds != 2 || packages[0].Refused != 1 || packages[0].LastBuild.IsZero() {
+		t.Fatalf("Unexpected counts for zlib: %+v", packages[0])
+	}
+}
@@ -0,0 +1,215 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxLicenseFileSize bounds how much of a license file we read.
+const maxLicenseFileSize = 256 * 1024
+
+// licenseFileRegex matches the usual names of license files.
+var licenseFileRegex = regexp.MustCompile(`(?i)^(licen[sc]e|copying|copyright|unlicense)([._-].*)?$`)
+
+// licensePhrases identifies licenses by phrases from their text, with more
+// specific licenses listed before those they contain, e.g. LGPL before GPL.
+var licensePhrases = []struct {
+	ID      string
+	Phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"LGPL-2.0", []string{"gnu library general public license", "version 2"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"BSL-1.0", []string{"boost software license", "version 1.0"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"permission is hereby granted, free of charge, to any person obtaining a copy"}},
+	{"Zlib", []string{"this software is provided 'as-is', without any express or implied"}},
+}
+
+// LicenseList is a license field which may be a single value or a list.
+type LicenseList []string
+
+// UnmarshalYAML accepts both forms of the license field.
+func (l *LicenseList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = LicenseList{value.Value}
+		return nil
+	}
+
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+
+	*l = list
+
+	return nil
+}
+
+// A LicenseFile is a license file found in the build, and the license it
+// was identified as, if any.
+type LicenseFile struct {
+	Path    string
+	License string
+}
+
+// A LicenseSummary compares the licenses found in a build with those
+// declared by the package.
+type LicenseSummary struct {
+	Declared   []string
+	Detected   map[string][]string // License to the files it was found in
+	Unknown    []string            // License files that couldn't be identified
+	Mismatches []string            // Detected licenses not covered by those declared
+}
+
+// DetectLicense will identify the SPDX license of the given license text,
+// returning an empty string if it is not recognised.
+func DetectLicense(text []byte) string {
+	// Normalize the whitespace and case so phrases match across line breaks
+	normal := strings.ToLower(strings.Join(strings.Fields(string(text)), " "))
+
+	for _, license := range licensePhrases {
+		matched := true
+
+		for _, phrase := range license.Phrases {
+			if !strings.Contains(normal, phrase) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return license.ID
+		}
+	}
+
+	return ""
+}
+
+// ScanLicenses will find and identify the license files within the given
+// directories, with paths relative to the directory they were found in.
+func ScanLicenses(dirs ...string) []LicenseFile {
+	var ret []LicenseFile
+
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() || !licenseFileRegex.MatchString(d.Name()) {
+				return nil //nolint:nilerr // unreadable entries are skipped
+			}
+
+			fi, err := os.Open(path)
+			if err != nil {
+				return nil //nolint:nilerr // unreadable entries are skipped
+			}
+			defer fi.Close()
+
+			text, err := io.ReadAll(io.LimitReader(fi, maxLicenseFileSize))
+			if err != nil {
+				return nil //nolint:nilerr // unreadable entries are skipped
+			}
+
+			rel, _ := filepath.Rel(dir, path)
+			ret = append(ret, LicenseFile{Path: rel, License: DetectLicense(text)})
+
+			return nil
+		})
+	}
+
+	return ret
+}
+
+// baseLicense strips the SPDX version qualifiers, e.g. GPL-2.0-or-later.
+func baseLicense(id string) string {
+	id = strings.TrimSuffix(strings.TrimSpace(id), "+")
+	id = strings.TrimSuffix(id, "-or-later")
+	id = strings.TrimSuffix(id, "-only")
+
+	return strings.ToLower(id)
+}
+
+// SummarizeLicenses will compare the detected licenses against the declared
+// licenses of the package.
+func SummarizeLicenses(declared []string, files []LicenseFile) *LicenseSummary {
+	summary := &LicenseSummary{
+		Declared: declared,
+		Detected: make(map[string][]string),
+	}
+
+	accepted := make(map[string]bool)
+	for _, license := range declared {
+		accepted[baseLicense(license)] = true
+	}
+
+	for _, file := range files {
+		if file.License == "" {
+			summary.Unknown = append(summary.Unknown, file.Path)
+			continue
+		}
+
+		if _, seen := summary.Detected[file.License]; !seen && !accepted[baseLicense(file.License)] {
+			summary.Mismatches = append(summary.Mismatches, file.License)
+		}
+
+		summary.Detected[file.License] = append(summary.Detected[file.License], file.Path)
+	}
+
+	sort.Strings(summary.Mismatches)
+
+	return summary
+}
+
+// ReportLicenses will log a summary of the licenses found in the build
+// and install trees of the package, flagging any not declared by it.
+func (p *Package) ReportLicenses(overlay *Overlay) *LicenseSummary {
+	root := filepath.Join(overlay.MountPoint, BuildUserHome[1:], "YPKG", "root", p.Name)
+	summary := SummarizeLicenses(p.Licenses, ScanLicenses(filepath.Join(root, "install"), filepath.Join(root, "build")))
+
+	detected := make([]string, 0, len(summary.Detected))
+	for license := range summary.Detected {
+		detected = append(detected, license)
+	}
+
+	sort.Strings(detected)
+
+	slog.Info("License summary", "declared", strings.Join(summary.Declared, ", "),
+		"detected", strings.Join(detected, ", "), "unidentified", len(summary.Unknown))
+
+	for _, license := range summary.Mismatches {
+		slog.Warn("Detected license is not declared in package", "license", license,
+			"files", strings.Join(summary.Detected[license], ", "))
+	}
+
+	return summary
+}
@@ -0,0 +1,72 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestDetectLicense(t *testing.T) {
+	tests := map[string]string{
+		"GNU LESSER GENERAL PUBLIC LICENSE\n Version 2.1, February 1999": "LGPL-2.1",
+		"GNU GENERAL PUBLIC LICENSE\n   Version 2, June 1991":            "GPL-2.0",
+		"Apache License\nVersion 2.0, January 2004":                      "Apache-2.0",
+		"Something else entirely":                                        "",
+	}
+
+	for text, expected := range tests {
+		if license := builder.DetectLicense([]byte(text)); license != expected {
+			t.Fatalf("Wrong license for %q: %s vs expected %s", text, license, expected)
+		}
+	}
+}
+
+func TestSummarizeLicenses(t *testing.T) {
+	pkg, err := builder.NewPackage(PackageTestFile)
+	if err != nil {
+		t.Fatalf("Failed to load package: %v", err)
+	}
+
+	if len(pkg.Licenses) != 1 || pkg.Licenses[0] != "GPL-3.0-or-later" {
+		t.Fatalf("Wrong declared licenses: %v", pkg.Licenses)
+	}
+
+	files := builder.ScanLicenses("testdata/licenses/install", "testdata/licenses/build")
+	if len(files) != 4 {
+		t.Fatalf("Wrong number of license files found: %v", files)
+	}
+
+	summary := builder.SummarizeLicenses(pkg.Licenses, files)
+
+	if len(summary.Detected["GPL-3.0"]) != 2 {
+		t.Fatalf("Wrong GPL-3.0 files: %v", summary.Detected["GPL-3.0"])
+	}
+
+	if len(summary.Unknown) != 1 || summary.Unknown[0] != "nano-8.0/COPYRIGHT" {
+		t.Fatalf("Wrong unidentified files: %v", summary.Unknown)
+	}
+
+	if len(summary.Mismatches) != 1 || summary.Mismatches[0] != "MIT" {
+		t.Fatalf("Wrong mismatches: %v", summary.Mismatches)
+	}
+
+	if summary = builder.SummarizeLicenses([]string{"GPL-3.0-only", "MIT"}, files); len(summary.Mismatches) != 0 {
+		t.Fatalf("Unexpected mismatches: %v", summary.Mismatches)
+	}
+}
@@ -0,0 +1,121 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultLocale is the locale used for builds unless configured otherwise.
+const DefaultLocale = "en_US.UTF-8"
+
+var (
+	// BuildLocale is the LANG and LC_ALL used within the chroot.
+	BuildLocale = DefaultLocale
+
+	// BuildTimezone is the TZ used within the chroot, empty for the image default.
+	BuildTimezone string
+
+	localeRegex   = regexp.MustCompile(`^[A-Za-z]{2,3}(_[A-Za-z0-9]+)?(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+	timezoneRegex = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+)
+
+// isBuiltinLocale determines whether the locale is always available.
+func isBuiltinLocale(locale string) bool {
+	switch strings.ToUpper(locale) {
+	case "C", "POSIX", "C.UTF-8", "C.UTF8":
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateLocale ensures that the locale is well formed, e.g. de_DE.UTF-8.
+// An empty locale means DefaultLocale.
+func ValidateLocale(locale string) error {
+	if locale == "" || isBuiltinLocale(locale) || localeRegex.MatchString(locale) {
+		return nil
+	}
+
+	return fmt.Errorf("Invalid locale: %s", locale)
+}
+
+// ValidateTimezone ensures that the timezone is a well formed zoneinfo name.
+func ValidateTimezone(timezone string) error {
+	if timezone == "" || timezoneRegex.MatchString(timezone) {
+		return nil
+	}
+
+	return fmt.Errorf("Invalid timezone: %s", timezone)
+}
+
+// localeGenCommand returns a command to generate the locale in the chroot if
+// it is missing. locale -a lists names with a normalized charset, such as
+// de_DE.utf8, so the check must account for that.
+func localeGenCommand(locale string) string {
+	name, charset, _ := strings.Cut(locale, ".")
+	charset, modifier, _ := strings.Cut(charset, "@")
+
+	if charset == "" {
+		charset = "UTF-8"
+	}
+
+	input := name
+	if modifier != "" {
+		input += "@" + modifier
+	}
+
+	normal := strings.ToLower(strings.ReplaceAll(charset, "-", ""))
+
+	listed := name + "." + normal
+	if modifier != "" {
+		listed += "@" + modifier
+	}
+
+	return fmt.Sprintf("locale -a | grep -qx '%s' || localedef -i '%s' -f '%s' '%s'", listed, input, charset, locale)
+}
+
+// EnsureLocale will generate the build locale within the chroot if it is not
+// already available, and ensure the build timezone exists.
+func (p *Package) EnsureLocale(notif PidNotifier, overlay *Overlay) error {
+	slog.Info("Build environment", "locale", BuildLocale, "timezone", BuildTimezone)
+
+	if BuildTimezone != "" {
+		if !PathExists(filepath.Join(overlay.MountPoint, "usr", "share", "zoneinfo", BuildTimezone)) {
+			return fmt.Errorf("Timezone %s is not available in the build root\n", BuildTimezone)
+		}
+	}
+
+	if isBuiltinLocale(BuildLocale) {
+		return nil
+	}
+
+	slog.Debug("Ensuring locale is available", "locale", BuildLocale)
+
+	err := ChrootExec(notif, overlay.MountPoint, "locale", localeGenCommand(BuildLocale))
+	notif.SetActivePID(0)
+
+	if err != nil {
+		return fmt.Errorf("Failed to generate locale %s, reason: %w\n", BuildLocale, err)
+	}
+
+	return nil
+}
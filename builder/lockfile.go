@@ -200,3 +200,18 @@ func (l *LockFile) Clean() error {
 
 	return nil
 }
+
+// IsLockHeld will determine whether the lockfile at path is currently owned
+// by another live process, without attempting to take the lock.
+func IsLockHeld(path string) bool {
+	lock := &LockFile{path: path, ourPID: os.Getpid(), conlock: new(sync.RWMutex)}
+
+	pid, err := lock.readPID()
+	if err != nil || pid <= 0 || pid == lock.ourPID {
+		return false
+	}
+
+	p, _ := os.FindProcess(pid)
+
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,162 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// LowMemoryJobs is the build parallelism used in low memory mode.
+	LowMemoryJobs = 2
+
+	// LowMemorySccacheLimit caps the address space of the sccache server,
+	// in KiB, while in low memory mode.
+	LowMemorySccacheLimit = 1024 * 1024
+
+	// lowMemoryCompression is the package compression level used in low
+	// memory mode, as higher levels of xz need far more memory.
+	lowMemoryCompression = 1
+)
+
+// LowMemory tunes builds for hosts without much memory to spare. Parallelism
+// is reduced, tmpfs is never used, the sccache server is capped and eopkg is
+// kept from large in-memory operations.
+var LowMemory = false
+
+// An EopkgOption is a value set in the [build] section of eopkg.conf.
+type EopkgOption struct {
+	Key   string
+	Value string
+}
+
+// lowMemoryOptions are the eopkg.conf values used in low memory mode.
+var lowMemoryOptions = []EopkgOption{
+	{"jobs", fmt.Sprintf("-j%d", LowMemoryJobs)},
+	{"compressionlevel", fmt.Sprintf("%d", lowMemoryCompression)},
+}
+
+// TuneEopkgConf will return the given eopkg.conf with the [build] section
+// adjusted for low memory mode, adding the section if it is missing.
+func TuneEopkgConf(conf []byte) []byte {
+	return SetEopkgBuildOptions(conf, lowMemoryOptions...)
+}
+
+// EopkgBuildOptions will return the values to set in the [build] section
+// of eopkg.conf for low memory mode and the artifact compression level, in
+// that order, so that an explicit compression level takes precedence.
+func EopkgBuildOptions() []EopkgOption {
+	var options []EopkgOption
+
+	if LowMemory {
+		options = append(options, lowMemoryOptions...)
+	}
+
+	if CompressionLevel >= 0 {
+		options = append(options, EopkgOption{"compressionlevel", fmt.Sprintf("%d", CompressionLevel)})
+	}
+
+	return options
+}
+
+// SetEopkgBuildOptions will return the given eopkg.conf with the options
+// set in the [build] section, adding the section if it is missing. Later
+// options replace earlier options with the same key.
+func SetEopkgBuildOptions(conf []byte, options ...EopkgOption) []byte {
+	values := make(map[string]string)
+
+	var order []string
+
+	for _, option := range options {
+		if _, ok := values[option.Key]; !ok {
+			order = append(order, option.Key)
+		}
+
+		values[option.Key] = option.Value
+	}
+
+	var out bytes.Buffer
+
+	inBuild := false
+	seenBuild := false
+	written := make(map[string]bool)
+
+	// flush writes any values not already replaced in the [build] section
+	flush := func() {
+		for _, key := range order {
+			if !written[key] {
+				fmt.Fprintf(&out, "%s = %s\n", key, values[key])
+				written[key] = true
+			}
+		}
+	}
+
+	// Blank lines in the [build] section are held back, so that any
+	// missing values are added before the next section
+	blanks := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if inBuild && trimmed == "" {
+			blanks++
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			if inBuild {
+				flush()
+			}
+
+			inBuild = trimmed == "[build]"
+			seenBuild = seenBuild || inBuild
+		}
+
+		out.WriteString(strings.Repeat("\n", blanks))
+		blanks = 0
+
+		if inBuild {
+			if key, _, found := strings.Cut(trimmed, "="); found {
+				key = strings.TrimSpace(key)
+				if value, ok := values[key]; ok {
+					fmt.Fprintf(&out, "%s = %s\n", key, value)
+					written[key] = true
+
+					continue
+				}
+			}
+		}
+
+		out.WriteString(line + "\n")
+	}
+
+	switch {
+	case inBuild:
+		flush()
+		out.WriteString(strings.Repeat("\n", blanks))
+	case !seenBuild:
+		out.WriteString("\n[build]\n")
+		flush()
+	}
+
+	return out.Bytes()
+}
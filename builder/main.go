@@ -30,9 +30,16 @@ var DisableColors bool
 // Controls whether or not we generate an ABI report.
 var DisableABIReport bool
 
+// OutputDir is where the build artifacts are collected to.
+var OutputDir = "."
+
+// ImagesDir is where we keep the rootfs images for build profiles, set from
+// images_dir in the configuration.
+var ImagesDir = DefaultImagesDir
+
 const (
-	// ImagesDir is where we keep the rootfs images for build profiles.
-	ImagesDir = "/var/lib/solbuild/images"
+	// DefaultImagesDir is where images are kept unless configured otherwise.
+	DefaultImagesDir = "/var/lib/solbuild/images"
 
 	// ImageSuffix is the common suffix for all solbuild images.
 	ImageSuffix = ".img"
@@ -43,20 +50,46 @@ const (
 	// ImageBaseURI is the storage area for base images.
 	ImageBaseURI = "https://solbuild.getsol.us"
 
-	// ImageRootsDir is where updates are performed on base images.
-	ImageRootsDir = "/var/lib/solbuild/roots"
+	// DefaultImageRootsDir is where updates are performed unless configured
+	// otherwise.
+	DefaultImageRootsDir = "/var/lib/solbuild/roots"
+
+	// DefaultLibDirectory is where solbuild keeps its own records unless
+	// configured otherwise.
+	DefaultLibDirectory = "/var/lib/solbuild"
+)
+
+var (
+	// ImageRootsDir is where updates are performed on base images, set from
+	// roots_dir in the configuration.
+	ImageRootsDir = DefaultImageRootsDir
+
+	// LibDirectory holds the records of solbuild itself, such as remembered
+	// build settings, set from lib_dir in the configuration.
+	LibDirectory = DefaultLibDirectory
+
+	// PackageCacheDirectory is where we share packages between all builders,
+	// set from package_cache_dir in the configuration.
+	PackageCacheDirectory = DefaultPackageCacheDirectory
+
+	// CacheDirectory is where packages' build cache are stored, set from
+	// cache_dir in the configuration.
+	CacheDirectory = DefaultCacheDirectory
 )
 
 const (
-	// PackageCacheDirectory is where we share packages between all builders.
-	PackageCacheDirectory = "/var/lib/solbuild/packages"
+	// DefaultPackageCacheDirectory is where packages are shared unless
+	// configured otherwise.
+	DefaultPackageCacheDirectory = "/var/lib/solbuild/packages"
 
-	// CacheDirectory is where packages' build cache are stored.
-	CacheDirectory = "/var/lib/solbuild/cache"
+	// DefaultCacheDirectory is where build caches are stored unless
+	// configured otherwise.
+	DefaultCacheDirectory = "/var/lib/solbuild/cache"
 
 	// Obsolete cache directories. These are only still specified so that the
-	// `delete-cache -a` subcommand will remove them. In the future they will
-	// be removed.
+	// `migrate-cache` subcommand can move their contents into CacheDirectory,
+	// and `delete-cache -a` will remove them. In the future they will be
+	// removed.
 	ObsoleteCcacheDirectory        = "/var/lib/solbuild/ccache/ypkg"
 	ObsoleteLegacyCcacheDirectory  = "/var/lib/solbuild/ccache/legacy"
 	ObsoleteSccacheDirectory       = "/var/lib/solbuild/sccache/ypkg"
@@ -79,7 +112,7 @@ const (
 	// BuildUserGecos is the build user's description.
 	BuildUserGecos = "solbuild user"
 
-	// BuildUserShell is the system shell for the build user.
+	// BuildUserShell is the preferred system shell for the build user.
 	BuildUserShell = "/bin/bash"
 )
 
@@ -119,12 +152,13 @@ func EmitImageError(image string) {
 	}
 }
 
-// EmitProfileError emits a stock response for an invalid profile.
-func EmitProfileError(p string) {
+// EmitProfileError emits a stock response for an invalid profile, listing
+// the profiles within the given directories.
+func EmitProfileError(p string, dirs []string) {
 	fmt.Fprintf(os.Stderr, "Error: '%v' is not a known profile\n", p)
 	fmt.Fprintf(os.Stderr, "Valid profiles include:\n\n")
 
-	profiles, err := GetAllProfiles()
+	profiles, err := GetProfilesFromDirs(dirs)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading profiles: %v\n", err)
 		return
@@ -142,12 +176,13 @@ func EmitProfileError(p string) {
 
 // A BackingImage is the core of any given profile.
 type BackingImage struct {
-	Name        string // Name of the profile
-	ImagePath   string // Absolute path to the .img file
-	ImagePathXZ string // Absolute path to the .img.xz file
-	ImageURI    string // URI of the image origin
-	RootDir     string // Where to mount the backing image for updates
-	LockPath    string // Our lock path for update operations
+	Name        string   // Name of the profile
+	ImagePath   string   // Absolute path to the .img file
+	ImagePathXZ string   // Absolute path to the .img.xz file
+	ImageURI    string   // URI of the image origin
+	Mirrors     []string // URIs of the image on mirrors, tried in order before ImageURI
+	RootDir     string   // Where to mount the backing image for updates
+	LockPath    string   // Our lock path for update operations
 }
 
 // IsInstalled will determine whether the given backing image has been installed
@@ -17,6 +17,7 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -31,6 +32,7 @@ import (
 	"github.com/getsolus/libosdev/disk"
 	"github.com/go-git/go-git/v5"
 
+	"github.com/getsolus/solbuild/builder/source"
 	"github.com/getsolus/solbuild/cli/log"
 )
 
@@ -56,6 +58,9 @@ var (
 
 	// ErrInterrupted is returned when the build is interrupted.
 	ErrInterrupted = errors.New("The operation was cancelled by the user")
+
+	// ErrHistoryMismatch is returned when a provided history does not match the package.
+	ErrHistoryMismatch = errors.New("History file does not match the package release")
 )
 
 // A Manager is responsible for cleanly managing the entire session within solbuild,
@@ -66,12 +71,12 @@ var (
 type Manager struct {
 	Config *Config // Our config from the merged system/vendor configs
 
-	image      *BackingImage // Storage for the overlay
-	overlay    *Overlay      // OverlayFS configuration
-	pkg        *Package      // Current package, if any
-	pkgManager *EopkgManager // Package manager, if any
-	lock       *sync.Mutex   // Lock on all operations to prevent.. damage.
-	profile    *Profile      // The profile we've been requested to use
+	image      *BackingImage  // Storage for the overlay
+	overlay    *Overlay       // OverlayFS configuration
+	pkg        *Package       // Current package, if any
+	pkgManager PackageManager // Package manager, if any
+	lock       *sync.Mutex    // Lock on all operations to prevent.. damage.
+	profile    *Profile       // The profile we've been requested to use
 
 	lockfile *LockFile // We track the global lock for each operation
 	didStart bool      // Whether we got anything done.
@@ -83,6 +88,14 @@ type Manager struct {
 
 	manifestTarget string // Generate manifest if set
 
+	secrets []*Secret // Secrets exposed to the build
+
+	toolchain []*ToolchainMount // Local tooling mounted over that of the image
+
+	inhibitor Inhibitor // Prevents the host going down mid-build, if set
+
+	profileDirs []string // Extra directories to load profiles from
+
 	activePID int // Active PID
 }
 
@@ -109,16 +122,26 @@ func NewManager() (*Manager, error) {
 		return nil, err
 	}
 
+	// Runtime flags may still override the configuration, so only warn
+	if err := man.Config.Validate(); err != nil {
+		slog.Warn("Invalid solbuild configuration", "err", err)
+	}
+
 	man.lock = new(sync.Mutex)
 
 	return man, nil
 }
 
-// SetActivePID will set the active task PID.
+// SetActivePID will set the active task PID. Once cancelled, any task
+// started is killed straight away.
 func (m *Manager) SetActivePID(pid int) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	m.activePID = pid
+
+	if m.cancelled && pid > 0 {
+		syscall.Kill(-pid, syscall.SIGKILL)
+	}
 }
 
 // SetManifestTarget will set the manifest target to be used
@@ -129,6 +152,29 @@ func (m *Manager) SetManifestTarget(target string) {
 	m.manifestTarget = strings.TrimSpace(target)
 }
 
+// SetSecrets will set the secrets to expose to the build.
+func (m *Manager) SetSecrets(secrets []*Secret) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.secrets = secrets
+}
+
+// SetToolchain will set the local tooling to mount over that of the image
+// for builds and chroots.
+func (m *Manager) SetToolchain(mounts []*ToolchainMount) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.toolchain = mounts
+}
+
+// SetInhibitor will set how the host is prevented from shutting down during
+// builds, replacing the systemd-logind default.
+func (m *Manager) SetInhibitor(inhibitor Inhibitor) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.inhibitor = inhibitor
+}
+
 // SetCommands overrides the eopkg binary used for all eopkg commands.
 func (m *Manager) SetCommands(eopkg string, ypkg string) {
 	m.lock.Lock()
@@ -149,6 +195,69 @@ func (m *Manager) SetCommands(eopkg string, ypkg string) {
 		"ypkg", ypkgBuildCommand)
 }
 
+// SetHistoryFile will load a pre-generated history.xml to be used in place
+// of generating one from git. This must be called before SetPackage.
+func (m *Manager) SetHistoryFile(path string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.pkg != nil {
+		return ErrManagerInitialised
+	}
+
+	history, err := NewPackageHistoryFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Loaded package history", "path", path, "updates", len(history.Updates))
+
+	m.history = history
+
+	return nil
+}
+
+// SetProfileDirs will set extra directories to load profiles from, separated
+// by colons. Relative directories are resolved against the current directory.
+func (m *Manager) SetProfileDirs(dirs string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, dir := range filepath.SplitList(dirs) {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+
+		m.profileDirs = append(m.profileDirs, dir)
+	}
+}
+
+// profileSearchDirs returns the directories to load profiles from, in order
+// of precedence: those set with SetProfileDirs, those in ProfilePathEnv,
+// those in the config, and finally the system paths.
+func (m *Manager) profileSearchDirs() []string {
+	return profileSearchDirs(m.profileDirs, m.Config)
+}
+
+// profileSearchDirs returns the directories to load profiles from, with the
+// given directories taking precedence over ProfilePathEnv, the config and
+// the system paths.
+func profileSearchDirs(extra []string, config *Config) []string {
+	dirs := append([]string{}, extra...)
+
+	for _, dir := range filepath.SplitList(os.Getenv(ProfilePathEnv)) {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	dirs = append(dirs, config.ProfileDirs...)
+
+	return append(dirs, ConfigPaths...)
+}
+
 // SetProfile will attempt to initialise the manager with a given profile
 // Currently this is locked to a backing image specification, but in future
 // will be expanded to support profiles *based* on backing images.
@@ -164,9 +273,11 @@ func (m *Manager) SetProfile(profile string) error {
 		profile = m.Config.DefaultProfile
 	}
 
-	prof, err := NewProfile(profile)
+	dirs := m.profileSearchDirs()
+
+	prof, err := NewProfileFromDirs(profile, dirs)
 	if err != nil {
-		EmitProfileError(profile)
+		EmitProfileError(profile, dirs)
 		return err
 	}
 
@@ -179,8 +290,40 @@ func (m *Manager) SetProfile(profile string) error {
 		return ErrManagerInitialised
 	}
 
+	proxy := m.Config.Proxy
+	if prof.Proxy != nil {
+		if err = prof.Proxy.Validate(); err != nil {
+			slog.Error("Invalid proxy in profile", "profile", profile, "err", err)
+			return err
+		}
+
+		proxy = *prof.Proxy
+	}
+
+	ApplyProxy(proxy)
+
+	if prof.Compression != "" {
+		if _, err = ParseCompression(prof.Compression); err != nil {
+			slog.Error("Invalid compression in profile", "profile", profile, "err", err)
+			return err
+		}
+
+		m.Config.Compression = prof.Compression
+	}
+
+	mirrors := m.Config.ImageMirrors
+	if len(prof.ImageMirrors) > 0 {
+		if err = ValidateMirrors(prof.ImageMirrors); err != nil {
+			slog.Error("Invalid image mirrors in profile", "profile", profile, "err", err)
+			return err
+		}
+
+		mirrors = prof.ImageMirrors
+	}
+
 	m.profile = prof
 	m.image = NewBackingImage(m.profile.Image)
+	m.image.SetMirrors(mirrors)
 
 	return nil
 }
@@ -193,6 +336,15 @@ func (m *Manager) GetProfile() *Profile {
 	return m.profile
 }
 
+// GetImage will return the backing image of the profile associated with this
+// builder.
+func (m *Manager) GetImage() *BackingImage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.image
+}
+
 // SetPackage will set the package associated with this manager.
 // This package will be used in build & chroot operations only.
 func (m *Manager) SetPackage(pkg *Package) error {
@@ -207,7 +359,18 @@ func (m *Manager) SetPackage(pkg *Package) error {
 		return ErrProfileNotInstalled
 	}
 
-	if m.Config.EnableHistory {
+	if m.history != nil {
+		if pkg.Type != PackageTypeYpkg {
+			slog.Warn("Ignoring history file for legacy package")
+
+			m.history = nil
+		} else if latest := m.history.Updates[0].Package; latest.Release != pkg.Release {
+			slog.Error("History file does not match package", "history_release", latest.Release,
+				"package_release", pkg.Release)
+
+			return ErrHistoryMismatch
+		}
+	} else if m.Config.EnableHistory {
 		slog.Info("History generation enabled")
 
 		// Obtain package history for git builds
@@ -232,7 +395,13 @@ func (m *Manager) SetPackage(pkg *Package) error {
 
 	m.pkg = pkg
 	m.overlay = NewOverlay(m.Config, m.profile, m.image, m.pkg)
-	m.pkgManager = NewEopkgManager(m, m.overlay.MountPoint)
+
+	pkgManager, err := NewPackageManager(m.profile.PackageManager, m, m.overlay.MountPoint)
+	if err != nil {
+		return err
+	}
+
+	m.pkgManager = pkgManager
 
 	return nil
 }
@@ -269,9 +438,7 @@ func (m *Manager) Cleanup() {
 	slog.Debug("Cleaning up")
 
 	if m.pkgManager != nil {
-		// Potentially unnecessary but meh
-		m.pkgManager.StopDBUS()
-		// Always needed
+		// Tears down dbus regardless of any phase still holding it
 		m.pkgManager.Cleanup()
 	}
 
@@ -323,6 +490,14 @@ func (m *Manager) Cleanup() {
 	}
 }
 
+// verifyImage will check the image for damage if it is due to be verified,
+// or verification was requested.
+func (m *Manager) verifyImage() error {
+	interval := time.Duration(m.Config.ImageVerifyInterval) * 24 * time.Hour
+
+	return m.image.Verify(interval, VerifyImage)
+}
+
 // doLock will handle the relevant locking operation for the given path.
 func (m *Manager) doLock(path, opType string) error {
 	// Handle file locking
@@ -364,9 +539,36 @@ func (m *Manager) SigIntCleanup() {
 	}()
 }
 
+// watchContext will cancel the manager once ctx is done, killing the task
+// running within the root so that the operation fails and cleans up after
+// itself as normal. Downloads are given ctx to abandon themselves. Any error
+// is then replaced with ErrInterrupted.
+func (m *Manager) watchContext(ctx context.Context, err *error) func() {
+	stop := context.AfterFunc(ctx, func() {
+		slog.Warn("Operation cancelled, cleaning up")
+		m.SetCancelled()
+
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		if m.activePID > 0 {
+			syscall.Kill(-m.activePID, syscall.SIGKILL)
+		}
+	})
+
+	return func() {
+		stop()
+
+		if ctx.Err() != nil {
+			*err = fmt.Errorf("%w: %w", ErrInterrupted, context.Cause(ctx))
+		}
+	}
+}
+
 // Build will attempt to build the package associated with this manager,
-// automatically handling any required cleanups.
-func (m *Manager) Build() error {
+// automatically handling any required cleanups. Cancelling ctx will
+// interrupt the build.
+func (m *Manager) Build(ctx context.Context) (err error) {
 	if m.IsCancelled() {
 		return ErrInterrupted
 	}
@@ -378,13 +580,36 @@ func (m *Manager) Build() error {
 	}
 	m.lock.Unlock()
 
-	// Now get on with the real work!
+	// Record the outcome once everything else has finished
+	start := time.Now()
+	CollectedArtifacts = nil
+
+	defer func() {
+		rec := NewAuditRecord(AuditBuild, start, err)
+		rec.Package = fmt.Sprintf("%s-%s-%d", m.pkg.Name, m.pkg.Version, m.pkg.Release)
+		rec.AddArtifacts(CollectedArtifacts)
+
+		if auditErr := m.Audit(rec); err == nil {
+			err = auditErr
+		}
+	}()
+
+	if err := m.checkLegacy(); err != nil {
+		return err
+	}
+
+	// Now get on with the real work! Cache usage is reported once the
+	// package cache has been merged by the cleanup.
+	BuildCacheUsage = &CacheUsage{}
+
+	defer m.reportCacheUsage()
 	defer m.Cleanup()
-	m.SigIntCleanup()
+	defer m.watchContext(ctx, &err)()
 
 	// Now set our options according to the config
 	m.overlay.EnableTmpfs = m.Config.EnableTmpfs
 	m.overlay.TmpfsSize = m.Config.TmpfsSize
+	m.overlay.DiskQuota = m.Config.DiskQuota
 
 	if !ValidMemSize(m.overlay.TmpfsSize) && m.overlay.EnableTmpfs {
 		log.Panic("Invalid memory size specified", "tmpfs_size", m.overlay.TmpfsSize)
@@ -394,11 +619,284 @@ func (m *Manager) Build() error {
 		return err
 	}
 
-	return m.pkg.Build(m, m.history, m.GetProfile(), m.pkgManager, m.overlay, m.manifestTarget)
+	if err := m.verifyImage(); err != nil {
+		return err
+	}
+
+	if err := EnforceCacheBudget(m.Config, m.pkg, m.overlay); err != nil {
+		return err
+	}
+
+	m.reportExpectedTime(start)
+
+	if err := EnforceLogRetention(m.Config); err != nil {
+		slog.Warn("Failed to enforce build log retention", "err", err)
+	}
+
+	WarnActiveDeprecations()
+
+	// Load the key up front, rather than failing after the build
+	signer, err := NewSigner(m.Config.SigningKey, m.Config.SigningURL)
+	if err != nil {
+		return err
+	}
+
+	ArtifactSigner = signer
+
+	logPath, closeLog, err := OpenBuildLog(m.pkg, m.secrets)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	defer m.reportTimings(logPath)
+	defer m.reportTests(logPath)
+	defer m.reportSandbox(logPath)
+
+	BuildSandbox = nil
+
+	if err := m.applyBuildEnvironment(); err != nil {
+		return err
+	}
+
+	if ContainerMode {
+		if err := CheckContainerPrivileges(); err != nil {
+			return err
+		}
+	}
+
+	if m.Config.PoolSize > 0 {
+		m.overlay.Pool = NewPool(m.Config, m.profile)
+		defer m.refillPool()
+	}
+
+	// Containers have no systemd-logind to inhibit shutdown
+	if m.inhibitor == nil {
+		m.inhibitor = NewInhibitor(m.Config.InhibitShutdown && !ContainerMode)
+	}
+
+	inhibitMsg := fmt.Sprintf("Build in Progress: %s-%s-%d. Please wait for the build to complete",
+		m.pkg.Name, m.pkg.Version, m.pkg.Release)
+
+	if inhibitLock, err := m.inhibitor.Inhibit(inhibitMsg); err != nil {
+		slog.Warn("Failed to inhibit shutdown during the build", "err", err)
+	} else {
+		defer inhibitLock.Close()
+	}
+
+	m.overlay.Toolchain = m.toolchain
+
+	if err = m.pkg.Build(ctx, m, m.history, m.GetProfile(), m.pkgManager, m.overlay, m.manifestTarget, m.secrets); err != nil {
+		if CaptureHome {
+			m.captureHome(logPath)
+		}
+
+		if m.overlay.QuotaExceeded() {
+			return fmt.Errorf("%w of %s, reason: %w", ErrQuotaExceeded, m.overlay.DiskQuota, err)
+		}
+
+		if m.overlay.TmpfsFull() {
+			return m.overlay.TmpfsError(err)
+		}
+
+		return err
+	}
+
+	m.rememberSettings()
+	m.recordDuration(start)
+
+	return nil
+}
+
+// reportTimings will print the breakdown of time spent in the chroot, and
+// store it alongside the build log.
+func (m *Manager) reportTimings(logPath string) {
+	slog.Info("Build timings", "breakdown", Timings.Summary())
+
+	path := strings.TrimSuffix(logPath, BuildLogSuffix) + TimingsSuffix
+	if err := Timings.Write(path); err != nil {
+		slog.Warn("Failed to store build timings", "path", path, "err", err)
+	}
+}
+
+// captureHome will archive the build user's home alongside the build log,
+// unless secrets were used, which the build may have left within it.
+func (m *Manager) captureHome(logPath string) {
+	if len(m.secrets) > 0 {
+		slog.Warn("Not capturing the home directory of a build using secrets")
+		return
+	}
+
+	path := strings.TrimSuffix(logPath, BuildLogSuffix) + HomeArchiveSuffix
+	if err := m.overlay.ArchiveHome(path); err != nil {
+		slog.Warn("Failed to capture home directory", "err", err)
+		return
+	}
+
+	slog.Info("Captured home directory of the failed build", "path", path)
+}
+
+// reportSandbox will store the summary of the sandbox the build ran in
+// alongside the build log.
+func (m *Manager) reportSandbox(logPath string) {
+	if BuildSandbox == nil {
+		return
+	}
+
+	path := strings.TrimSuffix(logPath, BuildLogSuffix) + SandboxSuffix
+	if err := BuildSandbox.Write(path); err != nil {
+		slog.Warn("Failed to store sandbox summary", "path", path, "err", err)
+	}
+}
+
+// reportTests will print the outcome of any test suites run during the
+// build, and store them alongside the build log, along with the logs of the
+// test harnesses if requested.
+func (m *Manager) reportTests(logPath string) {
+	results, err := ReadTestResults(logPath)
+	if err != nil {
+		slog.Warn("Failed to read test results", "path", logPath, "err", err)
+		return
+	}
+
+	if len(results) == 0 {
+		return
+	}
+
+	for _, result := range results {
+		if result.Failed > 0 {
+			slog.Warn("Test results", "suite", result.String())
+		} else {
+			slog.Info("Test results", "suite", result.String())
+		}
+	}
+
+	base := strings.TrimSuffix(logPath, BuildLogSuffix)
+
+	if err = WriteTestResults(base+TestResultsSuffix, results); err != nil {
+		slog.Warn("Failed to store test results", "path", base+TestResultsSuffix, "err", err)
+	}
+
+	if !m.Config.KeepTestLogs {
+		return
+	}
+
+	kept, err := KeepTestLogs(m.overlay.UpperDir, base+TestLogsSuffix)
+	if err != nil {
+		slog.Warn("Failed to keep test logs", "err", err)
+	}
+
+	// An isolated home is not part of the overlay
+	if m.overlay.mountedHome {
+		home := BuildUserHome[1:]
+
+		homeKept, err := KeepTestLogs(filepath.Join(m.overlay.MountPoint, home), filepath.Join(base+TestLogsSuffix, home))
+		if err != nil {
+			slog.Warn("Failed to keep test logs", "err", err)
+		}
+
+		kept += homeKept
+	}
+
+	if kept > 0 {
+		slog.Info("Kept test logs", "count", kept, "dir", base+TestLogsSuffix)
+	}
+}
+
+// applyBuildEnvironment will copy the build settings of the config into the
+// package globals read while building, falling back to the defaults. An
+// invalid setting fails the build, rather than being silently ignored.
+func (m *Manager) applyBuildEnvironment() error {
+	BuildLocale = DefaultLocale
+	if m.Config.Locale != "" {
+		BuildLocale = m.Config.Locale
+	}
+
+	BuildTimezone = m.Config.Timezone
+
+	LoginShell = BuildUserShell
+	if m.Config.ChrootShell != "" {
+		LoginShell = m.Config.ChrootShell
+	}
+
+	CheckImage = m.Config.CheckImage
+	CheckReleases = m.Config.CheckRelease
+	DNSServers = m.Config.DNSServers
+
+	var err error
+
+	if source.HTTPPolicy, err = source.ParseInsecurePolicy(m.Config.HTTPSources); err != nil {
+		return fmt.Errorf("Invalid http_sources, reason: %w", err)
+	}
+
+	if source.GitRemotePolicy, err = source.ParseRemotePolicy(m.Config.GitRemotePolicy); err != nil {
+		return fmt.Errorf("Invalid git_remote_policy, reason: %w", err)
+	}
+
+	source.AllowedRemotes = m.Config.GitRemoteAllow
+	source.DeniedRemotes = m.Config.GitRemoteDeny
+
+	StrictMode = m.Config.Strict
+	if StrictMode && source.HTTPPolicy == source.InsecureWarn {
+		source.HTTPPolicy = source.InsecureDeny
+	}
+
+	if StrictMode && source.GitRemotePolicy == source.RemoteWarn {
+		source.GitRemotePolicy = source.RemoteEnforce
+	}
+
+	source.UpgradeHTTP = m.Config.UpgradeHTTP
+	KeepDBUS = m.Config.KeepDBUS
+
+	ContainerMode = UseContainerMode(m.Config.ContainerMode)
+	if ContainerMode {
+		slog.Info("Running within a container")
+	}
+
+	CcacheDependMode = m.Config.CcacheDependMode
+	StateMaxSize = m.Config.StateMaxSize
+
+	if StallWarn, err = parseDuration("stall_warn", m.Config.StallWarn); err != nil {
+		return err
+	}
+
+	if StallKill, err = parseDuration("stall_kill", m.Config.StallKill); err != nil {
+		return err
+	}
+
+	if CPUAffinity, err = ResolveAffinity(m.Config.CPUs, m.Config.NUMANodes); err != nil {
+		return fmt.Errorf("Invalid cpus or numa_nodes, reason: %w", err)
+	}
+
+	IsolateHome = m.Config.IsolateHome
+	UseMetacopy = m.Config.OverlayMetacopy
+	UseIDMap = m.Config.IDMappedMounts
+
+	if CompressionLevel, err = ParseCompression(m.Config.Compression); err != nil {
+		return err
+	}
+
+	if CollectLayout, err = ParseArtifactLayout(m.Config.ArtifactLayout); err != nil {
+		return fmt.Errorf("Invalid artifact_layout, reason: %w", err)
+	}
+
+	ManifestName = DefaultManifestName
+	if m.Config.ManifestName != "" {
+		ManifestName = m.Config.ManifestName
+	}
+
+	LowMemory = m.Config.LowMemory
+	if LowMemory && m.overlay.EnableTmpfs {
+		slog.Warn("Not building in a tmpfs in low memory mode")
+
+		m.overlay.EnableTmpfs = false
+	}
+
+	return nil
 }
 
 // Chroot will enter the build environment to allow users to introspect it.
-func (m *Manager) Chroot() error {
+// Cancelling ctx will end the session.
+func (m *Manager) Chroot(ctx context.Context) (err error) {
 	if m.IsCancelled() {
 		return ErrInterrupted
 	}
@@ -410,19 +908,40 @@ func (m *Manager) Chroot() error {
 	}
 	m.lock.Unlock()
 
+	if err := m.checkLegacy(); err != nil {
+		return err
+	}
+
 	// Now get on with the real work!
 	defer m.Cleanup()
-	m.SigIntCleanup()
+	defer m.watchContext(ctx, &err)()
 
 	if err := m.doLock(m.overlay.LockPath, "chroot"); err != nil {
 		return err
 	}
 
+	if err := m.verifyImage(); err != nil {
+		return err
+	}
+
+	if err := m.applyBuildEnvironment(); err != nil {
+		return err
+	}
+
+	if ContainerMode {
+		if err := CheckContainerPrivileges(); err != nil {
+			return err
+		}
+	}
+
+	m.overlay.Toolchain = m.toolchain
+
 	return m.pkg.Chroot(m, m.pkgManager, m.overlay)
 }
 
-// Update will attempt to update the base image.
-func (m *Manager) Update() error {
+// Update will attempt to update the base image. Cancelling ctx will
+// interrupt the update.
+func (m *Manager) Update(ctx context.Context) (err error) {
 	if m.IsCancelled() {
 		return ErrInterrupted
 	}
@@ -438,22 +957,55 @@ func (m *Manager) Update() error {
 		return ErrProfileNotInstalled
 	}
 
+	pkgManager, err := NewPackageManager(m.profile.PackageManager, m, m.image.RootDir)
+	if err != nil {
+		m.lock.Unlock()
+		return err
+	}
+
 	m.updateMode = true
-	m.pkgManager = NewEopkgManager(m, m.image.RootDir)
+	m.pkgManager = pkgManager
 	m.lock.Unlock()
 
+	start := time.Now()
+
+	defer func() {
+		if auditErr := m.Audit(NewAuditRecord(AuditUpdate, start, err)); err == nil {
+			err = auditErr
+		}
+	}()
+
 	defer m.Cleanup()
-	m.SigIntCleanup()
+	defer m.watchContext(ctx, &err)()
 
 	if err := m.doLock(m.image.LockPath, "updating"); err != nil {
 		return err
 	}
 
-	return m.image.Update(m, m.pkgManager)
+	DNSServers = m.Config.DNSServers
+	CheckUpdates = m.Config.CheckUpdate
+	ImageGenerations = m.Config.ImageGenerations
+
+	if err = m.image.Update(m, m.pkgManager); err != nil {
+		m.image.AbandonUpdate()
+		return err
+	}
+
+	// The image only settles once unmounted, so hash it afterwards
+	m.pkgManager.Cleanup()
+	disk.GetMountManager().UnmountAll()
+
+	if err = m.image.CommitUpdate(); err != nil {
+		m.image.AbandonUpdate()
+		return err
+	}
+
+	return nil
 }
 
-// Index will attempt to index the given directory for eopkgs.
-func (m *Manager) Index(dir string) error {
+// Index will attempt to index the given directory for eopkgs. Cancelling
+// ctx will interrupt indexing.
+func (m *Manager) Index(ctx context.Context, dir string) (err error) {
 	if m.IsCancelled() {
 		return ErrInterrupted
 	}
@@ -465,9 +1017,13 @@ func (m *Manager) Index(dir string) error {
 	}
 	m.lock.Unlock()
 
+	if err := m.checkLegacy(); err != nil {
+		return err
+	}
+
 	// Now get on with the real work!
 	defer m.Cleanup()
-	m.SigIntCleanup()
+	defer m.watchContext(ctx, &err)()
 
 	// Now set our options according to the config
 	m.overlay.EnableTmpfs = m.Config.EnableTmpfs
@@ -481,7 +1037,73 @@ func (m *Manager) Index(dir string) error {
 		return err
 	}
 
-	return m.pkg.Index(m, dir, m.overlay)
+	DNSServers = m.Config.DNSServers
+
+	return m.pkg.Index(m, dir, m.overlay, m.pkgManager)
+}
+
+// ABIReport will generate the ABI report of the install root or .eopkg files
+// at the given paths into outputDir. Cancelling ctx will interrupt it.
+func (m *Manager) ABIReport(ctx context.Context, paths []string, outputDir string) (err error) {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+
+	m.lock.Lock()
+	if m.pkg == nil {
+		m.lock.Unlock()
+		return ErrNoPackage
+	}
+	m.lock.Unlock()
+
+	if err := m.checkLegacy(); err != nil {
+		return err
+	}
+
+	// Now get on with the real work!
+	defer m.Cleanup()
+	defer m.watchContext(ctx, &err)()
+
+	if err := m.doLock(m.overlay.LockPath, "abireport"); err != nil {
+		return err
+	}
+
+	return m.pkg.ABIReport(m, paths, outputDir, m.overlay)
+}
+
+// SelfTest will run the self test probes within a build root, reporting
+// whether the sandbox held against each. Cancelling ctx will interrupt it.
+func (m *Manager) SelfTest(ctx context.Context) (results []SelfTestResult, err error) {
+	if m.IsCancelled() {
+		return nil, ErrInterrupted
+	}
+
+	m.lock.Lock()
+	if m.pkg == nil {
+		m.lock.Unlock()
+		return nil, ErrNoPackage
+	}
+	m.lock.Unlock()
+
+	// Now get on with the real work!
+	defer m.Cleanup()
+	defer m.watchContext(ctx, &err)()
+
+	if err := m.doLock(m.overlay.LockPath, "selftest"); err != nil {
+		return nil, err
+	}
+
+	if err := m.verifyImage(); err != nil {
+		return nil, err
+	}
+
+	if ContainerMode {
+		if err := CheckContainerPrivileges(); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.pkg.SelfTest(m, m.overlay)
 }
 
 // SetTmpfs sets the manager tmpfs option.
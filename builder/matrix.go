@@ -0,0 +1,192 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// matrixFlags are the flags, each taking a value, that are replaced for the
+// build with each profile of a build matrix.
+var matrixFlags = map[string]bool{
+	"-p":                true,
+	"--profile":         true,
+	"--profiles":        true,
+	"--output-dir":      true,
+	"--artifact-layout": true,
+}
+
+// Exit codes of a build matrix, so that CI can tell a partial failure from
+// a total one.
+const (
+	// MatrixExitSuccess is used when every build succeeded.
+	MatrixExitSuccess = 0
+
+	// MatrixExitFailure is used when no build succeeded.
+	MatrixExitFailure = 1
+
+	// MatrixExitPartial is used when some builds succeeded, but others failed
+	// or were skipped.
+	MatrixExitPartial = 2
+)
+
+// A MatrixResult is the outcome of building with one profile of a build
+// matrix.
+type MatrixResult struct {
+	Profile   string
+	OutputDir string
+	Duration  time.Duration
+	Err       error
+	Skipped   bool // Not built, as an earlier build failed with fail fast
+}
+
+// Succeeded determines whether the profile was built successfully.
+func (r *MatrixResult) Succeeded() bool {
+	return r.Err == nil && !r.Skipped
+}
+
+// MatrixArgs will rewrite the arguments of a matrix build, without the
+// program name, to build with a single profile into the given directory with
+// the given artifact layout.
+func MatrixArgs(args []string, profile, outputDir string, layout ArtifactLayout) []string {
+	if len(args) == 0 {
+		return nil
+	}
+
+	// The sub-command must come first
+	ret := []string{args[0], "-p", profile, "--output-dir", outputDir, "--artifact-layout", string(layout)}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case matrixFlags[arg]:
+			i++
+		case len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.HasSuffix(arg, "p"):
+			// Grouped short flags ending with -p
+			ret = append(ret, strings.TrimSuffix(arg, "p"))
+			i++
+		default:
+			ret = append(ret, arg)
+		}
+	}
+
+	return ret
+}
+
+// BuildMatrix will build the package with each of the profiles in turn,
+// collecting each build into outputDir with the given layout. Every
+// build runs in a separate solbuild process, so that nothing leaks between
+// them. A failure does not prevent building with the later profiles, unless
+// failFast is set, in which case they are skipped.
+func BuildMatrix(args, profiles []string, outputDir string, layout ArtifactLayout, failFast bool) ([]*MatrixResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*MatrixResult, 0, len(profiles))
+	failed := false
+
+	for _, profile := range profiles {
+		result := &MatrixResult{
+			Profile:   profile,
+			OutputDir: layout.ArtifactDir(outputDir, profile),
+		}
+
+		if failed && failFast {
+			slog.Warn("Skipping profile after an earlier failure", "profile", profile)
+
+			result.Skipped = true
+			results = append(results, result)
+
+			continue
+		}
+
+		slog.Info("Building with profile", "profile", profile, "output", result.OutputDir)
+
+		c := exec.Command(exe, MatrixArgs(args, profile, outputDir, layout)...)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+
+		started := time.Now()
+		result.Err = c.Run()
+		result.Duration = time.Since(started)
+
+		if result.Err != nil {
+			slog.Error("Build failed with profile", "profile", profile, "err", result.Err)
+
+			failed = true
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// WriteMatrixSummary will write a table of the results of a build matrix.
+func WriteMatrixSummary(w io.Writer, results []*MatrixResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "PROFILE\tRESULT\tDURATION\tOUTPUT")
+
+	for _, result := range results {
+		outcome := "ok"
+
+		switch {
+		case result.Skipped:
+			outcome = "skipped"
+		case result.Err != nil:
+			outcome = "failed"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Profile, outcome, result.Duration.Round(time.Second), result.OutputDir)
+	}
+
+	return tw.Flush()
+}
+
+// MatrixExitCode returns the exit code reflecting the results of a build
+// matrix: MatrixExitSuccess when every build succeeded, MatrixExitFailure
+// when none did, and otherwise MatrixExitPartial.
+func MatrixExitCode(results []*MatrixResult) int {
+	succeeded := 0
+
+	for _, result := range results {
+		if result.Succeeded() {
+			succeeded++
+		}
+	}
+
+	switch succeeded {
+	case len(results):
+		return MatrixExitSuccess
+	case 0:
+		return MatrixExitFailure
+	default:
+		return MatrixExitPartial
+	}
+}
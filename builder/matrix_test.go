@@ -0,0 +1,88 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestMatrixArgs(t *testing.T) {
+	args := []string{"build", "-d", "--profiles", "main-x86_64,unstable-x86_64", "-tp", "main-x86_64", "--output-dir", "out", "package.yml"}
+
+	got := strings.Join(builder.MatrixArgs(args, "unstable-x86_64", "out", builder.LayoutProfileDir), " ")
+	expected := "build -p unstable-x86_64 --output-dir out --artifact-layout profile-dir -d -t package.yml"
+
+	if got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestWriteMatrixSummary(t *testing.T) {
+	results := []*builder.MatrixResult{
+		{Profile: "main-x86_64", OutputDir: "main-x86_64", Duration: 90 * time.Second},
+		{Profile: "unstable-x86_64", OutputDir: "unstable-x86_64", Duration: time.Second, Err: errors.New("exit status 1")},
+		{Profile: "main-i686", OutputDir: "main-i686", Skipped: true},
+	}
+
+	var buf bytes.Buffer
+	if err := builder.WriteMatrixSummary(&buf, results); err != nil {
+		t.Fatalf("Failed to write summary: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got: %q", buf.String())
+	}
+
+	if fields := strings.Fields(lines[1]); fields[1] != "ok" || fields[2] != "1m30s" {
+		t.Fatalf("Wrong row for main-x86_64: %q", lines[1])
+	}
+
+	if fields := strings.Fields(lines[2]); fields[1] != "failed" {
+		t.Fatalf("Wrong row for unstable-x86_64: %q", lines[2])
+	}
+
+	if fields := strings.Fields(lines[3]); fields[1] != "skipped" {
+		t.Fatalf("Wrong row for main-i686: %q", lines[3])
+	}
+}
+
+func TestMatrixExitCode(t *testing.T) {
+	ok := &builder.MatrixResult{Profile: "main-x86_64"}
+	failed := &builder.MatrixResult{Profile: "unstable-x86_64", Err: errors.New("exit status 1")}
+	skipped := &builder.MatrixResult{Profile: "main-i686", Skipped: true}
+
+	for _, tc := range []struct {
+		results  []*builder.MatrixResult
+		expected int
+	}{
+		{[]*builder.MatrixResult{ok, ok}, builder.MatrixExitSuccess},
+		{[]*builder.MatrixResult{ok, failed}, builder.MatrixExitPartial},
+		{[]*builder.MatrixResult{ok, failed, skipped}, builder.MatrixExitPartial},
+		{[]*builder.MatrixResult{failed, skipped}, builder.MatrixExitFailure},
+	} {
+		if code := builder.MatrixExitCode(tc.results); code != tc.expected {
+			t.Fatalf("Expected exit code %d, got %d", tc.expected, code)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// A CacheMigration moves the contents of an obsolete cache directory into
+// the unified layout beneath CacheDirectory.
+type CacheMigration struct {
+	From  string                // Obsolete cache directory
+	To    string                // Directory of the cache in the unified layout
+	Valid func(rel string) bool // Whether an entry is still of use
+}
+
+// CacheMigrations are the obsolete cache directories, and where their
+// contents now live.
+var CacheMigrations = cacheMigrations()
+
+// cacheMigrations finds where the obsolete cache directories move to within
+// the current CacheDirectory.
+func cacheMigrations() []CacheMigration {
+	return []CacheMigration{
+		{ObsoleteCcacheDirectory, filepath.Join(CacheDirectory, Ccache.Name), validCcacheEntry},
+		{ObsoleteLegacyCcacheDirectory, filepath.Join(CacheDirectory, Ccache.Name), validCcacheEntry},
+		{ObsoleteSccacheDirectory, filepath.Join(CacheDirectory, Sccache.Name), validCacheEntry},
+		{ObsoleteLegacySccacheDirectory, filepath.Join(CacheDirectory, Sccache.Name), validCacheEntry},
+	}
+}
+
+// A MigrationResult summarises a migrated cache directory.
+type MigrationResult struct {
+	Moved   int   // Entries moved into the unified layout
+	Size    int64 // Total size of the moved entries
+	Skipped int   // Entries dropped as invalid or already present
+}
+
+// validCacheEntry determines whether the entry is cached data, rather than
+// bookkeeping left behind by the cache.
+func validCacheEntry(rel string) bool {
+	name := filepath.Base(rel)
+
+	return !strings.HasSuffix(name, ".lock") && !strings.Contains(name, ".tmp")
+}
+
+// validCcacheEntry determines whether the entry is a ccache 4 result or
+// manifest, as older entries are ignored by ccache 4. Statistics are left
+// to the unified cache.
+func validCcacheEntry(rel string) bool {
+	if rel == "ccache.conf" {
+		return true
+	}
+
+	if !validCacheEntry(rel) || filepath.Base(rel) == "stats" {
+		return false
+	}
+
+	return strings.HasSuffix(rel, "R") || strings.HasSuffix(rel, "M")
+}
+
+// Migrate will move every valid entry of the obsolete directory into the
+// unified layout, never replacing an entry already there, and then remove
+// the obsolete directory.
+func (c *CacheMigration) Migrate() (*MigrationResult, error) {
+	res := &MigrationResult{}
+
+	if !PathExists(c.From) {
+		return res, nil
+	}
+
+	err := filepath.WalkDir(c.From, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(c.From, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(c.To, rel)
+
+		if !c.Valid(rel) || PathExists(target) {
+			res.Skipped++
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if err = os.MkdirAll(filepath.Dir(target), 0o0755); err != nil {
+			return err
+		}
+
+		if err = os.Rename(path, target); err != nil {
+			if err = disk.CopyFile(path, target); err != nil {
+				return err
+			}
+		}
+
+		res.Moved++
+		res.Size += info.Size()
+
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// The build user must be able to write to the migrated entries
+	if res.Moved > 0 {
+		err = filepath.WalkDir(c.To, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			return os.Lchown(path, BuildUserID, BuildUserGID)
+		})
+		if err != nil {
+			slog.Warn("Failed to give the build user the migrated cache", "path", c.To, "err", err)
+		}
+	}
+
+	slog.Debug("Removing obsolete cache directory", "path", c.From)
+
+	if err = os.RemoveAll(c.From); err != nil {
+		return res, err
+	}
+
+	// Remove the parent once every obsolete cache within it is gone
+	os.Remove(filepath.Dir(c.From))
+
+	return res, nil
+}
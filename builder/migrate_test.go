@@ -0,0 +1,89 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestMigrateCache(t *testing.T) {
+	from := filepath.Join(t.TempDir(), "ccache", "ypkg")
+	to := filepath.Join(t.TempDir(), "ccache")
+
+	entries := map[string]string{
+		"ccache.conf":        "max_size = 5G\n",
+		"a/b/0123456789abR":  "result",
+		"a/b/0123456789abM":  "manifest",
+		"a/b/stats":          "old stats",
+		"a/c/fedcba9876-1.o": "ccache 3 object",
+		"a/d/feedfacecafeR":  "stale result",
+		"a/d/tmp.cpp_stdout": "tmp.1234",
+	}
+
+	for rel, content := range entries {
+		path := filepath.Join(from, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o0755); err != nil {
+			t.Fatalf("Failed to create cache directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o0644); err != nil {
+			t.Fatalf("Failed to write cache entry: %v", err)
+		}
+	}
+
+	// Entries already in the unified layout are kept
+	if err := os.MkdirAll(filepath.Join(to, "a/d"), 0o0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(to, "a/d/feedfacecafeR"), []byte("fresh result"), 0o0644); err != nil {
+		t.Fatalf("Failed to write cache entry: %v", err)
+	}
+
+	migration := builder.CacheMigration{From: from, To: to, Valid: builder.CacheMigrations[0].Valid}
+
+	res, err := migration.Migrate()
+	if err != nil {
+		t.Fatalf("Failed to migrate cache: %v", err)
+	}
+
+	if res.Moved != 3 || res.Skipped != 4 {
+		t.Fatalf("Expected 3 moved and 4 skipped, got %d moved and %d skipped", res.Moved, res.Skipped)
+	}
+
+	for _, rel := range []string{"ccache.conf", "a/b/0123456789abR", "a/b/0123456789abM"} {
+		if !builder.PathExists(filepath.Join(to, rel)) {
+			t.Fatalf("Valid entry %s was not migrated", rel)
+		}
+	}
+
+	if kept, _ := os.ReadFile(filepath.Join(to, "a/d/feedfacecafeR")); string(kept) != "fresh result" {
+		t.Fatalf("Existing entry was replaced: %s", kept)
+	}
+
+	if builder.PathExists(filepath.Join(to, "a/b/stats")) || builder.PathExists(filepath.Join(to, "a/c/fedcba9876-1.o")) {
+		t.Fatal("Invalid entries were migrated")
+	}
+
+	if builder.PathExists(from) {
+		t.Fatal("Obsolete cache directory was not removed")
+	}
+}
@@ -0,0 +1,71 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// AcceptNewHash controls whether a source that no longer matches its hash,
+// such as an upstream tarball that was re-rolled, is accepted and the hash
+// in package.yml updated.
+var AcceptNewHash = false
+
+// handleMismatch will report a source that failed to match its hash,
+// accepting it if requested. Any other error is returned as is.
+func (p *Package) handleMismatch(err error) error {
+	var mismatch *source.ChecksumMismatch
+	if !errors.As(err, &mismatch) {
+		return err
+	}
+
+	attrs := []any{
+		"uri", mismatch.URI, "expected", mismatch.Expected, "actual", mismatch.Actual,
+		"size", mismatch.Size, "quarantine", mismatch.Quarantine,
+	}
+
+	if delta, ok := mismatch.SizeDelta(); ok {
+		attrs = append(attrs, "delta", fmt.Sprintf("%+d", delta))
+	}
+
+	slog.Error("Source does not match its hash", attrs...)
+
+	if p.Type != PackageTypeYpkg {
+		return err
+	}
+
+	if !AcceptNewHash {
+		slog.Info("Review the quarantined source, and pass --accept-new-hash to update package.yml if it is expected")
+		return err
+	}
+
+	if err := ReplaceSourceHash(p.Path, mismatch.Expected, mismatch.Actual); err != nil {
+		return fmt.Errorf("Failed to update the hash in %s, reason: %w", p.Path, err)
+	}
+
+	if err := mismatch.Accept(); err != nil {
+		return fmt.Errorf("Failed to accept the new source, reason: %w", err)
+	}
+
+	slog.Warn("Accepted new source hash", "uri", mismatch.URI, "hash", mismatch.Actual, "recipe", p.Path)
+
+	return nil
+}
@@ -26,10 +26,15 @@ import (
 func ConfigureNamespace() error {
 	slog.Debug("Configuring container namespace")
 
-	if err := syscall.Unshare(syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC); err != nil {
+	if err := syscall.Unshare(syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS); err != nil {
 		return fmt.Errorf("Failed to configure namespace, reason: %w\n", err)
 	}
 
+	// Builds should not see the host name
+	if err := syscall.Sethostname([]byte(BuildHostname)); err != nil {
+		return fmt.Errorf("Failed to set hostname, reason: %w\n", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,340 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Media types of the OCI image format, as written by ExportOCI.
+const (
+	OCIIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	OCIConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	OCILayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// ociLayoutVersion is the version of the image layout written.
+const ociLayoutVersion = "1.0.0"
+
+// OCIDescriptor refers to a blob of an OCI image by its digest.
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIIndex is the index.json of an OCI image layout.
+type OCIIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []OCIDescriptor `json:"manifests"`
+}
+
+// OCIManifest lists the config and layers of an OCI image.
+type OCIManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        OCIDescriptor   `json:"config"`
+	Layers        []OCIDescriptor `json:"layers"`
+}
+
+// OCIImageConfig describes how to run an OCI image, and the layers it is
+// made from.
+type OCIImageConfig struct {
+	Created      string `json:"created,omitempty"`
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		Env        []string `json:"Env,omitempty"`
+		Cmd        []string `json:"Cmd,omitempty"`
+		WorkingDir string   `json:"WorkingDir,omitempty"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ociDigest returns the digest of the hash in the form used by OCI images.
+func ociDigest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// ociBlob is a blob of the image, held in memory or in a file.
+type ociBlob struct {
+	desc OCIDescriptor
+	data []byte
+	path string
+}
+
+// newJSONBlob encodes v as a blob of the given media type.
+func newJSONBlob(mediaType string, v any) (*ociBlob, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return &ociBlob{
+		desc: OCIDescriptor{
+			MediaType: mediaType,
+			Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+			Size:      int64(len(data)),
+		},
+		data: data,
+	}, nil
+}
+
+// writeOCILayer will write the root as a compressed layer to path, returning
+// the descriptor of the layer and the digest of the uncompressed tarball.
+func writeOCILayer(root, path string) (OCIDescriptor, string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return OCIDescriptor{}, "", err
+	}
+	defer f.Close()
+
+	compressed := sha256.New()
+	counter := &countingWriter{}
+	zw := gzip.NewWriter(io.MultiWriter(f, compressed, counter))
+
+	uncompressed := sha256.New()
+
+	// tar keeps the hard links, device nodes and extended attributes of the
+	// image, sorted so the layer is reproducible
+	var stderr bytes.Buffer
+
+	c := exec.Command("tar", "--numeric-owner", "--xattrs", "--xattrs-include=*", "--sort=name",
+		"-C", root, "-cf", "-", ".")
+	c.Stdout = io.MultiWriter(zw, uncompressed)
+	c.Stderr = &stderr
+
+	if err = c.Run(); err != nil {
+		return OCIDescriptor{}, "", fmt.Errorf("Failed to archive %s, reason: %w: %s\n", root, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err = zw.Close(); err != nil {
+		return OCIDescriptor{}, "", err
+	}
+
+	desc := OCIDescriptor{
+		MediaType: OCILayerMediaType,
+		Digest:    ociDigest(compressed),
+		Size:      counter.n,
+	}
+
+	return desc, ociDigest(uncompressed), f.Close()
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+
+	return len(p), nil
+}
+
+// ExportOCI will write the root as an OCI image archive to dest, which may
+// be loaded with podman or docker. The image is tagged with name, and
+// created is recorded as the time the image was made.
+func ExportOCI(root, dest, name string, created time.Time) error {
+	// The layer is as large as the image, so keep it beside dest rather than
+	// in a tmpfs
+	dir, err := os.MkdirTemp(filepath.Dir(dest), ".solbuild-oci-")
+	if err != nil {
+		return fmt.Errorf("Failed to create required directories, reason: %w\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	slog.Info("Archiving image", "root", root)
+
+	layerPath := filepath.Join(dir, "layer.tar.gz")
+
+	layer, diffID, err := writeOCILayer(root, layerPath)
+	if err != nil {
+		return err
+	}
+
+	config := OCIImageConfig{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+	}
+
+	if !created.IsZero() {
+		config.Created = created.UTC().Format(time.RFC3339)
+	}
+
+	config.Config.Env = []string{"PATH=/usr/bin:/usr/sbin:/bin:/sbin"}
+	config.Config.Cmd = []string{BuildUserShell, "--login"}
+	config.Config.WorkingDir = "/"
+	config.RootFS.Type = "layers"
+	config.RootFS.DiffIDs = []string{diffID}
+
+	configBlob, err := newJSONBlob(OCIConfigMediaType, config)
+	if err != nil {
+		return err
+	}
+
+	manifestBlob, err := newJSONBlob(OCIManifestMediaType, OCIManifest{
+		SchemaVersion: 2,
+		MediaType:     OCIManifestMediaType,
+		Config:        configBlob.desc,
+		Layers:        []OCIDescriptor{layer},
+	})
+	if err != nil {
+		return err
+	}
+
+	ref := manifestBlob.desc
+	ref.Annotations = map[string]string{"org.opencontainers.image.ref.name": name}
+
+	index, err := json.Marshal(OCIIndex{
+		SchemaVersion: 2,
+		MediaType:     OCIIndexMediaType,
+		Manifests:     []OCIDescriptor{ref},
+	})
+	if err != nil {
+		return err
+	}
+
+	blobs := []*ociBlob{{desc: layer, path: layerPath}, configBlob, manifestBlob}
+
+	slog.Info("Writing OCI image", "dest", dest, "name", name)
+
+	tmp := dest + ".tmp"
+	if err = writeOCIArchive(tmp, index, blobs); err != nil {
+		os.Remove(tmp)
+
+		return fmt.Errorf("Failed to write OCI image %s, reason: %w\n", dest, err)
+	}
+
+	return os.Rename(tmp, dest)
+}
+
+// writeOCIArchive will write the image layout, with the index and blobs,
+// into the tarball at path.
+func writeOCIArchive(path string, index []byte, blobs []*ociBlob) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+
+	for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+		if err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0o0755}); err != nil {
+			return err
+		}
+	}
+
+	layout := []byte(fmt.Sprintf("{\"imageLayoutVersion\":%q}", ociLayoutVersion))
+	if err = writeOCIFile(tw, "oci-layout", bytes.NewReader(layout), int64(len(layout))); err != nil {
+		return err
+	}
+
+	if err = writeOCIFile(tw, "index.json", bytes.NewReader(index), int64(len(index))); err != nil {
+		return err
+	}
+
+	for _, blob := range blobs {
+		name := "blobs/sha256/" + strings.TrimPrefix(blob.desc.Digest, "sha256:")
+
+		if blob.path == "" {
+			err = writeOCIFile(tw, name, bytes.NewReader(blob.data), blob.desc.Size)
+		} else {
+			err = writeOCIFileFrom(tw, name, blob.path, blob.desc.Size)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeOCIFileFrom writes the file at src into the archive as name.
+func writeOCIFileFrom(tw *tar.Writer, name, src string, size int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeOCIFile(tw, name, f, size)
+}
+
+// writeOCIFile writes a regular file into the archive.
+func writeOCIFile(tw *tar.Writer, name string, r io.Reader, size int64) error {
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o0644, Size: size}); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(tw, r)
+
+	return err
+}
+
+// ExportOCI will write the backing image of the profile as an OCI image
+// archive to dest, mounting it read-only as InspectImage does.
+func (m *Manager) ExportOCI(dest string) error {
+	st, err := os.Stat(m.image.ImagePath)
+	if err != nil {
+		return ErrProfileNotInstalled
+	}
+
+	err = m.InspectImage(func(root string) error {
+		return ExportOCI(root, dest, m.profile.Name, st.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+
+	usr := GetUserInfo()
+	if err = os.Chown(dest, usr.UID, usr.GID); err != nil {
+		slog.Error("Error in restoring file ownership", "path", dest, "reason", err)
+	}
+
+	return nil
+}
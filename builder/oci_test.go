@@ -0,0 +1,183 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// readOCIArchive returns the files of the archive at path by name.
+func readOCIArchive(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", hdr.Name, err)
+		}
+
+		files[hdr.Name] = data
+	}
+
+	return files
+}
+
+// ociBlob returns the blob of the descriptor, checking its digest and size.
+func ociBlob(t *testing.T, files map[string][]byte, desc builder.OCIDescriptor) []byte {
+	t.Helper()
+
+	data, ok := files["blobs/sha256/"+strings.TrimPrefix(desc.Digest, "sha256:")]
+	if !ok {
+		t.Fatalf("Missing blob %s", desc.Digest)
+	}
+
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != desc.Digest || int64(len(data)) != desc.Size {
+		t.Fatalf("Blob %s does not match its descriptor", desc.Digest)
+	}
+
+	return data
+}
+
+func TestExportOCI(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "usr/bin/ypkg"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("usr/bin", filepath.Join(root, "bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "main-x86_64.oci.tar")
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := builder.ExportOCI(root, dest, "main-x86_64", created); err != nil {
+		t.Fatalf("Failed to export image: %v", err)
+	}
+
+	files := readOCIArchive(t, dest)
+
+	if string(files["oci-layout"]) != `{"imageLayoutVersion":"1.0.0"}` {
+		t.Fatalf("Unexpected oci-layout: %s", files["oci-layout"])
+	}
+
+	var index builder.OCIIndex
+	if err := json.Unmarshal(files["index.json"], &index); err != nil {
+		t.Fatalf("Failed to decode index: %v", err)
+	}
+
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations["org.opencontainers.image.ref.name"] != "main-x86_64" {
+		t.Fatalf("Expected a single manifest tagged with the profile, got: %+v", index.Manifests)
+	}
+
+	var manifest builder.OCIManifest
+	if err := json.Unmarshal(ociBlob(t, files, index.Manifests[0]), &manifest); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+
+	var config builder.OCIImageConfig
+	if err := json.Unmarshal(ociBlob(t, files, manifest.Config), &config); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+
+	if config.OS != "linux" || config.Created != "2024-01-02T03:04:05Z" {
+		t.Fatalf("Unexpected config: %+v", config)
+	}
+
+	if len(manifest.Layers) != 1 || len(config.RootFS.DiffIDs) != 1 {
+		t.Fatalf("Expected a single layer, got: %+v", manifest.Layers)
+	}
+
+	zr, err := gzip.NewReader(strings.NewReader(string(ociBlob(t, files, manifest.Layers[0]))))
+	if err != nil {
+		t.Fatalf("Failed to decompress layer: %v", err)
+	}
+
+	layer, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress layer: %v", err)
+	}
+
+	if sum := sha256.Sum256(layer); "sha256:"+hex.EncodeToString(sum[:]) != config.RootFS.DiffIDs[0] {
+		t.Fatal("Expected the diff_id to be the digest of the uncompressed layer")
+	}
+
+	found := make(map[string]*tar.Header)
+	tr := tar.NewReader(strings.NewReader(string(layer)))
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to read layer: %v", err)
+		}
+
+		found[strings.TrimPrefix(hdr.Name, "./")] = hdr
+	}
+
+	if hdr := found["usr/bin/ypkg"]; hdr == nil || hdr.Mode&0o111 == 0 {
+		t.Fatalf("Expected the executable in the layer, got: %v", found)
+	}
+
+	if hdr := found["bin"]; hdr == nil || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "usr/bin" {
+		t.Fatalf("Expected the symlink in the layer, got: %+v", hdr)
+	}
+
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(dest), ".solbuild-oci-*")); len(leftovers) != 0 {
+		t.Fatalf("Expected the layer to be removed, got: %v", leftovers)
+	}
+}
@@ -21,11 +21,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/getsolus/libosdev/commands"
 	"github.com/getsolus/libosdev/disk"
-
-	"github.com/getsolus/solbuild/cli/log"
 )
 
 // An Overlay is formed from a backing image & Package combination.
@@ -45,12 +44,26 @@ type Overlay struct {
 	EnableTmpfs bool   // Whether to use tmpfs for the upperdir or not
 	TmpfsSize   string // Size of the tmpfs to pass to mount, string form
 
+	DiskQuota string // Size of the scratch space the build may use, empty for no limit
+	QuotaPath string // Path to the sparse file backing the disk quota
+
 	ExtraMounts []string // Any extra mounts to take care of when cleaning up
 
+	StateSource string // Host directory of the persistent state of the package, if any
+
+	Toolchain []*ToolchainMount // Local tooling to mount over that of the image
+
+	Pool     *Pool // Pool to claim a pre-provisioned root from, if any
+	FromPool bool  // Whether the root was claimed from the pool
+
+	mappedMounts []string // Idmapped mounts within ExtraMounts, unknown to the mount manager
+
 	mountedImg     bool // Whether we mounted the image or not
 	mountedOverlay bool // Whether we mounted the overlay or not
 	mountedVFS     bool // Whether we mounted vfs or not
 	mountedTmpfs   bool // Whether we mounted tmpfs or not
+	mountedQuota   bool // Whether we mounted the disk quota filesystem or not
+	mountedHome    bool // Whether we mounted a tmpfs over the build user's home or not
 }
 
 // NewOverlay creates a new Overlay for us in builds, etc.
@@ -63,6 +76,11 @@ func NewOverlay(config *Config, profile *Profile, back *BackingImage, pkg *Packa
 	// i.e. /var/cache/solbuild/unstable-x86_64/nano
 	basedir := filepath.Join(config.OverlayRootDir, profile.Name, dirname)
 
+	return newOverlayAt(back, pkg, basedir)
+}
+
+// newOverlayAt creates a new Overlay rooted in the given directory.
+func newOverlayAt(back *BackingImage, pkg *Package, basedir string) *Overlay {
 	return &Overlay{
 		Back:           back,
 		Package:        pkg,
@@ -72,6 +90,7 @@ func NewOverlay(config *Config, profile *Profile, back *BackingImage, pkg *Packa
 		ImgDir:         filepath.Join(basedir, "img"),
 		MountPoint:     filepath.Join(basedir, "union"),
 		LockPath:       fmt.Sprintf("%s.lock", basedir),
+		QuotaPath:      basedir + QuotaImageSuffix,
 		mountedImg:     false,
 		mountedOverlay: false,
 		mountedVFS:     false,
@@ -150,6 +169,22 @@ func (o *Overlay) Mount() error {
 		if err := mountMan.Mount("tmpfs-root", o.BaseDir, "tmpfs", tmpfsOptions...); err != nil {
 			return fmt.Errorf("Failed to mount root tmpfs: point='%s' size='%s', reason: %w\n", o.BaseDir, o.TmpfsSize, err)
 		}
+
+		o.mountedTmpfs = true
+	}
+
+	// Bound the scratch space of the build, a tmpfs is already bounded
+	if !o.EnableTmpfs && o.DiskQuota != "" {
+		if err := o.mountQuota(); err != nil {
+			return err
+		}
+	}
+
+	// Fail early rather than with an opaque kernel error from the mount
+	if !o.EnableTmpfs {
+		if err := CheckOverlaySupport(o.BaseDir); err != nil {
+			return err
+		}
 	}
 
 	// Set up environment
@@ -161,7 +196,13 @@ func (o *Overlay) Mount() error {
 	slog.Debug("Mounting backing image", "point", o.Back.ImagePath)
 
 	if err := mountMan.Mount(o.Back.ImagePath, o.ImgDir, "auto", "ro", "loop"); err != nil {
-		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %w\n", o.Back.ImagePath, err)
+		if !Probe().LoopDevices {
+			return fmt.Errorf("Failed to mount backing image: point='%s', reason: %w. Loop devices are unavailable, "+
+				"try 'modprobe loop', or pass /dev/loop* into the container\n", o.Back.ImagePath, err)
+		}
+
+		return fmt.Errorf("Failed to mount backing image: point='%s', reason: %w. The image may be damaged, "+
+			"try 'solbuild build --verify'\n", o.Back.ImagePath, err)
 	}
 
 	o.mountedImg = true
@@ -172,17 +213,19 @@ func (o *Overlay) Mount() error {
 
 	// Mounting overlayfs..
 	err := mountMan.Mount("overlay", o.MountPoint, "overlay",
-		fmt.Sprintf("lowerdir=%s", o.ImgDir),
-		fmt.Sprintf("upperdir=%s", o.UpperDir),
-		fmt.Sprintf("workdir=%s", o.WorkDir))
-	// Check non-fatal..
+		Probe().OverlayOptions(o.ImgDir, o.UpperDir, o.WorkDir)...)
 	if err != nil {
-		log.Panic("Failed to mount overlayfs", "point", o.MountPoint, "err", err)
+		return fmt.Errorf("Failed to mount overlayfs: point='%s', reason: %w. The filesystem of %s may not support "+
+			"overlayfs, try a different overlay_root_dir or --tmpfs\n", o.MountPoint, err, o.BaseDir)
 	}
 
 	o.mountedOverlay = true
 
 	// Must be done here before we do any more overlayfs work
+	if err := CleanRunDir(o.MountPoint); err != nil {
+		return err
+	}
+
 	return EnsureEopkgLayout(o.MountPoint)
 }
 
@@ -190,11 +233,19 @@ func (o *Overlay) Mount() error {
 func (o *Overlay) Unmount() error {
 	mountMan := disk.GetMountManager()
 
-	for _, m := range o.ExtraMounts {
+	// Unmount in reverse, as later mounts may be nested within earlier ones
+	for _, m := range slices.Backward(o.ExtraMounts) {
+		if slices.Contains(o.mappedMounts, m) {
+			unmountMapped(m)
+			continue
+		}
+
 		mountMan.Unmount(m)
 	}
 
 	o.ExtraMounts = nil
+	o.mappedMounts = nil
+	o.mountedHome = false
 
 	vfsPoints := []string{
 		filepath.Join(o.MountPoint, "dev/pts"),
@@ -228,13 +279,19 @@ func (o *Overlay) Unmount() error {
 	}
 
 	if o.mountedTmpfs {
-		if err := mountMan.Unmount(o.UpperDir); err != nil {
+		if err := mountMan.Unmount(o.BaseDir); err != nil {
 			return err
 		}
 
 		o.mountedTmpfs = false
 	}
 
+	if o.mountedQuota {
+		if err := o.unmountQuota(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -262,14 +319,25 @@ func (o *Overlay) MountVFS() error {
 		}
 	}
 
-	// Bring up dev
-	slog.Debug("Mounting vfs /dev")
+	// Bring up dev, a devtmpfs is shared with the host so avoid it within
+	// containers
+	if ContainerMode {
+		slog.Debug("Bind mounting vfs /dev nodes")
 
-	if err := mountMan.Mount("devtmpfs", vfsPoints[0], "devtmpfs", "nosuid", "mode=755"); err != nil {
-		return fmt.Errorf("Failed to mount /dev, reason: %w\n", err)
-	}
+		o.mountedVFS = true
 
-	o.mountedVFS = true
+		if err := o.bindDevNodes(vfsPoints[0]); err != nil {
+			return err
+		}
+	} else {
+		slog.Debug("Mounting vfs /dev")
+
+		if err := mountMan.Mount("devtmpfs", vfsPoints[0], "devtmpfs", "nosuid", "mode=755"); err != nil {
+			return fmt.Errorf("Failed to mount /dev, reason: %w\n", err)
+		}
+
+		o.mountedVFS = true
+	}
 
 	// Bring up dev/pts
 	slog.Debug("Mounting vfs /dev/pts")
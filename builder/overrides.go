@@ -0,0 +1,58 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// PackageOverridesFile is an optional file alongside the package.yml that
+// adjusts how solbuild builds that package.
+const PackageOverridesFile = "solbuild.toml"
+
+// PackageOverrides are the per-package solbuild settings.
+type PackageOverrides struct {
+	IsolateCaches    bool   `toml:"isolate_caches"`    // Use compiler caches private to this package
+	NetworkingReason string `toml:"networking_reason"` // Why the build needs networking, required in strict mode
+	PersistentState  bool   `toml:"persistent_state"`  // Keep a state directory between builds of this package
+}
+
+// LoadPackageOverrides will read the overrides file in the given directory.
+// A missing file is not an error, and results in the defaults.
+func LoadPackageOverrides(dir string) (*PackageOverrides, error) {
+	overrides := &PackageOverrides{}
+	path := filepath.Join(dir, PackageOverridesFile)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return overrides, nil
+		}
+
+		return nil, err
+	}
+
+	if _, err = toml.Decode(string(b), overrides); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s, reason: %w", path, err)
+	}
+
+	return overrides, nil
+}
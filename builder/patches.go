@@ -0,0 +1,161 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrPatchFailed is returned when a patch from files/ does not apply cleanly
+// to the source it is meant for.
+var ErrPatchFailed = errors.New("Patch does not apply")
+
+// A Patch is a patch from files/ applied by the setup of a package.yml.
+type Patch struct {
+	File string   // Path of the patch relative to files/
+	Args []string // Arguments passed to patch, such as -p1
+}
+
+var (
+	// patchLine matches the use of the %patch macro with a patch from files/.
+	patchLine = regexp.MustCompile(`^%patch\b(.*?)<\s*(?:\$pkgfiles|\$\{pkgfiles\})/(\S+)`)
+
+	// patchHunk matches a hunk that failed to apply in the output of patch.
+	patchHunk = regexp.MustCompile(`^Hunk #\d+ FAILED at \d+`)
+)
+
+// ParsePatches will find the patches from files/ applied by the setup script,
+// in order. Patches after the script changes directory are ignored, as they
+// no longer apply to the root of the source.
+func ParsePatches(setup string) []Patch {
+	var patches []Patch
+
+	for _, line := range strings.Split(setup, "\n") {
+		line = strings.TrimSpace(line)
+
+		if fields := strings.Fields(line); len(fields) > 0 && (fields[0] == "cd" || fields[0] == "pushd") {
+			break
+		}
+
+		match := patchLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		patches = append(patches, Patch{
+			File: match[2],
+			Args: strings.Fields(match[1]),
+		})
+	}
+
+	return patches
+}
+
+// PatchFailure summarises why patch failed from its output, naming the file
+// and hunk that did not apply where possible.
+func PatchFailure(output string) string {
+	var file, last string
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(line, "patching file "); ok {
+			file = strings.Trim(name, "'")
+		}
+
+		if hunk := patchHunk.FindString(line); hunk != "" {
+			return fmt.Sprintf("%s in %s", hunk, file)
+		}
+
+		last = line
+	}
+
+	return last
+}
+
+// ApplyPatches will apply each patch in turn to the source tree at dir, just
+// as the %patch macro would, stopping at the first that does not apply.
+func ApplyPatches(dir, filesDir string, patches []Patch) error {
+	for _, patch := range patches {
+		args := []string{"-t", "-E", "--no-backup-if-mismatch", "-f"}
+		args = append(args, patch.Args...)
+		args = append(args, "-i", filepath.Join(filesDir, patch.File))
+
+		c := exec.Command("patch", args...)
+		c.Dir = dir
+
+		if out, err := c.CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %s: %s", ErrPatchFailed, patch.File, PatchFailure(string(out)))
+		}
+	}
+
+	return nil
+}
+
+// ValidatePatches will check that the patches from files/ apply cleanly to
+// the fetched source, before the root is prepared for the build. Only the
+// first source is checked, and only if it is an archive.
+func (p *Package) ValidatePatches() error {
+	if len(p.Patches) == 0 || !p.HasSources() {
+		return nil
+	}
+
+	archive := p.Sources[0].GetBindConfiguration("").BindSource
+
+	st, err := os.Stat(archive)
+	if err != nil || !st.Mode().IsRegular() {
+		slog.Debug("Not validating patches against a source that is not an archive", "source", p.Sources[0].GetIdentifier())
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "solbuild-patches-")
+	if err != nil {
+		return fmt.Errorf("Failed to create patch validation directory, reason: %w\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := exec.Command("tar", "-xf", archive, "-C", dir)
+	if strings.HasSuffix(archive, ".zip") {
+		c = exec.Command("unzip", "-q", archive, "-d", dir)
+	}
+
+	if out, err := c.CombinedOutput(); err != nil {
+		slog.Warn("Unable to extract source to validate patches", "path", archive, "err", err, "output", strings.TrimSpace(string(out)))
+		return nil
+	}
+
+	// Like ypkg, build within the single directory of the archive if it has one
+	workDir := dir
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		workDir = filepath.Join(dir, entries[0].Name())
+	}
+
+	slog.Info("Validating patches", "count", len(p.Patches))
+
+	return ApplyPatches(workDir, filepath.Join(filepath.Dir(p.Path), "files"), p.Patches)
+}
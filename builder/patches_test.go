@@ -0,0 +1,87 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+const testPatch = `--- a/hello.c
++++ b/hello.c
+@@ -1,3 +1,3 @@
+ int main(void)
+ {
+-	return 1;
++	return 0;
+ }
+`
+
+func TestParsePatches(t *testing.T) {
+	setup := `%patch -p1 < $pkgfiles/0001-fix-build.patch
+%patch -p1 -R <${pkgfiles}/revert/0002-revert.patch
+%configure
+cd subdir
+%patch -p1 < $pkgfiles/0003-subdir.patch
+`
+
+	patches := builder.ParsePatches(setup)
+	if len(patches) != 2 {
+		t.Fatalf("Expected 2 patches, got: %v", patches)
+	}
+
+	if patches[0].File != "0001-fix-build.patch" || strings.Join(patches[0].Args, " ") != "-p1" {
+		t.Fatalf("Wrong first patch: %v", patches[0])
+	}
+
+	if patches[1].File != "revert/0002-revert.patch" || strings.Join(patches[1].Args, " ") != "-p1 -R" {
+		t.Fatalf("Wrong second patch: %v", patches[1])
+	}
+}
+
+func TestApplyPatches(t *testing.T) {
+	files := t.TempDir()
+	if err := os.WriteFile(filepath.Join(files, "fix.patch"), []byte(testPatch), 0o644); err != nil {
+		t.Fatalf("Failed to write patch: %v", err)
+	}
+
+	patches := []builder.Patch{{File: "fix.patch", Args: []string{"-p1"}}}
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "hello.c"), []byte("int main(void)\n{\n\treturn 1;\n}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	if err := builder.ApplyPatches(src, files, patches); err != nil {
+		t.Fatalf("Failed to apply clean patch: %v", err)
+	}
+
+	// Already applied, so the hunk no longer matches
+	err := builder.ApplyPatches(src, files, patches)
+	if !errors.Is(err, builder.ErrPatchFailed) {
+		t.Fatalf("Expected ErrPatchFailed, got: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "fix.patch: Hunk #1 FAILED at 1 in hello.c") {
+		t.Fatalf("Expected failing hunk to be reported, got: %v", err)
+	}
+}
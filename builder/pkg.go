@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -41,6 +42,12 @@ const (
 
 	// PackageTypeIndex is a faux type to enable indexing.
 	PackageTypeIndex PackageType = "index"
+
+	// PackageTypeABIReport is a faux type to generate an ABI report.
+	PackageTypeABIReport PackageType = "abireport"
+
+	// PackageTypeSelfTest is a faux type to test the sandbox.
+	PackageTypeSelfTest PackageType = "selftest"
 )
 
 // IndexPackage is used by the index command to make use of the overlayfs
@@ -53,25 +60,52 @@ var IndexPackage = Package{
 	Path:    "",
 }
 
+// ABIReportPackage is used by the abireport command to make use of the
+// overlayfs system.
+var ABIReportPackage = Package{
+	Name:    "abireport",
+	Version: "1.0",
+	Type:    PackageTypeABIReport,
+	Release: 1,
+	Path:    "",
+}
+
+// SelfTestPackage is used by the selftest command to make use of the
+// overlayfs system.
+var SelfTestPackage = Package{
+	Name:    "selftest",
+	Version: "1.0",
+	Type:    PackageTypeSelfTest,
+	Release: 1,
+	Path:    "",
+}
+
 // Package is the main item we deal with, avoiding the internals.
 type Package struct {
-	Name       string          // Name of the package
-	Version    string          // Version of this package
-	Release    int             // Solus upgrades are based entirely on relno
-	Type       PackageType     // ypkg or pspec.xml legacy
-	Path       string          // Path to the build spec
-	Sources    []source.Source // Each package has 0 or more sources that we fetch
-	CanNetwork bool            // Only applicable to ypkg builds
-	CanCCache  bool            // Flag to enable (s)ccache
+	Name        string           // Name of the package
+	Version     string           // Version of this package
+	Release     int              // Solus upgrades are based entirely on relno
+	Type        PackageType      // ypkg or pspec.xml legacy
+	Path        string           // Path to the build spec
+	Sources     []source.Source  // Each package has 0 or more sources that we fetch
+	CanNetwork  bool             // Only applicable to ypkg builds
+	CanCCache   bool             // Flag to enable (s)ccache
+	Licenses    []string         // Declared licenses, ypkg only
+	Overrides   PackageOverrides // Per-package settings from solbuild.toml, ypkg only
+	Environment []string         // Variables required by the build itself, ypkg only
+	Patches     []Patch          // Patches from files/ applied by setup, ypkg only
 }
 
 // YmlPackage is a parsed ypkg build file.
 type YmlPackage struct {
-	Name       string              `yaml:"name"`
-	Version    string              `yaml:"version"`
-	Release    int                 `yaml:"release"`
-	Networking bool                `yaml:"networking"` // If set to false (default) we disable networking in the build
-	Source     []map[string]string `yaml:"source"`
+	Name        string            `yaml:"name"`
+	Version     string            `yaml:"version"`
+	Release     int               `yaml:"release"`
+	Networking  bool              `yaml:"networking"` // If set to false (default) we disable networking in the build
+	Source      RecipeSources     `yaml:"source"`
+	License     LicenseList       `yaml:"license"`
+	Environment RecipeEnvironment `yaml:"environment"`
+	Setup       string            `yaml:"setup"`
 
 	// Disable (s)ccache for this build.
 	CCache bool `yaml:"ccache"`
@@ -89,33 +123,84 @@ type XMLUpdate struct {
 
 // XMLArchive is an <Archive> line in Source section.
 type XMLArchive struct {
-	Type    string `xml:"type,attr"`
-	SHA1Sum string `xml:"sha1sum,attr"`
-	URI     string `xml:",chardata"`
+	Type      string `xml:"type,attr"`
+	SHA1Sum   string `xml:"sha1sum,attr"`
+	SHA256Sum string `xml:"sha256sum,attr"` // Preferred over sha1sum when set
+	Name      string `xml:"name,attr"`      // Rename the archive, as with a URI fragment
+	URI       string `xml:",chardata"`
+}
+
+// ErrLegacyUnsupported is returned when a pspec.xml uses a construct that
+// is only supported by package.yml.
+var ErrLegacyUnsupported = errors.New("xml: Unsupported in pspec.xml, please convert the package to package.yml")
+
+// Source returns the source for the archive, validated by its sha256sum if
+// it has one, otherwise by its sha1sum.
+func (a *XMLArchive) Source() (source.Source, error) { //nolint:ireturn // can return multiple implementations
+	uri := strings.TrimSpace(a.URI)
+
+	if strings.HasPrefix(uri, "git|") {
+		return nil, fmt.Errorf("%w: git source %s", ErrLegacyUnsupported, uri)
+	}
+
+	if name := strings.TrimSpace(a.Name); name != "" && !strings.Contains(uri, "#") {
+		uri += "#" + name
+	}
+
+	switch {
+	case a.SHA256Sum != "":
+		return source.New(uri, strings.TrimSpace(a.SHA256Sum), false)
+	case a.SHA1Sum != "":
+		return source.New(uri, strings.TrimSpace(a.SHA1Sum), true)
+	default:
+		return nil, fmt.Errorf("xml: Archive %s has no sha1sum or sha256sum", uri)
+	}
+}
+
+// XMLPatch is a <Patch> line in the Patches section.
+type XMLPatch struct {
+	Level int    `xml:"level,attr"`
+	Name  string `xml:",chardata"`
 }
 
 // XMLSource is the actual source info for each pspec.xml.
 type XMLSource struct {
-	Homepage string       `xml:"Homepage"`
-	Name     string       `xml:"Name"`
-	Archive  []XMLArchive `xml:"Archive"`
+	Homepage          string       `xml:"Homepage"`
+	Name              string       `xml:"Name"`
+	Archive           []XMLArchive `xml:"Archive"`
+	Summary           string       `xml:"Summary"`
+	Description       string       `xml:"Description"`
+	License           []string     `xml:"License"`
+	PartOf            string       `xml:"PartOf"`
+	BuildDependencies []string     `xml:"BuildDependencies>Dependency"`
+	Patches           []XMLPatch   `xml:"Patches>Patch"`
+}
+
+// XMLSubPackage is a <Package> produced by the pspec.xml.
+type XMLSubPackage struct {
+	Name                string   `xml:"Name"`
+	RuntimeDependencies []string `xml:"RuntimeDependencies>Dependency"`
 }
 
 // XMLPackage contains all of the pspec.xml metadata.
 type XMLPackage struct {
-	Name    string      `xml:"Name"`
-	Source  XMLSource   `xml:"Source"`
-	History []XMLUpdate `xml:"History>Update"`
+	Name     string          `xml:"Name"`
+	Source   XMLSource       `xml:"Source"`
+	Packages []XMLSubPackage `xml:"Package"`
+	History  []XMLUpdate     `xml:"History>Update"`
 }
 
 // NewPackage will attempt to parse the given path, and return a new Package
-// instance if this succeeds.
+// instance if this succeeds. The type of recipe is detected from both its
+// name and its contents.
 func NewPackage(path string) (*Package, error) {
-	if strings.HasSuffix(path, ".xml") {
-		return NewXMLPackage(path)
-	}
+	return NewPackageAs(path, "")
+}
 
-	return NewYmlPackage(path)
+// HasSources determines whether the package has any sources to fetch. Meta
+// packages have none, and skip the fetch and bind phases of the build.
+func (p *Package) HasSources() bool {
+	return len(p.Sources) > 0
 }
 
 // NewXMLPackage will attempt to parse the pspec.xml file @ path.
@@ -157,7 +242,12 @@ func NewXMLPackage(path string) (*Package, error) {
 	}
 
 	for _, archive := range xpkg.Source.Archive {
-		source, err := source.New(archive.URI, archive.SHA1Sum, true)
+		// Meta-packages may carry an empty Archive element
+		if strings.TrimSpace(archive.URI) == "" {
+			continue
+		}
+
+		source, err := archive.Source()
 		if err != nil {
 			return nil, err
 		}
@@ -206,6 +296,13 @@ func NewYmlPackage(path string) (*Package, error) {
 
 	ret.Path = path
 
+	overrides, err := LoadPackageOverrides(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Overrides = *overrides
+
 	return ret, nil
 }
 
@@ -225,17 +322,16 @@ func NewYmlPackageFromBytes(by []byte) (*Package, error) {
 		Type:       PackageTypeYpkg,
 		CanNetwork: ypkg.Networking,
 		CanCCache:  ypkg.CCache,
+		Licenses:   ypkg.License,
+		Patches:    ParsePatches(ypkg.Setup),
 	}
 
-	for _, row := range ypkg.Source {
-		for key, value := range row {
-			source, err := source.New(key, value, false)
-			if err != nil {
-				return nil, err
-			}
+	if ret.Environment, err = ypkg.Environment.Environment(); err != nil {
+		return nil, err
+	}
 
-			ret.Sources = append(ret.Sources, source)
-		}
+	if ret.Sources, err = ypkg.Source.Sources(); err != nil {
+		return nil, err
 	}
 
 	if ret.Name == "" {
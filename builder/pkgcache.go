@@ -0,0 +1,152 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// PackageCacheScratchSuffix is appended to the root to form the directory
+// holding packages downloaded during a build, until they are merged into the
+// shared package cache.
+const PackageCacheScratchSuffix = "-pkgcache"
+
+// ErrInvalidCachedPackage is returned when a downloaded package is not a
+// complete eopkg archive.
+var ErrInvalidCachedPackage = errors.New("Invalid cached package")
+
+// ValidateCachedPackage will ensure the file is a complete eopkg archive, as
+// only those may be merged into the shared package cache.
+func ValidateCachedPackage(path string) error {
+	if filepath.Ext(path) != ".eopkg" {
+		return fmt.Errorf("%w: %s is not an eopkg archive", ErrInvalidCachedPackage, filepath.Base(path))
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s, reason: %w", ErrInvalidCachedPackage, filepath.Base(path), err)
+	}
+	defer archive.Close()
+
+	for _, name := range []string{"metadata.xml", "files.xml"} {
+		f, err := archive.Open(name)
+		if err != nil {
+			return fmt.Errorf("%w: %s lacks %s", ErrInvalidCachedPackage, filepath.Base(path), name)
+		}
+
+		f.Close()
+	}
+
+	return nil
+}
+
+// MergePackageCache will move the valid packages downloaded into the scratch
+// directory into the shared package cache, returning how many were merged.
+// Anything else a build left behind, such as partial downloads or deletions,
+// is discarded.
+func MergePackageCache(scratch, cache string) (int, error) {
+	entries, err := os.ReadDir(scratch)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	merged := 0
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		source := filepath.Join(scratch, entry.Name())
+		target := filepath.Join(cache, entry.Name())
+
+		if err := ValidateCachedPackage(source); err != nil {
+			slog.Warn("Not merging package into the cache", "err", err)
+			continue
+		}
+
+		if PathExists(target) {
+			continue
+		}
+
+		// The scratch directory may live on a tmpfs
+		if err := os.Rename(source, target); err != nil {
+			if err = disk.CopyFile(source, target); err != nil {
+				os.Remove(target)
+				return merged, fmt.Errorf("Failed to merge %s into the package cache, reason: %w\n", entry.Name(), err)
+			}
+		}
+
+		merged++
+	}
+
+	return merged, nil
+}
+
+// mountCache will mount the shared package cache read-only within the root,
+// with an overlay capturing any new downloads in a scratch directory.
+func (e *EopkgManager) mountCache() error {
+	upper := filepath.Join(e.cacheScratch, "upper")
+	work := filepath.Join(e.cacheScratch, "work")
+
+	for _, dir := range []string{upper, work} {
+		if err := os.MkdirAll(dir, 0o0755); err != nil {
+			return fmt.Errorf("Failed to create package cache scratch %s, reason: %w\n", dir, err)
+		}
+	}
+
+	err := disk.GetMountManager().Mount("overlay", e.cacheTarget, "overlay",
+		fmt.Sprintf("lowerdir=%s", e.cacheSource),
+		fmt.Sprintf("upperdir=%s", upper),
+		fmt.Sprintf("workdir=%s", work))
+	if err != nil {
+		return err
+	}
+
+	e.cacheOverlay = true
+
+	return nil
+}
+
+// mergeCache will merge the packages downloaded during the build into the
+// shared package cache, once the cache is no longer mounted.
+func (e *EopkgManager) mergeCache() {
+	merged, err := MergePackageCache(filepath.Join(e.cacheScratch, "upper"), e.cacheSource)
+	if err != nil {
+		slog.Warn("Failed to merge downloaded packages into the cache", "err", err)
+	}
+
+	if merged > 0 {
+		slog.Debug("Merged downloaded packages into the cache", "count", merged)
+		BuildCacheUsage.recordPackages(merged)
+	}
+
+	if err := os.RemoveAll(e.cacheScratch); err != nil {
+		slog.Warn("Failed to remove package cache scratch", "dir", e.cacheScratch, "err", err)
+	}
+}
@@ -0,0 +1,108 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// writePackage creates an eopkg archive holding the given members.
+func writePackage(t *testing.T, path string, members ...string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create package: %v", err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, member := range members {
+		if _, err = w.Create(member); err != nil {
+			t.Fatalf("Failed to add %s to package: %v", member, err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+}
+
+func TestValidateCachedPackage(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "nano-8.0-180-1-x86_64.eopkg")
+	writePackage(t, good, "metadata.xml", "files.xml", "install.tar.xz")
+
+	if err := builder.ValidateCachedPackage(good); err != nil {
+		t.Fatalf("Valid package failed validation: %v", err)
+	}
+
+	partial := filepath.Join(dir, "vim-9.1-412-1-x86_64.eopkg")
+	writePackage(t, partial, "metadata.xml")
+
+	if err := builder.ValidateCachedPackage(partial); !errors.Is(err, builder.ErrInvalidCachedPackage) {
+		t.Fatalf("Package lacking files.xml passed validation: %v", err)
+	}
+
+	truncated := filepath.Join(dir, "glibc-2.40-140-1-x86_64.eopkg")
+	if err := os.WriteFile(truncated, []byte("PK\x03\x04"), 0o644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+
+	if err := builder.ValidateCachedPackage(truncated); !errors.Is(err, builder.ErrInvalidCachedPackage) {
+		t.Fatalf("Truncated package passed validation: %v", err)
+	}
+}
+
+func TestMergePackageCache(t *testing.T) {
+	scratch := t.TempDir()
+	cache := t.TempDir()
+
+	writePackage(t, filepath.Join(scratch, "nano-8.0-180-1-x86_64.eopkg"), "metadata.xml", "files.xml")
+	writePackage(t, filepath.Join(scratch, "vim-9.1-412-1-x86_64.eopkg.part"), "metadata.xml", "files.xml")
+	writePackage(t, filepath.Join(scratch, "zlib-1.3-40-1-x86_64.eopkg"), "metadata.xml")
+
+	merged, err := builder.MergePackageCache(scratch, cache)
+	if err != nil {
+		t.Fatalf("Failed to merge package cache: %v", err)
+	}
+
+	if merged != 1 {
+		t.Fatalf("Expected 1 merged package, got %d", merged)
+	}
+
+	if !builder.PathExists(filepath.Join(cache, "nano-8.0-180-1-x86_64.eopkg")) {
+		t.Fatal("Valid package was not merged into the cache")
+	}
+
+	for _, name := range []string{"vim-9.1-412-1-x86_64.eopkg.part", "zlib-1.3-40-1-x86_64.eopkg"} {
+		if builder.PathExists(filepath.Join(cache, name)) {
+			t.Fatalf("Invalid package %s was merged into the cache", name)
+		}
+	}
+
+	if merged, err = builder.MergePackageCache(filepath.Join(scratch, "missing"), cache); err != nil || merged != 0 {
+		t.Fatalf("Expected nothing to merge from a missing scratch, got %d: %v", merged, err)
+	}
+}
@@ -0,0 +1,158 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// PackageManagerEopkg manages roots with eopkg, the default.
+	PackageManagerEopkg = "eopkg"
+
+	// PackageManagerSol manages roots with sol, the successor to eopkg.
+	PackageManagerSol = "sol"
+)
+
+// ErrSolUnsupported is returned by every operation of the sol package
+// manager, until its tooling is available.
+var ErrSolUnsupported = errors.New("The sol package manager is not supported yet")
+
+// A RootRepo is a repo configured within a root, whichever package manager
+// configured it.
+type RootRepo struct {
+	ID  string
+	URI string
+}
+
+// A PackageManager manages the packages and repositories within a root, so
+// that roots may be built and updated with tooling other than eopkg.
+type PackageManager interface {
+	// Init will prepare the root for use.
+	Init() error
+
+	// CopyAssets will copy required host-side assets into the root.
+	CopyAssets() error
+
+	// StartDBUS will bring up any services the package manager requires.
+	StartDBUS() error
+
+	// StopDBUS will tear down services brought up by StartDBUS.
+	StopDBUS() error
+
+	// Cleanup will undo any work done within the root.
+	Cleanup()
+
+	// Upgrade will upgrade every package within the root.
+	Upgrade() error
+
+	// InstallComponent will install the named component within the root.
+	InstallComponent(comp string) error
+
+	// InstallDepsCommand will return the command installing the build
+	// dependencies of the recipe, a path within the root.
+	InstallDepsCommand(recipe string) (string, error)
+
+	// IndexCommand will return the command indexing the packages of the
+	// directory, a path within the root.
+	IndexCommand(dir string) (string, error)
+
+	// GetRepos will return the repos configured within the root.
+	GetRepos() ([]*RootRepo, error)
+
+	// AddRepo will add a repo to the root.
+	AddRepo(id, source string) error
+
+	// RemoveRepo will remove the named repo from the root.
+	RemoveRepo(id string) error
+}
+
+// ValidatePackageManager will ensure the named package manager is known. An
+// empty name is the default, eopkg.
+func ValidatePackageManager(name string) error {
+	switch name {
+	case "", PackageManagerEopkg, PackageManagerSol:
+		return nil
+	default:
+		return fmt.Errorf("Unknown package manager: %s (expected %s or %s)", name, PackageManagerEopkg, PackageManagerSol)
+	}
+}
+
+// NewPackageManager will return the named package manager for the root.
+func NewPackageManager(name string, notif PidNotifier, root string) (PackageManager, error) {
+	if err := ValidatePackageManager(name); err != nil {
+		return nil, err
+	}
+
+	if name == PackageManagerSol {
+		return NewSolManager(notif, root), nil
+	}
+
+	return NewEopkgManager(notif, root), nil
+}
+
+// SolManager is the skeleton of a PackageManager using sol. It fails every
+// operation until the sol tooling is available.
+type SolManager struct {
+	root  string
+	notif PidNotifier
+}
+
+// NewSolManager will return a new sol package manager.
+func NewSolManager(notif PidNotifier, root string) *SolManager {
+	return &SolManager{
+		root:  root,
+		notif: notif,
+	}
+}
+
+// Init implements PackageManager.
+func (s *SolManager) Init() error { return ErrSolUnsupported }
+
+// CopyAssets implements PackageManager.
+func (s *SolManager) CopyAssets() error { return ErrSolUnsupported }
+
+// StartDBUS implements PackageManager, sol does not require dbus.
+func (s *SolManager) StartDBUS() error { return nil }
+
+// StopDBUS implements PackageManager, sol does not require dbus.
+func (s *SolManager) StopDBUS() error { return nil }
+
+// Cleanup implements PackageManager.
+func (s *SolManager) Cleanup() {}
+
+// Upgrade implements PackageManager.
+func (s *SolManager) Upgrade() error { return ErrSolUnsupported }
+
+// InstallComponent implements PackageManager.
+func (s *SolManager) InstallComponent(string) error { return ErrSolUnsupported }
+
+// InstallDepsCommand implements PackageManager.
+func (s *SolManager) InstallDepsCommand(string) (string, error) { return "", ErrSolUnsupported }
+
+// IndexCommand implements PackageManager.
+func (s *SolManager) IndexCommand(string) (string, error) { return "", ErrSolUnsupported }
+
+// GetRepos implements PackageManager.
+func (s *SolManager) GetRepos() ([]*RootRepo, error) { return nil, ErrSolUnsupported }
+
+// AddRepo implements PackageManager.
+func (s *SolManager) AddRepo(string, string) error { return ErrSolUnsupported }
+
+// RemoveRepo implements PackageManager.
+func (s *SolManager) RemoveRepo(string) error { return ErrSolUnsupported }
@@ -0,0 +1,397 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	// PoolDirectory is the directory within the overlay root of a profile
+	// holding its pre-provisioned roots.
+	PoolDirectory = ".pool"
+
+	// PoolSlotMarker records when a pooled root was provisioned, and from
+	// which image.
+	PoolSlotMarker = "pool.toml"
+
+	// poolProvisioningSuffix marks a pooled root still being provisioned.
+	poolProvisioningSuffix = ".new"
+)
+
+// PoolSlotMaxAge is how long a pooled root may wait before it is considered
+// too far behind the repos to be worth claiming.
+var PoolSlotMaxAge = 24 * time.Hour
+
+// A PoolSlot is a root within the pool, with the image upgraded and
+// system.devel installed, ready to be claimed by a build.
+type PoolSlot struct {
+	Path        string    `toml:"-"`
+	Image       time.Time `toml:"image"`       // Modification time of the image it was provisioned from
+	Provisioned time.Time `toml:"provisioned"` // When the root was provisioned
+}
+
+// Fresh determines whether the slot was provisioned from the current image
+// recently enough to be claimed.
+func (s *PoolSlot) Fresh(image time.Time) bool {
+	return s.Image.Equal(image) && time.Since(s.Provisioned) < PoolSlotMaxAge
+}
+
+// A Pool holds the pre-provisioned roots of a profile, allowing builds to
+// skip straight to installing their dependencies.
+type Pool struct {
+	Dir      string // Directory holding the pooled roots
+	LockPath string // Lock held while provisioning roots
+}
+
+// NewPool will return the pool for the given profile.
+func NewPool(config *Config, profile *Profile) *Pool {
+	dir := filepath.Join(config.OverlayRootDir, profile.Name, PoolDirectory)
+
+	return &Pool{
+		Dir:      dir,
+		LockPath: dir + ".lock",
+	}
+}
+
+// imageStamp returns the modification time of the image, which changes
+// whenever the image is updated.
+func imageStamp(back *BackingImage) (time.Time, error) {
+	st, err := os.Stat(back.ImagePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return st.ModTime(), nil
+}
+
+// Slots will return the provisioned roots within the pool, oldest first.
+// Roots lacking a marker are returned as stale.
+func (p *Pool) Slots() ([]*PoolSlot, error) {
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var slots []*PoolSlot
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), poolProvisioningSuffix) {
+			continue
+		}
+
+		slot := &PoolSlot{Path: filepath.Join(p.Dir, entry.Name())}
+
+		if _, err := toml.DecodeFile(filepath.Join(slot.Path, PoolSlotMarker), slot); err != nil {
+			slog.Debug("Pooled root has no valid marker", "path", slot.Path, "err", err)
+		}
+
+		slots = append(slots, slot)
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Provisioned.Before(slots[j].Provisioned)
+	})
+
+	return slots, nil
+}
+
+// Claim will move a fresh root from the pool into place as the root of the
+// overlay, returning whether one was available.
+func (p *Pool) Claim(o *Overlay) (bool, error) {
+	image, err := imageStamp(o.Back)
+	if err != nil {
+		return false, err
+	}
+
+	slots, err := p.Slots()
+	if err != nil {
+		return false, err
+	}
+
+	for _, slot := range slots {
+		// Quick builds don't mind a base which is behind the repos
+		if !slot.Fresh(image) && (!QuickBuild || !slot.Image.Equal(image)) {
+			continue
+		}
+
+		if err := os.Rename(slot.Path, o.BaseDir); err != nil {
+			// Another build claimed it first
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return false, fmt.Errorf("Failed to claim pooled root %s, reason: %w\n", slot.Path, err)
+		}
+
+		os.Remove(filepath.Join(o.BaseDir, PoolSlotMarker))
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Prune will remove stale roots from the pool, along with any abandoned
+// while being provisioned, returning how many fresh roots remain. The pool
+// lock must be held.
+func (p *Pool) Prune(back *BackingImage) (int, error) {
+	image, err := imageStamp(back)
+	if err != nil {
+		return 0, err
+	}
+
+	abandoned, _ := filepath.Glob(filepath.Join(p.Dir, "*"+poolProvisioningSuffix))
+	for _, path := range abandoned {
+		slog.Debug("Removing abandoned pooled root", "path", path)
+
+		if err := os.RemoveAll(path); err != nil {
+			return 0, err
+		}
+	}
+
+	slots, err := p.Slots()
+	if err != nil {
+		return 0, err
+	}
+
+	fresh := 0
+
+	for _, slot := range slots {
+		if slot.Fresh(image) {
+			fresh++
+			continue
+		}
+
+		slog.Debug("Removing stale pooled root", "path", slot.Path)
+
+		if err := os.RemoveAll(slot.Path); err != nil {
+			return fresh, err
+		}
+	}
+
+	return fresh, nil
+}
+
+// newSlot will create the overlay for a new root within the pool.
+func (p *Pool) newSlot(back *BackingImage) (*Overlay, error) {
+	if err := os.MkdirAll(p.Dir, 0o0755); err != nil {
+		return nil, fmt.Errorf("Failed to create pool directory %s, reason: %w\n", p.Dir, err)
+	}
+
+	dir, err := os.MkdirTemp(p.Dir, "root-*"+poolProvisioningSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create pooled root, reason: %w\n", err)
+	}
+
+	return newOverlayAt(back, nil, dir), nil
+}
+
+// publish will mark the provisioned root as ready to be claimed.
+func (p *Pool) publish(o *Overlay) error {
+	image, err := imageStamp(o.Back)
+	if err != nil {
+		return err
+	}
+
+	slot := &PoolSlot{Image: image, Provisioned: time.Now().UTC()}
+
+	f, err := os.Create(filepath.Join(o.BaseDir, PoolSlotMarker))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = toml.NewEncoder(f).Encode(slot); err != nil {
+		return err
+	}
+
+	return os.Rename(o.BaseDir, strings.TrimSuffix(o.BaseDir, poolProvisioningSuffix))
+}
+
+// FillPool will provision roots for the profile until the pool holds size
+// fresh roots, removing any stale roots first. Cancelling ctx will interrupt
+// the provisioning.
+func (m *Manager) FillPool(ctx context.Context, size int) (err error) {
+	if m.IsCancelled() {
+		return ErrInterrupted
+	}
+
+	m.lock.Lock()
+	if m.image == nil {
+		m.lock.Unlock()
+		return ErrInvalidProfile
+	}
+
+	if !m.image.IsInstalled() {
+		m.lock.Unlock()
+		return ErrProfileNotInstalled
+	}
+	m.lock.Unlock()
+
+	defer m.Cleanup()
+	defer m.watchContext(ctx, &err)()
+
+	pool := NewPool(m.Config, m.profile)
+
+	if err := os.MkdirAll(filepath.Dir(pool.LockPath), 0o0755); err != nil {
+		return err
+	}
+
+	if err := m.doLock(pool.LockPath, "pool"); err != nil {
+		return err
+	}
+
+	if err := m.applyBuildEnvironment(); err != nil {
+		return err
+	}
+
+	ready, err := pool.Prune(m.image)
+	if err != nil {
+		return fmt.Errorf("Failed to prune pool, reason: %w\n", err)
+	}
+
+	for ; ready < size; ready++ {
+		if m.IsCancelled() {
+			return ErrInterrupted
+		}
+
+		slog.Info("Provisioning pooled root", "profile", m.profile.Name, "ready", ready, "size", size)
+
+		if err := m.provisionSlot(pool); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Pool is full", "profile", m.profile.Name, "size", size)
+
+	return nil
+}
+
+// provisionSlot will bring up a new root within the pool, upgrading it and
+// installing system.devel as a build would, before tearing it down again.
+func (m *Manager) provisionSlot(pool *Pool) error {
+	overlay, err := pool.newSlot(m.image)
+	if err != nil {
+		return err
+	}
+
+	pman, err := NewPackageManager(m.profile.PackageManager, m, overlay.MountPoint)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	m.overlay = overlay
+	m.pkgManager = pman
+	m.lock.Unlock()
+
+	ChrootEnvironment = SaneEnvironment("root", "/root")
+
+	err = provisionRoot(pman, overlay)
+
+	pman.Cleanup()
+	MurderDeathKill(overlay.MountPoint)
+
+	if unmountErr := overlay.Unmount(); unmountErr != nil && err == nil {
+		err = unmountErr
+	}
+
+	if err != nil {
+		os.RemoveAll(overlay.BaseDir)
+		return fmt.Errorf("Failed to provision pooled root, reason: %w\n", err)
+	}
+
+	return pool.publish(overlay)
+}
+
+// provisionRoot will prepare the root as the first steps of a build would.
+func provisionRoot(pman PackageManager, overlay *Overlay) error {
+	if err := overlay.Mount(); err != nil {
+		return err
+	}
+
+	if err := AddBuildUser(overlay.MountPoint); err != nil {
+		return err
+	}
+
+	if err := overlay.MountVFS(); err != nil {
+		return err
+	}
+
+	if err := pman.Init(); err != nil {
+		return err
+	}
+
+	if err := pman.StartDBUS(); err != nil {
+		return fmt.Errorf("Failed to start d-bus, reason: %w\n", err)
+	}
+	defer pman.StopDBUS()
+
+	if err := pman.Upgrade(); err != nil {
+		return fmt.Errorf("Failed to upgrade rootfs, reason: %w\n", err)
+	}
+
+	return pman.InstallComponent("system.devel")
+}
+
+// refillPool will provision a replacement for a pooled root claimed by the
+// build in the background, without waiting for it.
+func (m *Manager) refillPool() {
+	if m.overlay == nil || !m.overlay.FromPool {
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		slog.Warn("Unable to refill the pool", "err", err)
+		return
+	}
+
+	args := []string{"pool", "-p", m.profile.Name, "-s", fmt.Sprint(m.Config.PoolSize)}
+	if len(m.profileDirs) > 0 {
+		args = append(args, "--profile-dir", strings.Join(m.profileDirs, string(filepath.ListSeparator)))
+	}
+
+	c := exec.Command(exe, args...)
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := c.Start(); err != nil {
+		slog.Warn("Unable to refill the pool", "err", err)
+		return
+	}
+
+	slog.Debug("Refilling the pool in the background", "pid", c.Process.Pid)
+
+	c.Process.Release()
+}
@@ -0,0 +1,106 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// writeSlot creates a pooled root provisioned from an image with the given
+// modification time.
+func writeSlot(t *testing.T, pool *builder.Pool, name string, image, provisioned time.Time) string {
+	t.Helper()
+
+	path := filepath.Join(pool.Dir, name)
+	if err := os.MkdirAll(filepath.Join(path, "tmp"), 0o0755); err != nil {
+		t.Fatalf("Failed to create pooled root: %v", err)
+	}
+
+	marker := fmt.Sprintf("image = %s\nprovisioned = %s\n", image.Format(time.RFC3339Nano), provisioned.Format(time.RFC3339Nano))
+	if err := os.WriteFile(filepath.Join(path, builder.PoolSlotMarker), []byte(marker), 0o0644); err != nil {
+		t.Fatalf("Failed to write pool marker: %v", err)
+	}
+
+	return path
+}
+
+func TestPoolClaim(t *testing.T) {
+	bk := testImage(t, "")
+	if err := os.WriteFile(bk.ImagePath, []byte("image"), 0o0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	st, err := os.Stat(bk.ImagePath)
+	if err != nil {
+		t.Fatalf("Failed to stat image: %v", err)
+	}
+
+	config := &builder.Config{OverlayRootDir: t.TempDir()}
+	profile := &builder.Profile{Name: "test"}
+	pool := builder.NewPool(config, profile)
+
+	// Provisioned from an older image, or too long ago
+	outdated := writeSlot(t, pool, "root-1", st.ModTime().Add(-time.Hour), time.Now())
+	expired := writeSlot(t, pool, "root-2", st.ModTime(), time.Now().Add(-2*builder.PoolSlotMaxAge))
+	fresh := writeSlot(t, pool, "root-3", st.ModTime(), time.Now())
+
+	overlay := builder.NewOverlay(config, profile, bk, &builder.Package{Name: "nano"})
+
+	claimed, err := pool.Claim(overlay)
+	if err != nil || !claimed {
+		t.Fatalf("Failed to claim fresh root: %v", err)
+	}
+
+	if builder.PathExists(fresh) || !builder.PathExists(filepath.Join(overlay.BaseDir, "tmp")) {
+		t.Fatal("Claimed root was not moved into place")
+	}
+
+	if builder.PathExists(filepath.Join(overlay.BaseDir, builder.PoolSlotMarker)) {
+		t.Fatal("Pool marker was left in the claimed root")
+	}
+
+	if claimed, _ = pool.Claim(builder.NewOverlay(config, profile, bk, &builder.Package{Name: "vim"})); claimed {
+		t.Fatal("Claimed a stale root")
+	}
+
+	if err := os.MkdirAll(filepath.Join(pool.Dir, "root-4.new"), 0o0755); err != nil {
+		t.Fatalf("Failed to create abandoned root: %v", err)
+	}
+
+	writeSlot(t, pool, "root-5", st.ModTime(), time.Now())
+
+	ready, err := pool.Prune(bk)
+	if err != nil {
+		t.Fatalf("Failed to prune pool: %v", err)
+	}
+
+	if ready != 1 {
+		t.Fatalf("Expected 1 fresh root, got %d", ready)
+	}
+
+	for _, path := range []string{outdated, expired, filepath.Join(pool.Dir, "root-4.new")} {
+		if builder.PathExists(path) {
+			t.Fatalf("Stale root %s was not pruned", path)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1" //nolint:gosec // eopkg indexes record sha1 digests
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// ErrPackageHash is returned when a preloaded package does not match the
+// hash recorded in the repo index.
+var ErrPackageHash = errors.New("Package does not match the repo index")
+
+// xzMagic starts every xz compressed file.
+var xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+// A PackageIndex maps the file names of packages in repo indexes to their
+// sha1 digests.
+type PackageIndex map[string]string
+
+// Merge will add the packages of another index to this one.
+func (i PackageIndex) Merge(other PackageIndex) {
+	for name, hash := range other {
+		i[name] = hash
+	}
+}
+
+// ParsePackageIndex will read the package archives listed in an uncompressed
+// eopkg index.
+func ParsePackageIndex(r io.Reader) (PackageIndex, error) {
+	index := make(PackageIndex)
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return index, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse repo index, reason: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Package" {
+			continue
+		}
+
+		var pkg indexPackage
+		if err = decoder.DecodeElement(&pkg, &start); err != nil {
+			return nil, fmt.Errorf("Failed to parse repo index, reason: %w", err)
+		}
+
+		// Components and groups may also be Package elements, without archives
+		if pkg.PackageURI != "" && pkg.PackageHash != "" {
+			index[path.Base(pkg.PackageURI)] = strings.ToLower(pkg.PackageHash)
+		}
+	}
+}
+
+// LoadPackageIndex will read the eopkg index at the given URI or path, which
+// may be xz compressed. A directory is taken to be a local repo.
+func LoadPackageIndex(uri string) (PackageIndex, error) {
+	if st, err := os.Stat(uri); err == nil && st.IsDir() {
+		uri = filepath.Join(uri, RepoIndexFile)
+	}
+
+	data, err := readPreloadFile(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read repo index %s, reason: %w", uri, err)
+	}
+
+	if bytes.HasPrefix(data, xzMagic) {
+		cmd := exec.Command("xz", "-d", "-c")
+		cmd.Stdin = bytes.NewReader(data)
+
+		if data, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("Failed to decompress repo index %s, reason: %w", uri, err)
+		}
+	}
+
+	return ParsePackageIndex(bytes.NewReader(data))
+}
+
+// isRemote determines whether the location is a URL rather than a path.
+func isRemote(location string) bool {
+	u, err := url.Parse(location)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// readPreloadFile will read a local file or fetch a remote one.
+func readPreloadFile(location string) ([]byte, error) {
+	if !isRemote(location) {
+		return os.ReadFile(location)
+	}
+
+	resp, err := httpGet(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// PreloadSources returns the packages to preload from the given location: a
+// directory of packages, a single package, or a file listing the paths or
+// URLs of packages, one per line.
+func PreloadSources(location string) ([]string, error) {
+	st, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if st.IsDir() {
+		return filepath.Glob(filepath.Join(location, "*.eopkg"))
+	}
+
+	if filepath.Ext(location) == ".eopkg" {
+		return []string{location}, nil
+	}
+
+	f, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sources []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Relative paths are relative to the list
+		if !isRemote(line) && !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(location), line)
+		}
+
+		sources = append(sources, line)
+	}
+
+	return sources, scanner.Err()
+}
+
+// A PreloadResult counts the outcome of preloading packages.
+type PreloadResult struct {
+	Added      int // Packages copied into the cache
+	Existing   int // Packages already in the cache
+	Unverified int // Added packages not found in any repo index
+	Rejected   int // Packages that were invalid or failed verification
+}
+
+// fileSha1sum returns the sha1 digest of the file.
+func fileSha1sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New() //nolint:gosec // eopkg indexes record sha1 digests
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stagePreload will make the package available as a local file within the
+// staging directory, downloading it if needed, and returns its path.
+func stagePreload(source, staging string) (string, error) {
+	name := filepath.Base(source)
+	if isRemote(source) {
+		if u, err := url.Parse(source); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+
+	staged := filepath.Join(staging, name)
+
+	if !isRemote(source) {
+		return staged, disk.CopyFile(source, staged)
+	}
+
+	resp, err := httpGet(source)
+	if err != nil {
+		return staged, err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(staged)
+	if err != nil {
+		return staged, err
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		return staged, err
+	}
+
+	return staged, f.Close()
+}
+
+// preloadPackage will copy a single package into the cache, verifying it
+// against the index if it is listed there. The package is staged beside the
+// cache, so that only complete and valid packages are moved into place.
+func preloadPackage(source, cacheDir, staging string, index PackageIndex, result *PreloadResult) error {
+	staged, err := stagePreload(source, staging)
+	defer os.Remove(staged)
+
+	if err != nil {
+		return fmt.Errorf("Failed to fetch package %s, reason: %w", source, err)
+	}
+
+	name := filepath.Base(staged)
+	target := filepath.Join(cacheDir, name)
+
+	if PathExists(target) {
+		slog.Debug("Package is already cached", "name", name)
+
+		result.Existing++
+
+		return nil
+	}
+
+	if err = ValidateCachedPackage(staged); err != nil {
+		return err
+	}
+
+	if expected, ok := index[name]; ok {
+		sum, err := fileSha1sum(staged)
+		if err != nil {
+			return err
+		}
+
+		if sum != expected {
+			return fmt.Errorf("%w: %s has sha1 %s, expected %s", ErrPackageHash, name, sum, expected)
+		}
+	} else {
+		if index != nil {
+			slog.Warn("Package is not in any repo index, unable to verify it", "name", name)
+		}
+
+		result.Unverified++
+	}
+
+	if err = os.Chmod(staged, 0o0644); err != nil {
+		return err
+	}
+
+	if err = os.Rename(staged, target); err != nil {
+		return fmt.Errorf("Failed to add %s to the package cache, reason: %w", name, err)
+	}
+
+	result.Added++
+
+	return nil
+}
+
+// PreloadPackages will copy the packages from the sources into the package
+// cache, so that builds need not download them. Each is validated as an
+// eopkg archive and, when listed in the index, verified against its hash.
+// A nil index skips verification. Packages already cached are left alone,
+// and invalid packages are rejected without stopping the others.
+func PreloadPackages(sources []string, index PackageIndex, cacheDir string) (*PreloadResult, error) {
+	if err := os.MkdirAll(cacheDir, 0o0755); err != nil {
+		return nil, fmt.Errorf("Failed to create package cache %s, reason: %w", cacheDir, err)
+	}
+
+	// Staged on the same filesystem, so packages are moved into place whole
+	staging, err := os.MkdirTemp(cacheDir, ".preload-")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create staging directory, reason: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	result := &PreloadResult{}
+
+	for _, source := range sources {
+		if err = preloadPackage(source, cacheDir, staging, index, result); err != nil {
+			slog.Error("Rejected package", "source", source, "err", err)
+
+			result.Rejected++
+		}
+	}
+
+	return result, nil
+}
+
+// ReadPackageIndex will read the indexes of the repos used by the profile:
+// those cached within the image, and those the profile adds.
+func (m *Manager) ReadPackageIndex() (PackageIndex, error) {
+	if m.IsCancelled() {
+		return nil, ErrInterrupted
+	}
+
+	if !m.image.IsInstalled() {
+		return nil, ErrProfileNotInstalled
+	}
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "inspecting"); err != nil {
+		return nil, err
+	}
+
+	index := make(PackageIndex)
+
+	err := m.image.MountReadOnly(func(root string) error {
+		paths, _ := filepath.Glob(filepath.Join(root, "var/lib/eopkg/index/*/eopkg-index.xml"))
+
+		for _, path := range paths {
+			repoIndex, err := LoadPackageIndex(path)
+			if err != nil {
+				return err
+			}
+
+			index.Merge(repoIndex)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, repo := range m.GetProfile().Repos {
+		repoIndex, err := LoadPackageIndex(repo.indexURI())
+		if err != nil {
+			slog.Warn("Unable to read the index of repo, its packages cannot be verified", "name", name, "err", err)
+			continue
+		}
+
+		index.Merge(repoIndex)
+	}
+
+	return index, nil
+}
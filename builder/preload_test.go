@@ -0,0 +1,161 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"crypto/sha1" //nolint:gosec // eopkg indexes record sha1 digests
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// sha1File returns the sha1 digest of the file.
+func sha1File(t *testing.T, path string) string {
+	t.Helper()
+
+	by, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	sum := sha1.Sum(by) //nolint:gosec // eopkg indexes record sha1 digests
+
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParsePackageIndex(t *testing.T) {
+	index := `<PISI>
+  <Component><Name>system.base</Name></Component>
+  <Package>
+    <Name>nano</Name>
+    <PackageURI>n/nano/nano-8.0-180-1-x86_64.eopkg</PackageURI>
+    <PackageHash>ABCDEF0123</PackageHash>
+  </Package>
+</PISI>`
+
+	parsed, err := builder.ParsePackageIndex(strings.NewReader(index))
+	if err != nil {
+		t.Fatalf("Failed to parse index: %v", err)
+	}
+
+	if len(parsed) != 1 || parsed["nano-8.0-180-1-x86_64.eopkg"] != "abcdef0123" {
+		t.Fatalf("Unexpected index: %v", parsed)
+	}
+
+	if _, err = exec.LookPath("xz"); err != nil {
+		t.Skip("xz is not available")
+	}
+
+	// A local repo holds a compressed index
+	repo := t.TempDir()
+	path := filepath.Join(repo, "eopkg-index.xml")
+
+	if err = os.WriteFile(path, []byte(index), 0o644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	if out, err := exec.Command("xz", path).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compress index: %v: %s", err, out)
+	}
+
+	if parsed, err = builder.LoadPackageIndex(repo); err != nil || len(parsed) != 1 {
+		t.Fatalf("Failed to load compressed index: %v (%v)", parsed, err)
+	}
+}
+
+func TestPreloadPackages(t *testing.T) {
+	src := t.TempDir()
+	cache := filepath.Join(t.TempDir(), "packages")
+
+	verified := filepath.Join(src, "nano-8.0-180-1-x86_64.eopkg")
+	writePackage(t, verified, "metadata.xml", "files.xml")
+
+	tampered := filepath.Join(src, "vim-9.1-412-1-x86_64.eopkg")
+	writePackage(t, tampered, "metadata.xml", "files.xml")
+
+	unlisted := filepath.Join(src, "zlib-1.3-30-1-x86_64.eopkg")
+	writePackage(t, unlisted, "metadata.xml", "files.xml")
+
+	if err := os.WriteFile(filepath.Join(src, "glibc-2.40-140-1-x86_64.eopkg"), []byte("PK"), 0o644); err != nil {
+		t.Fatalf("Failed to write package: %v", err)
+	}
+
+	index := builder.PackageIndex{
+		filepath.Base(verified): sha1File(t, verified),
+		filepath.Base(tampered): strings.Repeat("0", 40),
+	}
+
+	sources, err := builder.PreloadSources(src)
+	if err != nil || len(sources) != 4 {
+		t.Fatalf("Expected 4 packages in the directory, got %v (%v)", sources, err)
+	}
+
+	result, err := builder.PreloadPackages(sources, index, cache)
+	if err != nil {
+		t.Fatalf("Failed to preload packages: %v", err)
+	}
+
+	if *result != (builder.PreloadResult{Added: 2, Unverified: 1, Rejected: 2}) {
+		t.Fatalf("Unexpected result: %+v", *result)
+	}
+
+	for name, cached := range map[string]bool{
+		"nano-8.0-180-1-x86_64.eopkg":   true,
+		"zlib-1.3-30-1-x86_64.eopkg":    true,
+		"vim-9.1-412-1-x86_64.eopkg":    false,
+		"glibc-2.40-140-1-x86_64.eopkg": false,
+	} {
+		if builder.PathExists(filepath.Join(cache, name)) != cached {
+			t.Fatalf("Wrong cache state for %s", name)
+		}
+	}
+
+	if leftover, _ := filepath.Glob(filepath.Join(cache, ".preload-*")); len(leftover) != 0 {
+		t.Fatalf("Staging directory left behind: %v", leftover)
+	}
+
+	// A list of URLs and relative paths, with one package already cached
+	srv := httptest.NewServer(http.FileServer(http.Dir(src)))
+	t.Cleanup(srv.Close)
+
+	list := filepath.Join(src, "packages.list")
+	contents := fmt.Sprintf("# Packages for CI\n%s/%s\n\nnano-8.0-180-1-x86_64.eopkg\n", srv.URL, filepath.Base(tampered))
+
+	if err = os.WriteFile(list, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+
+	if sources, err = builder.PreloadSources(list); err != nil || len(sources) != 2 {
+		t.Fatalf("Expected 2 packages in the list, got %v (%v)", sources, err)
+	}
+
+	if result, err = builder.PreloadPackages(sources, nil, cache); err != nil {
+		t.Fatalf("Failed to preload packages: %v", err)
+	}
+
+	if *result != (builder.PreloadResult{Added: 1, Existing: 1, Unverified: 1}) {
+		t.Fatalf("Unexpected result: %+v", *result)
+	}
+}
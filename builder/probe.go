@@ -0,0 +1,172 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HostFeatures are the features of the host kernel that solbuild relies on,
+// or makes use of when available.
+type HostFeatures struct {
+	Kernel             string `json:"kernel"`               // Release of the running kernel
+	Overlay            bool   `json:"overlay"`              // Whether overlayfs is available
+	OverlayMetacopy    bool   `json:"overlay_metacopy"`     // Whether overlayfs can copy up metadata only
+	OverlayRedirectDir bool   `json:"overlay_redirect_dir"` // Whether overlayfs can rename directories without copying them up
+	UserNamespaces     bool   `json:"user_namespaces"`      // Whether user namespaces may be created
+	IDMappedMounts     bool   `json:"idmapped_mounts"`      // Whether bind mounts may be idmapped
+	LoopDevices        bool   `json:"loop_devices"`         // Whether loop devices are available to mount images
+	CgroupVersion      int    `json:"cgroup_version"`       // 1, 2, or 0 when cgroups are not mounted
+}
+
+// UseMetacopy enables metacopy for the build overlay, when supported.
+var UseMetacopy = true
+
+var (
+	hostFeatures     *HostFeatures
+	hostFeaturesOnce sync.Once
+)
+
+// Probe will return the features of the host kernel, which are only
+// detected once.
+func Probe() *HostFeatures {
+	hostFeaturesOnce.Do(func() { hostFeatures = ProbeHost("/") })
+
+	return hostFeatures
+}
+
+// ProbeHost will detect the features of the kernel from the /proc, /sys and
+// /dev within root.
+func ProbeHost(root string) *HostFeatures {
+	features := &HostFeatures{
+		Kernel:         strings.TrimSpace(readProbeFile(root, "proc/sys/kernel/osrelease")),
+		Overlay:        hasFilesystem(root, "overlay") || PathExists(filepath.Join(root, "sys/module/overlay")),
+		UserNamespaces: PathExists(filepath.Join(root, "proc/self/ns/user")),
+		LoopDevices: PathExists(filepath.Join(root, "dev/loop-control")) ||
+			PathExists(filepath.Join(root, "sys/module/loop")),
+	}
+
+	// Module parameters are only present when the kernel supports them
+	if features.Overlay {
+		params := filepath.Join(root, "sys/module/overlay/parameters")
+		features.OverlayMetacopy = PathExists(filepath.Join(params, "metacopy"))
+		features.OverlayRedirectDir = PathExists(filepath.Join(params, "redirect_dir"))
+	}
+
+	if value := strings.TrimSpace(readProbeFile(root, "proc/sys/user/max_user_namespaces")); value != "" {
+		if limit, err := strconv.Atoi(value); err == nil && limit == 0 {
+			features.UserNamespaces = false
+		}
+	}
+
+	// Idmapped mounts arrived in 5.12, and need a user namespace to map with
+	features.IDMappedMounts = features.UserNamespaces && kernelAtLeast(features.Kernel, 5, 12)
+
+	switch {
+	case PathExists(filepath.Join(root, "sys/fs/cgroup/cgroup.controllers")):
+		features.CgroupVersion = 2
+	case hasFilesystem(root, "cgroup") && PathExists(filepath.Join(root, "sys/fs/cgroup/cpu")):
+		features.CgroupVersion = 1
+	}
+
+	return features
+}
+
+// kernelAtLeast determines whether the kernel release is at least the given
+// version.
+func kernelAtLeast(release string, major, minor int) bool {
+	fields := strings.FieldsFunc(release, func(r rune) bool { return r < '0' || r > '9' })
+	if len(fields) < 2 {
+		return false
+	}
+
+	gotMajor, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+
+	gotMinor, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// readProbeFile returns the contents of the file within root, or nothing if
+// it cannot be read.
+func readProbeFile(root, path string) string {
+	data, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// hasFilesystem determines whether the kernel supports the filesystem type,
+// as listed in /proc/filesystems.
+func hasFilesystem(root, name string) bool {
+	scanner := bufio.NewScanner(bytes.NewReader([]byte(readProbeFile(root, "proc/filesystems"))))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OverlayOptions will return the options to mount the build overlay with,
+// enabling metacopy when UseMetacopy is set and it is supported, so that
+// changing the ownership or mode of a file from the image, such as within
+// the build home, does not copy up its contents.
+func (f *HostFeatures) OverlayOptions(lower, upper, work string) []string {
+	options := []string{
+		"lowerdir=" + lower,
+		"upperdir=" + upper,
+		"workdir=" + work,
+	}
+
+	if UseMetacopy && f.OverlayMetacopy {
+		options = append(options, "metacopy=on")
+	}
+
+	return options
+}
+
+// Problems will describe the missing features that prevent builds.
+func (f *HostFeatures) Problems() []string {
+	var problems []string
+
+	if !f.Overlay {
+		problems = append(problems, "overlayfs is unavailable, try 'modprobe overlay'")
+	}
+
+	if !f.LoopDevices {
+		problems = append(problems, "loop devices are unavailable, try 'modprobe loop', or pass /dev/loop* into the container")
+	}
+
+	return problems
+}
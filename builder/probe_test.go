@@ -0,0 +1,124 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func writeProbeRoot(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for path, content := range files {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	return root
+}
+
+func TestProbeHost(t *testing.T) {
+	root := writeProbeRoot(t, map[string]string{
+		"proc/sys/kernel/osrelease":                  "6.12.8-311.current\n",
+		"proc/filesystems":                           "nodev\tsysfs\nnodev\ttmpfs\n\text4\nnodev\toverlay\n",
+		"proc/self/ns/user":                          "",
+		"proc/sys/user/max_user_namespaces":          "63498\n",
+		"sys/module/overlay/parameters/metacopy":     "N\n",
+		"sys/module/overlay/parameters/redirect_dir": "N\n",
+		"sys/fs/cgroup/cgroup.controllers":           "cpuset cpu io memory pids\n",
+		"dev/loop-control":                           "",
+	})
+
+	features := builder.ProbeHost(root)
+	expected := builder.HostFeatures{
+		Kernel:             "6.12.8-311.current",
+		Overlay:            true,
+		OverlayMetacopy:    true,
+		OverlayRedirectDir: true,
+		UserNamespaces:     true,
+		IDMappedMounts:     true,
+		LoopDevices:        true,
+		CgroupVersion:      2,
+	}
+
+	if *features != expected {
+		t.Fatalf("Expected %+v, got: %+v", expected, *features)
+	}
+
+	if problems := features.Problems(); len(problems) != 0 {
+		t.Fatalf("Expected no problems, got: %v", problems)
+	}
+
+	options := features.OverlayOptions("/img", "/tmp", "/work")
+	if !slices.Equal(options, []string{"lowerdir=/img", "upperdir=/tmp", "workdir=/work", "metacopy=on"}) {
+		t.Fatalf("Expected metacopy to be enabled, got: %v", options)
+	}
+
+	builder.UseMetacopy = false
+
+	t.Cleanup(func() { builder.UseMetacopy = true })
+
+	if options = features.OverlayOptions("/img", "/tmp", "/work"); slices.Contains(options, "metacopy=on") {
+		t.Fatalf("Expected metacopy to be disabled, got: %v", options)
+	}
+}
+
+func TestProbeHostMissing(t *testing.T) {
+	root := writeProbeRoot(t, map[string]string{
+		"proc/sys/kernel/osrelease":         "6.1.0\n",
+		"proc/filesystems":                  "nodev\tsysfs\n\text4\n",
+		"proc/self/ns/user":                 "",
+		"proc/sys/user/max_user_namespaces": "0\n",
+	})
+
+	features := builder.ProbeHost(root)
+	if features.Overlay || features.OverlayMetacopy || features.UserNamespaces || features.IDMappedMounts ||
+		features.LoopDevices || features.CgroupVersion != 0 {
+		t.Fatalf("Expected no features, got: %+v", *features)
+	}
+
+	if problems := features.Problems(); len(problems) != 2 {
+		t.Fatalf("Expected overlayfs and loop device problems, got: %v", problems)
+	}
+
+	if options := features.OverlayOptions("/img", "/tmp", "/work"); slices.Contains(options, "metacopy=on") {
+		t.Fatalf("Expected metacopy to be unsupported, got: %v", options)
+	}
+
+	// User namespaces are available, but the kernel is too old
+	root = writeProbeRoot(t, map[string]string{
+		"proc/sys/kernel/osrelease": "5.10.0-28-amd64\n",
+		"proc/self/ns/user":         "",
+	})
+
+	if features = builder.ProbeHost(root); !features.UserNamespaces || features.IDMappedMounts {
+		t.Fatalf("Expected idmapped mounts to be unsupported, got: %+v", *features)
+	}
+}
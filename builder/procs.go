@@ -0,0 +1,104 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// A ProcessTable finds the processes running on the host. Processes may exit
+// at any time, so anything listed may have gone by the time it is looked at.
+type ProcessTable interface {
+	// PIDs lists the processes running.
+	PIDs() ([]int, error)
+
+	// Cwd resolves the working directory of the process.
+	Cwd(pid int) (string, error)
+}
+
+// ProcTable finds the processes through the procfs mounted at Dir.
+type ProcTable struct {
+	Dir string
+}
+
+// HostProcesses are the processes of the host, as seen through /proc.
+var HostProcesses ProcessTable = ProcTable{Dir: "/proc"}
+
+// PIDs implements ProcessTable.
+func (t ProcTable) PIDs() ([]int, error) {
+	// Entries read before an error are still good, as processes exiting
+	// mid-walk may cut it short
+	entries, err := os.ReadDir(t.Dir)
+	if err != nil && len(entries) == 0 {
+		return nil, err
+	}
+
+	if err != nil {
+		slog.Debug("Failed to list all processes", "dir", t.Dir, "err", err)
+	}
+
+	var pids []int
+
+	for _, entry := range entries {
+		// Skip self, sys and the other entries that are not processes
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid <= 0 {
+			continue
+		}
+
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
+// Cwd implements ProcessTable.
+func (t ProcTable) Cwd(pid int) (string, error) {
+	return filepath.EvalSymlinks(filepath.Join(t.Dir, strconv.Itoa(pid), "cwd"))
+}
+
+// FindRootProcesses returns the processes of the table working within the
+// given root, skipping any that exit while they are being looked at.
+func FindRootProcesses(table ProcessTable, root string) ([]int, error) {
+	path, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	pids, err := table.PIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []int
+
+	for _, pid := range pids {
+		cwd, err := table.Cwd(pid)
+		if err != nil {
+			continue
+		}
+
+		if cwd == path {
+			ret = append(ret, pid)
+		}
+	}
+
+	return ret, nil
+}
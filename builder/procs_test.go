@@ -0,0 +1,124 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// fakeProcTree creates a procfs with a process for each of the working
+// directories.
+func fakeProcTree(t *testing.T, cwds map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, cwd := range cwds {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatalf("Failed to create process %s: %v", name, err)
+		}
+
+		if cwd == "" {
+			continue
+		}
+
+		if err := os.Symlink(cwd, filepath.Join(dir, name, "cwd")); err != nil {
+			t.Fatalf("Failed to link cwd of %s: %v", name, err)
+		}
+	}
+
+	return dir
+}
+
+func TestFindRootProcesses(t *testing.T) {
+	root := t.TempDir()
+	other := t.TempDir()
+
+	// The root may be reached through a symlink
+	link := filepath.Join(t.TempDir(), "root")
+	if err := os.Symlink(root, link); err != nil {
+		t.Fatalf("Failed to link root: %v", err)
+	}
+
+	proc := fakeProcTree(t, map[string]string{
+		"10":   root,
+		"11":   other,
+		"12":   "",                              // Exited, its cwd already gone
+		"13":   filepath.Join(other, "missing"), // Exited, cwd no longer resolves
+		"14":   link,                            // Working within the root through the link
+		"self": root,                            // Not a process
+		"sys":  "",                              // Not a process
+		"-1":   root,                            // Not a pid
+	})
+
+	pids, err := builder.FindRootProcesses(builder.ProcTable{Dir: proc}, link)
+	if err != nil {
+		t.Fatalf("Failed to find processes: %v", err)
+	}
+
+	slices.Sort(pids)
+
+	if !slices.Equal(pids, []int{10, 14}) {
+		t.Fatalf("Expected processes 10 and 14, got: %v", pids)
+	}
+
+	if _, err = builder.FindRootProcesses(builder.ProcTable{Dir: filepath.Join(proc, "missing")}, root); err == nil {
+		t.Fatal("Expected a missing procfs to fail")
+	}
+}
+
+// vanishingTable lists processes which have exited by the time they are
+// looked at.
+type vanishingTable struct {
+	root string
+}
+
+func (v vanishingTable) PIDs() ([]int, error) {
+	return []int{1, 2, 3}, nil
+}
+
+func (v vanishingTable) Cwd(pid int) (string, error) {
+	if pid == 2 {
+		return v.root, nil
+	}
+
+	return "", &fs.PathError{Op: "readlink", Path: "/proc/cwd", Err: fs.ErrNotExist}
+}
+
+func TestFindRootProcessesVanishing(t *testing.T) {
+	root := t.TempDir()
+
+	pids, err := builder.FindRootProcesses(vanishingTable{root: root}, root)
+	if err != nil {
+		t.Fatalf("Exited processes should be skipped, got: %v", err)
+	}
+
+	if !slices.Equal(pids, []int{2}) {
+		t.Fatalf("Expected process 2, got: %v", pids)
+	}
+
+	if _, err = builder.FindRootProcesses(vanishingTable{root: root}, filepath.Join(root, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected a missing root to fail, got: %v", err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -29,28 +30,67 @@ import (
 // A Repo is a definition of a repository to add to the eopkg root during
 // the build process.
 type Repo struct {
-	Name      string `toml:"-"`         // Name of the repo, set by implementation not yoml
-	URI       string `toml:"uri"`       // URI of the repository
-	Local     bool   `toml:"local"`     // Local repository for bindmounting
-	AutoIndex bool   `toml:"autoindex"` // Enable automatic indexing of the repo
+	Name      string   `toml:"-"`         // Name of the repo, set by implementation not yoml
+	URI       string   `toml:"uri"`       // URI of the repository
+	Local     bool     `toml:"local"`     // Local repository for bindmounting
+	AutoIndex bool     `toml:"autoindex"` // Enable automatic indexing of the repo
+	Packages  []string `toml:"packages"`  // Only enable for packages matching these patterns
+
+	IndexSha256 string `toml:"index_sha256"` // Required SHA256 digest of the repo index
+	SigningKey  string `toml:"signing_key"`  // OpenPGP public key that must have signed the index
+}
+
+// IsConditional determines whether the repo is only enabled for some packages.
+func (r *Repo) IsConditional() bool {
+	return len(r.Packages) > 0
+}
+
+// AppliesTo determines whether the repo should be enabled for the named
+// package. Unconditional repos apply to every package.
+func (r *Repo) AppliesTo(name string) bool {
+	if !r.IsConditional() {
+		return true
+	}
+
+	for _, pattern := range r.Packages {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
 }
 
 // A Profile is a configuration defining what backing image to use, what repos
 // to add, etc.
 type Profile struct {
-	AddRepos    []string         `toml:"add_repos"`    // Allow locking to a single set of repos
-	Image       string           `toml:"image"`        // The backing image for this profile
-	Name        string           `toml:"-"`            // Name of this profile, set by file name not toml
-	RemoveRepos []string         `toml:"remove_repos"` // A set of repos to remove. ["*"] is valid here.
-	Repos       map[string]*Repo `toml:"repo"`         // Allow defining custom repos
+	AddRepos       []string         `toml:"add_repos"`       // Allow locking to a single set of repos
+	Compression    string           `toml:"compression"`     // Compression of produced packages, replacing that of solbuild.conf
+	Image          string           `toml:"image"`           // The backing image for this profile
+	ImageMirrors   []string         `toml:"image_mirrors"`   // Mirrors to fetch the image from, replacing those of solbuild.conf
+	Name           string           `toml:"-"`               // Name of this profile, set by file name not toml
+	PackageManager string           `toml:"package_manager"` // Package manager for the image, eopkg by default
+	Proxy          *ProxyConfig     `toml:"proxy"`           // Proxies replacing those of solbuild.conf for this profile
+	RemoveRepos    []string         `toml:"remove_repos"`    // A set of repos to remove. ["*"] is valid here.
+	Repos          map[string]*Repo `toml:"repo"`            // Allow defining custom repos
 }
 
 // ProfileSuffix is the fixed extension for solbuild profile files.
 var ProfileSuffix = ".profile"
 
+// ProfilePathEnv may hold extra directories to load profiles from, separated
+// by colons, such as a directory within a packaging repository.
+const ProfilePathEnv = "SOLBUILD_PROFILE_PATH"
+
 // NewProfile will attempt to load the named profile from the system paths.
 func NewProfile(name string) (*Profile, error) {
-	for _, p := range ConfigPaths {
+	return NewProfileFromDirs(name, ConfigPaths)
+}
+
+// NewProfileFromDirs will attempt to load the named profile from the first
+// of the given directories holding it.
+func NewProfileFromDirs(name string, dirs []string) (*Profile, error) {
+	for _, p := range dirs {
 		fp := filepath.Join(p, fmt.Sprintf("%s%s", name, ProfileSuffix))
 		if !PathExists(fp) {
 			continue
@@ -64,19 +104,58 @@ func NewProfile(name string) (*Profile, error) {
 
 // GetAllProfiles will locate all available profiles for solbuild.
 func GetAllProfiles() (map[string]*Profile, error) {
+	return GetProfilesFromDirs(ConfigPaths)
+}
+
+// ProfileNames will return the sorted names of the profiles that may be used
+// with the config, searching the colon separated dirs first as with the
+// --profile-dir option. Unlike a Manager it does not require root, so that
+// profile names can be completed by the shell.
+func ProfileNames(config *Config, dirs string) ([]string, error) {
+	var extra []string
+
+	for _, dir := range filepath.SplitList(dirs) {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+
+		extra = append(extra, dir)
+	}
+
+	profiles, err := GetProfilesFromDirs(profileSearchDirs(extra, config))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// GetProfilesFromDirs will locate all profiles within the given directories.
+// Profiles in earlier directories take precedence.
+func GetProfilesFromDirs(dirs []string) (map[string]*Profile, error) {
 	ret := make(map[string]*Profile)
 
-	for _, p := range ConfigPaths {
+	for _, p := range dirs {
 		gl := filepath.Join(p, "*.profile")
 
 		profiles, _ := filepath.Glob(gl)
 
 		for _, o := range profiles {
-			if profile, err := NewProfileFromPath(o); err == nil {
-				ret[profile.Name] = profile
-			} else {
+			profile, err := NewProfileFromPath(o)
+			if err != nil {
 				return nil, err
 			}
+
+			if _, ok := ret[profile.Name]; !ok {
+				ret[profile.Name] = profile
+			}
 		}
 	}
 
@@ -111,9 +190,23 @@ func NewProfileFromPath(path string) (*Profile, error) {
 		return nil, err
 	}
 
-	// Ensure all repos have a valid name
+	if err = ValidatePackageManager(profile.PackageManager); err != nil {
+		return nil, err
+	}
+
+	// Ensure all repos have a valid name and package patterns
 	for name, repo := range profile.Repos {
 		repo.Name = name
+
+		for _, pattern := range repo.Packages {
+			if _, err = filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("Invalid package pattern '%s' for repo %v", pattern, name)
+			}
+		}
+
+		if err = repo.validatePin(); err != nil {
+			return nil, err
+		}
 	}
 
 	// Ignore a wildcard add
@@ -130,3 +223,56 @@ func NewProfileFromPath(path string) (*Profile, error) {
 
 	return profile, nil
 }
+
+// GetRepos returns the repos to enable when building the named package.
+// Conditional repos are only enabled for matching packages, in which case
+// they are enabled regardless of add_repos, after all other repos.
+func (p *Profile) GetRepos(name string) []*Repo {
+	var ret []*Repo
+
+	if (len(p.AddRepos) == 1 && p.AddRepos[0] == "*") || len(p.AddRepos) == 0 {
+		for _, repo := range p.Repos {
+			if !repo.IsConditional() {
+				ret = append(ret, repo)
+			}
+		}
+	} else {
+		for _, id := range p.AddRepos {
+			if repo := p.Repos[id]; repo.AppliesTo(name) {
+				ret = append(ret, repo)
+			}
+		}
+	}
+
+	var conditional []*Repo
+
+	for _, repo := range p.Repos {
+		if repo.IsConditional() && repo.AppliesTo(name) {
+			conditional = append(conditional, repo)
+		}
+	}
+
+	sort.Slice(conditional, func(i, j int) bool {
+		return conditional[i].Name < conditional[j].Name
+	})
+
+	for _, repo := range conditional {
+		// Already enabled via add_repos
+		if !containsRepo(ret, repo) {
+			ret = append(ret, repo)
+		}
+	}
+
+	return ret
+}
+
+// containsRepo determines whether the repo is already in the set.
+func containsRepo(repos []*Repo, repo *Repo) bool {
+	for _, r := range repos {
+		if r == repo {
+			return true
+		}
+	}
+
+	return false
+}
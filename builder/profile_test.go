@@ -17,6 +17,10 @@
 package builder_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/getsolus/solbuild/builder"
@@ -72,3 +76,181 @@ func TestLoadProfile(t *testing.T) {
 		t.Fatalf("Invalid AddRepos: %s", profile.AddRepos[0])
 	}
 }
+
+func repoNames(repos []*builder.Repo) []string {
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+
+	return names
+}
+
+func TestConditionalRepos(t *testing.T) {
+	profile, err := builder.NewProfileFromPath("testdata/conditional.profile")
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+
+	tests := map[string][]string{
+		"nano":         {"Solus"},
+		"haskell-text": {"Solus", "Haskell"},
+		"ghc":          {"Solus", "Haskell"},
+		"ghc-extra":    {"Solus"},
+	}
+
+	for pkg, expected := range tests {
+		names := repoNames(profile.GetRepos(pkg))
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Wrong repos for %s: %v vs expected %v", pkg, names, expected)
+		}
+	}
+
+	// All repos enabled implicitly, conditional still filtered
+	profile.AddRepos = nil
+
+	if names := repoNames(profile.GetRepos("nano")); len(names) != 1 || names[0] != "Solus" {
+		t.Fatalf("Conditional repo enabled for non-matching package: %v", names)
+	}
+}
+
+func TestPinnedRepo(t *testing.T) {
+	if _, err := builder.NewProfileFromPath("testdata/bad-pin.profile"); err == nil {
+		t.Fatal("Loaded profile pinning an autoindexed repo")
+	}
+
+	profile, err := builder.NewProfileFromPath("testdata/pinned.profile")
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+
+	repo := profile.Repos["Pinned"]
+	if !repo.IsPinned() {
+		t.Fatal("Repo should be pinned")
+	}
+
+	if err = repo.Verify(); err != nil {
+		t.Fatalf("Failed to verify pinned repo: %v", err)
+	}
+
+	repo.IndexSha256 = strings.Repeat("0", 64)
+
+	if err = repo.Verify(); !errors.Is(err, builder.ErrRepoVerification) {
+		t.Fatalf("Verified repo with wrong digest: %v", err)
+	}
+}
+
+func TestPlanRepoChanges(t *testing.T) {
+	profile, err := builder.NewProfileFromPath("testdata/conditional.profile")
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+
+	profile.RemoveRepos = []string{"Solus"}
+
+	current := []*builder.RootRepo{
+		{ID: "Solus", URI: "https://cdn.getsol.us/repo/shannon/eopkg-index.xml.xz"},
+		{ID: "Local", URI: "/hostRepos/Local/eopkg-index.xml.xz"},
+	}
+
+	changes := builder.PlanRepoChanges(current, profile, "haskell-text")
+
+	expected := []builder.RepoChange{
+		{Action: builder.RepoRemove, Name: "Solus", URI: current[0].URI},
+		{Action: builder.RepoKeep, Name: "Local", URI: current[1].URI},
+		{Action: builder.RepoAdd, Name: "Solus", URI: profile.Repos["Solus"].URI},
+		{Action: builder.RepoAdd, Name: "Haskell", URI: "/var/lib/haskell-repo", Conditional: true},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d repo changes, got %v", len(expected), changes)
+	}
+
+	for i, change := range changes {
+		if change != expected[i] {
+			t.Fatalf("Expected repo change %v, got %v", expected[i], change)
+		}
+	}
+}
+
+func TestProfilePackageManager(t *testing.T) {
+	if _, err := builder.NewProfileFromPath("testdata/bad-manager.profile"); err == nil {
+		t.Fatal("Loaded a profile with an unknown package manager")
+	}
+
+	profile, err := builder.NewProfileFromPath("testdata/sol.profile")
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+
+	pman, err := builder.NewPackageManager(profile.PackageManager, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create package manager: %v", err)
+	}
+
+	if err = pman.Init(); !errors.Is(err, builder.ErrSolUnsupported) {
+		t.Fatalf("Expected sol to be unsupported, got %v", err)
+	}
+
+	if _, err = pman.InstallDepsCommand("/home/build/package.yml"); !errors.Is(err, builder.ErrSolUnsupported) {
+		t.Fatalf("Expected sol dependency installs to be unsupported, got %v", err)
+	}
+
+	if pman, _ = builder.NewPackageManager("", nil, t.TempDir()); pman == nil {
+		t.Fatal("Expected eopkg by default")
+	}
+
+	if _, ok := pman.(*builder.EopkgManager); !ok {
+		t.Fatalf("Expected eopkg by default, got %T", pman)
+	}
+
+	cmd, err := pman.InstallDepsCommand("/home/build/package.yml")
+	if err != nil || !strings.HasPrefix(cmd, "ypkg-install-deps ") || !strings.Contains(cmd, "-f /home/build/package.yml") {
+		t.Fatalf("Unexpected eopkg dependency install command %q (%v)", cmd, err)
+	}
+}
+
+func writeTestProfile(t *testing.T, dir, name, image string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name+builder.ProfileSuffix)
+	if err := os.WriteFile(path, []byte("image = \""+image+"\"\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write test profile: %v", err)
+	}
+}
+
+func TestProfileDirs(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+
+	writeTestProfile(t, first, "custom", "unstable-x86_64")
+	writeTestProfile(t, second, "custom", "main-x86_64")
+	writeTestProfile(t, second, "other", "main-x86_64")
+
+	dirs := []string{first, second}
+
+	profile, err := builder.NewProfileFromDirs("custom", dirs)
+	if err != nil {
+		t.Fatalf("Failed to load profile from directories: %v", err)
+	}
+
+	if profile.Image != "unstable-x86_64" {
+		t.Fatalf("Earlier directory should take precedence, got image: %v", profile.Image)
+	}
+
+	if _, err = builder.NewProfileFromDirs("missing", dirs); !errors.Is(err, builder.ErrInvalidProfile) {
+		t.Fatalf("Expected ErrInvalidProfile for missing profile, got: %v", err)
+	}
+
+	profiles, err := builder.GetProfilesFromDirs(dirs)
+	if err != nil {
+		t.Fatalf("Failed to list profiles: %v", err)
+	}
+
+	if len(profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got: %v", len(profiles))
+	}
+
+	if profiles["custom"].Image != "unstable-x86_64" {
+		t.Fatalf("Earlier directory should take precedence, got image: %v", profiles["custom"].Image)
+	}
+}
@@ -0,0 +1,184 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// progressTailLines is how many lines of raw output are kept, to be shown
+// should the command fail.
+const progressTailLines = 30
+
+var (
+	// ansiEscape matches the colour codes eopkg may emit.
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+	// eopkgStep matches eopkg counting through the packages of a transaction,
+	// e.g. "Downloading 3 / 25".
+	eopkgStep = regexp.MustCompile(`^(Downloading|Installing|Removing|Configuring)\s+(\d+)\s*/\s*(\d+)$`)
+
+	// eopkgPackage matches eopkg naming the package it is working on, e.g.
+	// "Installing nano, version 8.0, release 180".
+	eopkgPackage = regexp.MustCompile(`^(Installing|Upgrading|Removing|Configuring)\s+(\S+),\s+version\s+(\S+),\s+release\s+(\d+)`)
+
+	// eopkgSize matches eopkg reporting the size of the transaction, e.g.
+	// "Total size of package(s): 120.50 MB".
+	eopkgSize = regexp.MustCompile(`^Total size of package\(s\):\s+(.+)$`)
+)
+
+// EopkgProgress is a single step reported by eopkg.
+type EopkgProgress struct {
+	Action  string // What eopkg is doing, such as Downloading or Installing
+	Current int    // Position of the package within the transaction
+	Total   int    // Number of packages within the transaction
+	Package string // Name of the package, if known
+	Size    string // Total size of the transaction, if known
+}
+
+// ParseEopkgProgress will parse a single line of eopkg output, returning the
+// progress it reports. The second return value is false when the line does
+// not report any progress.
+func ParseEopkgProgress(line string) (EopkgProgress, bool) {
+	line = strings.TrimSpace(ansiEscape.ReplaceAllString(line, ""))
+
+	if m := eopkgStep.FindStringSubmatch(line); m != nil {
+		current, _ := strconv.Atoi(m[2])
+		total, _ := strconv.Atoi(m[3])
+
+		return EopkgProgress{Action: m[1], Current: current, Total: total}, true
+	}
+
+	if m := eopkgPackage.FindStringSubmatch(line); m != nil {
+		return EopkgProgress{Action: m[1], Package: m[2]}, true
+	}
+
+	if m := eopkgSize.FindStringSubmatch(line); m != nil {
+		return EopkgProgress{Size: strings.TrimSpace(m[1])}, true
+	}
+
+	return EopkgProgress{}, false
+}
+
+// EopkgProgressWriter reports the progress of eopkg as it writes its output,
+// passing the raw output on to another writer.
+type EopkgProgressWriter struct {
+	label   string
+	raw     io.Writer
+	partial []byte
+	tail    [][]byte
+	state   EopkgProgress
+}
+
+// NewEopkgProgressWriter will return a writer reporting progress under the
+// given label, with the raw output sent to raw.
+func NewEopkgProgressWriter(label string, raw io.Writer) *EopkgProgressWriter {
+	return &EopkgProgressWriter{
+		label: label,
+		raw:   raw,
+	}
+}
+
+// Write implements io.Writer.
+func (w *EopkgProgressWriter) Write(p []byte) (int, error) {
+	if _, err := w.raw.Write(p); err != nil {
+		return 0, err
+	}
+
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		w.line(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush will handle any final line not ending in a newline.
+func (w *EopkgProgressWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.line(w.partial)
+		w.partial = nil
+	}
+}
+
+// Tail returns the most recent lines of raw output.
+func (w *EopkgProgressWriter) Tail() []byte {
+	return append(bytes.Join(w.tail, []byte("\n")), '\n')
+}
+
+// line will record a single line of output, reporting any progress in it.
+func (w *EopkgProgressWriter) line(line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	w.tail = append(w.tail, bytes.Clone(line))
+	if len(w.tail) > progressTailLines {
+		w.tail = w.tail[1:]
+	}
+
+	progress, ok := ParseEopkgProgress(string(line))
+	if !ok {
+		return
+	}
+
+	switch {
+	case progress.Size != "":
+		w.state.Size = progress.Size
+
+		slog.Info("Total size of packages", "label", w.label, "size", w.state.Size)
+	case progress.Package != "":
+		// eopkg names the package after counting it, report them together
+		w.state.Action = progress.Action
+		w.state.Package = progress.Package
+
+		slog.Info(w.state.Action, "label", w.label, "package", w.state.Package, "progress", w.counter())
+	default:
+		w.state.Action = progress.Action
+		w.state.Current = progress.Current
+		w.state.Total = progress.Total
+		w.state.Package = ""
+
+		// Downloads are not followed by the package name
+		if w.state.Action == "Downloading" {
+			slog.Info(w.state.Action, "label", w.label, "progress", w.counter())
+		}
+	}
+}
+
+// counter returns the position within the transaction, e.g. "3 of 25".
+func (w *EopkgProgressWriter) counter() string {
+	return fmt.Sprintf("%d of %d", w.state.Current, w.state.Total)
+}
+
+// Progress returns the most recent progress reported.
+func (w *EopkgProgressWriter) Progress() EopkgProgress {
+	return w.state
+}
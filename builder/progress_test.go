@@ -0,0 +1,81 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParseEopkgProgress(t *testing.T) {
+	tests := map[string]builder.EopkgProgress{
+		"Downloading 3 / 25":                         {Action: "Downloading", Current: 3, Total: 25},
+		"\x1b[33mInstalling 12 / 25\x1b[0m":          {Action: "Installing", Current: 12, Total: 25},
+		"Installing nano, version 8.0, release 180":  {Action: "Installing", Package: "nano"},
+		"Upgrading glibc, version 2.40, release 140": {Action: "Upgrading", Package: "glibc"},
+		"Total size of package(s): 120.50 MB":        {Size: "120.50 MB"},
+	}
+
+	for line, expected := range tests {
+		progress, ok := builder.ParseEopkgProgress(line)
+		if !ok {
+			t.Fatalf("Expected progress from %q", line)
+		}
+
+		if progress != expected {
+			t.Fatalf("Unexpected progress from %q: %+v", line, progress)
+		}
+	}
+
+	if _, ok := builder.ParseEopkgProgress("Extracting the files of nano"); ok {
+		t.Fatal("Expected no progress from an unrelated line")
+	}
+}
+
+func TestEopkgProgressWriter(t *testing.T) {
+	var raw bytes.Buffer
+
+	output := "Total size of package(s): 1.20 MB\nDownloading 1 / 2\nDownloading 2 / 2\n" +
+		"Installing 2 / 2\nInstalling nano, version 8.0, release 180\nSome final line"
+
+	w := builder.NewEopkgProgressWriter("upgrade", &raw)
+
+	// Split writes across lines, as a pipe would
+	for _, chunk := range []string{output[:20], output[20:50], output[50:]} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	w.Flush()
+
+	if raw.String() != output {
+		t.Fatalf("Raw output was not passed on: %q", raw.String())
+	}
+
+	expected := builder.EopkgProgress{Action: "Installing", Current: 2, Total: 2, Package: "nano", Size: "1.20 MB"}
+	if progress := w.Progress(); progress != expected {
+		t.Fatalf("Unexpected progress: %+v", progress)
+	}
+
+	if tail := string(w.Tail()); !strings.HasSuffix(tail, "Some final line\n") {
+		t.Fatalf("Unexpected tail: %q", tail)
+	}
+}
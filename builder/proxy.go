@@ -0,0 +1,114 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// A ProxyConfig holds the proxies used both for downloads on the host and
+// within the chroot, so that builds behave the same no matter whose shell
+// launched solbuild.
+type ProxyConfig struct {
+	HTTP    string `toml:"http"`     // Proxy for HTTP requests
+	HTTPS   string `toml:"https"`    // Proxy for HTTPS requests
+	FTP     string `toml:"ftp"`      // Proxy for FTP requests
+	NoProxy string `toml:"no_proxy"` // Comma separated hosts to reach directly
+}
+
+// proxyVariables are the environment variables controlling proxies, which are
+// honoured in either case by most tools. The proxy URLs come first.
+var proxyVariables = []string{"http_proxy", "https_proxy", "ftp_proxy", "no_proxy"}
+
+// Proxy is the proxy configuration in effect, set from the config and any
+// override in the profile.
+var Proxy ProxyConfig
+
+// values maps each proxy variable to its configured value.
+func (p ProxyConfig) values() map[string]string {
+	return map[string]string{
+		"http_proxy":  p.HTTP,
+		"https_proxy": p.HTTPS,
+		"ftp_proxy":   p.FTP,
+		"no_proxy":    p.NoProxy,
+	}
+}
+
+// Validate will ensure each configured proxy is a URL with a host.
+func (p ProxyConfig) Validate() error {
+	values := p.values()
+
+	for _, name := range proxyVariables[:3] {
+		if values[name] == "" {
+			continue
+		}
+
+		u, err := url.Parse(values[name])
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Invalid %s proxy, must be a URL such as http://proxy:3128", strings.TrimSuffix(name, "_proxy"))
+		}
+	}
+
+	return nil
+}
+
+// Environment returns the configured proxies as environment variables, in
+// both lower and upper case.
+func (p ProxyConfig) Environment() []string {
+	values := p.values()
+
+	var env []string
+
+	for _, name := range proxyVariables {
+		if values[name] == "" {
+			continue
+		}
+
+		env = append(env,
+			fmt.Sprintf("%s=%s", name, values[name]),
+			fmt.Sprintf("%s=%s", strings.ToUpper(name), values[name]))
+	}
+
+	return env
+}
+
+// ApplyProxy makes p the proxy configuration in effect. The environment of
+// solbuild itself is replaced too, as host-side downloads and the tools they
+// run read their proxies from it. Proxies inherited from the invoking shell
+// are dropped with a warning rather than silently used.
+func ApplyProxy(p ProxyConfig) {
+	Proxy = p
+	values := p.values()
+
+	for _, name := range proxyVariables {
+		for _, variable := range []string{name, strings.ToUpper(name)} {
+			if inherited := os.Getenv(variable); inherited != "" && inherited != values[name] {
+				slog.Warn("Ignoring proxy from the environment, set it in the [proxy] section of solbuild.conf instead", "variable", variable)
+			}
+
+			if values[name] == "" {
+				os.Unsetenv(variable)
+			} else {
+				os.Setenv(variable, values[name])
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestApplyProxy(t *testing.T) {
+	t.Setenv("http_proxy", "http://inherited:8080")
+	t.Setenv("FTP_PROXY", "http://inherited:8080")
+
+	builder.ApplyProxy(builder.ProxyConfig{HTTPS: "http://proxy:3128", NoProxy: "localhost"})
+	t.Cleanup(func() { builder.ApplyProxy(builder.ProxyConfig{}) })
+
+	expected := []string{
+		"https_proxy=http://proxy:3128",
+		"HTTPS_PROXY=http://proxy:3128",
+		"no_proxy=localhost",
+		"NO_PROXY=localhost",
+	}
+
+	if env := builder.Proxy.Environment(); !slices.Equal(env, expected) {
+		t.Fatalf("Expected proxy environment %v, got: %v", expected, env)
+	}
+
+	for _, name := range []string{"http_proxy", "FTP_PROXY"} {
+		if value, ok := os.LookupEnv(name); ok {
+			t.Fatalf("Expected inherited %s to be dropped, got: %s", name, value)
+		}
+	}
+
+	if os.Getenv("HTTPS_PROXY") != "http://proxy:3128" {
+		t.Fatalf("Expected configured proxy in the environment, got: %s", os.Getenv("HTTPS_PROXY"))
+	}
+
+	if env := builder.SaneEnvironment("root", "/root"); !slices.Contains(env, "https_proxy=http://proxy:3128") || slices.Contains(env, "http_proxy=http://inherited:8080") {
+		t.Fatalf("Expected only configured proxies in the chroot environment, got: %v", env)
+	}
+}
+
+func TestLoadProfileProxy(t *testing.T) {
+	profile, err := builder.NewProfileFromPath("testdata/proxy.profile")
+	if err != nil {
+		t.Fatalf("Failed to load profile: %v", err)
+	}
+
+	if profile.Proxy == nil || profile.Proxy.HTTP != "http://proxy.example.com:3128" {
+		t.Fatalf("Expected proxy override in profile, got: %v", profile.Proxy)
+	}
+
+	if err = profile.Proxy.Validate(); err != nil {
+		t.Fatalf("Failed to validate proxy: %v", err)
+	}
+
+	if profile, err = builder.NewProfileFromPath(ProfileTestFile); err != nil || profile.Proxy != nil {
+		t.Fatalf("Expected no proxy override, got: %v (%v)", profile, err)
+	}
+}
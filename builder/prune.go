@@ -0,0 +1,343 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// byteUnits are the suffixes accepted by ParseByteSize, in IEC multiples.
+var byteUnits = map[byte]int64{
+	'K': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+	'T': 1 << 40,
+	'P': 1 << 50,
+}
+
+// ParseByteSize will parse a size such as "500M" or "1.5T" into bytes. A bare
+// number is taken to be in bytes.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := int64(1)
+	if m, ok := byteUnits[s[len(s)-1]]; ok {
+		multiplier = m
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// A pruneCandidate is a location that may be removed to relieve cache pressure.
+type pruneCandidate struct {
+	Path string
+	Kind UsageKind
+	Size int64
+	Time time.Time // Last use, older candidates are removed first
+}
+
+// remove will delete the candidate from disk.
+func (c *pruneCandidate) remove() error {
+	if err := os.RemoveAll(c.Path); err != nil {
+		return err
+	}
+
+	// Also drop the stale overlay lockfile
+	if c.Kind == UsageOverlay {
+		os.Remove(c.Path + ".lock")
+	}
+
+	return nil
+}
+
+// accessTime returns the last access time of the file, falling back to the
+// modification time.
+func accessTime(st os.FileInfo) time.Time {
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(sys.Atim.Sec, sys.Atim.Nsec)
+	}
+
+	return st.ModTime()
+}
+
+// sortOldestFirst orders candidates so the least recently used come first.
+func sortOldestFirst(candidates []pruneCandidate) []pruneCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Time.Before(candidates[j].Time)
+	})
+
+	return candidates
+}
+
+// overlayCandidates returns all package roots not currently in use. The
+// pool of a profile is not a package root, and is left to the pool itself.
+func overlayCandidates(config *Config, keep map[string]bool) []pruneCandidate {
+	var candidates []pruneCandidate
+
+	for _, usage := range packageUsage(nil, config.OverlayRootDir, UsageOverlay) {
+		if usage.Package == PoolDirectory || keep[usage.Path] || IsLockHeld(usage.Path+".lock") {
+			continue
+		}
+
+		st, err := os.Stat(usage.Path)
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, pruneCandidate{usage.Path, usage.Kind, usage.Size, st.ModTime()})
+	}
+
+	return sortOldestFirst(candidates)
+}
+
+// sourceCandidates returns all cached tarball sources not used by this build.
+func sourceCandidates(keep map[string]bool) []pruneCandidate {
+	var candidates []pruneCandidate
+
+	entries, _ := os.ReadDir(source.SourceDir)
+
+	for _, entry := range entries {
+		path := filepath.Join(source.SourceDir, entry.Name())
+
+		// Skip git sources, staging, and legacy sha1sum symlinks
+		if !entry.IsDir() || path == source.GitSourceDir || path == source.SourceStagingDir || keep[path] {
+			continue
+		}
+
+		st, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		size, _ := DirSize(path)
+		candidates = append(candidates, pruneCandidate{path, UsageSources, size, st.ModTime()})
+	}
+
+	return sortOldestFirst(candidates)
+}
+
+// packageCandidates returns the cached .eopkg files, least recently used first.
+func packageCandidates() []pruneCandidate {
+	var candidates []pruneCandidate
+
+	pkgs, _ := filepath.Glob(filepath.Join(PackageCacheDirectory, "*.eopkg"))
+
+	for _, pkg := range pkgs {
+		st, err := os.Stat(pkg)
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, pruneCandidate{pkg, UsagePackages, st.Size(), accessTime(st)})
+	}
+
+	return sortOldestFirst(candidates)
+}
+
+// prunableKinds are the kinds of storage that pruning may remove.
+var prunableKinds = map[UsageKind]bool{
+	UsageOverlay:  true,
+	UsageSources:  true,
+	UsagePackages: true,
+}
+
+// prunableDiskUsage sums the locations that pruning may remove. Images, build
+// caches, state and git sources are never pruned, so they are not counted,
+// lest they push everything else out of the budget.
+func prunableDiskUsage(config *Config) int64 {
+	var total int64
+
+	for _, usage := range GetDiskUsage(config) {
+		if !prunableKinds[usage.Kind] || (usage.Kind == UsageOverlay && usage.Package == PoolDirectory) {
+			continue
+		}
+
+		total += usage.Size
+	}
+
+	return total
+}
+
+// EnforceCacheBudget will prune solbuild-owned storage until the usage of
+// build roots, sources and cached packages is within the configured budget.
+// Old build roots are removed first, then unused sources, and finally the
+// least recently used cached packages. Anything required by pkg is never
+// removed.
+func EnforceCacheBudget(config *Config, pkg *Package, overlay *Overlay) error {
+	if config.CacheBudget == "" {
+		return nil
+	}
+
+	budget, err := ParseByteSize(config.CacheBudget)
+	if err != nil {
+		return fmt.Errorf("Invalid cache_budget, reason: %w", err)
+	}
+
+	total := prunableDiskUsage(config)
+	if total <= budget {
+		slog.Debug("Disk usage within budget", "usage", total, "budget", budget)
+		return nil
+	}
+
+	slog.Warn("Disk usage exceeds cache budget, pruning", "usage", total, "budget", budget)
+
+	keep := map[string]bool{overlay.BaseDir: true}
+
+	for _, src := range pkg.Sources {
+		bind := src.GetBindConfiguration("")
+		keep[filepath.Dir(bind.BindSource)] = true
+	}
+
+	candidates := overlayCandidates(config, keep)
+	candidates = append(candidates, sourceCandidates(keep)...)
+	candidates = append(candidates, packageCandidates()...)
+
+	for _, candidate := range candidates {
+		if total <= budget {
+			break
+		}
+
+		slog.Info("Pruning to relieve cache pressure", "kind", candidate.Kind, "path", candidate.Path,
+			"size", candidate.Size)
+
+		if err := candidate.remove(); err != nil {
+			slog.Warn("Failed to prune", "path", candidate.Path, "err", err)
+			continue
+		}
+
+		total -= candidate.Size
+	}
+
+	if total > budget {
+		slog.Warn("Unable to prune below cache budget", "usage", total, "budget", budget)
+	}
+
+	return nil
+}
+
+// A PrunePolicy selects what Prune removes. Candidates matching any of the
+// policies are removed.
+type PrunePolicy struct {
+	OlderThan time.Duration // Remove anything unused for longer, 0 to ignore age
+	Budget    int64         // Remove the least recently used until usage is within, 0 for no budget
+	Orphans   bool          // Remove legacy source links whose source is gone
+	DryRun    bool          // Only report what would be removed
+}
+
+// A PruneResult is a location removed, or which would be removed, by Prune.
+type PruneResult struct {
+	Path     string    `json:"path"`
+	Kind     UsageKind `json:"kind"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Prune will remove build roots, cached sources and cached packages as
+// selected by the policy, least recently used first. Build roots in use by
+// a running build are never removed.
+func Prune(config *Config, policy PrunePolicy) ([]PruneResult, error) {
+	candidates := overlayCandidates(config, nil)
+	candidates = append(candidates, sourceCandidates(nil)...)
+	candidates = append(candidates, packageCandidates()...)
+	candidates = sortOldestFirst(candidates)
+
+	var selected []pruneCandidate
+
+	total := int64(0)
+	if policy.Budget > 0 {
+		total = prunableDiskUsage(config)
+	}
+
+	for _, candidate := range candidates {
+		switch {
+		case policy.OlderThan > 0 && time.Since(candidate.Time) > policy.OlderThan:
+		case policy.Budget > 0 && total > policy.Budget:
+		default:
+			continue
+		}
+
+		selected = append(selected, candidate)
+		total -= candidate.Size
+	}
+
+	if policy.Orphans {
+		selected = append(selected, orphanCandidates()...)
+	}
+
+	results := make([]PruneResult, 0, len(selected))
+
+	for _, candidate := range selected {
+		if !policy.DryRun {
+			slog.Debug("Pruning", "kind", candidate.Kind, "path", candidate.Path, "size", candidate.Size)
+
+			if err := candidate.remove(); err != nil {
+				return results, fmt.Errorf("Failed to prune %s, reason: %w\n", candidate.Path, err)
+			}
+		}
+
+		results = append(results, PruneResult{candidate.Path, candidate.Kind, candidate.Size, candidate.Time})
+	}
+
+	return results, nil
+}
+
+// orphanCandidates returns the legacy sha1sum links to cached sources which
+// have since been removed.
+func orphanCandidates() []pruneCandidate {
+	var candidates []pruneCandidate
+
+	entries, _ := os.ReadDir(source.SourceDir)
+
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		path := filepath.Join(source.SourceDir, entry.Name())
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+
+		st, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, pruneCandidate{path, UsageSources, 0, st.ModTime()})
+	}
+
+	return candidates
+}
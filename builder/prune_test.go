@@ -0,0 +1,222 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	config := &builder.Config{
+		OverlayRootDir:  filepath.Join(dir, "roots"),
+		CacheDir:        filepath.Join(dir, "cache"),
+		ImagesDir:       filepath.Join(dir, "images"),
+		PackageCacheDir: filepath.Join(dir, "packages"),
+		SourcesDir:      filepath.Join(dir, "sources"),
+		StateDir:        filepath.Join(dir, "state"),
+	}
+
+	builder.ApplyDirectories(config)
+	t.Cleanup(func() { builder.ApplyDirectories(&builder.Config{}) })
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	oldRoot := filepath.Join(config.OverlayRootDir, "main-x86_64", "nano")
+	newRoot := filepath.Join(config.OverlayRootDir, "main-x86_64", "zstd")
+	oldSource := filepath.Join(source.SourceDir, "0123abcd")
+
+	for _, path := range []string{oldRoot, newRoot, oldSource} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(path, "data"), make([]byte, 4096), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{oldRoot, oldSource} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orphan := filepath.Join(source.SourceDir, "deadbeef")
+	if err := os.Symlink("missing", orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run only reports what would be removed
+	results, err := builder.Prune(config, builder.PrunePolicy{OlderThan: 7 * 24 * time.Hour, Orphans: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+
+	pruned := make(map[string]bool)
+	for _, result := range results {
+		pruned[result.Path] = true
+	}
+
+	if len(results) != 3 || !pruned[oldRoot] || !pruned[oldSource] || !pruned[orphan] {
+		t.Fatalf("Wrong candidates to prune: %+v", results)
+	}
+
+	if !builder.PathExists(oldRoot) || !builder.PathExists(oldSource) {
+		t.Fatal("Dry run removed files")
+	}
+
+	if _, err = builder.Prune(config, builder.PrunePolicy{OlderThan: 7 * 24 * time.Hour, Orphans: true}); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+
+	if builder.PathExists(oldRoot) || builder.PathExists(oldSource) || !builder.PathExists(newRoot) {
+		t.Fatal("Wrong roots and sources pruned by age")
+	}
+
+	if _, err = os.Lstat(orphan); !os.IsNotExist(err) {
+		t.Fatal("Orphaned source link was not pruned")
+	}
+
+	// Anything left is removed to get within budget
+	if results, err = builder.Prune(config, builder.PrunePolicy{Budget: 1}); err != nil || len(results) != 1 {
+		t.Fatalf("Failed to prune to budget: %+v, %v", results, err)
+	}
+
+	if builder.PathExists(newRoot) {
+		t.Fatal("Root was not pruned to get within budget")
+	}
+}
+
+func TestPruneSkipsPoolAndLockedRoots(t *testing.T) {
+	dir := t.TempDir()
+	config := &builder.Config{
+		OverlayRootDir:  filepath.Join(dir, "roots"),
+		PackageCacheDir: filepath.Join(dir, "packages"),
+		SourcesDir:      filepath.Join(dir, "sources"),
+	}
+
+	builder.ApplyDirectories(config)
+	t.Cleanup(func() { builder.ApplyDirectories(&builder.Config{}) })
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	pool := filepath.Join(config.OverlayRootDir, "main-x86_64", builder.PoolDirectory)
+	locked := filepath.Join(config.OverlayRootDir, "main-x86_64", "nano")
+	unlocked := filepath.Join(config.OverlayRootDir, "main-x86_64", "zstd")
+
+	for _, path := range []string{filepath.Join(pool, "slot"), locked, unlocked} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, path := range []string{pool, locked, unlocked} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another running solbuild holds the lock of the root
+	holder := exec.Command("sleep", "30")
+	if err := holder.Start(); err != nil {
+		t.Skipf("Cannot start a process to hold the lock: %v", err)
+	}
+
+	t.Cleanup(func() {
+		holder.Process.Kill()
+		holder.Wait()
+	})
+
+	if err := os.WriteFile(locked+".lock", []byte(strconv.Itoa(holder.Process.Pid)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := builder.Prune(config, builder.PrunePolicy{OlderThan: 7 * 24 * time.Hour, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+
+	if len(results) != 1 || results[0].Path != unlocked {
+		t.Fatalf("Expected only the unlocked root to be pruned, got %+v", results)
+	}
+}
+
+func TestEnforceCacheBudgetIgnoresImages(t *testing.T) {
+	dir := t.TempDir()
+	config := &builder.Config{
+		OverlayRootDir:  filepath.Join(dir, "roots"),
+		CacheDir:        filepath.Join(dir, "cache"),
+		ImagesDir:       filepath.Join(dir, "images"),
+		PackageCacheDir: filepath.Join(dir, "packages"),
+		SourcesDir:      filepath.Join(dir, "sources"),
+		StateDir:        filepath.Join(dir, "state"),
+		CacheBudget:     "16K",
+	}
+
+	builder.ApplyDirectories(config)
+	t.Cleanup(func() { builder.ApplyDirectories(&builder.Config{}) })
+
+	root := filepath.Join(config.OverlayRootDir, "main-x86_64", "nano")
+	pkgFile := filepath.Join(config.PackageCacheDir, "zstd-1.5.6-9-1-x86_64.eopkg")
+
+	for _, path := range []string{root, config.ImagesDir, config.PackageCacheDir} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "data"), make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The image alone is far larger than the budget, but can't be pruned
+	image := filepath.Join(config.ImagesDir, "main-x86_64"+builder.ImageSuffix)
+	if err := os.WriteFile(image, make([]byte, 64*1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := &builder.Package{Name: "zstd"}
+	overlay := &builder.Overlay{BaseDir: filepath.Join(config.OverlayRootDir, "main-x86_64", "zstd")}
+
+	if err := builder.EnforceCacheBudget(config, pkg, overlay); err != nil {
+		t.Fatalf("Failed to enforce budget: %v", err)
+	}
+
+	if !builder.PathExists(root) || !builder.PathExists(image) {
+		t.Fatal("Pruned within budget because of the image")
+	}
+
+	// Once what can be pruned is over budget, it is pruned
+	if err := os.WriteFile(pkgFile, make([]byte, 32*1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.EnforceCacheBudget(config, pkg, overlay); err != nil {
+		t.Fatalf("Failed to enforce budget: %v", err)
+	}
+
+	if builder.PathExists(root) || builder.PathExists(pkgFile) || !builder.PathExists(image) {
+		t.Fatal("Wrong locations pruned to get within budget")
+	}
+}
@@ -0,0 +1,100 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// QuickBuild trades correctness for speed while iterating on a recipe. The
+// base is not upgraded, older pooled roots may be claimed, the check stage
+// and ABI report are skipped, and the artifacts are neither signed nor
+// manifested, being marked as unfit for release instead.
+var QuickBuild bool
+
+// QuickBuildSuffix is the suffix of the marker collected alongside the
+// artifacts of a quick build.
+const QuickBuildSuffix = ".quick-build"
+
+// StripCheck removes the check stage from the package.yml at the given path.
+func StripCheck(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err = yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("Failed to parse recipe, reason: %w\n", err)
+	}
+
+	if len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	root := node.Content[0]
+	stripped := false
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "check" {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			stripped = true
+
+			break
+		}
+	}
+
+	if !stripped {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(4)
+
+	if err = enc.Encode(&node); err != nil {
+		return fmt.Errorf("Failed to write recipe, reason: %w\n", err)
+	}
+
+	if err = enc.Close(); err != nil {
+		return err
+	}
+
+	slog.Debug("Skipping the check stage of the quick build", "path", path)
+
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// writeQuickMarker marks the artifacts in dir as coming from a quick build,
+// returning the path of the marker.
+func (p *Package) writeQuickMarker(dir string) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", p.Name, p.Version, p.Release, QuickBuildSuffix))
+	note := "These packages are from a quick build with solbuild, and are not fit for release.\n"
+
+	if err := os.WriteFile(path, []byte(note), 0o644); err != nil {
+		return "", fmt.Errorf("Failed to mark quick build, reason: %w\n", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,78 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestStripCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "package.yml")
+	recipe := `name: nano
+version: 8.0
+release: 1
+build: |
+    %make
+check: |
+    %make check
+install: |
+    %make_install
+`
+
+	if err := os.WriteFile(path, []byte(recipe), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := builder.StripCheck(path); err != nil {
+		t.Fatalf("Failed to strip check stage: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stripped := string(data)
+	if strings.Contains(stripped, "check") {
+		t.Errorf("Check stage was not stripped:\n%s", stripped)
+	}
+
+	for _, key := range []string{"name: nano", "build:", "install:"} {
+		if !strings.Contains(stripped, key) {
+			t.Errorf("Expected %q to be kept:\n%s", key, stripped)
+		}
+	}
+
+	// A recipe without a check stage is left untouched
+	recipe = "name: nano\nversion: 8.0\n"
+	if err = os.WriteFile(path, []byte(recipe), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = builder.StripCheck(path); err != nil {
+		t.Fatalf("Failed to strip check stage: %v", err)
+	}
+
+	if data, _ = os.ReadFile(path); string(data) != recipe {
+		t.Errorf("Recipe without a check stage was rewritten:\n%s", data)
+	}
+}
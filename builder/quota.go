@@ -0,0 +1,141 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// QuotaImageSuffix is appended to the base directory of an overlay to give
+// the path of the sparse file backing its disk quota.
+const QuotaImageSuffix = ".quota.img"
+
+// quotaExhausted is the free space below which a failed build is considered
+// to have exceeded its disk quota, or filled its tmpfs.
+const quotaExhausted = 64 * 1024 * 1024
+
+// ErrQuotaExceeded is returned when a build fails having used all of its
+// disk quota.
+var ErrQuotaExceeded = errors.New("Build exceeded its disk quota")
+
+// ErrTmpfsFull is returned when a build fails having filled its tmpfs.
+var ErrTmpfsFull = errors.New("Build ran out of space in its tmpfs")
+
+// mountQuota will back the base directory of the overlay with a loopback
+// filesystem of the quota size, so that a single build cannot exhaust the
+// storage of the host. The backing file is sparse, only using the space the
+// build writes.
+func (o *Overlay) mountQuota() error {
+	size, err := ParseByteSize(o.DiskQuota)
+	if err != nil {
+		return fmt.Errorf("Invalid disk quota, reason: %w\n", err)
+	}
+
+	slog.Debug("Creating disk quota filesystem", "path", o.QuotaPath, "size", o.DiskQuota)
+
+	f, err := os.Create(o.QuotaPath)
+	if err != nil {
+		return fmt.Errorf("Failed to create disk quota file, reason: %w\n", err)
+	}
+
+	err = f.Truncate(size)
+	f.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to size disk quota file, reason: %w\n", err)
+	}
+
+	if out, err := exec.Command("mkfs.ext4", "-q", "-F", "-m", "0", o.QuotaPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to create disk quota filesystem, reason: %w: %s\n", err, strings.TrimSpace(string(out)))
+	}
+
+	if err = os.MkdirAll(o.BaseDir, 0o0755); err != nil {
+		return fmt.Errorf("Failed to create overlay storage directory: dir='%s', reason: %w\n", o.BaseDir, err)
+	}
+
+	if err = disk.GetMountManager().Mount(o.QuotaPath, o.BaseDir, "ext4", "loop"); err != nil {
+		return fmt.Errorf("Failed to mount disk quota filesystem: point='%s', reason: %w\n", o.BaseDir, err)
+	}
+
+	o.mountedQuota = true
+
+	return nil
+}
+
+// unmountQuota will tear down the disk quota filesystem, discarding it.
+func (o *Overlay) unmountQuota() error {
+	if err := disk.GetMountManager().Unmount(o.BaseDir); err != nil {
+		return err
+	}
+
+	o.mountedQuota = false
+
+	return os.Remove(o.QuotaPath)
+}
+
+// QuotaExceeded determines whether the build has used up its disk quota.
+func (o *Overlay) QuotaExceeded() bool {
+	if !o.mountedQuota {
+		return false
+	}
+
+	return spaceExhausted(o.BaseDir)
+}
+
+// TmpfsFull determines whether the build has filled its tmpfs, running out
+// of either space or inodes.
+func (o *Overlay) TmpfsFull() bool {
+	if !o.mountedTmpfs {
+		return false
+	}
+
+	return spaceExhausted(o.BaseDir)
+}
+
+// TmpfsError describes the tmpfs limit a failed build ran into.
+func (o *Overlay) TmpfsError(err error) error {
+	size := o.TmpfsSize
+	if size == "" {
+		size = "the default size, half of the memory"
+	}
+
+	return fmt.Errorf("%w of %s: raise tmpfs_size in solbuild.conf(5) or pass a larger --memory, "+
+		"or build without --tmpfs, reason: %w", ErrTmpfsFull, size, err)
+}
+
+// spaceExhausted determines whether the filesystem of dir has next to no
+// free space, or no free inodes.
+func spaceExhausted(dir string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false
+	}
+
+	if st.Files > 0 && st.Ffree == 0 {
+		return true
+	}
+
+	return int64(st.Bavail)*st.Bsize < quotaExhausted
+}
@@ -0,0 +1,181 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pspecRoot is the root element of every pspec.xml.
+const pspecRoot = "PISI"
+
+var (
+	// ErrRecipeType is returned when the type of a recipe cannot be found
+	// from its name or contents.
+	ErrRecipeType = errors.New("Unable to tell whether the recipe is a package.yml or pspec.xml")
+
+	// ErrRecipeMismatch is returned when the name of a recipe disagrees with
+	// its contents.
+	ErrRecipeMismatch = errors.New("Recipe contents do not match its name")
+)
+
+// ParsePackageType will parse the recipe type given by a user, where an
+// empty type detects it from the recipe.
+func ParsePackageType(name string) (PackageType, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return "", nil
+	case "ypkg", "yml", "yaml", "package.yml":
+		return PackageTypeYpkg, nil
+	case "legacy", "xml", "pspec", "pspec.xml":
+		return PackageTypeXML, nil
+	default:
+		return "", fmt.Errorf("Unknown recipe type %s, expected ypkg or legacy", name)
+	}
+}
+
+// recipeDescription names the recipe format of the package type.
+func recipeDescription(kind PackageType) string {
+	if kind == PackageTypeXML {
+		return "pspec.xml"
+	}
+
+	return "package.yml"
+}
+
+// recipeTypeFromName will find the package type implied by the extension of
+// the recipe, or an empty type for any other name.
+func recipeTypeFromName(path string) PackageType {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return PackageTypeXML
+	case ".yml", ".yaml":
+		return PackageTypeYpkg
+	default:
+		return ""
+	}
+}
+
+// SniffRecipe will find the package type of the recipe from its contents,
+// returning an empty type when it looks like neither format. An error is
+// returned for contents that can never be a recipe, such as binary files
+// or XML documents other than a pspec.
+func SniffRecipe(data []byte) (PackageType, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", errors.New("Recipe is a binary file, not a package.yml or pspec.xml")
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return "", errors.New("Recipe is empty")
+	}
+
+	if trimmed[0] == '<' {
+		decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return "", fmt.Errorf("Recipe looks like XML but cannot be parsed, reason: %w", err)
+			}
+
+			if start, ok := token.(xml.StartElement); ok {
+				if start.Name.Local != pspecRoot {
+					return "", fmt.Errorf("Recipe is an XML document with a <%s> root, not a pspec.xml", start.Name.Local)
+				}
+
+				return PackageTypeXML, nil
+			}
+		}
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil || len(node.Content) == 0 {
+		return "", nil //nolint:nilerr // neither format, which the caller reports
+	}
+
+	if node.Content[0].Kind == yaml.MappingNode {
+		return PackageTypeYpkg, nil
+	}
+
+	return "", nil
+}
+
+// DetectPackageType will find the package type of the recipe, from both
+// its name and its contents, failing when the two disagree.
+func DetectPackageType(path string, data []byte) (PackageType, error) {
+	byName := recipeTypeFromName(path)
+
+	byContents, err := SniffRecipe(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch {
+	case byName != "" && byContents != "" && byName != byContents:
+		return "", fmt.Errorf("%w: %s is named like a %s but contains a %s, pass --recipe-type to override",
+			ErrRecipeMismatch, path, recipeDescription(byName), recipeDescription(byContents))
+	case byName != "":
+		return byName, nil
+	case byContents != "":
+		return byContents, nil
+	default:
+		return "", fmt.Errorf("%w: %s, pass --recipe-type ypkg or --recipe-type legacy", ErrRecipeType, path)
+	}
+}
+
+// NewPackageAs will parse the recipe at path as the given package type,
+// detecting the type from the recipe when it is empty.
+func NewPackageAs(path string, kind PackageType) (*Package, error) {
+	if kind == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if kind, err = DetectPackageType(path, data); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		pkg *Package
+		err error
+	)
+
+	if kind == PackageTypeXML {
+		pkg, err = NewXMLPackage(path)
+	} else {
+		pkg, err = NewYmlPackage(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s as a %s, reason: %w", path, recipeDescription(kind), err)
+	}
+
+	return pkg, nil
+}
@@ -0,0 +1,121 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParsePackageType(t *testing.T) {
+	tests := map[string]builder.PackageType{
+		"":         "",
+		"ypkg":     builder.PackageTypeYpkg,
+		"YML":      builder.PackageTypeYpkg,
+		"legacy":   builder.PackageTypeXML,
+		"xml":      builder.PackageTypeXML,
+		"pspec":    builder.PackageTypeXML,
+		"ypkg ":    builder.PackageTypeYpkg,
+		"Legacy  ": builder.PackageTypeXML,
+	}
+
+	for name, expected := range tests {
+		kind, err := builder.ParsePackageType(name)
+		if err != nil {
+			t.Fatalf("Failed to parse recipe type %q: %v", name, err)
+		}
+
+		if kind != expected {
+			t.Fatalf("Expected %q for %q, got: %q", expected, name, kind)
+		}
+	}
+
+	if _, err := builder.ParsePackageType("rpm"); err == nil {
+		t.Fatal("Parsed unknown recipe type")
+	}
+}
+
+func TestSniffRecipe(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected builder.PackageType
+		fails    bool
+	}{
+		{"\xef\xbb\xbf<?xml version=\"1.0\"?>\n<!DOCTYPE PISI>\n<PISI></PISI>", builder.PackageTypeXML, false},
+		{"name: nano\nversion: 8.0\n", builder.PackageTypeYpkg, false},
+		{"just some text", "", false},
+		{"- a\n- b\n", "", false},
+		{"<Component><Name>x</Name></Component>", "", true},
+		{"<PISI", "", true},
+		{"\x7fELF\x00\x00", "", true},
+		{" \n\t", "", true},
+	}
+
+	for _, test := range tests {
+		kind, err := builder.SniffRecipe([]byte(test.data))
+		if test.fails != (err != nil) {
+			t.Fatalf("Unexpected error sniffing %q: %v", test.data, err)
+		}
+
+		if kind != test.expected {
+			t.Fatalf("Expected %q for %q, got: %q", test.expected, test.data, kind)
+		}
+	}
+}
+
+func TestNewPackageDetection(t *testing.T) {
+	recipe, err := os.ReadFile(PackageTestFile)
+	if err != nil {
+		t.Fatalf("Failed to read recipe: %v", err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("Failed to write recipe: %v", err)
+		}
+
+		return path
+	}
+
+	misnamed := write("pspec.xml", recipe)
+	if _, err = builder.NewPackage(misnamed); !errors.Is(err, builder.ErrRecipeMismatch) {
+		t.Fatalf("Expected ErrRecipeMismatch, got: %v", err)
+	}
+
+	pkg, err := builder.NewPackageAs(misnamed, builder.PackageTypeYpkg)
+	if err != nil {
+		t.Fatalf("Failed to load recipe with an explicit type: %v", err)
+	}
+
+	if pkg.Type != builder.PackageTypeYpkg {
+		t.Fatalf("Expected ypkg package, got: %s", pkg.Type)
+	}
+
+	if pkg, err = builder.NewPackage(write("recipe", recipe)); err != nil || pkg.Type != builder.PackageTypeYpkg {
+		t.Fatalf("Failed to detect package.yml from its contents: %v", err)
+	}
+
+	if _, err = builder.NewPackage(write("notes", []byte("not a recipe"))); !errors.Is(err, builder.ErrRecipeType) {
+		t.Fatalf("Expected ErrRecipeType, got: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// ErrInvalidSource is returned when the sources of a package.yml are malformed.
+var ErrInvalidSource = errors.New("ypkg: Invalid source")
+
+// A RecipeSource is a single url : hash (or git|url : ref) entry of the
+// sources of a package.yml.
+type RecipeSource struct {
+	URI       string
+	Validator string // Hash of an archive, or ref of a git source
+	Line      int    // Line of the recipe the source is declared on
+}
+
+// RecipeSources are the sources of a package.yml, in the order declared.
+// Each item of the list is a mapping, which may hold several sources:
+//
+//	source:
+//	    - https://example.com/a.tar.xz : <sha256sum>
+//	    - https://example.com/b.tar.xz : <sha256sum>
+//	      git|https://example.com/c.git : v1.0
+type RecipeSources []RecipeSource
+
+// invalidSource returns an ErrInvalidSource for the node of the recipe.
+func invalidSource(node *yaml.Node, format string, args ...any) error {
+	return fmt.Errorf("%w on line %d: %s", ErrInvalidSource, node.Line, fmt.Sprintf(format, args...))
+}
+
+// UnmarshalYAML validates the sources, keeping them in the order declared.
+func (s *RecipeSources) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+		return nil
+	}
+
+	if value.Kind != yaml.SequenceNode {
+		return invalidSource(value, "expected a list of url : hash entries")
+	}
+
+	seen := make(map[string]int)
+
+	var sources RecipeSources
+
+	for _, item := range value.Content {
+		if item.Kind != yaml.MappingNode {
+			return invalidSource(item, "expected url : hash, got %q", item.Value)
+		}
+
+		if len(item.Content) == 0 {
+			return invalidSource(item, "empty entry")
+		}
+
+		for i := 0; i < len(item.Content); i += 2 {
+			key, val := item.Content[i], item.Content[i+1]
+
+			if key.Kind != yaml.ScalarNode {
+				return invalidSource(key, "expected the url to be a string")
+			}
+
+			uri := strings.TrimSpace(key.Value)
+			if uri == "" {
+				return invalidSource(key, "missing url")
+			}
+
+			if val.Kind != yaml.ScalarNode {
+				return invalidSource(val, "expected the hash of %s to be a string", uri)
+			}
+
+			validator := strings.TrimSpace(val.Value)
+			if validator == "" || val.Tag == "!!null" {
+				return invalidSource(key, "missing hash for %s", uri)
+			}
+
+			if line, ok := seen[uri]; ok {
+				return invalidSource(key, "%s is already declared on line %d", uri, line)
+			}
+
+			seen[uri] = key.Line
+
+			sources = append(sources, RecipeSource{URI: uri, Validator: validator, Line: key.Line})
+		}
+	}
+
+	*s = sources
+
+	return nil
+}
+
+// Sources will create the sources to fetch, in the order declared.
+func (s RecipeSources) Sources() ([]source.Source, error) {
+	ret := make([]source.Source, 0, len(s))
+
+	for _, src := range s {
+		fetch, err := source.New(src.URI, src.Validator, false)
+		if err != nil {
+			return nil, fmt.Errorf("%w on line %d: %w", ErrInvalidSource, src.Line, err)
+		}
+
+		ret = append(ret, fetch)
+	}
+
+	return ret, nil
+}
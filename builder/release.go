@@ -0,0 +1,129 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ErrReleaseNotBumped is returned when the release of the package is not
+// newer than the one already published.
+var ErrReleaseNotBumped = errors.New("Release has not been bumped")
+
+// CheckReleases controls whether the release of the package is checked
+// against the published one before building.
+var CheckReleases = true
+
+// ForceRelease will only warn when the release of the package is not newer
+// than the one already published, rather than failing the build.
+var ForceRelease = false
+
+// indexPackage is the part of a package in an eopkg index needed to find its
+// published release, and to verify its archive.
+type indexPackage struct {
+	Source struct {
+		Name string `xml:"Name"`
+	} `xml:"Source"`
+	History struct {
+		Updates []XMLUpdate `xml:"Update"`
+	} `xml:"History"`
+	PackageURI  string `xml:"PackageURI"`
+	PackageHash string `xml:"PackageHash"`
+}
+
+// PublishedRelease will find the newest release of the source in the given
+// eopkg index, or 0 if it has not been published.
+func PublishedRelease(r io.Reader, source string) (int, error) {
+	dec := xml.NewDecoder(r)
+	release := 0
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return release, nil
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Package" {
+			continue
+		}
+
+		var pkg indexPackage
+		if err = dec.DecodeElement(&pkg, &start); err != nil {
+			return 0, err
+		}
+
+		if pkg.Source.Name != source {
+			continue
+		}
+
+		for _, update := range pkg.History.Updates {
+			release = max(release, update.Release)
+		}
+	}
+}
+
+// CheckRelease will ensure the release of the package is newer than the one
+// published in the remote repos configured within the root, catching a
+// forgotten release bump before a long build. Local repos are skipped, as
+// they hold previous builds of the package.
+func (p *Package) CheckRelease(root string, profile *Profile) error {
+	indexes, _ := filepath.Glob(filepath.Join(root, "var/lib/eopkg/index/*/eopkg-index.xml"))
+
+	for _, index := range indexes {
+		name := filepath.Base(filepath.Dir(index))
+		if repo, ok := profile.Repos[name]; ok && repo.Local {
+			continue
+		}
+
+		f, err := os.Open(index)
+		if err != nil {
+			return err
+		}
+
+		published, err := PublishedRelease(f, p.Name)
+		f.Close()
+
+		if err != nil {
+			return fmt.Errorf("Failed to read index of repo %s, reason: %w\n", name, err)
+		}
+
+		if p.Release > published {
+			continue
+		}
+
+		if !ForceRelease {
+			return fmt.Errorf("%w: %s release %d is already published in repo %s as release %d, "+
+				"bump the release or pass --force", ErrReleaseNotBumped, p.Name, p.Release, name, published)
+		}
+
+		slog.Warn("Release has not been bumped", "package", p.Name, "release", p.Release, "repo", name,
+			"published", published)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// clearRemotes forgets the git remotes contacted by earlier fetches.
+func clearRemotes() {
+	source.ResetContactedRemotes()
+}
+
+// reportRemotes logs the hosts of every git remote contacted while fetching
+// sources, so that builds reaching out to unexpected hosts can be spotted.
+func reportRemotes() {
+	remotes := source.ContactedRemotes()
+	if len(remotes) == 0 {
+		return
+	}
+
+	var hosts, disallowed []string
+
+	for _, remote := range remotes {
+		host := remote.Host
+		if host == "" {
+			host = "local"
+		}
+
+		hosts = append(hosts, host)
+
+		if !remote.Allowed {
+			disallowed = append(disallowed, host)
+		}
+	}
+
+	slices.Sort(hosts)
+	hosts = slices.Compact(hosts)
+
+	if len(disallowed) == 0 {
+		slog.Info("Git remotes required by sources", "count", len(remotes), "hosts", strings.Join(hosts, ", "))
+		return
+	}
+
+	slices.Sort(disallowed)
+	slog.Warn("Git remotes required by sources", "count", len(remotes), "hosts", strings.Join(hosts, ", "),
+		"disallowed", strings.Join(slices.Compact(disallowed), ", "))
+}
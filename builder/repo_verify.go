@@ -0,0 +1,152 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+const (
+	// RepoIndexFile is the name of the index within a local repository.
+	RepoIndexFile = "eopkg-index.xml.xz"
+
+	// RepoSignatureSuffix is appended to the index URI to find its detached
+	// OpenPGP signature.
+	RepoSignatureSuffix = ".sig"
+)
+
+var (
+	// ErrRepoVerification is returned when a pinned repo fails verification.
+	ErrRepoVerification = errors.New("Repository index failed verification")
+
+	sha256Regex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// IsPinned determines whether the repo index must be verified before use.
+func (r *Repo) IsPinned() bool {
+	return r.IndexSha256 != "" || r.SigningKey != ""
+}
+
+// validatePin will ensure the pinning options on the repo are usable.
+func (r *Repo) validatePin() error {
+	if !r.IsPinned() {
+		return nil
+	}
+
+	if r.AutoIndex {
+		return fmt.Errorf("Repo %v cannot be pinned when autoindex is enabled", r.Name)
+	}
+
+	if r.IndexSha256 != "" && !sha256Regex.MatchString(r.IndexSha256) {
+		return fmt.Errorf("Invalid index_sha256 for repo %v", r.Name)
+	}
+
+	return nil
+}
+
+// indexURI returns the location of the repo index.
+func (r *Repo) indexURI() string {
+	if r.Local {
+		return filepath.Join(r.URI, RepoIndexFile)
+	}
+
+	return r.URI
+}
+
+// readRepoFile will read a file from a local or remote repository.
+func (r *Repo) readRepoFile(uri string) ([]byte, error) {
+	if r.Local {
+		return os.ReadFile(uri)
+	}
+
+	resp, err := httpGet(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+// readKeyRing loads an armored or binary OpenPGP public key file.
+func readKeyRing(path string) (openpgp.EntityList, error) {
+	by, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(by)); err == nil {
+		return keyring, nil
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(by))
+}
+
+// Verify will fetch the repo index and ensure it matches the pinned digest
+// and is signed by the pinned key, before the repo is added to the root.
+func (r *Repo) Verify() error {
+	uri := r.indexURI()
+
+	slog.Debug("Verifying repository index", "name", r.Name, "uri", uri)
+
+	index, err := r.readRepoFile(uri)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch index of repo %s, reason: %w\n", r.Name, err)
+	}
+
+	if r.IndexSha256 != "" {
+		sum := sha256.Sum256(index)
+		if digest := hex.EncodeToString(sum[:]); !strings.EqualFold(digest, r.IndexSha256) {
+			return fmt.Errorf("%w: repo %s has digest %s, expected %s", ErrRepoVerification, r.Name, digest,
+				strings.ToLower(r.IndexSha256))
+		}
+	}
+
+	if r.SigningKey != "" {
+		keyring, err := readKeyRing(r.SigningKey)
+		if err != nil {
+			return fmt.Errorf("Failed to load signing key for repo %s, reason: %w\n", r.Name, err)
+		}
+
+		sig, err := r.readRepoFile(uri + RepoSignatureSuffix)
+		if err != nil {
+			return fmt.Errorf("%w: unable to fetch signature for repo %s: %w", ErrRepoVerification, r.Name, err)
+		}
+
+		if _, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(index), bytes.NewReader(sig), nil); err != nil {
+			if _, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(index), bytes.NewReader(sig), nil); err != nil {
+				return fmt.Errorf("%w: bad signature for repo %s: %w", ErrRepoVerification, r.Name, err)
+			}
+		}
+	}
+
+	slog.Info("Verified repository index", "name", r.Name)
+
+	return nil
+}
@@ -19,7 +19,6 @@ package builder
 import (
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
 
 	"github.com/getsolus/libosdev/disk"
@@ -31,7 +30,7 @@ const (
 )
 
 // addLocalRepo will try to add the repo and bind mount it into the target.
-func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgManager, repo *Repo) error {
+func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager PackageManager, repo *Repo) error {
 	// Ensure the source exists too. Sorta helpful like that.
 	if !PathExists(repo.URI) {
 		return fmt.Errorf("Local repo does not exist")
@@ -40,11 +39,9 @@ func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgM
 	mman := disk.GetMountManager()
 
 	// Ensure the target mountpoint actually exists ...
-	tgt := filepath.Join(o.MountPoint, BindRepoDir[1:], repo.Name)
-	if !PathExists(tgt) {
-		if err := os.MkdirAll(tgt, 0o0755); err != nil {
-			return err
-		}
+	tgt, err := o.secureDir(filepath.Join(o.MountPoint, BindRepoDir[1:], repo.Name), 0o0755)
+	if err != nil {
+		return err
 	}
 
 	// BindMount the directory into place
@@ -58,8 +55,12 @@ func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgM
 	if repo.AutoIndex {
 		slog.Debug("Reindexing repository", "name", repo.Name)
 
-		command := fmt.Sprintf("cd %s/%s; %s", BindRepoDir, repo.Name, eopkgCommand(installCommand+" index --skip-signing ."))
-		err := ChrootExec(notif, o.MountPoint, command)
+		command, err := pkgManager.IndexCommand(filepath.Join(BindRepoDir, repo.Name))
+		if err != nil {
+			return err
+		}
+
+		err = ChrootExec(notif, o.MountPoint, "repos", command)
 		notif.SetActivePID(0)
 
 		if err != nil {
@@ -68,7 +69,9 @@ func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgM
 	} else {
 		tgtIndex := filepath.Join(tgt, "eopkg-index.xml.xz")
 		if !PathExists(tgtIndex) {
-			slog.Warn("Repository index doesn't exist. Please index it to use it.", "repo", repo.Name)
+			if err := strictWarn("Repository index doesn't exist. Please index it to use it.", "repo", repo.Name); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -78,7 +81,7 @@ func (p *Package) addLocalRepo(notif PidNotifier, o *Overlay, pkgManager *EopkgM
 	return pkgManager.AddRepo(repo.Name, chrootLocal)
 }
 
-func (p *Package) removeRepos(pkgManager *EopkgManager, repos []string) error {
+func (p *Package) removeRepos(pkgManager PackageManager, repos []string) error {
 	if len(repos) < 1 {
 		return nil
 	}
@@ -95,12 +98,18 @@ func (p *Package) removeRepos(pkgManager *EopkgManager, repos []string) error {
 }
 
 // addRepos will add the specified filtered set of repos to the rootfs.
-func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManager, repos []*Repo) error {
+func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager PackageManager, repos []*Repo) error {
 	if len(repos) < 1 {
 		return nil
 	}
 
 	for _, repo := range repos {
+		if repo.IsPinned() {
+			if err := repo.Verify(); err != nil {
+				return err
+			}
+		}
+
 		if repo.Local {
 			slog.Debug("Adding local repo to system", "name", repo.Name, "uri", repo.URI)
 
@@ -121,38 +130,38 @@ func (p *Package) addRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManag
 	return nil
 }
 
-// ConfigureRepos will attempt to configure the repos according to the configuration
-// of the manager.
-func (p *Package) ConfigureRepos(notif PidNotifier, o *Overlay, pkgManager *EopkgManager, profile *Profile) error {
-	repos, err := pkgManager.GetRepos()
-	if err != nil {
-		return err
-	}
-
+// repoRemovals returns the repos that the profile removes from the root.
+func repoRemovals(current []*RootRepo, profile *Profile) []string {
 	var removals []string
 
-	// Find out which repos to remove
 	if len(profile.RemoveRepos) == 1 && profile.RemoveRepos[0] == "*" {
-		for _, r := range repos {
+		for _, r := range current {
 			removals = append(removals, r.ID)
 		}
 	} else {
 		removals = append(removals, profile.RemoveRepos...)
 	}
 
-	if err := p.removeRepos(pkgManager, removals); err != nil {
+	return removals
+}
+
+// ConfigureRepos will attempt to configure the repos according to the configuration
+// of the manager.
+func (p *Package) ConfigureRepos(notif PidNotifier, o *Overlay, pkgManager PackageManager, profile *Profile) error {
+	repos, err := pkgManager.GetRepos()
+	if err != nil {
 		return err
 	}
 
-	var addRepos []*Repo
+	if err := p.removeRepos(pkgManager, repoRemovals(repos, profile)); err != nil {
+		return err
+	}
 
-	if (len(profile.AddRepos) == 1 && profile.AddRepos[0] == "*") || len(profile.AddRepos) == 0 {
-		for _, repo := range profile.Repos {
-			addRepos = append(addRepos, repo)
-		}
-	} else {
-		for _, id := range profile.AddRepos {
-			addRepos = append(addRepos, profile.Repos[id])
+	addRepos := profile.GetRepos(p.Name)
+
+	for _, repo := range addRepos {
+		if repo.IsConditional() {
+			slog.Info("Enabling conditional repository", "name", repo.Name, "package", p.Name)
 		}
 	}
 
@@ -0,0 +1,107 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import "slices"
+
+// A RepoAction is an operation performed on a repo in the root.
+type RepoAction string
+
+const (
+	// RepoKeep is a repo in the image that is left in place.
+	RepoKeep RepoAction = "keep"
+
+	// RepoRemove is a repo in the image that is removed.
+	RepoRemove RepoAction = "remove"
+
+	// RepoAdd is a repo from the profile that is added.
+	RepoAdd RepoAction = "add"
+)
+
+// A RepoChange is a single repo operation that a build would perform.
+type RepoChange struct {
+	Action      RepoAction `json:"action"`
+	Name        string     `json:"name"`
+	URI         string     `json:"uri"`
+	Conditional bool       `json:"conditional,omitempty"` // Only added for matching packages
+}
+
+// PlanRepoChanges determines the repo operations that building the named
+// package with the profile would perform against the current repos, in the
+// order they are carried out, without performing them.
+func PlanRepoChanges(current []*RootRepo, profile *Profile, name string) []RepoChange {
+	removals := repoRemovals(current, profile)
+	changes := make([]RepoChange, 0, len(current))
+
+	for _, repo := range current {
+		action := RepoKeep
+		if slices.Contains(removals, repo.ID) {
+			action = RepoRemove
+		}
+
+		changes = append(changes, RepoChange{Action: action, Name: repo.ID, URI: repo.URI})
+	}
+
+	for _, repo := range profile.GetRepos(name) {
+		changes = append(changes, RepoChange{
+			Action:      RepoAdd,
+			Name:        repo.Name,
+			URI:         repo.URI,
+			Conditional: repo.IsConditional(),
+		})
+	}
+
+	return changes
+}
+
+// ReadRepos will mount the image read-only to find the repos configured
+// within it.
+func (b *BackingImage) ReadRepos() (repos []*RootRepo, err error) {
+	err = b.MountReadOnly(func(root string) error {
+		repos, err = NewEopkgManager(nil, root).GetRepos()
+
+		return err
+	})
+
+	return repos, err
+}
+
+// DiffRepos will determine the repo changes that building the named package
+// would make to the image, without making them.
+func (m *Manager) DiffRepos(name string) ([]RepoChange, error) {
+	if m.IsCancelled() {
+		return nil, ErrInterrupted
+	}
+
+	if !m.image.IsInstalled() {
+		return nil, ErrProfileNotInstalled
+	}
+
+	defer m.Cleanup()
+	m.SigIntCleanup()
+
+	if err := m.doLock(m.image.LockPath, "inspecting"); err != nil {
+		return nil, err
+	}
+
+	repos, err := m.image.ReadRepos()
+	if err != nil {
+		return nil, err
+	}
+
+	return PlanRepoChanges(repos, m.GetProfile(), name), nil
+}
@@ -0,0 +1,89 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// BuildHostname is the fixed hostname set within the container, so that the
+// host name never leaks into builds.
+const BuildHostname = "solbuild"
+
+// hostResolvConf is the host resolver configuration that nameservers are
+// taken from when none are configured.
+var hostResolvConf = "/etc/resolv.conf"
+
+// DNSServers are the nameservers written to the resolv.conf of the build.
+// When empty, only the nameservers of the host are used, leaving behind any
+// search domains and options that could leak into the build.
+var DNSServers []string
+
+// ValidateDNSServers will ensure each server is an IP address.
+func ValidateDNSServers(servers []string) error {
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("Invalid DNS server: %s", server)
+		}
+	}
+
+	return nil
+}
+
+// hostNameservers returns the nameservers listed in the given resolv.conf.
+func hostNameservers(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var servers []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+
+	return servers
+}
+
+// GenerateResolvConf returns a minimal resolv.conf for the build, listing
+// only the given nameservers, or those of the host if none are given.
+func GenerateResolvConf(servers []string) []byte {
+	if len(servers) == 0 {
+		servers = hostNameservers(hostResolvConf)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by solbuild\n")
+
+	for _, server := range servers {
+		fmt.Fprintf(&buf, "nameserver %s\n", server)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,48 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestGenerateResolvConf(t *testing.T) {
+	conf := string(builder.GenerateResolvConf([]string{"192.0.2.1", "2001:db8::1"}))
+
+	for _, want := range []string{"nameserver 192.0.2.1\n", "nameserver 2001:db8::1\n"} {
+		if !strings.Contains(conf, want) {
+			t.Fatalf("Expected %q in resolv.conf, got:\n%s", want, conf)
+		}
+	}
+
+	if strings.Contains(conf, "search") {
+		t.Fatalf("Generated resolv.conf must not contain search domains:\n%s", conf)
+	}
+}
+
+func TestValidateDNSServers(t *testing.T) {
+	if err := builder.ValidateDNSServers([]string{"192.0.2.1", "::1"}); err != nil {
+		t.Fatalf("Valid DNS servers should be accepted: %v", err)
+	}
+
+	if err := builder.ValidateDNSServers([]string{"dns.example.com"}); err == nil {
+		t.Fatalf("Host names should not be accepted as DNS servers")
+	}
+}
@@ -0,0 +1,284 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SandboxSuffix replaces the build log suffix to give the path of the stored
+// sandbox summary for that build.
+const SandboxSuffix = ".sandbox.json"
+
+// sandboxNamespaces are the namespaces checked for being unshared from the
+// host, in the order they are reported.
+var sandboxNamespaces = []string{"mnt", "ipc", "uts", "net", "pid", "user", "cgroup"}
+
+// seccompModes are the names of the values of Seccomp in /proc/self/status.
+var seccompModes = map[string]string{
+	"0": "disabled",
+	"1": "strict",
+	"2": "filter",
+}
+
+// A SandboxMount is a mount visible within the build root.
+type SandboxMount struct {
+	Target   string `json:"target"` // Path within the build root
+	Type     string `json:"type"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// A SandboxSummary is the effective sandbox of a build, as seen just before
+// the build itself is started.
+type SandboxSummary struct {
+	Namespaces  []string       `json:"namespaces"` // Namespaces unshared from the host
+	Networking  bool           `json:"networking"` // Whether the build can reach the network
+	Tmpfs       bool           `json:"tmpfs"`
+	TmpfsSize   string         `json:"tmpfs_size,omitempty"`
+	UIDMap      []string       `json:"uid_map"`
+	Environment []string       `json:"environment"` // Proxy values are redacted
+	Seccomp     string         `json:"seccomp"`
+	Mounts      []SandboxMount `json:"mounts"`
+}
+
+// BuildSandbox holds the sandbox summary of the current build, once known.
+var BuildSandbox *SandboxSummary
+
+// InspectSandbox will describe the sandbox the build is about to run in.
+func InspectSandbox(overlay *Overlay, networking bool) (*SandboxSummary, error) {
+	summary := &SandboxSummary{
+		Namespaces:  unsharedNamespaces(),
+		Networking:  networking,
+		Environment: RedactEnvironment(ChrootEnvironment),
+		Tmpfs:       overlay.EnableTmpfs,
+		TmpfsSize:   overlay.TmpfsSize,
+		Seccomp:     "unknown",
+	}
+
+	if b, err := os.ReadFile("/proc/self/uid_map"); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			summary.UIDMap = append(summary.UIDMap, strings.Join(strings.Fields(line), " "))
+		}
+	}
+
+	if fi, err := os.Open("/proc/self/status"); err == nil {
+		summary.Seccomp = ParseSeccomp(fi)
+		fi.Close()
+	}
+
+	fi, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read mounts, reason: %w\n", err)
+	}
+	defer fi.Close()
+
+	if summary.Mounts, err = ParseMountInfo(fi, overlay.MountPoint); err != nil {
+		return nil, fmt.Errorf("Failed to read mounts, reason: %w\n", err)
+	}
+
+	return summary, nil
+}
+
+// unsharedNamespaces returns the namespaces that differ from those of init.
+func unsharedNamespaces() []string {
+	var ret []string
+
+	for _, ns := range sandboxNamespaces {
+		self, err := os.Readlink(filepath.Join("/proc/self/ns", ns))
+		if err != nil {
+			continue
+		}
+
+		if host, err := os.Readlink(filepath.Join("/proc/1/ns", ns)); err == nil && host != self {
+			ret = append(ret, ns)
+		}
+	}
+
+	return ret
+}
+
+// ParseSeccomp will find the seccomp mode in the contents of
+// /proc/self/status.
+func ParseSeccomp(r io.Reader) string {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		value, ok := strings.CutPrefix(sc.Text(), "Seccomp:")
+		if !ok {
+			continue
+		}
+
+		if mode, ok := seccompModes[strings.TrimSpace(value)]; ok {
+			return mode
+		}
+	}
+
+	return "unknown"
+}
+
+// ParseMountInfo will find the mounts at or beneath root in the contents of
+// /proc/self/mountinfo, with their targets relative to root.
+func ParseMountInfo(r io.Reader, root string) ([]SandboxMount, error) {
+	var ret []SandboxMount
+
+	root = filepath.Clean(root)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+
+		// Optional fields end with a lone "-", followed by the type
+		sep := -1
+
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+
+		if sep < 0 || sep+1 >= len(fields) {
+			continue
+		}
+
+		target := unescapeMountPath(fields[4])
+		if target != root && !strings.HasPrefix(target, root+"/") {
+			continue
+		}
+
+		ret = append(ret, SandboxMount{
+			Target:   "/" + strings.TrimPrefix(strings.TrimPrefix(target, root), "/"),
+			Type:     fields[sep+1],
+			ReadOnly: hasMountOption(fields[5], "ro"),
+		})
+	}
+
+	return ret, sc.Err()
+}
+
+// unescapeMountPath will decode the octal escapes used for whitespace in
+// mountinfo paths.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(c))
+
+				i += 3
+
+				continue
+			}
+		}
+
+		sb.WriteByte(path[i])
+	}
+
+	return sb.String()
+}
+
+// hasMountOption determines whether the comma separated options include
+// the given option.
+func hasMountOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Summary returns a concise description of the sandbox, such as
+// "namespaces mnt,ipc,uts,net; networking off; tmpfs off; seccomp disabled;
+// 14 mounts, 3 read-write".
+func (s *SandboxSummary) Summary() string {
+	namespaces := "none"
+	if len(s.Namespaces) > 0 {
+		namespaces = strings.Join(s.Namespaces, ",")
+	}
+
+	networking := "off"
+	if s.Networking {
+		networking = "on"
+	}
+
+	tmpfs := "off"
+	if s.Tmpfs {
+		tmpfs = "on"
+
+		if s.TmpfsSize != "" {
+			tmpfs = s.TmpfsSize
+		}
+	}
+
+	uidMap := "none"
+	if len(s.UIDMap) > 0 {
+		uidMap = strings.Join(s.UIDMap, ", ")
+	}
+
+	rw := 0
+
+	for _, mount := range s.Mounts {
+		if !mount.ReadOnly {
+			rw++
+		}
+	}
+
+	return fmt.Sprintf("namespaces %s; networking %s; tmpfs %s; uid map %s; seccomp %s; %d mounts, %d read-write",
+		namespaces, networking, tmpfs, uidMap, s.Seccomp, len(s.Mounts), rw)
+}
+
+// Write will store the summary as JSON at the given path.
+func (s *SandboxSummary) Write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o0644)
+}
+
+// recordSandbox will inspect and log the sandbox the build is about to run
+// in, keeping it in BuildSandbox to be stored alongside the build log.
+func (p *Package) recordSandbox(overlay *Overlay, networking bool) {
+	sandbox, err := InspectSandbox(overlay, networking)
+	if err != nil {
+		slog.Warn("Failed to inspect the sandbox", "err", err)
+		return
+	}
+
+	BuildSandbox = sandbox
+
+	slog.Info("Build sandbox", "summary", sandbox.Summary())
+
+	for _, mount := range sandbox.Mounts {
+		slog.Debug("Sandbox mount", "target", mount.Target, "type", mount.Type, "read_only", mount.ReadOnly)
+	}
+}
@@ -0,0 +1,83 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+const testMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+40 22 7:0 / /var/cache/solbuild/main/nano/img ro,relatime shared:20 - ext4 /dev/loop0 ro
+41 22 0:40 / /var/cache/solbuild/main/nano/union rw,relatime shared:21 - overlay overlay rw,lowerdir=img
+42 41 0:5 / /var/cache/solbuild/main/nano/union/dev rw,nosuid shared:22 - devtmpfs devtmpfs rw
+43 41 8:1 /var/lib/solbuild/sources/x /var/cache/solbuild/main/nano/union/home/build/source\040files ro,relatime shared:1 - ext4 /dev/sda1 rw
+44 22 0:41 / /var/cache/solbuild/main/nano/union2 rw shared:23 - tmpfs tmpfs rw
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := builder.ParseMountInfo(strings.NewReader(testMountInfo), "/var/cache/solbuild/main/nano/union/")
+	if err != nil {
+		t.Fatalf("Failed to parse mountinfo: %v", err)
+	}
+
+	expected := []builder.SandboxMount{
+		{Target: "/", Type: "overlay", ReadOnly: false},
+		{Target: "/dev", Type: "devtmpfs", ReadOnly: false},
+		{Target: "/home/build/source files", Type: "ext4", ReadOnly: true},
+	}
+
+	if len(mounts) != len(expected) {
+		t.Fatalf("Expected %d mounts, got: %v", len(expected), mounts)
+	}
+
+	for i, mount := range mounts {
+		if mount != expected[i] {
+			t.Fatalf("Expected mount %v, got: %v", expected[i], mount)
+		}
+	}
+}
+
+func TestParseSeccomp(t *testing.T) {
+	status := "Name:\tsolbuild\nSeccomp:\t2\nSeccomp_filters:\t1\n"
+	if mode := builder.ParseSeccomp(strings.NewReader(status)); mode != "filter" {
+		t.Fatalf("Expected filter mode, got: %s", mode)
+	}
+
+	if mode := builder.ParseSeccomp(strings.NewReader("Name:\tsolbuild\n")); mode != "unknown" {
+		t.Fatalf("Expected unknown mode, got: %s", mode)
+	}
+}
+
+func TestSandboxSummary(t *testing.T) {
+	summary := &builder.SandboxSummary{
+		Namespaces: []string{"mnt", "net"},
+		UIDMap:     []string{"0 0 4294967295"},
+		Seccomp:    "disabled",
+		Mounts: []builder.SandboxMount{
+			{Target: "/", Type: "overlay"},
+			{Target: "/home/build/source", Type: "ext4", ReadOnly: true},
+		},
+	}
+
+	expected := "namespaces mnt,net; networking off; tmpfs off; uid map 0 0 4294967295; seccomp disabled; 2 mounts, 1 read-write"
+	if got := summary.Summary(); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,116 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// eopkgPackageDB is where eopkg records the installed packages.
+const eopkgPackageDB = "var/lib/eopkg/package"
+
+// maxReportedDamage limits how many damaged packages are listed.
+const maxReportedDamage = 5
+
+// ErrImageDamaged is returned when the backing image fails its sanity checks.
+var ErrImageDamaged = errors.New("The backing image is damaged. Refresh it with 'solbuild update', " +
+	"or delete it with 'solbuild delete-cache -i' and run 'solbuild init' again")
+
+// CheckImage controls whether the image is sanity checked before building.
+var CheckImage bool
+
+// findChrootBinary determines whether the command exists within the root.
+func findChrootBinary(root, command string) bool {
+	if filepath.IsAbs(command) {
+		return PathExists(filepath.Join(root, command[1:]))
+	}
+
+	for _, dir := range []string{"usr/bin", "usr/sbin", "bin", "sbin"} {
+		if PathExists(filepath.Join(root, dir, command)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPackageDB will make sure that every installed package has its
+// metadata recorded, as an interrupted update can leave partial entries.
+func checkPackageDB(root string) error {
+	entries, err := os.ReadDir(filepath.Join(root, eopkgPackageDB))
+	if err != nil {
+		return fmt.Errorf("%w: unable to read package database, reason: %w", ErrImageDamaged, err)
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: package database is empty", ErrImageDamaged)
+	}
+
+	var damaged []string
+
+	for _, entry := range entries {
+		dir := filepath.Join(root, eopkgPackageDB, entry.Name())
+
+		if !PathExists(filepath.Join(dir, "metadata.xml")) || !PathExists(filepath.Join(dir, "files.xml")) {
+			damaged = append(damaged, entry.Name())
+		}
+	}
+
+	if len(damaged) == 0 {
+		return nil
+	}
+
+	if len(damaged) > maxReportedDamage {
+		damaged = append(damaged[:maxReportedDamage], "...")
+	}
+
+	return fmt.Errorf("%w: incomplete package database entries: %s", ErrImageDamaged, strings.Join(damaged, ", "))
+}
+
+// CheckImageSanity will run quick consistency checks on the root, ensuring
+// that the package database is intact and that the binaries required to
+// build the given type of package are present.
+func CheckImageSanity(root string, pkgType PackageType) error {
+	slog.Debug("Checking image sanity", "root", root)
+
+	required := []string{FallbackShell, installCommand, "dbus-daemon", "dbus-uuidgen"}
+
+	if pkgType == PackageTypeXML {
+		required = append(required, xmlBuildCommand)
+	} else {
+		required = append(required, ypkgBuildCommand, "ypkg-install-deps")
+	}
+
+	var missing []string
+
+	for _, command := range required {
+		if !findChrootBinary(root, command) {
+			missing = append(missing, command)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrImageDamaged, strings.Join(missing, ", "))
+	}
+
+	return checkPackageDB(root)
+}
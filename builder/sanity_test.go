@@ -0,0 +1,109 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// makeImageRoot creates a fake image with the given binaries and packages.
+func makeImageRoot(t *testing.T, binaries, packages []string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for _, path := range binaries {
+		path = filepath.Join(root, path)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+
+		if err := os.WriteFile(path, nil, 0o0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	for _, pkg := range packages {
+		dir := filepath.Join(root, "var/lib/eopkg/package", pkg)
+		if err := os.MkdirAll(dir, 0o0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+
+		for _, file := range []string{"metadata.xml", "files.xml"} {
+			if err := os.WriteFile(filepath.Join(dir, file), nil, 0o0644); err != nil {
+				t.Fatalf("Failed to create %s: %v", file, err)
+			}
+		}
+	}
+
+	return root
+}
+
+var sanityBinaries = []string{
+	"bin/sh", "bin/bash", "usr/bin/eopkg.bin", "usr/bin/dbus-daemon", "usr/bin/dbus-uuidgen",
+	"usr/bin/ypkg-build", "usr/bin/ypkg-install-deps",
+}
+
+func TestCheckImageSanity(t *testing.T) {
+	root := makeImageRoot(t, sanityBinaries, []string{"nano-8.0-163", "ypkg-34-120"})
+
+	if err := builder.CheckImageSanity(root, builder.PackageTypeYpkg); err != nil {
+		t.Fatalf("Healthy image failed sanity check: %v", err)
+	}
+
+	// An interrupted update leaves partial package entries
+	if err := os.Remove(filepath.Join(root, "var/lib/eopkg/package/nano-8.0-163/files.xml")); err != nil {
+		t.Fatalf("Failed to damage image: %v", err)
+	}
+
+	if err := builder.CheckImageSanity(root, builder.PackageTypeYpkg); !errors.Is(err, builder.ErrImageDamaged) {
+		t.Fatalf("Damaged package database passed sanity check: %v", err)
+	}
+}
+
+func TestCheckImageSanityBinaries(t *testing.T) {
+	root := makeImageRoot(t, sanityBinaries[:4], []string{"nano-8.0-163"})
+
+	if err := builder.CheckImageSanity(root, builder.PackageTypeYpkg); !errors.Is(err, builder.ErrImageDamaged) {
+		t.Fatalf("Image missing binaries passed sanity check: %v", err)
+	}
+
+	if err := builder.CheckImageSanity(t.TempDir(), builder.PackageTypeYpkg); !errors.Is(err, builder.ErrImageDamaged) {
+		t.Fatalf("Empty image passed sanity check: %v", err)
+	}
+}
+
+func TestResolveShell(t *testing.T) {
+	root := makeImageRoot(t, sanityBinaries, nil)
+
+	if shell := builder.ResolveShell(root, builder.BuildUserShell); shell != builder.BuildUserShell {
+		t.Fatalf("Expected %s, got %s", builder.BuildUserShell, shell)
+	}
+
+	// Minimal images lack bash
+	minimal := makeImageRoot(t, []string{"bin/sh", "usr/bin/eopkg.bin"}, nil)
+
+	if shell := builder.ResolveShell(minimal, builder.BuildUserShell); shell != builder.FallbackShell {
+		t.Fatalf("Expected fallback to %s, got %s", builder.FallbackShell, shell)
+	}
+}
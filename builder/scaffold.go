@@ -0,0 +1,372 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/getsolus/solbuild/util"
+)
+
+// BuildType is the build system we guessed for a new package.
+type BuildType string
+
+const (
+	// BuildTypeAutotools is used for ./configure based sources.
+	BuildTypeAutotools BuildType = "autotools"
+
+	// BuildTypeCMake is used for CMakeLists.txt based sources.
+	BuildTypeCMake BuildType = "cmake"
+
+	// BuildTypeMeson is used for meson.build based sources.
+	BuildTypeMeson BuildType = "meson"
+
+	// BuildTypePython is used for setup.py / pyproject.toml based sources.
+	BuildTypePython BuildType = "python"
+
+	// BuildTypeUnknown is used when no build system could be identified.
+	BuildTypeUnknown BuildType = "unknown"
+)
+
+// ErrRecipeExists is returned when we would overwrite an existing recipe.
+var ErrRecipeExists = errors.New("A package.yml already exists in the target directory")
+
+// archiveSuffixes are stripped from the source file name when guessing the
+// package name and version. Longest suffixes must come first.
+var archiveSuffixes = []string{
+	".tar.gz",
+	".tar.xz",
+	".tar.bz2",
+	".tar.zst",
+	".tar.lz",
+	".tgz",
+	".tbz2",
+	".txz",
+	".tar",
+	".zip",
+}
+
+// nameVersionRegex splits "name-1.2.3" or "name_1.2.3" into its parts.
+var nameVersionRegex = regexp.MustCompile(`^(.+?)[-_]v?([0-9][A-Za-z0-9.+_~-]*)$`)
+
+// versionOnlyRegex matches file names which are just a version, such as the
+// archives generated by GitHub for tags.
+var versionOnlyRegex = regexp.MustCompile(`^v?([0-9][A-Za-z0-9.+_~-]*)$`)
+
+// buildTypeMarkers maps a top-level file in the source archive to the build
+// type it implies. Earlier entries take priority.
+var buildTypeMarkers = []struct {
+	File string
+	Type BuildType
+}{
+	{"meson.build", BuildTypeMeson},
+	{"CMakeLists.txt", BuildTypeCMake},
+	{"configure", BuildTypeAutotools},
+	{"configure.ac", BuildTypeAutotools},
+	{"pyproject.toml", BuildTypePython},
+	{"setup.py", BuildTypePython},
+}
+
+// buildSteps are the ypkg macros used for each build type.
+var buildSteps = map[BuildType][3]string{
+	BuildTypeAutotools: {"%configure", "%make", "%make_install"},
+	BuildTypeCMake:     {"%cmake_ninja", "%ninja_build", "%ninja_install"},
+	BuildTypeMeson:     {"%meson_configure", "%ninja_build", "%ninja_install"},
+	BuildTypePython:    {"", "%python3_setup", "%python3_install"},
+	BuildTypeUnknown:   {"", "", ""},
+}
+
+const recipeTemplate = `name       : {{ .Name }}
+version    : {{ .Version }}
+release    : 1
+source     :
+    - {{ .URI }} : {{ .Sha256 }}
+homepage   : {{ .Homepage }}
+license    : UPDATE-ME # Use SPDX identifiers
+component  : UPDATE-ME
+summary    : UPDATE-ME
+description: |
+    UPDATE-ME
+{{- if .Setup }}
+setup      : |
+    {{ .Setup }}
+{{- end }}
+{{- if .Build }}
+build      : |
+    {{ .Build }}
+{{- end }}
+{{- if .Install }}
+install    : |
+    {{ .Install }}
+{{- end }}
+`
+
+// A Scaffold is the set of guesses used to generate a starting package.yml
+// for a new package from its upstream source archive.
+type Scaffold struct {
+	Name      string    // Guessed package name
+	Version   string    // Guessed package version
+	Homepage  string    // Guessed upstream homepage
+	URI       string    // URI of the source archive
+	Sha256    string    // sha256sum of the source archive
+	BuildType BuildType // Guessed build system
+}
+
+// NewScaffold will download the source archive at uri and inspect it to
+// produce a new Scaffold.
+func NewScaffold(uri string) (*Scaffold, error) {
+	uriObj, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if uriObj.Scheme == "" || uriObj.Host == "" {
+		return nil, fmt.Errorf("Not a valid source URL: %s", uri)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "solbuild-new-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, path.Base(uriObj.Path))
+
+	slog.Info("Downloading source", "uri", uri)
+
+	if err := downloadFile(uri, archive); err != nil {
+		return nil, fmt.Errorf("Failed to download source %s, reason: %w", uri, err)
+	}
+
+	hash, err := FileSha256sum(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	name, version := GuessNameVersion(uriObj)
+
+	return &Scaffold{
+		Name:      name,
+		Version:   version,
+		Homepage:  GuessHomepage(uriObj),
+		URI:       uri,
+		Sha256:    hash,
+		BuildType: GuessBuildType(archive),
+	}, nil
+}
+
+// downloadFile fetches uri into the file at dest.
+func downloadFile(uri, dest string) error {
+	resp, err := httpGet(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fi, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	_, err = io.Copy(fi, resp.Body)
+
+	return err
+}
+
+// httpGet performs a GET request identifying as solbuild, failing on any
+// status other than 200.
+func httpGet(uri string) (*http.Response, error) {
+	return httpGetContext(context.Background(), uri)
+}
+
+// httpGetContext is httpGet, abandoning the request once ctx is done.
+func httpGetContext(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "solbuild/"+util.SolbuildVersion)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+// trimArchiveSuffix removes any known archive extension from name.
+func trimArchiveSuffix(name string) string {
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+
+	return name
+}
+
+// GuessNameVersion will attempt to work out the package name and version
+// from the source URL. Either may be empty if no sensible guess is possible.
+func GuessNameVersion(uri *url.URL) (name, version string) {
+	base := trimArchiveSuffix(path.Base(uri.Path))
+
+	if m := nameVersionRegex.FindStringSubmatch(base); m != nil {
+		return strings.ToLower(m[1]), m[2]
+	}
+
+	// Tag archives such as github.com/owner/repo/archive/v1.0.tar.gz
+	// only carry the version, so take the name from the repo path.
+	if m := versionOnlyRegex.FindStringSubmatch(base); m != nil {
+		parts := strings.Split(strings.Trim(uri.Path, "/"), "/")
+		if len(parts) > 1 {
+			name = strings.ToLower(parts[1])
+		}
+
+		return name, m[1]
+	}
+
+	return strings.ToLower(base), ""
+}
+
+// GuessHomepage will attempt to work out the upstream homepage from the
+// source URL.
+func GuessHomepage(uri *url.URL) string {
+	parts := strings.Split(strings.Trim(uri.Path, "/"), "/")
+
+	switch uri.Host {
+	case "github.com", "gitlab.com", "codeberg.org":
+		if len(parts) > 1 {
+			return fmt.Sprintf("https://%s/%s/%s", uri.Host, parts[0], parts[1])
+		}
+	case "files.pythonhosted.org", "pypi.io":
+		name, _ := GuessNameVersion(uri)
+		if name != "" {
+			return "https://pypi.org/project/" + name
+		}
+	}
+
+	return fmt.Sprintf("https://%s", uri.Host)
+}
+
+// GuessBuildType inspects the listing of the given archive to work out which
+// build system the source uses.
+func GuessBuildType(archive string) BuildType {
+	var buf bytes.Buffer
+
+	c := exec.Command("tar", "-tf", archive)
+	if strings.HasSuffix(archive, ".zip") {
+		c = exec.Command("unzip", "-Z1", archive)
+	}
+
+	c.Stdout = &buf
+
+	if err := c.Run(); err != nil {
+		slog.Warn("Unable to list source archive", "path", archive, "err", err)
+		return BuildTypeUnknown
+	}
+
+	return buildTypeFromListing(strings.Split(buf.String(), "\n"))
+}
+
+// buildTypeFromListing determines the build type from the archive members,
+// only considering files in the top level directory of the source.
+func buildTypeFromListing(members []string) BuildType {
+	topLevel := make(map[string]bool)
+
+	for _, member := range members {
+		parts := strings.Split(strings.Trim(member, "/"), "/")
+
+		switch len(parts) {
+		case 1:
+			topLevel[parts[0]] = true
+		case 2:
+			topLevel[parts[1]] = true
+		}
+	}
+
+	for _, marker := range buildTypeMarkers {
+		if topLevel[marker.File] {
+			return marker.Type
+		}
+	}
+
+	return BuildTypeUnknown
+}
+
+// Write will emit the package.yml and files/ layout into dir.
+func (s *Scaffold) Write(dir string) error {
+	recipe := filepath.Join(dir, "package.yml")
+	if PathExists(recipe) {
+		return ErrRecipeExists
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o0755); err != nil {
+		return fmt.Errorf("Failed to create files directory, reason: %w", err)
+	}
+
+	tmpl := template.Must(template.New("package.yml").Parse(recipeTemplate))
+	steps := buildSteps[s.BuildType]
+
+	name, version := s.Name, s.Version
+	if name == "" {
+		name = "UPDATE-ME"
+	}
+
+	if version == "" {
+		version = "UPDATE-ME"
+	}
+
+	var buf bytes.Buffer
+
+	err := tmpl.Execute(&buf, map[string]string{
+		"Name":     name,
+		"Version":  version,
+		"URI":      s.URI,
+		"Sha256":   s.Sha256,
+		"Homepage": s.Homepage,
+		"Setup":    steps[0],
+		"Build":    steps[1],
+		"Install":  steps[2],
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(recipe, buf.Bytes(), 0o0644)
+}
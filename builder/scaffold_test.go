@@ -0,0 +1,103 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestGuessNameVersion(t *testing.T) {
+	tests := []struct {
+		uri     string
+		name    string
+		version string
+	}{
+		{"https://www.nano-editor.org/dist/v7/nano-7.2.tar.xz", "nano", "7.2"},
+		{"https://github.com/getsolus/solbuild/archive/refs/tags/v1.7.1.tar.gz", "solbuild", "1.7.1"},
+		{"https://files.pythonhosted.org/packages/source/r/requests/requests-2.31.0.tar.gz", "requests", "2.31.0"},
+		{"https://download.gnome.org/sources/gtk/4.12/gtk-4.12.4.tar.xz", "gtk", "4.12.4"},
+		{"https://example.com/foo_bar-1.0rc1.zip", "foo_bar", "1.0rc1"},
+	}
+
+	for _, test := range tests {
+		uri, err := url.Parse(test.uri)
+		if err != nil {
+			t.Fatalf("Failed to parse test URI %s: %v", test.uri, err)
+		}
+
+		name, version := builder.GuessNameVersion(uri)
+		if name != test.name {
+			t.Fatalf("Wrong name for %s: '%s' vs expected '%s'", test.uri, name, test.name)
+		}
+
+		if version != test.version {
+			t.Fatalf("Wrong version for %s: '%s' vs expected '%s'", test.uri, version, test.version)
+		}
+	}
+}
+
+func TestGuessHomepage(t *testing.T) {
+	uri, _ := url.Parse("https://github.com/getsolus/solbuild/archive/refs/tags/v1.7.1.tar.gz")
+	if home := builder.GuessHomepage(uri); home != "https://github.com/getsolus/solbuild" {
+		t.Fatalf("Wrong homepage: %s", home)
+	}
+
+	uri, _ = url.Parse("https://www.nano-editor.org/dist/v7/nano-7.2.tar.xz")
+	if home := builder.GuessHomepage(uri); home != "https://www.nano-editor.org" {
+		t.Fatalf("Wrong homepage: %s", home)
+	}
+}
+
+func TestConvertPspec(t *testing.T) {
+	conv, err := builder.ConvertPspec("testdata/convert/pspec.xml")
+	if err != nil {
+		t.Fatalf("Failed to convert pspec.xml: %v", err)
+	}
+
+	recipe := string(conv.Recipe)
+
+	for _, want := range []string{
+		"name       : legacy-tool\n",
+		"release    : 7\n",
+		"    - https://example.com/legacy-tool-1.2.tar.xz : UPDATE-ME # TODO: sha256sum",
+		"    - GPL-2.0-or-later\n",
+		"component  : system.utils\n",
+		"    A legacy tool still built from pspec.xml\n",
+		"builddeps  :\n    - zlib-devel\n",
+		"rundeps    :\n    - zlib\n",
+		"setup      : |\n    %patch -p1 -i $pkgfiles/fix-build.patch\n    %configure --disable-static --enable-shared\n",
+		"build      : |\n    %make\n",
+		"install    : |\n    %make_install\n    # TODO: unconverted: pisitools.dodoc(\"README\", \"COPYING\")\n",
+	} {
+		if !strings.Contains(recipe, want) {
+			t.Fatalf("Expected %q in converted recipe:\n%s", want, recipe)
+		}
+	}
+
+	// sha256sum, subpackage and pisitools.dodoc
+	if len(conv.TODOs) != 3 {
+		t.Fatalf("Expected 3 TODOs, got %v", conv.TODOs)
+	}
+
+	if _, err = builder.NewYmlPackageFromBytes(conv.Recipe); err != nil {
+		t.Fatalf("Converted recipe is not valid: %v", err)
+	}
+}
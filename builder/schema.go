@@ -0,0 +1,173 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ImageSchema is the version of the filesystem layout within a backing image.
+type ImageSchema int
+
+const (
+	// SchemaClassic is the traditional layout, where /var/run and /var/lock
+	// may be real directories within the image.
+	SchemaClassic ImageSchema = 1
+
+	// SchemaRunSymlinks is the stateless layout, where /var/run and /var/lock
+	// are already symlinks into /run.
+	SchemaRunSymlinks ImageSchema = 2
+
+	// SchemaUsrMerge is the merged /usr layout, where /bin, /sbin and /lib
+	// are symlinks into /usr.
+	SchemaUsrMerge ImageSchema = 3
+)
+
+// String returns a human readable name for the schema.
+func (s ImageSchema) String() string {
+	switch s {
+	case SchemaClassic:
+		return "classic"
+	case SchemaRunSymlinks:
+		return "run-symlinks"
+	case SchemaUsrMerge:
+		return "usr-merge"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// A layoutMigration is a single idempotent change to a build root.
+type layoutMigration struct {
+	Name   string
+	Before ImageSchema // Only applied to images with an older schema than this
+	Needed func(root string) bool
+	Apply  func(root string) error
+}
+
+// isSymlink determines whether path is a symlink.
+func isSymlink(path string) bool {
+	st, err := os.Lstat(path)
+	return err == nil && st.Mode()&os.ModeSymlink != 0
+}
+
+// ensureSymlink creates the symlink at path if nothing exists there yet.
+func ensureSymlink(target, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+
+	return os.Symlink(target, path)
+}
+
+// layoutMigrations are applied in order by EnsureEopkgLayout.
+var layoutMigrations = []layoutMigration{
+	{
+		Name:   "run-lock",
+		Before: SchemaUsrMerge + 1,
+		Needed: func(root string) bool {
+			return !PathExists(filepath.Join(root, "run", "lock"))
+		},
+		Apply: func(root string) error {
+			return os.MkdirAll(filepath.Join(root, "run", "lock"), 0o0755)
+		},
+	},
+	{
+		// Ensures we don't end up with /var/lock vs /run/lock nonsense
+		Name:   "run-symlinks",
+		Before: SchemaRunSymlinks,
+		Needed: func(root string) bool {
+			return !isSymlink(filepath.Join(root, "var", "lock")) || !isSymlink(filepath.Join(root, "var", "run"))
+		},
+		Apply: func(root string) error {
+			if err := os.MkdirAll(filepath.Join(root, "var"), 0o0755); err != nil {
+				return err
+			}
+
+			if err := ensureSymlink("../run/lock", filepath.Join(root, "var", "lock")); err != nil {
+				return err
+			}
+
+			return ensureSymlink("../run", filepath.Join(root, "var", "run"))
+		},
+	},
+	{
+		// Enables our bind mounting for caching
+		Name:   "package-cache",
+		Before: SchemaUsrMerge + 1,
+		Needed: func(root string) bool {
+			return !PathExists(filepath.Join(root, "var", "cache", "eopkg", "packages"))
+		},
+		Apply: func(root string) error {
+			return os.MkdirAll(filepath.Join(root, "var", "cache", "eopkg", "packages"), 0o0755)
+		},
+	},
+}
+
+// CleanRunDir will remove any stale runtime state from /run within the root.
+// This must only be done when the root is freshly mounted, before anything
+// within it has been started.
+func CleanRunDir(root string) error {
+	runPath := filepath.Join(root, "run")
+
+	if err := os.RemoveAll(runPath); err != nil {
+		return fmt.Errorf("Failed to clean stale /run, reason: %w\n", err)
+	}
+
+	if err := os.MkdirAll(runPath, 0o0755); err != nil {
+		return fmt.Errorf("Failed to clean stale /run, reason: %w\n", err)
+	}
+
+	return nil
+}
+
+// DetectImageSchema will determine the layout version of the given root.
+func DetectImageSchema(root string) ImageSchema {
+	if !isSymlink(filepath.Join(root, "var", "run")) || !isSymlink(filepath.Join(root, "var", "lock")) {
+		return SchemaClassic
+	}
+
+	if isSymlink(filepath.Join(root, "bin")) {
+		return SchemaUsrMerge
+	}
+
+	return SchemaRunSymlinks
+}
+
+// EnsureEopkgLayout will enforce changes to the filesystem to make sure that
+// it works as expected. Only the migrations required by the schema of the
+// root are applied, and calling it repeatedly is safe.
+func EnsureEopkgLayout(root string) error {
+	schema := DetectImageSchema(root)
+
+	for _, migration := range layoutMigrations {
+		if schema >= migration.Before || !migration.Needed(root) {
+			continue
+		}
+
+		slog.Debug("Applying layout migration", "name", migration.Name, "schema", schema)
+
+		if err := migration.Apply(root); err != nil {
+			return fmt.Errorf("Failed to apply layout migration %s, reason: %w", migration.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// makeRoot creates a fake build root with the given directories and symlinks.
+func makeRoot(t *testing.T, dirs []string, links map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	for path, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, path)); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", path, err)
+		}
+	}
+
+	return root
+}
+
+// checkLayout asserts the layout required by eopkg, and that layout checks
+// are idempotent and never touch the contents of /run.
+func checkLayout(t *testing.T, root string, schema builder.ImageSchema) {
+	t.Helper()
+
+	if detected := builder.DetectImageSchema(root); detected != schema {
+		t.Fatalf("Wrong schema detected: %v vs expected %v", detected, schema)
+	}
+
+	if err := builder.EnsureEopkgLayout(root); err != nil {
+		t.Fatalf("Failed to ensure layout: %v", err)
+	}
+
+	pid := filepath.Join(root, "run", "dbus.pid")
+	if err := os.WriteFile(pid, []byte("1"), 0o0644); err != nil {
+		t.Fatalf("Failed to write to /run: %v", err)
+	}
+
+	if err := builder.EnsureEopkgLayout(root); err != nil {
+		t.Fatalf("Failed to ensure layout a second time: %v", err)
+	}
+
+	if !builder.PathExists(pid) {
+		t.Fatal("Layout check removed the contents of /run")
+	}
+
+	for _, dir := range []string{"run/lock", "var/cache/eopkg/packages", "var/lock", "var/run"} {
+		if st, err := os.Stat(filepath.Join(root, dir)); err != nil || !st.IsDir() {
+			t.Fatalf("Missing directory %s in layout", dir)
+		}
+	}
+
+	if err := builder.CleanRunDir(root); err != nil {
+		t.Fatalf("Failed to clean /run: %v", err)
+	}
+
+	if builder.PathExists(pid) {
+		t.Fatal("Stale /run contents survived a clean")
+	}
+}
+
+func TestLayoutClassic(t *testing.T) {
+	root := makeRoot(t, []string{"bin", "run", "var"}, nil)
+	checkLayout(t, root, builder.SchemaClassic)
+
+	if target, err := os.Readlink(filepath.Join(root, "var", "run")); err != nil || target != "../run" {
+		t.Fatalf("Wrong /var/run symlink: %s", target)
+	}
+}
+
+func TestLayoutRunSymlinks(t *testing.T) {
+	root := makeRoot(t, []string{"bin", "run/lock", "var"}, map[string]string{
+		"var/run":  "../run",
+		"var/lock": "../run/lock",
+	})
+	checkLayout(t, root, builder.SchemaRunSymlinks)
+}
+
+func TestLayoutUsrMerge(t *testing.T) {
+	root := makeRoot(t, []string{"usr/bin", "run/lock", "var"}, map[string]string{
+		"bin":      "usr/bin",
+		"var/run":  "../run",
+		"var/lock": "../run/lock",
+	})
+	checkLayout(t, root, builder.SchemaUsrMerge)
+}
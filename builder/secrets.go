@@ -0,0 +1,300 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+const (
+	// SecretsDir is where secrets are made available inside the chroot.
+	SecretsDir = "/run/secrets"
+
+	// minSecretScanLength is the shortest secret we will search artifacts
+	// for, as anything shorter will produce false positives.
+	minSecretScanLength = 8
+
+	redactedSecret = "[REDACTED]"
+)
+
+var (
+	// ErrSecretLeaked is returned when a secret is found in the build output.
+	ErrSecretLeaked = errors.New("A build secret was found in the package contents")
+
+	secretNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// A Secret is a file from the host that is exposed to the build for its
+// duration only, such as a token for a private registry.
+type Secret struct {
+	Name string // Name of the secret, used as the file name in SecretsDir
+	Path string // Path to the secret on the host
+
+	value []byte // Contents of the secret, never logged
+}
+
+// ParseSecret will parse a name=path secret specification and load it.
+func ParseSecret(spec string) (*Secret, error) {
+	name, path, found := strings.Cut(spec, "=")
+	if !found || name == "" || path == "" {
+		return nil, fmt.Errorf("Invalid secret '%s', expected name=path", spec)
+	}
+
+	if !secretNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("Invalid secret name '%s'", name)
+	}
+
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read secret %s, reason: %w", name, err)
+	}
+
+	if len(bytes.TrimSpace(value)) < minSecretScanLength {
+		slog.Warn("Secret is too short to be scanned for in build output", "name", name)
+	}
+
+	return &Secret{Name: name, Path: path, value: value}, nil
+}
+
+// LogValue ensures that only the secret name is ever logged.
+func (s *Secret) LogValue() slog.Value {
+	return slog.StringValue(s.Name)
+}
+
+// secretsMountPoint returns the host-side path of SecretsDir for the overlay.
+func secretsMountPoint(o *Overlay) string {
+	return filepath.Join(o.MountPoint, SecretsDir[1:])
+}
+
+// MountSecrets will expose the secrets in a private tmpfs within the chroot,
+// readable only by the build user.
+func (p *Package) MountSecrets(o *Overlay, secrets []*Secret) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	target, err := o.secureDir(secretsMountPoint(o), 0o0700)
+	if err != nil {
+		return fmt.Errorf("Failed to create secrets directory, reason: %w\n", err)
+	}
+
+	slog.Debug("Mounting secrets tmpfs", "target", target)
+
+	if err := disk.GetMountManager().Mount("tmpfs-secrets", target, "tmpfs", "size=16M", "mode=0700",
+		fmt.Sprintf("uid=%d", BuildUserID), fmt.Sprintf("gid=%d", BuildUserGID), "nosuid", "nodev", "noexec"); err != nil {
+		return fmt.Errorf("Failed to mount secrets tmpfs, reason: %w\n", err)
+	}
+
+	o.ExtraMounts = append(o.ExtraMounts, target)
+
+	for _, secret := range secrets {
+		slog.Debug("Exposing secret to build", "secret", secret)
+
+		path := filepath.Join(target, secret.Name)
+		if err := os.WriteFile(path, secret.value, 0o0400); err != nil {
+			return fmt.Errorf("Failed to write secret %s, reason: %w\n", secret.Name, err)
+		}
+
+		if err := os.Chown(path, BuildUserID, BuildUserGID); err != nil {
+			return fmt.Errorf("Failed to chown secret %s, reason: %w\n", secret.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// UnmountSecrets will remove the secrets from the chroot as soon as the build
+// no longer needs them.
+func (p *Package) UnmountSecrets(o *Overlay, secrets []*Secret) {
+	if len(secrets) == 0 {
+		return
+	}
+
+	target := secretsMountPoint(o)
+
+	if err := disk.GetMountManager().Unmount(target); err != nil {
+		slog.Warn("Failed to unmount secrets tmpfs", "target", target, "err", err)
+		return
+	}
+
+	mounts := o.ExtraMounts[:0]
+
+	for _, m := range o.ExtraMounts {
+		if m != target {
+			mounts = append(mounts, m)
+		}
+	}
+
+	o.ExtraMounts = mounts
+}
+
+// scannable returns the secret values that are long enough to search for.
+func scannable(secrets []*Secret) [][]byte {
+	ret := make([][]byte, 0, len(secrets))
+
+	for _, secret := range secrets {
+		if value := bytes.TrimSpace(secret.value); len(value) >= minSecretScanLength {
+			ret = append(ret, value)
+		}
+	}
+
+	return ret
+}
+
+// CheckSecretLeaks will walk the package install tree to make sure that no
+// secret has been baked into the package contents.
+func CheckSecretLeaks(dir string, secrets []*Secret) error {
+	values := scannable(secrets)
+	if len(values) == 0 || !PathExists(dir) {
+		return nil
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			if bytes.Contains(contents, value) {
+				rel, _ := filepath.Rel(dir, path)
+				slog.Error("Build secret found in package contents", "path", rel)
+
+				return ErrSecretLeaked
+			}
+		}
+
+		return nil
+	})
+}
+
+// RedactSecrets will scrub any secrets from the given plain-text artifact.
+func RedactSecrets(path string, secrets []*Secret) error {
+	values := scannable(secrets)
+	if len(values) == 0 {
+		return nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	redacted := contents
+	for _, value := range values {
+		redacted = bytes.ReplaceAll(redacted, value, []byte(redactedSecret))
+	}
+
+	if bytes.Equal(redacted, contents) {
+		return nil
+	}
+
+	slog.Warn("Redacted build secret from artifact", "path", filepath.Base(path))
+
+	return os.WriteFile(path, redacted, 0o0644)
+}
+
+// A redactingWriter scrubs secrets from a stream as it is written. As a
+// secret may be split across writes, any tail that could begin a secret is
+// held back until the next write shows whether it does.
+type redactingWriter struct {
+	w       io.Writer
+	values  [][]byte
+	pending []byte
+	lock    sync.Mutex
+}
+
+// newRedactingWriter returns a writer scrubbing the secrets from all that is
+// written to w. It must be flushed once the stream has ended.
+func newRedactingWriter(w io.Writer, secrets []*Secret) *redactingWriter {
+	return &redactingWriter{w: w, values: scannable(secrets)}
+}
+
+// Write implements io.Writer.
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.values) == 0 {
+		return r.w.Write(p)
+	}
+
+	r.pending = append(r.pending, p...)
+
+	for _, value := range r.values {
+		r.pending = bytes.ReplaceAll(r.pending, value, []byte(redactedSecret))
+	}
+
+	held := r.heldBack()
+
+	if _, err := r.w.Write(r.pending[:len(r.pending)-held]); err != nil {
+		return 0, err
+	}
+
+	r.pending = append(r.pending[:0], r.pending[len(r.pending)-held:]...)
+
+	return len(p), nil
+}
+
+// heldBack returns the length of the longest tail of pending that is the
+// start of a secret.
+func (r *redactingWriter) heldBack() int {
+	longest := 0
+
+	for _, value := range r.values {
+		for n := min(len(value)-1, len(r.pending)); n > longest; n-- {
+			if bytes.HasPrefix(value, r.pending[len(r.pending)-n:]) {
+				longest = n
+				break
+			}
+		}
+	}
+
+	return longest
+}
+
+// Flush writes out anything held back, which the stream ended before it
+// could complete a secret.
+func (r *redactingWriter) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, err := r.w.Write(r.pending)
+	r.pending = nil
+
+	return err
+}
@@ -0,0 +1,216 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+const testSecret = "hunter2-hunter2"
+
+// loadSecret writes the value to a file and loads it as the named secret.
+func loadSecret(t *testing.T, name, value string) *builder.Secret {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	secret, err := builder.ParseSecret(name + "=" + path)
+	if err != nil {
+		t.Fatalf("Failed to load secret: %v", err)
+	}
+
+	return secret
+}
+
+func TestParseSecret(t *testing.T) {
+	if secret := loadSecret(t, "token", testSecret); secret.Name != "token" {
+		t.Fatalf("Expected secret token, got: %s", secret.Name)
+	}
+
+	for _, spec := range []string{"", "token", "=path", "token=", "../token=path", "token=/missing"} {
+		if _, err := builder.ParseSecret(spec); err == nil {
+			t.Fatalf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestMountSecrets(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Mounting the secrets requires root")
+	}
+
+	overlay := &builder.Overlay{MountPoint: t.TempDir()}
+	pkg := &builder.Package{Name: "nano"}
+	secrets := []*builder.Secret{loadSecret(t, "token", testSecret)}
+
+	if err := pkg.MountSecrets(overlay, secrets); err != nil {
+		t.Fatalf("Failed to mount secrets: %v", err)
+	}
+
+	target := filepath.Join(overlay.MountPoint, builder.SecretsDir[1:])
+	path := filepath.Join(target, "token")
+
+	if !slices.Contains(overlay.ExtraMounts, target) {
+		t.Fatalf("Expected the secrets to be unmounted on cleanup, got: %v", overlay.ExtraMounts)
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to find secret: %v", err)
+	}
+
+	if st.Mode().Perm() != 0o400 {
+		t.Fatalf("Expected secret to be readable by its owner only, got: %v", st.Mode())
+	}
+
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok && sys.Uid != uint32(builder.BuildUserID) {
+		t.Fatalf("Expected secret to be owned by the build user, got: %d", sys.Uid)
+	}
+
+	pkg.UnmountSecrets(overlay, secrets)
+
+	if slices.Contains(overlay.ExtraMounts, target) {
+		t.Fatalf("Expected the secrets to be forgotten once unmounted, got: %v", overlay.ExtraMounts)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected secret to be gone once unmounted, got: %v", err)
+	}
+}
+
+func TestCheckSecretLeaks(t *testing.T) {
+	secrets := []*builder.Secret{loadSecret(t, "token", testSecret)}
+	installDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(installDir, "usr", "share"), 0o755); err != nil {
+		t.Fatalf("Failed to create install dir: %v", err)
+	}
+
+	config := filepath.Join(installDir, "usr", "share", "nano.conf")
+	if err := os.WriteFile(config, []byte("token = none\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := builder.CheckSecretLeaks(installDir, secrets); err != nil {
+		t.Fatalf("Expected no leak, got: %v", err)
+	}
+
+	if err := os.WriteFile(config, []byte("token = "+testSecret+"\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := builder.CheckSecretLeaks(installDir, secrets); !errors.Is(err, builder.ErrSecretLeaked) {
+		t.Fatalf("Expected the leak to be found, got: %v", err)
+	}
+
+	// A secret too short to scan for is never reported
+	short := []*builder.Secret{loadSecret(t, "pin", "1234")}
+	if err := os.WriteFile(config, []byte("pin = 1234\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := builder.CheckSecretLeaks(installDir, short); err != nil {
+		t.Fatalf("Expected a short secret to be skipped, got: %v", err)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	secrets := []*builder.Secret{loadSecret(t, "token", testSecret)}
+
+	path := filepath.Join(t.TempDir(), "pspec_x86_64.xml")
+	if err := os.WriteFile(path, []byte("<Token>"+testSecret+"</Token>\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write artifact: %v", err)
+	}
+
+	if err := builder.RedactSecrets(path, secrets); err != nil {
+		t.Fatalf("Failed to redact artifact: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read artifact: %v", err)
+	}
+
+	if string(data) != "<Token>[REDACTED]</Token>\n" {
+		t.Fatalf("Expected the secret to be redacted, got: %s", data)
+	}
+}
+
+func TestBuildLogRedaction(t *testing.T) {
+	builder.BuildLogDir = t.TempDir()
+
+	secrets := []*builder.Secret{loadSecret(t, "token", testSecret)}
+	pkg := &builder.Package{Name: "nano", Version: "8.0", Release: 180}
+
+	path, closeLog, err := builder.OpenBuildLog(pkg, secrets)
+	if err != nil {
+		t.Fatalf("Failed to open build log: %v", err)
+	}
+
+	// The secret is split across writes, as the output of a build may be
+	for _, chunk := range []string{"token=hunt", "er2-hun", "ter2\n", "hunter done\n"} {
+		if _, err = io.WriteString(builder.BuildOutput, chunk); err != nil {
+			t.Fatalf("Failed to write build output: %v", err)
+		}
+	}
+
+	// Redacted as written, should the build never finish
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read build log: %v", err)
+	}
+
+	if string(data) != "token=[REDACTED]\nhunter done\n" {
+		t.Fatalf("Expected the secret to be redacted while building, got: %q", data)
+	}
+
+	// A tail that may begin a secret is held back until the log is closed
+	if _, err = io.WriteString(builder.BuildOutput, "hunter2"); err != nil {
+		t.Fatalf("Failed to write build output: %v", err)
+	}
+
+	closeLog()
+
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatalf("Failed to read build log: %v", err)
+	}
+
+	if strings.Contains(string(data), testSecret) || !strings.HasSuffix(string(data), "hunter2") {
+		t.Fatalf("Expected the held back output once closed, got: %q", data)
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat build log: %v", err)
+	}
+
+	if st.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected the build log to be private, got: %v", st.Mode())
+	}
+}
@@ -0,0 +1,182 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks is the most symlinks followed resolving a path, as with the
+// kernel, to stop symlink loops.
+const maxSymlinks = 40
+
+// ErrUnsafePath is returned when a path within the build root would resolve
+// outside of it, such as through a symlink planted by an earlier build phase.
+var ErrUnsafePath = errors.New("Path escapes the build root")
+
+// SecureJoin will resolve the path, which must be within root, as if root
+// were the filesystem root: symlinks are followed, but absolute targets and
+// ".." components can never leave root. Missing components are kept as they
+// are, so the result may not exist yet.
+func SecureJoin(root, path string) (string, error) {
+	root = filepath.Clean(root)
+
+	rel, err := filepath.Rel(root, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%w: %s is not within %s", ErrUnsafePath, path, root)
+	}
+
+	resolved := root
+	remaining := strings.Split(rel, "/")
+	links := 0
+
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if resolved != root {
+				resolved = filepath.Dir(resolved)
+			}
+
+			continue
+		}
+
+		next := filepath.Join(resolved, component)
+
+		st, err := os.Lstat(next)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		if err != nil || st.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("%w: too many levels of symlinks in %s", ErrUnsafePath, path)
+		}
+
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(target) {
+			resolved = root
+		}
+
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+
+	return resolved, nil
+}
+
+// checkWithin will ensure the path, as returned by SecureJoin, still
+// resolves to itself within root, catching symlinks swapped in while it was
+// being created.
+func checkWithin(root, path string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	rel, _ := filepath.Rel(root, path)
+	if real != filepath.Join(realRoot, rel) {
+		return fmt.Errorf("%w: %s resolves to %s", ErrUnsafePath, path, real)
+	}
+
+	return nil
+}
+
+// SecureMkdirAll will create the directory at the path within root, and any
+// missing parents, without following symlinks out of root. The directory
+// that was created is returned, which differs from path when a symlink
+// within root was followed.
+func SecureMkdirAll(root, path string, perm os.FileMode) (string, error) {
+	safe, err := SecureJoin(root, path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, _ := filepath.Rel(root, safe)
+	dir := filepath.Clean(root)
+
+	for _, component := range strings.Split(rel, "/") {
+		if component == "." {
+			continue
+		}
+
+		// A symlink swapped in since it was resolved is caught below
+		dir = filepath.Join(dir, component)
+		if err = os.Mkdir(dir, perm); err != nil && !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+
+	if st, err := os.Lstat(safe); err != nil || !st.IsDir() {
+		return "", fmt.Errorf("%w: %s is not a directory", ErrUnsafePath, safe)
+	}
+
+	return safe, checkWithin(root, safe)
+}
+
+// SecureTouchFile will create the file at the path within root if it doesn't
+// exist, enabling use of bind mounts, without following symlinks out of
+// root. The parent directory must already exist. The file that was created
+// is returned, which differs from path when a symlink within root was
+// followed.
+func SecureTouchFile(root, path string) (string, error) {
+	safe, err := SecureJoin(root, path)
+	if err != nil {
+		return "", err
+	}
+
+	w, err := os.OpenFile(safe, os.O_RDONLY|os.O_CREATE|syscall.O_NOFOLLOW, 0o0644)
+	if err != nil {
+		return "", err
+	}
+
+	w.Close()
+
+	return safe, checkWithin(root, safe)
+}
+
+// secureDir will create the directory at the path within the root of the
+// overlay, returning where it was created.
+func (o *Overlay) secureDir(path string, perm os.FileMode) (string, error) {
+	dir, err := SecureMkdirAll(o.MountPoint, path, perm)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create %s, reason: %w", path, err)
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,102 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestSecureJoin(t *testing.T) {
+	root := t.TempDir()
+
+	for name, target := range map[string]string{
+		"abs":  "/etc",
+		"up":   "../../../../etc",
+		"loop": "loop",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	for path, expected := range map[string]string{
+		"abs/passwd":       "etc/passwd",
+		"up/passwd":        "etc/passwd",
+		"missing/../abs/x": "etc/x",
+		"home/build":       "home/build",
+	} {
+		got, err := builder.SecureJoin(root, filepath.Join(root, path))
+		if err != nil || got != filepath.Join(root, expected) {
+			t.Fatalf("Wrong resolution of %s: %s (%v)", path, got, err)
+		}
+	}
+
+	if _, err := builder.SecureJoin(root, filepath.Join(root, "loop")); !errors.Is(err, builder.ErrUnsafePath) {
+		t.Fatalf("Expected a symlink loop to be refused, got %v", err)
+	}
+
+	if _, err := builder.SecureJoin(root, filepath.Dir(root)); !errors.Is(err, builder.ErrUnsafePath) {
+		t.Fatalf("Expected a path outside the root to be refused, got %v", err)
+	}
+}
+
+func TestSecureBindTargets(t *testing.T) {
+	root := t.TempDir()
+	host := t.TempDir()
+
+	// A recipe plants symlinks to the host where bind targets are created
+	sources := filepath.Join(root, "home/build/YPKG")
+	if err := os.MkdirAll(sources, 0o755); err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+
+	if err := os.Symlink(host, filepath.Join(sources, "sources")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	dir, err := builder.SecureMkdirAll(root, filepath.Join(sources, "sources", "nano"), 0o755)
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if dir != filepath.Join(root, host, "nano") {
+		t.Fatalf("Directory was not created within the root: %s", dir)
+	}
+
+	if builder.PathExists(filepath.Join(host, "nano")) {
+		t.Fatal("Directory was created on the host")
+	}
+
+	hostFile := filepath.Join(host, "shadow")
+	if err = os.Symlink(hostFile, filepath.Join(dir, "nano-8.0.tar.xz")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	file, err := builder.SecureTouchFile(root, filepath.Join(dir, "nano-8.0.tar.xz"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if file != filepath.Join(root, hostFile) || builder.PathExists(hostFile) {
+		t.Fatalf("File was not created within the root: %s", file)
+	}
+}
@@ -0,0 +1,164 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// SelfTestMarker is written to the root of the overlay, so that a probe can
+// tell whether a process shares the root of the build.
+const SelfTestMarker = "/.solbuild-selftest"
+
+// A SelfTestProbe attempts to reach outside of the sandbox from within the
+// build root.
+type SelfTestProbe struct {
+	Name     string      // Short name of the probe
+	Desc     string      // What the probe attempts
+	Required bool        // Whether the sandbox is meant to prevent it
+	Command  string      // Exits successfully when the sandbox holds
+	Escaped  func() bool // Checks the host after the command, if set
+}
+
+// SelfTestResult is the outcome of a single probe.
+type SelfTestResult struct {
+	Probe *SelfTestProbe
+	Held  bool  // Whether the sandbox held
+	Err   error // Set when the probe could not be run
+}
+
+// SelfTestProbes returns the probes run by the self test. The escape path is
+// a file on the host that the build root must not be able to write.
+func SelfTestProbes(escape string) []*SelfTestProbe {
+	return []*SelfTestProbe{
+		{
+			Name:     "network",
+			Desc:     "Reach the network with networking disabled",
+			Required: true,
+			Command:  "! grep -q -v -e 'lo:' -e '|' /proc/net/dev",
+		},
+		{
+			Name:     "host-write",
+			Desc:     "Write to the host outside of the overlay",
+			Required: true,
+			Command:  fmt.Sprintf("{ echo escaped > /proc/1/root%s; } 2> /dev/null; true", escape),
+			Escaped:  func() bool { return PathExists(escape) },
+		},
+		{
+			Name: "host-processes",
+			Desc: "See processes outside of the build root",
+			Command: fmt.Sprintf(`for p in /proc/[0-9]*; do
+  [ -d "$p" ] || continue
+  [ -e "$p/root%s" ] || exit 1
+done`, SelfTestMarker),
+		},
+		{
+			Name: "host-devices",
+			Desc: "Access the block devices of the host",
+			Command: `for d in /dev/* /dev/*/*; do
+  [ -b "$d" ] && exit 1
+done
+exit 0`,
+		},
+	}
+}
+
+// RunSelfTest runs each of the probes with run, which executes a command
+// within the build root.
+func RunSelfTest(probes []*SelfTestProbe, run func(command string) error) []SelfTestResult {
+	results := make([]SelfTestResult, 0, len(probes))
+
+	for _, probe := range probes {
+		slog.Debug("Running self test probe", "probe", probe.Name)
+
+		result := SelfTestResult{Probe: probe}
+
+		var exitErr *exec.ExitError
+
+		switch err := run(probe.Command); {
+		case err == nil:
+			result.Held = probe.Escaped == nil || !probe.Escaped()
+		case errors.As(err, &exitErr):
+			result.Held = false
+		default:
+			result.Err = err
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// SelfTestFailed determines whether any required probe did not hold.
+func SelfTestFailed(results []SelfTestResult) bool {
+	for _, result := range results {
+		if result.Probe.Required && !result.Held {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SelfTest brings up the build root as for a build with networking disabled,
+// and runs the self test probes within it.
+func (p *Package) SelfTest(notif PidNotifier, overlay *Overlay) ([]SelfTestResult, error) {
+	slog.Debug("Beginning self test", "profile", overlay.Back.Name)
+
+	ChrootEnvironment = SaneEnvironment("root", "/root")
+
+	if err := overlay.CleanExisting(); err != nil {
+		return nil, err
+	}
+
+	if err := p.ActivateRoot(overlay); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(overlay.MountPoint, SelfTestMarker[1:]), nil, 0o0644); err != nil {
+		return nil, fmt.Errorf("Failed to write self test marker, reason: %w\n", err)
+	}
+
+	if err := DropNetworking(); err != nil {
+		return nil, err
+	}
+
+	if err := overlay.ConfigureNetworking(); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "solbuild-selftest-")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create required directories, reason: %w\n", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	results := RunSelfTest(SelfTestProbes(filepath.Join(dir, "escaped")), func(command string) error {
+		return ChrootExec(notif, overlay.MountPoint, "selftest", command)
+	})
+
+	notif.SetActivePID(0)
+
+	return results, nil
+}
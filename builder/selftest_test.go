@@ -0,0 +1,98 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	escape := filepath.Join(t.TempDir(), "escaped")
+	probes := builder.SelfTestProbes(escape)
+
+	errFailed := exec.Command("false").Run()
+	errStart := errors.New("chroot is missing")
+
+	// Each probe is judged on the exit status of its command, except the
+	// host write which is only judged on the host
+	run := func(command string) error {
+		switch command {
+		case probes[0].Command:
+			return errFailed
+		case probes[1].Command:
+			return os.WriteFile(escape, []byte("escaped\n"), 0o644)
+		case probes[2].Command:
+			return nil
+		default:
+			return errStart
+		}
+	}
+
+	results := builder.RunSelfTest(probes, run)
+	if len(results) != len(probes) {
+		t.Fatalf("Expected %d results, got: %d", len(probes), len(results))
+	}
+
+	expected := []bool{false, false, true, false}
+	for i, result := range results {
+		if result.Probe != probes[i] {
+			t.Fatalf("Expected result %d for probe %s, got: %s", i, probes[i].Name, result.Probe.Name)
+		}
+
+		if result.Held != expected[i] {
+			t.Fatalf("Expected probe %s to hold: %t", result.Probe.Name, expected[i])
+		}
+	}
+
+	if !errors.Is(results[3].Err, errStart) {
+		t.Fatalf("Expected the probe to report it could not run, got: %v", results[3].Err)
+	}
+
+	if !builder.SelfTestFailed(results) {
+		t.Fatal("Expected the self test to fail")
+	}
+}
+
+func TestSelfTestFailedRequiredOnly(t *testing.T) {
+	probes := builder.SelfTestProbes(filepath.Join(t.TempDir(), "escaped"))
+
+	results := builder.RunSelfTest(probes, func(command string) error {
+		for _, probe := range probes {
+			if probe.Command == command && !probe.Required {
+				return exec.Command("false").Run()
+			}
+		}
+
+		return nil
+	})
+
+	for _, result := range results {
+		if result.Held == !result.Probe.Required {
+			t.Fatalf("Unexpected result for probe %s: %+v", result.Probe.Name, result)
+		}
+	}
+
+	if builder.SelfTestFailed(results) {
+		t.Fatal("Expected only optional probes to fail, and the self test to pass")
+	}
+}
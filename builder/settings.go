@@ -0,0 +1,159 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// BuildSettingsFile is where the settings of the last successful build of
+// each package on this host are remembered, within LibDirectory.
+var BuildSettingsFile = buildSettingsFile()
+
+// buildSettingsFile returns the path of the remembered settings within the
+// current LibDirectory.
+func buildSettingsFile() string {
+	return filepath.Join(LibDirectory, "build-settings.toml")
+}
+
+// BuildSettings are the choices made for a successful build of a package,
+// reused as the defaults for its next build.
+type BuildSettings struct {
+	EnableTmpfs bool   `toml:"enable_tmpfs"` // Whether the build was in a tmpfs
+	TmpfsSize   string `toml:"tmpfs_size"`   // Size of the tmpfs that was enough
+	LowMemory   bool   `toml:"lowmem"`       // Whether low memory mode was used
+}
+
+// LoadBuildSettings will return the remembered settings of every package.
+func LoadBuildSettings() (map[string]BuildSettings, error) {
+	settings := make(map[string]BuildSettings)
+
+	if _, err := toml.DecodeFile(BuildSettingsFile, &settings); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return settings, nil
+		}
+
+		return nil, fmt.Errorf("Failed to read build settings %s, reason: %w\n", BuildSettingsFile, err)
+	}
+
+	return settings, nil
+}
+
+// RememberBuildSettings will store the settings used to build the named
+// package, replacing any previously remembered.
+func RememberBuildSettings(name string, remembered BuildSettings) error {
+	settings, err := LoadBuildSettings()
+	if err != nil {
+		return err
+	}
+
+	settings[name] = remembered
+
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by solbuild, settings of the last successful build of each package\n")
+
+	if err = toml.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(BuildSettingsFile), 0o0755); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(BuildSettingsFile, buf.Bytes(), 0o0644); err != nil {
+		return fmt.Errorf("Failed to write build settings %s, reason: %w\n", BuildSettingsFile, err)
+	}
+
+	return nil
+}
+
+// RecallBuildSettings will apply the settings remembered from the last
+// successful build of the named package over those of the config, returning
+// whether there were any. Settings given on the command line take precedence
+// over both, so nothing is recalled once any of them is set.
+func RecallBuildSettings(config *Config, name string, given BuildSettings) bool {
+	if !config.RememberSettings || given != (BuildSettings{}) {
+		return false
+	}
+
+	settings, err := LoadBuildSettings()
+	if err != nil {
+		slog.Warn("Failed to recall build settings", "err", err)
+		return false
+	}
+
+	remembered, ok := settings[name]
+	if !ok {
+		return false
+	}
+
+	if remembered.EnableTmpfs != config.EnableTmpfs || remembered.TmpfsSize != config.TmpfsSize {
+		slog.Warn("Remembered settings replace the tmpfs settings of the config, set remember_settings = false to keep them",
+			"package", name, "enable_tmpfs", config.EnableTmpfs, "tmpfs_size", config.TmpfsSize)
+	}
+
+	slog.Info("Using the settings of the last successful build", "package", name, "source", BuildSettingsFile,
+		"tmpfs", remembered.EnableTmpfs, "tmpfs_size", remembered.TmpfsSize, "lowmem", remembered.LowMemory)
+
+	config.EnableTmpfs = remembered.EnableTmpfs
+	config.TmpfsSize = remembered.TmpfsSize
+	config.LowMemory = remembered.LowMemory
+
+	return true
+}
+
+// RecallSettings will apply the settings remembered for the package unless
+// any were given on the command line, returning whether there were any.
+func (m *Manager) RecallSettings(given BuildSettings) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.pkg == nil {
+		return false
+	}
+
+	return RecallBuildSettings(m.Config, m.pkg.Name, given)
+}
+
+// rememberSettings will store the settings used for the package, once it
+// has been built successfully.
+func (m *Manager) rememberSettings() {
+	if !m.Config.RememberSettings {
+		return
+	}
+
+	remembered := BuildSettings{
+		EnableTmpfs: m.overlay.EnableTmpfs,
+		LowMemory:   LowMemory,
+	}
+
+	if remembered.EnableTmpfs {
+		remembered.TmpfsSize = m.overlay.TmpfsSize
+	}
+
+	if err := RememberBuildSettings(m.pkg.Name, remembered); err != nil {
+		slog.Warn("Failed to remember build settings", "err", err)
+	}
+}
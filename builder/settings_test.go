@@ -0,0 +1,107 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestRememberBuildSettings(t *testing.T) {
+	builder.BuildSettingsFile = filepath.Join(t.TempDir(), "build-settings.toml")
+
+	settings, err := builder.LoadBuildSettings()
+	if err != nil || len(settings) != 0 {
+		t.Fatalf("Expected no remembered settings, got %v (%v)", settings, err)
+	}
+
+	llvm := builder.BuildSettings{EnableTmpfs: true, TmpfsSize: "48G"}
+
+	if err = builder.RememberBuildSettings("llvm", llvm); err != nil {
+		t.Fatalf("Failed to remember settings: %v", err)
+	}
+
+	if err = builder.RememberBuildSettings("nano", builder.BuildSettings{LowMemory: true}); err != nil {
+		t.Fatalf("Failed to remember settings: %v", err)
+	}
+
+	if settings, err = builder.LoadBuildSettings(); err != nil {
+		t.Fatalf("Failed to load settings: %v", err)
+	}
+
+	if settings["llvm"] != llvm || !settings["nano"].LowMemory {
+		t.Fatalf("Unexpected remembered settings: %v", settings)
+	}
+}
+
+func TestRecallBuildSettings(t *testing.T) {
+	builder.BuildSettingsFile = filepath.Join(t.TempDir(), "build-settings.toml")
+
+	remembered := builder.BuildSettings{EnableTmpfs: true, TmpfsSize: "48G", LowMemory: true}
+
+	if err := builder.RememberBuildSettings("llvm", remembered); err != nil {
+		t.Fatalf("Failed to remember settings: %v", err)
+	}
+
+	newConfig := func() *builder.Config {
+		return &builder.Config{RememberSettings: true, EnableTmpfs: false, TmpfsSize: "8G"}
+	}
+
+	// Remembered settings win over the config
+	config := newConfig()
+
+	if !builder.RecallBuildSettings(config, "llvm", builder.BuildSettings{}) {
+		t.Fatal("Expected remembered settings to be recalled")
+	}
+
+	if !config.EnableTmpfs || config.TmpfsSize != "48G" || !config.LowMemory {
+		t.Fatalf("Expected remembered settings over the config, got %+v", config)
+	}
+
+	// Settings given on the command line win over remembered ones
+	for _, given := range []builder.BuildSettings{
+		{EnableTmpfs: true},
+		{TmpfsSize: "16G"},
+		{LowMemory: true},
+	} {
+		config = newConfig()
+
+		if builder.RecallBuildSettings(config, "llvm", given) {
+			t.Fatalf("Expected nothing recalled with %+v given", given)
+		}
+
+		if config.EnableTmpfs || config.TmpfsSize != "8G" || config.LowMemory {
+			t.Fatalf("Expected the config untouched with %+v given, got %+v", given, config)
+		}
+	}
+
+	// Nothing is recalled once disabled, or for unknown packages
+	config = newConfig()
+	config.RememberSettings = false
+
+	if builder.RecallBuildSettings(config, "llvm", builder.BuildSettings{}) || config.TmpfsSize != "8G" {
+		t.Fatalf("Expected nothing recalled with remember_settings disabled, got %+v", config)
+	}
+
+	config = newConfig()
+
+	if builder.RecallBuildSettings(config, "nano", builder.BuildSettings{}) || config.TmpfsSize != "8G" {
+		t.Fatalf("Expected nothing recalled for an unknown package, got %+v", config)
+	}
+}
@@ -0,0 +1,40 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"log/slog"
+)
+
+// FallbackShell is used within the chroot when the preferred shell is missing,
+// such as in minimal images lacking bash.
+const FallbackShell = "/bin/sh"
+
+// LoginShell is the shell spawned within the chroot by "solbuild chroot".
+var LoginShell = BuildUserShell
+
+// ResolveShell will return the shell if it exists within the root, otherwise
+// falling back to FallbackShell.
+func ResolveShell(root, shell string) string {
+	if shell == FallbackShell || findChrootBinary(root, shell) {
+		return shell
+	}
+
+	slog.Debug("Shell not found in chroot, falling back", "shell", shell, "fallback", FallbackShell)
+
+	return FallbackShell
+}
@@ -0,0 +1,142 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/getsolus/solbuild/util"
+)
+
+// ArtifactSignatureSuffix is appended to the name of a package to give the
+// name of its detached OpenPGP signature.
+const ArtifactSignatureSuffix = ".sig"
+
+// ErrNoSigningKey is returned when the signing key has no usable private key.
+var ErrNoSigningKey = errors.New("No unencrypted private key found in signing key")
+
+// A Signer produces a detached signature for the data.
+type Signer interface {
+	Sign(data io.Reader) ([]byte, error)
+}
+
+// ArtifactSigner is used to sign each package as it is collected. Packages
+// are not signed when it is nil.
+var ArtifactSigner Signer
+
+// keySigner signs with a local OpenPGP private key.
+type keySigner struct {
+	entity *openpgp.Entity
+}
+
+// Sign creates a binary detached signature with the private key.
+func (k *keySigner) Sign(data io.Reader) ([]byte, error) {
+	var sig bytes.Buffer
+
+	if err := openpgp.DetachSign(&sig, k.entity, data, nil); err != nil {
+		return nil, err
+	}
+
+	return sig.Bytes(), nil
+}
+
+// serviceSigner signs by sending the data to an external signing service,
+// which responds with the detached signature.
+type serviceSigner struct {
+	url string
+}
+
+// Sign posts the data to the signing service.
+func (s *serviceSigner) Sign(data io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, data)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("User-Agent", "solbuild/"+util.SolbuildVersion)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status from signing service: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// NewSigner returns a signer for the given private key file or signing
+// service URL, or nil if neither is set.
+func NewSigner(keyPath, url string) (Signer, error) {
+	switch {
+	case keyPath != "" && url != "":
+		return nil, errors.New("Only one of signing_key and signing_url may be set")
+	case url != "":
+		return &serviceSigner{url: url}, nil
+	case keyPath == "":
+		return nil, nil //nolint:nilnil // signing is optional
+	}
+
+	keyring, err := readKeyRing(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load signing key %s, reason: %w\n", keyPath, err)
+	}
+
+	for _, entity := range keyring {
+		if entity.PrivateKey != nil && !entity.PrivateKey.Encrypted {
+			return &keySigner{entity: entity}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNoSigningKey, keyPath)
+}
+
+// SignArtifact will write a detached signature next to the file, returning
+// the path of the signature.
+func SignArtifact(signer Signer, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sig, err := signer.Sign(f)
+	if err != nil {
+		return "", fmt.Errorf("Failed to sign %s, reason: %w\n", path, err)
+	}
+
+	sigPath := path + ArtifactSignatureSuffix
+	if err = os.WriteFile(sigPath, sig, 0o0644); err != nil {
+		return "", err
+	}
+
+	slog.Debug("Signed build artifact", "path", path)
+
+	return sigPath, nil
+}
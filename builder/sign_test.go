@@ -0,0 +1,113 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// writeSigningKey generates a private key, writing it to a temporary file.
+func writeSigningKey(t *testing.T) (*openpgp.Entity, string) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("solbuild", "test", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = entity.SerializePrivate(&buf, nil); err != nil {
+		t.Fatalf("Failed to serialize key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "signing.key")
+	if err = os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return entity, path
+}
+
+func TestSignArtifact(t *testing.T) {
+	entity, keyPath := writeSigningKey(t)
+
+	signer, err := builder.NewSigner(keyPath, "")
+	if err != nil {
+		t.Fatalf("Failed to load signing key: %v", err)
+	}
+
+	pkg := filepath.Join(t.TempDir(), "nano-8.0-1-1-x86_64.eopkg")
+	if err = os.WriteFile(pkg, []byte("package"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sigPath, err := builder.SignArtifact(signer, pkg)
+	if err != nil {
+		t.Fatalf("Failed to sign package: %v", err)
+	}
+
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		t.Fatalf("Signature was not written: %v", err)
+	}
+
+	keyring := openpgp.EntityList{entity}
+	if _, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader([]byte("package")), bytes.NewReader(sig), nil); err != nil {
+		t.Fatalf("Signature does not verify: %v", err)
+	}
+
+	tram := builder.NewTransitManifest("unstable")
+	if err = tram.AddFile(pkg); err != nil {
+		t.Fatalf("Failed to add package to manifest: %v", err)
+	}
+
+	if tram.File[0].Signature != filepath.Base(sigPath) {
+		t.Fatalf("Manifest does not list the signature, got %q", tram.File[0].Signature)
+	}
+}
+
+func TestSignerService(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte("signed:"), body...))
+	}))
+	defer srv.Close()
+
+	signer, err := builder.NewSigner("", srv.URL)
+	if err != nil {
+		t.Fatalf("Failed to create service signer: %v", err)
+	}
+
+	sig, err := signer.Sign(bytes.NewReader([]byte("package")))
+	if err != nil || string(sig) != "signed:package" {
+		t.Fatalf("Unexpected signature %q: %v", sig, err)
+	}
+
+	if signer, _ = builder.NewSigner("", ""); signer != nil {
+		t.Fatal("No signer should be returned when signing is not configured")
+	}
+}
@@ -17,18 +17,22 @@
 package source
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
-const (
-	// GitSourceDir is the base directory for all cached git sources.
-	GitSourceDir = "/var/lib/solbuild/sources/git"
-)
+// GitSourceDir is the base directory for all cached git sources.
+var GitSourceDir = filepath.Join(DefaultSourceDir, "git")
+
+// commitPattern matches a full SHA-1 or SHA-256 commit hash.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
 
 // A GitSource as referenced by `ypkg` build spec. A git source must have
 // a valid ref to check out to.
@@ -37,6 +41,10 @@ type GitSource struct {
 	Ref       string
 	BaseName  string
 	ClonePath string // This is where we will have cloned into
+
+	Floating bool   // Whether Ref is a branch, rather than a fixed commit or tag
+	Locked   string // Commit to use for a floating Ref, as recorded in a lock file
+	Commit   string // Commit that Ref resolved to when fetched
 }
 
 // NewGit will create a new GitSource for the given URI & ref combination.
@@ -66,9 +74,9 @@ func NewGit(uri, ref string) (*GitSource, error) {
 }
 
 // clone shallow clones an upstream git repository to the local disk.
-func (g *GitSource) clone() error {
+func (g *GitSource) clone(ctx context.Context) error {
 	// Create a blobless clone without checking out a ref
-	cmd := exec.Command("git", "clone", "--filter=blob:none", "--no-checkout", g.URI, g.ClonePath)
+	cmd := exec.CommandContext(ctx, "git", "clone", "--filter=blob:none", "--no-checkout", g.URI, g.ClonePath)
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stdout
@@ -77,10 +85,10 @@ func (g *GitSource) clone() error {
 }
 
 // updateRefs checks the upstream for new refs and tags in case we need them for future git commands.
-func (g *GitSource) updateRefs() error {
+func (g *GitSource) updateRefs(ctx context.Context) error {
 	// --tags: Update git tags as well
 	// --force: Force overwrite any refs locally (such as when upstream moves a tag)
-	cmd := exec.Command("git", "fetch", "--tags", "--force", "origin")
+	cmd := exec.CommandContext(ctx, "git", "fetch", "--tags", "--force", "origin")
 
 	cmd.Dir = g.ClonePath
 	cmd.Stdout = os.Stdout
@@ -100,12 +108,43 @@ func (g *GitSource) switchRef() error {
 	return cmd.Run()
 }
 
-// submodules will handle setup of the git submodules after a
-// reset has taken place.
-func (g *GitSource) submodules() error {
-	// --init initializes the submodule if it hasn't been initialized alredy
-	cmd := exec.Command("git", "submodule", "update", "--init", "--filter=blob:none", "--recursive")
+// revParse resolves the revision to a full commit hash.
+func (g *GitSource) revParse(rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	cmd.Dir = g.ClonePath
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// switchFloating will switch to the commit for a branch ref, either the
+// locked commit or the tip of the upstream branch. The local branch is also
+// moved to it, so that it is what ypkg will check out within the build.
+func (g *GitSource) switchFloating() error {
+	target := g.Locked
+	if target == "" {
+		tip, err := g.revParse("refs/remotes/origin/" + g.Ref)
+		if err != nil {
+			return fmt.Errorf("unable to resolve branch %s: %w", g.Ref, err)
+		}
 
+		target = tip
+	}
+
+	cmd := exec.Command("git", "switch", "--discard-changes", "--detach", target)
+	cmd.Dir = g.ClonePath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	cmd = exec.Command("git", "branch", "--force", g.Ref, target)
 	cmd.Dir = g.ClonePath
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stdout
@@ -113,6 +152,106 @@ func (g *GitSource) submodules() error {
 	return cmd.Run()
 }
 
+// submodules will handle setup of the git submodules after a
+// reset has taken place.
+func (g *GitSource) submodules(ctx context.Context) error {
+	return updateSubmodules(ctx, g.ClonePath)
+}
+
+// updateSubmodules will check out the submodules of the tree in dir, and
+// then their own submodules. Each level is initialized first, so that the
+// remotes can be checked before git contacts them.
+func updateSubmodules(ctx context.Context, dir string) error {
+	// init resolves the remotes of new submodules into .git/config
+	cmd := exec.CommandContext(ctx, "git", "submodule", "init")
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	remotes, err := gitConfigValues(dir, "", `^submodule\..*\.url$`)
+	if err != nil {
+		return err
+	}
+
+	if len(remotes) == 0 {
+		return nil
+	}
+
+	for _, remote := range remotes {
+		if err = CheckRemote(remote); err != nil {
+			return err
+		}
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "submodule", "update", "--filter=blob:none")
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+
+	if err = cmd.Run(); err != nil {
+		return err
+	}
+
+	paths, err := gitConfigValues(dir, ".gitmodules", `^submodule\..*\.path$`)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		// Submodules that were not checked out have no tree of their own
+		if !PathExists(filepath.Join(dir, path, ".git")) {
+			continue
+		}
+
+		if err = updateSubmodules(ctx, filepath.Join(dir, path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gitConfigValues returns the values of the keys matching the pattern in the
+// git config of the tree in dir, or the given file within it.
+func gitConfigValues(dir, file, pattern string) ([]string, error) {
+	args := []string{"config"}
+	if file != "" {
+		if !PathExists(filepath.Join(dir, file)) {
+			return nil, nil
+		}
+
+		args = append(args, "--file", file)
+	}
+
+	cmd := exec.Command("git", append(args, "--get-regexp", pattern)...)
+	cmd.Dir = dir
+
+	out, err := cmd.Output()
+	if err != nil {
+		// Exit status 1 means no keys matched
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var values []string
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if _, value, ok := strings.Cut(line, " "); ok {
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
 // For some reason git blobless clones create pack files with 600 permissions. These break future operations
 // as those files cannot be read by non-root users. Fix those permissions so things work as they should.
 func (g *GitSource) fixPermissions() error {
@@ -123,29 +262,79 @@ func (g *GitSource) fixPermissions() error {
 	return cmd.Run()
 }
 
+// ResolveFloating will determine whether Ref is a branch without fetching
+// the repository. A full commit hash never floats, the refs of an existing
+// clone are used when they know Ref, and otherwise the upstream branches are
+// listed.
+func (g *GitSource) ResolveFloating(ctx context.Context) (bool, error) {
+	if commitPattern.MatchString(g.Ref) {
+		return false, nil
+	}
+
+	if PathExists(g.ClonePath) {
+		if _, err := g.revParse("refs/tags/" + g.Ref); err == nil {
+			return false, nil
+		}
+
+		if _, err := g.revParse("refs/remotes/origin/" + g.Ref); err == nil {
+			return true, nil
+		}
+	}
+
+	if err := CheckRemote(g.URI); err != nil {
+		return false, err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", g.URI, "refs/heads/"+g.Ref)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("unable to list branches of %s: %w", g.URI, err)
+	}
+
+	return len(strings.TrimSpace(string(out))) > 0, nil
+}
+
 // Fetch will attempt to download the git tree locally. If it already exists
 // then we'll make an attempt to update it.
-func (g *GitSource) Fetch() error {
+func (g *GitSource) Fetch(ctx context.Context) error {
+	if err := CheckRemote(g.URI); err != nil {
+		return err
+	}
+
 	// First things first, make sure we have a destination
 	if !PathExists(g.ClonePath) {
-		if err := g.clone(); err != nil {
+		if err := g.clone(ctx); err != nil {
 			return err
 		}
 	} else {
 		// Repo already exists locally, get the latest refs from origin
-		if err := g.updateRefs(); err != nil {
+		if err := g.updateRefs(ctx); err != nil {
 			return err
 		}
 	}
 
+	// Branches float, so they are resolved to a specific commit
+	_, err := g.revParse("refs/remotes/origin/" + g.Ref)
+	g.Floating = err == nil
+
 	// Checkout the ref we want
-	err := g.switchRef()
+	if g.Floating {
+		err = g.switchFloating()
+	} else {
+		err = g.switchRef()
+	}
+
 	if err != nil {
 		return err
 	}
 
+	if g.Commit, err = g.revParse("HEAD"); err != nil {
+		return err
+	}
+
 	// Update or checkout submodules
-	err = g.submodules()
+	err = g.submodules(ctx)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,105 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+)
+
+// An InsecurePolicy decides what happens to sources fetched over plain HTTP.
+type InsecurePolicy string
+
+const (
+	// InsecureWarn fetches plain HTTP sources with a warning.
+	InsecureWarn InsecurePolicy = "warn"
+
+	// InsecureDeny refuses to fetch plain HTTP sources.
+	InsecureDeny InsecurePolicy = "deny"
+
+	// InsecureAllow fetches plain HTTP sources silently.
+	InsecureAllow InsecurePolicy = "allow"
+)
+
+// ErrInsecureSource is returned when a plain HTTP source is denied.
+var ErrInsecureSource = errors.New("source is served over plain HTTP")
+
+var (
+	// HTTPPolicy is applied to sources that could not be fetched over HTTPS.
+	HTTPPolicy = InsecureWarn
+
+	// UpgradeHTTP controls whether plain HTTP sources are first attempted
+	// over HTTPS.
+	UpgradeHTTP = true
+)
+
+// ParseInsecurePolicy will return the policy with the given name. An empty
+// name is the default, InsecureWarn.
+func ParseInsecurePolicy(name string) (InsecurePolicy, error) {
+	switch policy := InsecurePolicy(name); policy {
+	case "":
+		return InsecureWarn, nil
+	case InsecureWarn, InsecureDeny, InsecureAllow:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid HTTP source policy: %s (expected warn, deny or allow)", name)
+	}
+}
+
+// IsInsecureURI determines whether the source would be fetched without TLS.
+func IsInsecureURI(uri *url.URL) bool {
+	return uri.Scheme == "http"
+}
+
+// httpsURI returns the URI of the source with the scheme upgraded to HTTPS.
+func httpsURI(uri *url.URL) string {
+	upgraded := *uri
+	upgraded.Scheme = "https"
+
+	return upgraded.String()
+}
+
+// downloadInsecure will fetch a plain HTTP source, first trying HTTPS when
+// enabled, and otherwise applying the HTTPPolicy.
+func (s *SimpleSource) downloadInsecure(ctx context.Context, destination string) error {
+	if UpgradeHTTP {
+		uri := httpsURI(s.url)
+
+		err := s.downloadURI(ctx, destination, uri)
+		if err == nil {
+			slog.Info("Fetched plain HTTP source over HTTPS", "uri", uri)
+			return nil
+		}
+
+		slog.Debug("Unable to fetch source over HTTPS, falling back", "uri", uri, "err", err)
+		os.Remove(destination)
+	}
+
+	switch HTTPPolicy {
+	case InsecureDeny:
+		return fmt.Errorf("%w: %s", ErrInsecureSource, s.URI)
+	case InsecureWarn:
+		slog.Warn("Fetching source over plain HTTP, consider using HTTPS", "uri", s.URI)
+	case InsecureAllow:
+	}
+
+	return s.downloadURI(ctx, destination, s.URI)
+}
@@ -17,18 +17,32 @@
 package source
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-const (
+// DefaultSourceDir is where sources are stored unless configured otherwise.
+const DefaultSourceDir = "/var/lib/solbuild/sources"
+
+var (
 	// SourceDir is where we store all tarballs.
-	SourceDir = "/var/lib/solbuild/sources"
+	SourceDir = DefaultSourceDir
 
 	// SourceStagingDir is where we initially fetch downloads.
-	SourceStagingDir = "/var/lib/solbuild/sources/staging"
+	SourceStagingDir = filepath.Join(DefaultSourceDir, "staging")
 )
 
+// SetSourceDir relocates the stored sources, along with the staging,
+// quarantine and git directories beneath it.
+func SetSourceDir(dir string) {
+	SourceDir = dir
+	SourceStagingDir = filepath.Join(dir, "staging")
+	SourceQuarantineDir = filepath.Join(dir, "quarantine")
+	GitSourceDir = filepath.Join(dir, "git")
+}
+
 // A BindConfiguration is used by a source as a way to express bind
 // mounts required for a given source.
 //
@@ -53,7 +67,8 @@ type Source interface {
 	IsFetched() bool
 
 	// Fetch will attempt to fetch the this source locally and cache it.
-	Fetch() error
+	// Cancelling ctx will abandon the fetch.
+	Fetch(ctx context.Context) error
 
 	// GetBindConfiguration should return a valid configuration specifying
 	// the origin on our local filesystem, and the target within the container.
@@ -74,8 +89,17 @@ type Source interface {
 // The legacy argument will determine whether special care should be taken
 // for legacy packages (i.e. sha1sum vs sha256sum).
 //
+// Schemes other than the builtin ones may be provided by a Factory passed to
+// Register, or by a helper executable in HelperDirs.
+//
 // In all cases, New will fallback to the SimpleSource implementation.
 func New(uri, validator string, legacy bool) (Source, error) { //nolint:ireturn // can return multiple implementations
+	if !isBuiltinScheme(uri) {
+		if src, err := newPlugin(uri, validator, legacy); src != nil || err != nil {
+			return src, err
+		}
+	}
+
 	if legacy {
 		return NewSimple(uri, validator, legacy)
 	}
@@ -87,6 +111,17 @@ func New(uri, validator string, legacy bool) (Source, error) { //nolint:ireturn
 	return NewSimple(uri, validator, legacy)
 }
 
+// isBuiltinScheme determines whether the URI is handled by solbuild itself.
+func isBuiltinScheme(uri string) bool {
+	for _, prefix := range []string{"http://", "https://", "ftp://", "file://", "git|"} {
+		if strings.HasPrefix(uri, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // PathExists is a helper function to determine the existence of a file path.
 func PathExists(path string) bool {
 	if st, err := os.Stat(path); err == nil && st != nil {
@@ -0,0 +1,169 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// HelperPrefix is the prefix of executables implementing a source scheme,
+// followed by the scheme name, e.g. solbuild-source-s3.
+const HelperPrefix = "solbuild-source-"
+
+// HelperDirs are searched in order for source helper executables.
+var HelperDirs = []string{
+	"/etc/solbuild/sources",
+	"/usr/lib/solbuild/sources",
+}
+
+// A Factory creates a Source for a URI with a custom scheme. It receives the
+// same arguments as New.
+type Factory func(uri, validator string, legacy bool) (Source, error)
+
+var (
+	factories     = make(map[string]Factory)
+	factoriesLock sync.RWMutex
+)
+
+// Register will make a custom source scheme available to New. This allows
+// programs embedding solbuild to support new schemes, such as s3://, without
+// patching solbuild. Registering a scheme again replaces the previous Factory.
+func Register(scheme string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	factories[scheme] = factory
+}
+
+// lookupFactory returns the Factory registered for the scheme, if any.
+func lookupFactory(scheme string) Factory {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	return factories[scheme]
+}
+
+// FindHelper returns the path of the helper executable for the scheme, or an
+// empty string if there is none.
+func FindHelper(scheme string) string {
+	for _, dir := range HelperDirs {
+		path := filepath.Join(dir, HelperPrefix+scheme)
+
+		if st, err := os.Stat(path); err == nil && st.Mode().IsRegular() && st.Mode()&0o111 != 0 {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// newPlugin returns a source from a registered Factory or helper executable
+// for the URI scheme, or nil if the scheme is not provided by either.
+func newPlugin(uri, validator string, legacy bool) (Source, error) { //nolint:ireturn // plugins provide any implementation
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return nil, nil //nolint:nilnil // not a plugin URI, fall through to the builtin sources
+	}
+
+	if factory := lookupFactory(u.Scheme); factory != nil {
+		return factory(uri, validator, legacy)
+	}
+
+	if helper := FindHelper(u.Scheme); helper != "" {
+		return NewHelper(uri, validator, legacy, helper)
+	}
+
+	return nil, nil //nolint:nilnil // not a plugin URI, fall through to the builtin sources
+}
+
+// HelperRequest is written as JSON to the stdin of a source helper.
+type HelperRequest struct {
+	URI         string `json:"uri"`         // Source URI as written in the package
+	Destination string `json:"destination"` // File the helper must write the source to
+	Validator   string `json:"validator"`   // Expected sha256sum, or sha1sum for legacy
+}
+
+// HelperResponse may be written as JSON to the stdout of a source helper to
+// explain a failure.
+type HelperResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// NewHelper creates a source fetched by an external helper executable. The
+// source is otherwise cached, validated and bound just as a SimpleSource.
+func NewHelper(uri, validator string, legacy bool, helper string) (*SimpleSource, error) {
+	s, err := NewSimple(uri, validator, legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	s.fetcher = func(ctx context.Context, destination string) error {
+		return runHelper(ctx, helper, &HelperRequest{URI: uri, Destination: destination, Validator: validator})
+	}
+
+	return s, nil
+}
+
+// runHelper executes the helper with the request, surfacing any error it
+// reports in its response.
+func runHelper(ctx context.Context, helper string, req *HelperRequest) error {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Fetching source with helper", "helper", filepath.Base(helper), "uri", req.URI)
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, helper)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stdout
+
+	runErr := cmd.Run()
+
+	var resp HelperResponse
+	if out.Len() > 0 {
+		if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+			return fmt.Errorf("Invalid response from source helper %s, reason: %w", helper, err)
+		}
+	}
+
+	if resp.Error != "" {
+		return fmt.Errorf("Source helper %s failed: %s", helper, resp.Error)
+	}
+
+	if runErr != nil {
+		return fmt.Errorf("Source helper %s failed, reason: %w", helper, runErr)
+	}
+
+	if !PathExists(req.Destination) {
+		return fmt.Errorf("Source helper %s did not write %s", helper, req.Destination)
+	}
+
+	return nil
+}
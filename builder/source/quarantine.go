@@ -0,0 +1,130 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package source
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SourceQuarantineDir is where downloads that fail validation are kept for
+// review, such as when an upstream re-rolls a tarball.
+var SourceQuarantineDir = filepath.Join(DefaultSourceDir, "quarantine")
+
+// ErrChecksumMismatch is returned when a download does not match the hash
+// of the source.
+var ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+// A ChecksumMismatch describes a download that did not match the expected
+// hash of the source. The download is kept in quarantine, and may be
+// accepted to use it in place of the expected source.
+type ChecksumMismatch struct {
+	URI          string // URI of the source
+	Expected     string // Hash of the source
+	Actual       string // Hash of the download
+	Size         int64  // Size of the download
+	PreviousSize int64  // Size of the expected source, or -1 if it is not cached
+	Quarantine   string // Path of the quarantined download
+
+	source *SimpleSource
+}
+
+// Error describes the mismatch.
+func (m *ChecksumMismatch) Error() string {
+	return fmt.Sprintf("%s for %s: got %s, expected %s", ErrChecksumMismatch, m.URI, m.Actual, m.Expected)
+}
+
+// Unwrap allows the mismatch to be matched with ErrChecksumMismatch.
+func (m *ChecksumMismatch) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+// SizeDelta returns the difference in size between the download and the
+// expected source, if the expected source is still cached.
+func (m *ChecksumMismatch) SizeDelta() (int64, bool) {
+	if m.PreviousSize < 0 {
+		return 0, false
+	}
+
+	return m.Size - m.PreviousSize, true
+}
+
+// Accept will move the quarantined download into the source cache, and use
+// it as the source from now on. Only package.yml sources may be accepted.
+func (m *ChecksumMismatch) Accept() error {
+	dir := filepath.Join(SourceDir, m.Actual)
+	if err := os.MkdirAll(dir, 0o0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(m.Quarantine, filepath.Join(dir, m.source.File)); err != nil {
+		return err
+	}
+
+	os.Remove(filepath.Dir(m.Quarantine))
+
+	m.source.validator = m.Actual
+
+	return nil
+}
+
+// quarantine will move a download that failed validation out of staging,
+// describing how it differs from the expected source.
+func (s *SimpleSource) quarantine(path string) error {
+	checksum := s.GetSHA256Sum
+	if s.legacy {
+		checksum = s.GetSHA1Sum
+	}
+
+	actual, err := checksum(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(SourceQuarantineDir, actual)
+	if err = os.MkdirAll(dir, 0o0755); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, s.File)
+	if err = os.Rename(path, dest); err != nil {
+		return err
+	}
+
+	st, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+
+	mismatch := &ChecksumMismatch{
+		URI:          s.URI,
+		Expected:     s.validator,
+		Actual:       actual,
+		Size:         st.Size(),
+		PreviousSize: -1,
+		Quarantine:   dest,
+		source:       s,
+	}
+
+	if st, err := os.Stat(s.GetPath(s.validator)); err == nil {
+		mismatch.PreviousSize = st.Size()
+	}
+
+	return mismatch
+}
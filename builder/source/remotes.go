@@ -0,0 +1,196 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package source
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// A RemotePolicy decides what happens when a git remote contacted on the
+// host, such as a submodule, is not permitted by AllowedRemotes and
+// DeniedRemotes.
+type RemotePolicy string
+
+const (
+	// RemoteWarn contacts disallowed remotes with a warning.
+	RemoteWarn RemotePolicy = "warn"
+
+	// RemoteEnforce refuses to contact disallowed remotes.
+	RemoteEnforce RemotePolicy = "enforce"
+
+	// RemoteIgnore contacts every remote, only reporting them.
+	RemoteIgnore RemotePolicy = "off"
+)
+
+// ErrRemoteDenied is returned when a disallowed remote is required.
+var ErrRemoteDenied = errors.New("remote host is not allowed")
+
+var (
+	// GitRemotePolicy is applied to every git remote contacted on the host.
+	GitRemotePolicy = RemoteWarn
+
+	// AllowedRemotes are the domains git remotes may be fetched from. Each
+	// also permits its subdomains. When empty, every domain not denied is
+	// allowed.
+	AllowedRemotes []string
+
+	// DeniedRemotes are the domains git remotes may never be fetched from,
+	// along with their subdomains. These take precedence over AllowedRemotes.
+	DeniedRemotes []string
+)
+
+// A ContactedRemote is a remote contacted while fetching sources.
+type ContactedRemote struct {
+	URI     string // Remote as given to git
+	Host    string // Host of the remote, empty for a local path
+	Allowed bool   // Whether the host is permitted by the lists
+}
+
+var (
+	contacted     []ContactedRemote
+	contactedLock sync.Mutex
+)
+
+// ParseRemotePolicy will return the policy with the given name. An empty
+// name is the default, RemoteWarn.
+func ParseRemotePolicy(name string) (RemotePolicy, error) {
+	switch policy := RemotePolicy(name); policy {
+	case "":
+		return RemoteWarn, nil
+	case RemoteWarn, RemoteEnforce, RemoteIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Invalid git remote policy: %s (expected warn, enforce or off)", name)
+	}
+}
+
+// RemoteHost returns the host of a git remote, which may be a URL or the
+// scp-like user@host:path syntax. Local paths have no host.
+func RemoteHost(uri string) (string, error) {
+	if strings.Contains(uri, "://") {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return "", err
+		}
+
+		if parsed.Scheme == "file" {
+			return "", nil
+		}
+
+		if parsed.Hostname() == "" {
+			return "", fmt.Errorf("remote has no host: %s", uri)
+		}
+
+		return strings.ToLower(parsed.Hostname()), nil
+	}
+
+	// git treats a colon before any slash as the scp-like syntax
+	colon := strings.Index(uri, ":")
+	if colon < 0 || strings.Contains(uri[:colon], "/") {
+		return "", nil
+	}
+
+	host := uri[:colon]
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return "", fmt.Errorf("remote has no host: %s", uri)
+	}
+
+	return strings.ToLower(host), nil
+}
+
+// matchesDomain determines whether the host is one of the domains, or one
+// of their subdomains.
+func matchesDomain(host string, domains []string) bool {
+	return slices.ContainsFunc(domains, func(domain string) bool {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	})
+}
+
+// RemoteAllowed determines whether the lists permit fetching from the host.
+// Local paths are always allowed.
+func RemoteAllowed(host string) bool {
+	switch {
+	case host == "":
+		return true
+	case matchesDomain(host, DeniedRemotes):
+		return false
+	case len(AllowedRemotes) == 0:
+		return true
+	default:
+		return matchesDomain(host, AllowedRemotes)
+	}
+}
+
+// CheckRemote records the git remote as contacted, and applies the
+// GitRemotePolicy when its host is not allowed. An error is returned if the
+// remote must not be contacted.
+func CheckRemote(uri string) error {
+	host, err := RemoteHost(uri)
+	if err != nil {
+		return err
+	}
+
+	allowed := RemoteAllowed(host)
+
+	contactedLock.Lock()
+	contacted = append(contacted, ContactedRemote{URI: uri, Host: host, Allowed: allowed})
+	contactedLock.Unlock()
+
+	if allowed || GitRemotePolicy == RemoteIgnore {
+		slog.Info("Contacting git remote", "host", host, "uri", uri)
+		return nil
+	}
+
+	if GitRemotePolicy == RemoteEnforce {
+		return fmt.Errorf("%w: %s (%s)", ErrRemoteDenied, host, uri)
+	}
+
+	slog.Warn("Contacting git remote that is not allowed", "host", host, "uri", uri)
+
+	return nil
+}
+
+// ContactedRemotes returns every remote checked since the last call to
+// ResetContactedRemotes, in the order they were checked. Remotes refused by
+// the policy are included.
+func ContactedRemotes() []ContactedRemote {
+	contactedLock.Lock()
+	defer contactedLock.Unlock()
+
+	return slices.Clone(contacted)
+}
+
+// ResetContactedRemotes forgets the remotes contacted so far.
+func ResetContactedRemotes() {
+	contactedLock.Lock()
+	defer contactedLock.Unlock()
+
+	contacted = nil
+}
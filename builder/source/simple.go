@@ -17,9 +17,11 @@
 package source
 
 import (
+	"context"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -44,7 +46,8 @@ type SimpleSource struct {
 	legacy    bool   // If this is ypkg or not
 	validator string // Validation key for this source
 
-	url *url.URL
+	url     *url.URL
+	fetcher func(ctx context.Context, destination string) error // Custom download, e.g. a source helper
 }
 
 // NewSimple will create a new source instance.
@@ -125,11 +128,24 @@ func (s *SimpleSource) IsFetched() bool {
 }
 
 // download downloads simple files using go grab.
-func (s *SimpleSource) download(destination string) error {
+func (s *SimpleSource) download(ctx context.Context, destination string) error {
+	if s.fetcher != nil {
+		return s.fetchCustom(ctx, destination)
+	}
+
 	if IsFileURI(s.url) {
 		return CopyFile(s.url.Path, destination)
 	}
 
+	if IsInsecureURI(s.url) {
+		return s.downloadInsecure(ctx, destination)
+	}
+
+	return s.downloadURI(ctx, destination, s.URI)
+}
+
+// downloadURI downloads the source from the given URI using go grab.
+func (s *SimpleSource) downloadURI(ctx context.Context, destination, uri string) error {
 	// Some web servers (*cough* sourceforge) have strange redirection behavior. It's possible to work around this by clearing the Referer header on every redirect
 	headHttpClient := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -147,14 +163,19 @@ func (s *SimpleSource) download(destination string) error {
 	}
 
 	// Do a HEAD request, following all redirects until we get the final URL.
-	headResp, err := headHttpClient.Head(s.URI)
+	headReq, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, nil)
+	if err != nil {
+		return err
+	}
+
+	headResp, err := headHttpClient.Do(headReq)
 	if err != nil {
 		return err
 	}
 	defer headResp.Body.Close()
 
 	finalURL := headResp.Request.URL.String()
-	if s.URI != finalURL {
+	if uri != finalURL {
 		slog.Info("Source URL redirected", "uri", finalURL)
 	}
 
@@ -163,6 +184,8 @@ func (s *SimpleSource) download(destination string) error {
 		return err
 	}
 
+	req = req.WithContext(ctx)
+
 	// Indicate that we will accept any response content-type. Some servers will fail without this (like netfilter.org)
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Accept#sect1
 	req.HTTPRequest.Header.Add("Accept", "*/*")
@@ -200,11 +223,35 @@ func (s *SimpleSource) download(destination string) error {
 	s.showProgress(resp)
 
 	if err := resp.Err(); err != nil {
-		slog.Error("Error downloading", "uri", s.URI, "err", err)
+		slog.Error("Error downloading", "uri", uri, "err", err)
+
+		return err
+	}
 
+	return nil
+}
+
+// fetchCustom downloads with the custom fetcher, which cannot be trusted to
+// validate the source itself.
+func (s *SimpleSource) fetchCustom(ctx context.Context, destination string) error {
+	if err := s.fetcher(ctx, destination); err != nil {
+		return err
+	}
+
+	checksum := s.GetSHA256Sum
+	if s.legacy {
+		checksum = s.GetSHA1Sum
+	}
+
+	sum, err := checksum(destination)
+	if err != nil {
 		return err
 	}
 
+	if !strings.EqualFold(sum, s.validator) {
+		return ErrChecksumMismatch
+	}
+
 	return nil
 }
 
@@ -246,7 +293,7 @@ func (s *SimpleSource) showProgress(resp *grab.Response) {
 }
 
 // Fetch will download the given source and cache it locally.
-func (s *SimpleSource) Fetch() error {
+func (s *SimpleSource) Fetch(ctx context.Context) error {
 	// Now go and download it
 	slog.Debug("Downloading source", "uri", s.URI)
 
@@ -259,8 +306,12 @@ func (s *SimpleSource) Fetch() error {
 		}
 	}
 
-	// Grab the file
-	if err := s.download(destPath); err != nil {
+	// Grab the file, keeping it for review if it doesn't match
+	if err := s.download(ctx, destPath); err != nil {
+		if errors.Is(err, grab.ErrBadChecksum) || errors.Is(err, ErrChecksumMismatch) {
+			return s.quarantine(destPath)
+		}
+
 		return err
 	}
 
@@ -0,0 +1,382 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+type fakeSource struct {
+	source.SimpleSource
+}
+
+func TestRegisterSource(t *testing.T) {
+	fake := &fakeSource{}
+
+	source.Register("artifactory", func(uri, validator string, legacy bool) (source.Source, error) {
+		return fake, nil
+	})
+
+	src, err := source.New("artifactory://store/foo-1.0.tar.xz", "abc", false)
+	if err != nil {
+		t.Fatalf("Failed to create registered source: %v", err)
+	}
+
+	if src != fake {
+		t.Fatalf("Registered factory was not used, got %T", src)
+	}
+
+	// Builtin schemes can't be taken over
+	source.Register("https", func(uri, validator string, legacy bool) (source.Source, error) {
+		return fake, nil
+	})
+
+	if src, _ = source.New("https://example.com/foo-1.0.tar.xz", "abc", false); src == fake {
+		t.Fatal("Builtin scheme was replaced by a plugin")
+	}
+}
+
+func TestSourceHelper(t *testing.T) {
+	dir := t.TempDir()
+	helper := filepath.Join(dir, source.HelperPrefix+"s3")
+
+	if err := os.WriteFile(helper, []byte("#!/bin/sh\nexit 0\n"), 0o0755); err != nil {
+		t.Fatalf("Failed to write helper: %v", err)
+	}
+
+	orig := source.HelperDirs
+	source.HelperDirs = []string{dir}
+
+	defer func() { source.HelperDirs = orig }()
+
+	if found := source.FindHelper("s3"); found != helper {
+		t.Fatalf("Wrong helper found: %s", found)
+	}
+
+	src, err := source.New("s3://bucket/nano-8.0.tar.xz", "abc", false)
+	if err != nil {
+		t.Fatalf("Failed to create helper source: %v", err)
+	}
+
+	simple, ok := src.(*source.SimpleSource)
+	if !ok || simple.File != "nano-8.0.tar.xz" {
+		t.Fatalf("Unexpected helper source: %#v", src)
+	}
+
+	if source.FindHelper("gcs") != "" {
+		t.Fatal("Found helper for unknown scheme")
+	}
+}
+
+func TestInsecurePolicy(t *testing.T) {
+	for _, name := range []string{"warn", "deny", "allow"} {
+		if policy, err := source.ParseInsecurePolicy(name); err != nil || string(policy) != name {
+			t.Fatalf("Failed to parse policy %s: %v", name, err)
+		}
+	}
+
+	if policy, _ := source.ParseInsecurePolicy(""); policy != source.InsecureWarn {
+		t.Fatalf("Expected the default policy to warn, got %s", policy)
+	}
+
+	if _, err := source.ParseInsecurePolicy("block"); err == nil {
+		t.Fatal("Unknown policy should not be accepted")
+	}
+
+	for uri, insecure := range map[string]bool{
+		"http://example.com/foo-1.0.tar.xz":  true,
+		"https://example.com/foo-1.0.tar.xz": false,
+		"file:///tmp/foo-1.0.tar.xz":         false,
+	} {
+		parsed, _ := url.Parse(uri)
+		if source.IsInsecureURI(parsed) != insecure {
+			t.Fatalf("Wrong insecure detection for %s", uri)
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	mismatch := &source.ChecksumMismatch{
+		URI:          "https://example.com/foo-1.0.tar.xz",
+		Expected:     "abc",
+		Actual:       "def",
+		Size:         2048,
+		PreviousSize: -1,
+	}
+
+	if !errors.Is(mismatch, source.ErrChecksumMismatch) {
+		t.Fatal("Mismatch does not match ErrChecksumMismatch")
+	}
+
+	if _, ok := mismatch.SizeDelta(); ok {
+		t.Fatal("Size delta reported without the previous source")
+	}
+
+	mismatch.PreviousSize = 2148
+
+	if delta, ok := mismatch.SizeDelta(); !ok || delta != -100 {
+		t.Fatalf("Expected a size delta of -100, got %d", delta)
+	}
+}
+
+func TestRemoteHost(t *testing.T) {
+	for uri, host := range map[string]string{
+		"https://github.com/getsolus/solbuild.git": "github.com",
+		"ssh://git@GitLab.com:2222/foo/bar.git":    "gitlab.com",
+		"git://git.kernel.org/pub/scm/git/git.git": "git.kernel.org",
+		"git@github.com:getsolus/solbuild.git":     "github.com",
+		"[git@codeberg.org]:foo/bar.git":           "codeberg.org",
+		"file:///srv/git/foo.git":                  "",
+		"/srv/git/foo.git":                         "",
+		"../foo/bar:baz.git":                       "",
+		"https://user@sub.example.com/foo/bar.git": "sub.example.com",
+	} {
+		if got, err := source.RemoteHost(uri); err != nil || got != host {
+			t.Fatalf("Wrong host for %s: %q (%v)", uri, got, err)
+		}
+	}
+
+	if _, err := source.RemoteHost("https:///foo.git"); err == nil {
+		t.Fatal("Remote without a host should not be accepted")
+	}
+}
+
+func TestRemotePolicy(t *testing.T) {
+	if policy, _ := source.ParseRemotePolicy(""); policy != source.RemoteWarn {
+		t.Fatalf("Expected the default policy to warn, got %s", policy)
+	}
+
+	if _, err := source.ParseRemotePolicy("deny"); err == nil {
+		t.Fatal("Unknown policy should not be accepted")
+	}
+
+	origPolicy, origAllowed, origDenied := source.GitRemotePolicy, source.AllowedRemotes, source.DeniedRemotes
+
+	defer func() {
+		source.GitRemotePolicy, source.AllowedRemotes, source.DeniedRemotes = origPolicy, origAllowed, origDenied
+	}()
+
+	source.AllowedRemotes = []string{"github.com", ".gnome.org"}
+	source.DeniedRemotes = []string{"evil.github.com"}
+
+	for host, allowed := range map[string]bool{
+		"github.com":          true,
+		"codeload.github.com": true,
+		"gitlab.gnome.org":    true,
+		"evil.github.com":     false,
+		"notgithub.com":       false,
+		"gitlab.com":          false,
+		"":                    true,
+	} {
+		if source.RemoteAllowed(host) != allowed {
+			t.Fatalf("Wrong allowed state for %q", host)
+		}
+	}
+
+	source.ResetContactedRemotes()
+	source.GitRemotePolicy = source.RemoteWarn
+
+	if err := source.CheckRemote("https://gitlab.com/foo/bar.git"); err != nil {
+		t.Fatalf("Disallowed remote should only warn: %v", err)
+	}
+
+	source.GitRemotePolicy = source.RemoteEnforce
+
+	if err := source.CheckRemote("https://github.com/foo/bar.git"); err != nil {
+		t.Fatalf("Allowed remote was refused: %v", err)
+	}
+
+	if err := source.CheckRemote("git@gitlab.com:foo/bar.git"); !errors.Is(err, source.ErrRemoteDenied) {
+		t.Fatalf("Expected the remote to be denied, got %v", err)
+	}
+
+	remotes := source.ContactedRemotes()
+	if len(remotes) != 3 || remotes[0].Allowed || !remotes[1].Allowed || remotes[2].Host != "gitlab.com" {
+		t.Fatalf("Unexpected contacted remotes: %+v", remotes)
+	}
+}
+
+func TestSubmoduleRemoteDenied(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream")
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", upstream}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=solbuild", "GIT_AUTHOR_EMAIL=solbuild@localhost",
+			"GIT_COMMITTER_NAME=solbuild", "GIT_COMMITTER_EMAIL=solbuild@localhost")
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+
+		return strings.TrimSpace(string(out))
+	}
+
+	if err := os.MkdirAll(upstream, 0o0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+
+	git("init", "--quiet")
+
+	modules := "[submodule \"vendor\"]\n\tpath = vendor\n\turl = https://git.denied.example/vendor.git\n"
+	if err := os.WriteFile(filepath.Join(upstream, ".gitmodules"), []byte(modules), 0o0644); err != nil {
+		t.Fatalf("Failed to write .gitmodules: %v", err)
+	}
+
+	git("add", ".gitmodules")
+	git("update-index", "--add", "--cacheinfo", "160000,"+strings.Repeat("a", 40)+",vendor")
+	git("commit", "--quiet", "-m", "Add vendor")
+
+	origPolicy, origDenied := source.GitRemotePolicy, source.DeniedRemotes
+
+	defer func() { source.GitRemotePolicy, source.DeniedRemotes = origPolicy, origDenied }()
+
+	source.GitRemotePolicy = source.RemoteEnforce
+	source.DeniedRemotes = []string{"denied.example"}
+
+	src := &source.GitSource{
+		URI:       upstream,
+		Ref:       git("rev-parse", "HEAD"),
+		ClonePath: filepath.Join(dir, "clone"),
+	}
+
+	if err := src.Fetch(context.Background()); !errors.Is(err, source.ErrRemoteDenied) {
+		t.Fatalf("Expected the submodule remote to be denied, got %v", err)
+	}
+}
+
+func TestSourceFetchCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never respond, as a stalled mirror would
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	origDir, origPolicy, origUpgrade := source.SourceDir, source.HTTPPolicy, source.UpgradeHTTP
+
+	defer func() {
+		source.SetSourceDir(origDir)
+		source.HTTPPolicy, source.UpgradeHTTP = origPolicy, origUpgrade
+	}()
+
+	source.SetSourceDir(t.TempDir())
+	source.HTTPPolicy, source.UpgradeHTTP = source.InsecureAllow, false
+
+	src, err := source.NewSimple(srv.URL+"/nano-8.0.tar.xz", strings.Repeat("0", 64), false)
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+
+	if err = src.Fetch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the fetch to be cancelled, got %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("Cancelled fetch took %s to return", elapsed)
+	}
+}
+
+func TestAcceptNewHash(t *testing.T) {
+	tarball := []byte("re-rolled nano tarball")
+	sum := sha256.Sum256(tarball)
+	actual := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	}))
+	defer srv.Close()
+
+	origDir, origPolicy, origUpgrade := source.SourceDir, source.HTTPPolicy, source.UpgradeHTTP
+
+	defer func() {
+		source.SetSourceDir(origDir)
+		source.HTTPPolicy, source.UpgradeHTTP = origPolicy, origUpgrade
+		builder.AcceptNewHash = false
+	}()
+
+	source.SetSourceDir(t.TempDir())
+	source.HTTPPolicy, source.UpgradeHTTP = source.InsecureAllow, false
+	builder.AcceptNewHash = true
+
+	orig, err := os.ReadFile(PackageTestFile)
+	if err != nil {
+		t.Fatalf("Failed to read test package: %v", err)
+	}
+
+	recipe := filepath.Join(t.TempDir(), "package.yml")
+	edited := strings.Replace(string(orig), "https://www.nano-editor.org/dist/v7/nano-7.2.tar.xz", srv.URL+"/nano-7.2.tar.xz", 1)
+
+	if err = os.WriteFile(recipe, []byte(edited), 0o0644); err != nil {
+		t.Fatalf("Failed to write test package: %v", err)
+	}
+
+	pkg, err := builder.NewPackage(recipe)
+	if err != nil {
+		t.Fatalf("Failed to load package: %v", err)
+	}
+
+	overlay := &builder.Overlay{MountPoint: t.TempDir()}
+
+	// Assets are copied into the root before the sources are fetched
+	if err = pkg.CopyAssets(nil, overlay); err != nil {
+		t.Fatalf("Failed to copy assets: %v", err)
+	}
+
+	if err = pkg.FetchSources(context.Background(), overlay); err != nil {
+		t.Fatalf("Expected the new hash to be accepted, got %v", err)
+	}
+
+	for _, path := range []string{recipe, filepath.Join(pkg.GetWorkDir(overlay), "package.yml")} {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read recipe: %v", err)
+		}
+
+		if !strings.Contains(string(contents), actual) {
+			t.Fatalf("Expected %s to have the accepted hash %s:\n%s", path, actual, contents)
+		}
+	}
+
+	if !pkg.Sources[0].IsFetched() {
+		t.Fatal("Expected the accepted source to be in place for the build")
+	}
+}
@@ -0,0 +1,174 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// SourceLockFile is the name of the lock file kept alongside package.yml,
+// recording the commits that floating git refs were resolved to.
+const SourceLockFile = "sources.lock"
+
+// ErrFloatingRef is returned in locked mode when a git source refers to a
+// branch that has no commit recorded in the lock file.
+var ErrFloatingRef = errors.New("git source refers to a branch with no locked commit")
+
+var (
+	// LockedSources controls whether floating git refs must be locked. When set,
+	// the lock file is used as is, and is never written.
+	LockedSources bool
+
+	// UpdateSourceLock controls whether floating git refs are resolved to the
+	// tip of their branch again, ignoring their locked commits, and the lock
+	// file updated with the result.
+	UpdateSourceLock bool
+)
+
+// A SourceLock records the commit resolved for each floating git source.
+type SourceLock struct {
+	Git map[string]string `yaml:"git"` // Mapping of source identifier to commit
+}
+
+// LoadSourceLock will read the lock file at the given path. A missing lock
+// file is not an error, and results in an empty lock.
+func LoadSourceLock(path string) (*SourceLock, error) {
+	lock := &SourceLock{Git: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s, reason: %w", path, err)
+	}
+
+	if lock.Git == nil {
+		lock.Git = make(map[string]string)
+	}
+
+	return lock, nil
+}
+
+// Save will write the lock file to the given path.
+func (l *SourceLock) Save(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	data = append([]byte("# Generated by solbuild, do not edit\n"), data...)
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// SourceLockPath returns the path of the lock file for this package.
+func (p *Package) SourceLockPath() string {
+	return filepath.Join(filepath.Dir(p.Path), SourceLockFile)
+}
+
+// gitSources returns all git sources of the package.
+func (p *Package) gitSources() (ret []*source.GitSource) {
+	for _, src := range p.Sources {
+		if git, ok := src.(*source.GitSource); ok {
+			ret = append(ret, git)
+		}
+	}
+
+	return ret
+}
+
+// applySourceLock will pin floating git sources to their locked commits,
+// unless the lock is being updated.
+func (p *Package) applySourceLock(lock *SourceLock) {
+	for _, git := range p.gitSources() {
+		if UpdateSourceLock {
+			git.Locked = ""
+			continue
+		}
+
+		git.Locked = lock.Git[git.GetIdentifier()]
+	}
+}
+
+// CheckSourceLock will ensure that every git source referring to a branch
+// has a locked commit, before any of them are fetched.
+func (p *Package) CheckSourceLock(ctx context.Context, lock *SourceLock) error {
+	for _, git := range p.gitSources() {
+		id := git.GetIdentifier()
+		if lock.Git[id] != "" {
+			continue
+		}
+
+		floating, err := git.ResolveFloating(ctx)
+		if err != nil {
+			return err
+		}
+
+		if floating {
+			return fmt.Errorf("%w: %s", ErrFloatingRef, id)
+		}
+	}
+
+	return nil
+}
+
+// updateSourceLock will record the commits that floating git sources were
+// resolved to, writing the lock file if anything changed. In locked mode any
+// floating source without a locked commit is an error instead.
+func (p *Package) updateSourceLock(lock *SourceLock) error {
+	changed := false
+
+	for _, git := range p.gitSources() {
+		if !git.Floating {
+			continue
+		}
+
+		id := git.GetIdentifier()
+
+		if LockedSources && git.Locked == "" {
+			return fmt.Errorf("%w: %s", ErrFloatingRef, id)
+		}
+
+		slog.Info("Resolved floating git ref", "source", id, "commit", git.Commit)
+
+		if lock.Git[id] != git.Commit {
+			lock.Git[id] = git.Commit
+			changed = true
+		}
+	}
+
+	if !changed || LockedSources {
+		return nil
+	}
+
+	return lock.Save(p.SourceLockPath())
+}
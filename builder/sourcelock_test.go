@@ -0,0 +1,111 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+func TestSourceLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), builder.SourceLockFile)
+
+	lock, err := builder.LoadSourceLock(path)
+	if err != nil {
+		t.Fatalf("Missing lock file should not be an error: %v", err)
+	}
+
+	if len(lock.Git) != 0 {
+		t.Fatalf("Expected an empty lock, got %v", lock.Git)
+	}
+
+	id := "https://github.com/getsolus/solbuild.git#main"
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	lock.Git[id] = commit
+
+	if err = lock.Save(path); err != nil {
+		t.Fatalf("Failed to save lock file: %v", err)
+	}
+
+	lock, err = builder.LoadSourceLock(path)
+	if err != nil {
+		t.Fatalf("Failed to load lock file: %v", err)
+	}
+
+	if lock.Git[id] != commit {
+		t.Fatalf("Expected locked commit %s, got %s", commit, lock.Git[id])
+	}
+}
+
+func TestCheckSourceLock(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream")
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", upstream}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=solbuild", "GIT_AUTHOR_EMAIL=solbuild@localhost",
+			"GIT_COMMITTER_NAME=solbuild", "GIT_COMMITTER_EMAIL=solbuild@localhost")
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+
+		return strings.TrimSpace(string(out))
+	}
+
+	if err := os.MkdirAll(upstream, 0o0755); err != nil {
+		t.Fatalf("Failed to create upstream: %v", err)
+	}
+
+	git("init", "--quiet", "--initial-branch=main")
+	git("commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+	git("tag", "v1.0")
+
+	newSource := func(ref string) *source.GitSource {
+		return &source.GitSource{URI: upstream, Ref: ref, ClonePath: filepath.Join(dir, "clone")}
+	}
+
+	branch := newSource("main")
+	pkg := &builder.Package{Sources: []source.Source{newSource("v1.0"), newSource(git("rev-parse", "HEAD")), branch}}
+
+	lock := &builder.SourceLock{Git: make(map[string]string)}
+	if err := pkg.CheckSourceLock(context.Background(), lock); !errors.Is(err, builder.ErrFloatingRef) {
+		t.Fatalf("Expected the unlocked branch to be refused before fetching, got %v", err)
+	}
+
+	if builder.PathExists(branch.ClonePath) {
+		t.Fatal("The source was fetched before the lock was checked")
+	}
+
+	lock.Git[branch.GetIdentifier()] = git("rev-parse", "HEAD")
+	if err := pkg.CheckSourceLock(context.Background(), lock); err != nil {
+		t.Fatalf("Expected the locked branch to be accepted, got %v", err)
+	}
+}
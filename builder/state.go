@@ -0,0 +1,127 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// StateDirectory is where the persistent state of packages is kept, laid out
+// as $profile/$package, set from state_dir in the configuration.
+var StateDirectory = DefaultStateDirectory
+
+const (
+	// DefaultStateDirectory is where persistent state is kept unless
+	// configured otherwise.
+	DefaultStateDirectory = "/var/lib/solbuild/state"
+
+	// StateEnv is set to the location of the persistent state within the
+	// build.
+	StateEnv = "SOLBUILD_STATE_DIR"
+)
+
+// StateDir is the chroot-internal directory of the persistent state.
+var StateDir = path.Join(BuildUserHome, ".state")
+
+var (
+	// IgnoreState will skip the persistent state of the package, for a
+	// clean build.
+	IgnoreState = false
+
+	// StateMaxSize is the size the persistent state of a package may grow
+	// to before it is discarded, empty for no limit.
+	StateMaxSize = ""
+)
+
+// GetStateSource returns the host directory of the persistent state of this
+// package when built with the given profile.
+func (p *Package) GetStateSource(profile string) string {
+	return filepath.Join(StateDirectory, profile, p.Name)
+}
+
+// checkStateSize will discard the persistent state once it has outgrown
+// StateMaxSize, so that it cannot grow without bound.
+func checkStateSize(dir string) error {
+	if StateMaxSize == "" {
+		return nil
+	}
+
+	limit, err := ParseByteSize(StateMaxSize)
+	if err != nil {
+		return err
+	}
+
+	size, err := DirSize(dir)
+	if err != nil || size <= limit {
+		return err
+	}
+
+	slog.Warn("Persistent state exceeds its size limit, discarding it", "dir", dir, "size", size,
+		"limit", StateMaxSize)
+
+	return os.RemoveAll(dir)
+}
+
+// BindState will make the persistent state of the package available to the
+// build, if the package has opted in to it.
+func (p *Package) BindState(o *Overlay) error {
+	if o.StateSource == "" {
+		return nil
+	}
+
+	if IgnoreState {
+		slog.Info("Ignoring the persistent state of the package for a clean build")
+		return nil
+	}
+
+	if err := checkStateSize(o.StateSource); err != nil {
+		return fmt.Errorf("Failed to check persistent state, reason: %w\n", err)
+	}
+
+	if !PathExists(o.StateSource) {
+		if err := os.MkdirAll(o.StateSource, 0o0755); err != nil {
+			return fmt.Errorf("Failed to create persistent state directory, reason: %w\n", err)
+		}
+
+		if err := os.Chown(o.StateSource, BuildUserID, BuildUserGID); err != nil {
+			return fmt.Errorf("Failed to set persistent state permissions, reason: %w\n", err)
+		}
+	}
+
+	target, err := o.secureDir(filepath.Join(o.MountPoint, StateDir[1:]), 0o0755)
+	if err != nil {
+		return fmt.Errorf("Failed to create persistent state target, reason: %w\n", err)
+	}
+
+	slog.Info("Using the persistent state of the package", "dir", o.StateSource)
+
+	if err := disk.GetMountManager().BindMount(o.StateSource, target); err != nil {
+		return fmt.Errorf("Failed to bind mount persistent state, reason: %w\n", err)
+	}
+
+	o.ExtraMounts = append(o.ExtraMounts, target)
+
+	ChrootEnvironment = append(ChrootEnvironment, fmt.Sprintf("%s=%s", StateEnv, StateDir))
+
+	return nil
+}
@@ -0,0 +1,43 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrStrict is returned when a warning is treated as an error in strict mode.
+var ErrStrict = errors.New("Warning treated as an error in strict mode")
+
+// StrictMode turns selected warnings into build failures, for CI builds
+// that must enforce them.
+var StrictMode = false
+
+// strictWarn will log the warning, returning an error wrapping ErrStrict
+// instead when running in strict mode.
+func strictWarn(msg string, args ...any) error {
+	if !StrictMode {
+		slog.Warn(msg, args...)
+		return nil
+	}
+
+	slog.Error(msg, args...)
+
+	return fmt.Errorf("%w: %s", ErrStrict, msg)
+}
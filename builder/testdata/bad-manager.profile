@@ -0,0 +1,2 @@
+image = "unstable-x86_64"
+package_manager = "apt"
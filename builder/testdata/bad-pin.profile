@@ -0,0 +1,7 @@
+image = "unstable-x86_64"
+
+[repo.Indexed]
+uri = "testdata/pinned"
+local = true
+autoindex = true
+index_sha256 = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
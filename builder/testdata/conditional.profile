@@ -0,0 +1,12 @@
+image = "unstable-x86_64"
+
+add_repos = ["Solus"]
+
+[repo.Solus]
+uri = "https://mirrors.rit.edu/solus/packages/unstable/eopkg-index.xml.xz"
+
+# Only enabled when building Haskell packages
+[repo.Haskell]
+uri = "/var/lib/haskell-repo"
+local = true
+packages = ["haskell-*", "ghc"]
@@ -0,0 +1,6 @@
+image = "unstable-x86_64"
+
+[repo.Pinned]
+uri = "testdata/pinned"
+local = true
+index_sha256 = "2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE"
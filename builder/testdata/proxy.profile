@@ -0,0 +1,6 @@
+image = "unstable-x86_64"
+
+[proxy]
+http = "http://proxy.example.com:3128"
+https = "http://proxy.example.com:3128"
+no_proxy = "localhost,.example.com"
@@ -0,0 +1,4 @@
+image = "unstable-x86_64"
+
+# Manage the image with sol rather than eopkg
+package_manager = "sol"
@@ -0,0 +1,246 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+const (
+	// TestResultsSuffix replaces the build log suffix to give the path of the
+	// stored test results for that build.
+	TestResultsSuffix = ".tests.json"
+
+	// TestLogsSuffix replaces the build log suffix to give the directory the
+	// test logs of that build are kept in.
+	TestLogsSuffix = ".tests"
+)
+
+// testLogNames are the logs written by the test harnesses we understand.
+var testLogNames = []string{
+	"test-suite.log", // automake
+	"LastTest.log",   // ctest
+	"testlog.txt",    // meson
+}
+
+var (
+	// automakeCount matches a line of the automake test suite summary,
+	// e.g. "# PASS:  10".
+	automakeCount = regexp.MustCompile(`^# (TOTAL|PASS|SKIP|XFAIL|FAIL|XPASS|ERROR):\s+(\d+)$`)
+
+	// ctestSummary matches the ctest summary, e.g.
+	// "95% tests passed, 2 tests failed out of 40".
+	ctestSummary = regexp.MustCompile(`^\d+% tests passed, (\d+) tests? failed out of (\d+)$`)
+
+	// mesonCount matches a line of the meson test summary, e.g. "Ok: 10".
+	mesonCount = regexp.MustCompile(`^(Ok|Expected Fail|Fail|Unexpected Pass|Skipped|Timeout):\s+(\d+)$`)
+
+	// pytestSummary matches the pytest summary, e.g.
+	// "==== 1 failed, 10 passed, 2 skipped in 3.21s ====".
+	pytestSummary = regexp.MustCompile(`^=+ (.+) in [\d.]+s(?: \([^)]*\))? =+$`)
+
+	// pytestCount matches a single count within the pytest summary.
+	pytestCount = regexp.MustCompile(`(\d+) (passed|failed|errors?|skipped|xfailed|xpassed)`)
+)
+
+// A TestResult is the outcome of a single test suite run during the build.
+type TestResult struct {
+	Harness string `json:"harness"` // automake, ctest, meson or pytest
+	Passed  int    `json:"passed"`
+	Failed  int    `json:"failed"`
+	Skipped int    `json:"skipped"`
+}
+
+// String returns the outcome, e.g. "pytest: 10 passed, 1 failed, 2 skipped".
+func (t TestResult) String() string {
+	return fmt.Sprintf("%s: %d passed, %d failed, %d skipped", t.Harness, t.Passed, t.Failed, t.Skipped)
+}
+
+// ParseTestResults will find the summaries of the test suites run within the
+// output of a build, in the order they were run.
+func ParseTestResults(r io.Reader) ([]TestResult, error) {
+	var results []TestResult
+
+	// current is the result whose summary spans several lines, if any
+	var current *TestResult
+
+	// start will begin a new result from the given harness
+	start := func(harness string) *TestResult {
+		results = append(results, TestResult{Harness: harness})
+		return &results[len(results)-1]
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(ansiEscape.ReplaceAllString(scanner.Text(), ""))
+
+		if m := automakeCount.FindStringSubmatch(line); m != nil {
+			count, _ := strconv.Atoi(m[2])
+
+			switch m[1] {
+			case "TOTAL":
+				current = start("automake")
+			case "PASS", "XFAIL":
+				if current != nil {
+					current.Passed += count
+				}
+			case "SKIP":
+				if current != nil {
+					current.Skipped += count
+				}
+			default:
+				if current != nil {
+					current.Failed += count
+				}
+			}
+
+			continue
+		}
+
+		if m := mesonCount.FindStringSubmatch(line); m != nil {
+			count, _ := strconv.Atoi(m[2])
+
+			switch m[1] {
+			case "Ok":
+				current = start("meson")
+				current.Passed += count
+			case "Expected Fail":
+				if current != nil {
+					current.Passed += count
+				}
+			case "Skipped":
+				if current != nil {
+					current.Skipped += count
+				}
+			default:
+				if current != nil {
+					current.Failed += count
+				}
+			}
+
+			continue
+		}
+
+		current = nil
+
+		if m := ctestSummary.FindStringSubmatch(line); m != nil {
+			failed, _ := strconv.Atoi(m[1])
+			total, _ := strconv.Atoi(m[2])
+
+			result := start("ctest")
+			result.Passed = total - failed
+			result.Failed = failed
+
+			continue
+		}
+
+		if m := pytestSummary.FindStringSubmatch(line); m != nil {
+			counts := pytestCount.FindAllStringSubmatch(m[1], -1)
+			if len(counts) == 0 {
+				continue
+			}
+
+			result := start("pytest")
+
+			for _, c := range counts {
+				count, _ := strconv.Atoi(c[1])
+
+				switch c[2] {
+				case "passed", "xfailed":
+					result.Passed += count
+				case "skipped":
+					result.Skipped += count
+				default:
+					result.Failed += count
+				}
+			}
+		}
+	}
+
+	return results, scanner.Err()
+}
+
+// ReadTestResults will find the test suite summaries within a build log.
+func ReadTestResults(logPath string) ([]TestResult, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseTestResults(f)
+}
+
+// WriteTestResults will store the test results as JSON at the given path.
+func WriteTestResults(path string, results []TestResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o0644)
+}
+
+// KeepTestLogs will copy the logs written by test harnesses beneath root into
+// dir, keeping their paths relative to root. The number kept is returned.
+func KeepTestLogs(root, dir string) (int, error) {
+	kept := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil //nolint:nilerr // unreadable entries are skipped
+		}
+
+		if !d.Type().IsRegular() || !slices.Contains(testLogNames, d.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, rel)
+		if err = os.MkdirAll(filepath.Dir(target), 0o0755); err != nil {
+			return err
+		}
+
+		if err = disk.CopyFile(path, target); err != nil {
+			return fmt.Errorf("Failed to keep test log %s, reason: %w\n", path, err)
+		}
+
+		kept++
+
+		return nil
+	})
+
+	return kept, err
+}
@@ -0,0 +1,99 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimingsSuffix replaces the build log suffix to give the path of the stored
+// command timings for that build.
+const TimingsSuffix = ".timings.json"
+
+// A CommandTiming is the total time spent running commands with one label.
+type CommandTiming struct {
+	Label    string        `json:"label"`
+	Duration time.Duration `json:"duration"`
+	Count    int           `json:"count"` // Number of commands run
+}
+
+// BuildTimings records how long the commands run within the chroot took,
+// grouped by label in the order they were first run.
+type BuildTimings struct {
+	entries []*CommandTiming
+	lock    sync.Mutex
+}
+
+// Timings holds the command timings of the current operation.
+var Timings = &BuildTimings{}
+
+// Record will add the duration of a command to the total for its label.
+func (t *BuildTimings) Record(label string, duration time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, entry := range t.entries {
+		if entry.Label == label {
+			entry.Duration += duration
+			entry.Count++
+
+			return
+		}
+	}
+
+	t.entries = append(t.entries, &CommandTiming{Label: label, Duration: duration, Count: 1})
+}
+
+// Entries returns a copy of the recorded timings.
+func (t *BuildTimings) Entries() []CommandTiming {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	ret := make([]CommandTiming, 0, len(t.entries))
+	for _, entry := range t.entries {
+		ret = append(ret, *entry)
+	}
+
+	return ret
+}
+
+// Summary returns a breakdown such as "deps install 142s, ypkg-build 1893s".
+func (t *BuildTimings) Summary() string {
+	entries := t.Entries()
+	parts := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		parts = append(parts, fmt.Sprintf("%s %s", entry.Label, entry.Duration.Round(time.Second)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Write will store the timings as JSON at the given path.
+func (t *BuildTimings) Write(path string) error {
+	data, err := json.MarshalIndent(t.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o0644)
+}
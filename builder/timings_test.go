@@ -0,0 +1,41 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestBuildTimings(t *testing.T) {
+	timings := &builder.BuildTimings{}
+
+	timings.Record("deps install", 100*time.Second)
+	timings.Record("ypkg-build", 1893*time.Second)
+	timings.Record("deps install", 42*time.Second)
+
+	entries := timings.Entries()
+	if len(entries) != 2 || entries[0].Count != 2 {
+		t.Fatalf("Expected commands grouped by label, got %v", entries)
+	}
+
+	if summary := timings.Summary(); summary != "deps install 2m22s, ypkg-build 31m33s" {
+		t.Fatalf("Unexpected timing summary: %s", summary)
+	}
+}
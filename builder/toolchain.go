@@ -0,0 +1,97 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/getsolus/libosdev/disk"
+)
+
+// A ToolchainMount replaces part of the tooling within the image, such as
+// ypkg, with a local copy from the host, so that changes to the tooling may
+// be tested against real packages.
+type ToolchainMount struct {
+	Source string // Absolute path of the local copy on the host
+	Target string // Absolute path of the tooling within the chroot
+}
+
+// ParseToolchainMount will parse a SRC:DEST toolchain mount specification.
+func ParseToolchainMount(spec string) (*ToolchainMount, error) {
+	source, target, found := strings.Cut(spec, ":")
+	if !found || source == "" || target == "" {
+		return nil, fmt.Errorf("Invalid toolchain mount '%s', expected SRC:DEST", spec)
+	}
+
+	if !filepath.IsAbs(target) {
+		return nil, fmt.Errorf("Invalid toolchain mount '%s', %s is not an absolute path", spec, target)
+	}
+
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve toolchain path %s, reason: %w", source, err)
+	}
+
+	if !PathExists(source) {
+		return nil, fmt.Errorf("Toolchain path %s does not exist", source)
+	}
+
+	return &ToolchainMount{Source: source, Target: filepath.Clean(target)}, nil
+}
+
+// BindToolchain will bind mount the local tooling over that of the image,
+// read-only. Builds call this once the build dependencies are installed, so
+// that they cannot replace it.
+func (p *Package) BindToolchain(o *Overlay) error {
+	if len(o.Toolchain) == 0 {
+		return nil
+	}
+
+	mountMan := disk.GetMountManager()
+
+	for _, mount := range o.Toolchain {
+		slog.Warn("Building with local tooling, the package is not reproducible", "source", mount.Source, "target", mount.Target)
+
+		st, err := os.Stat(mount.Source)
+		if err != nil {
+			return fmt.Errorf("Failed to find toolchain path %s, reason: %w\n", mount.Source, err)
+		}
+
+		var target string
+		if st.IsDir() {
+			target, err = SecureMkdirAll(o.MountPoint, mount.Target, 0o0755)
+		} else {
+			target, err = SecureTouchFile(o.MountPoint, mount.Target)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to create bind mount target %s, reason: %w\n", mount.Target, err)
+		}
+
+		if err := mountMan.BindMount(mount.Source, target, "ro"); err != nil {
+			return fmt.Errorf("Failed to bind mount toolchain %s, reason: %w\n", mount.Source, err)
+		}
+
+		o.ExtraMounts = append(o.ExtraMounts, target)
+	}
+
+	return nil
+}
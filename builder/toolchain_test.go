@@ -0,0 +1,53 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParseToolchainMount(t *testing.T) {
+	dir := t.TempDir()
+
+	mount, err := builder.ParseToolchainMount(dir + ":/usr/lib/python3.11/site-packages/ypkg2/")
+	if err != nil {
+		t.Fatalf("Failed to parse toolchain mount: %v", err)
+	}
+
+	if mount.Source != dir {
+		t.Fatalf("Expected source %s, got: %s", dir, mount.Source)
+	}
+
+	if mount.Target != "/usr/lib/python3.11/site-packages/ypkg2" {
+		t.Fatalf("Expected a clean target, got: %s", mount.Target)
+	}
+
+	for _, spec := range []string{
+		"",
+		dir,
+		dir + ":",
+		":/usr/bin/ypkg-build",
+		dir + ":usr/bin/ypkg-build",
+		dir + "/missing:/usr/bin/ypkg-build",
+	} {
+		if _, err := builder.ParseToolchainMount(spec); err == nil {
+			t.Fatalf("Expected %q to be rejected", spec)
+		}
+	}
+}
@@ -18,9 +18,14 @@ package builder
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -29,10 +34,32 @@ import (
 const (
 	// TransitManifestSuffix is the extension that a valid transit manifest must have.
 	TransitManifestSuffix = ".tram"
+
+	// TransitManifestVersion is the format version of the manifests written.
+	// Version 1.1 added the arch, profile and abi_report header fields.
+	TransitManifestVersion = "1.1"
+
+	// DefaultManifestName is the template of the manifest filename, before
+	// the suffix is added.
+	DefaultManifestName = "{name}-{version}-{release}"
+)
+
+var (
+	// ErrIllegalUpload is returned when someone is a spanner and tries uploading an unsupported file.
+	ErrIllegalUpload = errors.New("The manifest file is NOT an eopkg")
+
+	// ErrMixedArch is returned when the files of a manifest were built for
+	// different architectures.
+	ErrMixedArch = errors.New("The manifest files are for more than one architecture")
+
+	// ErrInvalidManifestName is returned when the manifest filename template
+	// would not produce a plain filename.
+	ErrInvalidManifestName = errors.New("Invalid manifest_name")
 )
 
-// ErrIllegalUpload is returned when someone is a spanner and tries uploading an unsupported file.
-var ErrIllegalUpload = errors.New("The manifest file is NOT an eopkg")
+// ManifestName is the template used to name transit manifests, see
+// TransitManifest.Filename.
+var ManifestName = DefaultManifestName
 
 // A TransitManifestHeader is required in all .tram uploads to ensure that both
 // the sender and recipient are talking in the same fashion.
@@ -42,6 +69,16 @@ type TransitManifestHeader struct {
 
 	// The repo that the uploader is intending to upload *to*
 	Target string `toml:"target"`
+
+	// Architecture of the packages, i.e. x86_64
+	Arch string `toml:"arch,omitempty"`
+
+	// Profile the packages were built with
+	Profile string `toml:"profile,omitempty"`
+
+	// Cryptographic checksum of the ABI report, as given by running
+	// `sha256sum abi_* | sha256sum` alongside the packages
+	ABIReport string `toml:"abi_report,omitempty"`
 }
 
 // A TransitManifest is provided by build servers to validate the upload of
@@ -65,6 +102,9 @@ type TransitManifestFile struct {
 
 	// Cryptographic checksum to allow integrity checks post-upload/pre-merge
 	Sha256 string `toml:"sha256"`
+
+	// Relative filename of the detached signature, if the file was signed
+	Signature string `toml:"signature,omitempty"`
 }
 
 // NewTransitManifest will attempt to load the transit manifest from the
@@ -72,31 +112,127 @@ type TransitManifestFile struct {
 func NewTransitManifest(target string) *TransitManifest {
 	return &TransitManifest{
 		Manifest: TransitManifestHeader{
-			Version: "1.0",
+			Version: TransitManifestVersion,
 			Target:  target,
 		},
 	}
 }
 
-// AddFile will attempt to add a file to the payload for this package.
+// AddFile will attempt to add a file to the payload for this package. Any
+// detached signature alongside the file is recorded too, and the
+// architecture of the manifest is taken from the filename, less any profile
+// suffix added by LayoutProfileSuffix.
 func (t *TransitManifest) AddFile(path string) error {
 	if !strings.HasSuffix(path, ".eopkg") {
 		return ErrIllegalUpload
 	}
 
+	if arch := eopkgArch(trimArtifactSuffix(filepath.Base(path), t.Manifest.Profile)); arch != "" {
+		if t.Manifest.Arch != "" && t.Manifest.Arch != arch {
+			return fmt.Errorf("%w: %s and %s", ErrMixedArch, t.Manifest.Arch, arch)
+		}
+
+		t.Manifest.Arch = arch
+	}
+
 	hash, err := FileSha256sum(path)
 	if err != nil {
 		return err
 	}
 
-	t.File = append(t.File, TransitManifestFile{
+	file := TransitManifestFile{
 		Path:   filepath.Base(path),
 		Sha256: hash,
-	})
+	}
+
+	if PathExists(path + ArtifactSignatureSuffix) {
+		file.Signature = file.Path + ArtifactSignatureSuffix
+	}
+
+	t.File = append(t.File, file)
 
 	return nil
 }
 
+// AddABIReport will record the checksum of the given ABI report files.
+func (t *TransitManifest) AddABIReport(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	sorted := append([]string(nil), paths...)
+	sort.Slice(sorted, func(i, j int) bool { return filepath.Base(sorted[i]) < filepath.Base(sorted[j]) })
+
+	// Hash the output sha256sum(1) would give for the files
+	sums := sha256.New()
+
+	for _, path := range sorted {
+		hash, err := FileSha256sum(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(sums, "%s  %s\n", hash, filepath.Base(path))
+	}
+
+	t.Manifest.ABIReport = hex.EncodeToString(sums.Sum(nil))
+
+	return nil
+}
+
+// Filename will expand the template to give the filename of the manifest
+// for the package. The template may use {name}, {version}, {release},
+// {arch}, {profile} and {target}, and the manifest suffix is added if it is
+// missing.
+func (t *TransitManifest) Filename(template string, pkg *Package) (string, error) {
+	name := strings.NewReplacer(
+		"{name}", pkg.Name,
+		"{version}", pkg.Version,
+		"{release}", strconv.Itoa(pkg.Release),
+		"{arch}", t.Manifest.Arch,
+		"{profile}", t.Manifest.Profile,
+		"{target}", t.Manifest.Target,
+	).Replace(template)
+
+	if name == "" || strings.ContainsAny(name, "/{}") || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: %q expands to %q", ErrInvalidManifestName, template, name)
+	}
+
+	if !strings.HasSuffix(name, TransitManifestSuffix) {
+		name += TransitManifestSuffix
+	}
+
+	return name, nil
+}
+
+// ValidateManifestName will check that the template gives a plain filename.
+func ValidateManifestName(template string) error {
+	tram := NewTransitManifest("unstable")
+	tram.Manifest.Arch = "x86_64"
+	tram.Manifest.Profile = "main-x86_64"
+
+	_, err := tram.Filename(template, &Package{Name: "nano", Version: "8.0", Release: 1})
+
+	return err
+}
+
+// eopkgArch returns the architecture in the filename of an eopkg, i.e.
+// x86_64 for nano-2.7.5-68-1-x86_64.eopkg.
+func eopkgArch(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), ".eopkg")
+
+	// Delta packages carry no architecture
+	if strings.Contains(base, "-delta-") {
+		return ""
+	}
+
+	if i := strings.LastIndex(base, "-"); i >= 0 {
+		return base[i+1:]
+	}
+
+	return ""
+}
+
 // Write will dump the manifest to the given file path.
 func (t *TransitManifest) Write(path string) error {
 	blob := bytes.Buffer{}
@@ -0,0 +1,121 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+// writeFiles writes each of the named files to dir, with its name as the
+// contents, returning their paths.
+func writeFiles(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+
+	var paths []string
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths
+}
+
+func TestTransitManifestHeader(t *testing.T) {
+	dir := t.TempDir()
+	pkgs := writeFiles(t, dir, "nano-8.0-1-1-x86_64.eopkg", "nano-dbginfo-8.0-1-1-x86_64.eopkg")
+	abi := writeFiles(t, dir, "abi_used_symbols", "abi_symbols")
+
+	tram := builder.NewTransitManifest("unstable")
+	tram.Manifest.Profile = "main-x86_64"
+
+	for _, pkg := range pkgs {
+		if err := tram.AddFile(pkg); err != nil {
+			t.Fatalf("Failed to add package to manifest: %v", err)
+		}
+	}
+
+	if err := tram.AddABIReport(abi); err != nil {
+		t.Fatalf("Failed to add ABI report to manifest: %v", err)
+	}
+
+	if tram.Manifest.Version != builder.TransitManifestVersion || tram.Manifest.Arch != "x86_64" {
+		t.Fatalf("Unexpected manifest header %+v", tram.Manifest)
+	}
+
+	// sha256sum abi_* | sha256sum
+	const want = "87193159c0a842a72b41c920f75817e22fb4e1cd47d9dae812eff0324f9133f4"
+	if tram.Manifest.ABIReport != want {
+		t.Fatalf("Unexpected ABI report checksum %q", tram.Manifest.ABIReport)
+	}
+
+	// The checksum must not depend on the order the files are given in
+	reordered := builder.NewTransitManifest("unstable")
+	if err := reordered.AddABIReport([]string{abi[1], abi[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if reordered.Manifest.ABIReport != tram.Manifest.ABIReport {
+		t.Fatal("ABI report checksum depends on the order of the files")
+	}
+
+	other := writeFiles(t, dir, "nano-8.0-1-1-aarch64.eopkg")
+	if err := tram.AddFile(other[0]); !errors.Is(err, builder.ErrMixedArch) {
+		t.Fatalf("Expected mixed architectures to be refused, got %v", err)
+	}
+}
+
+func TestTransitManifestFilename(t *testing.T) {
+	pkg := &builder.Package{Name: "nano", Version: "8.0", Release: 12}
+
+	tram := builder.NewTransitManifest("unstable")
+	tram.Manifest.Arch = "x86_64"
+	tram.Manifest.Profile = "main-x86_64"
+
+	tests := map[string]string{
+		builder.DefaultManifestName:         "nano-8.0-12.tram",
+		"{name}-{version}-{release}-{arch}": "nano-8.0-12-x86_64.tram",
+		"{target}/{name}":                   "",
+		"{name}-{profile}.tram":             "nano-main-x86_64.tram",
+		"{name}-{unknown}":                  "",
+		"":                                  "",
+	}
+
+	for template, want := range tests {
+		got, err := tram.Filename(template, pkg)
+		if want == "" {
+			if !errors.Is(err, builder.ErrInvalidManifestName) {
+				t.Errorf("Expected %q to be refused, got %q", template, got)
+			}
+
+			continue
+		}
+
+		if err != nil || got != want {
+			t.Errorf("Expected %q to give %q, got %q: %v", template, want, got, err)
+		}
+	}
+}
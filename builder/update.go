@@ -17,15 +17,26 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/getsolus/libosdev/disk"
 )
 
-func (b *BackingImage) updatePackages(_ PidNotifier, pkgManager *EopkgManager) error {
+// CheckUpdates will check that an updated image can still be used for builds
+// before it replaces the image, keeping the previous image otherwise.
+var CheckUpdates = true
+
+// ErrUpdateRejected is returned when the updated image fails its checks, so
+// the previous image was kept.
+var ErrUpdateRejected = errors.New("The updated image cannot be used for builds, keeping the previous image")
+
+func (b *BackingImage) updatePackages(_ PidNotifier, pkgManager PackageManager) error {
 	slog.Debug("Initialising package manager")
 
 	if err := pkgManager.Init(); err != nil {
@@ -61,9 +72,79 @@ func (b *BackingImage) updatePackages(_ PidNotifier, pkgManager *EopkgManager) e
 	return nil
 }
 
+// checkUpdate will ensure the updated root is intact, and that the tools
+// needed for builds still run within it.
+func (b *BackingImage) checkUpdate(notif PidNotifier) error {
+	slog.Debug("Checking updated image", "name", b.Name)
+
+	if err := CheckImageSanity(b.RootDir, PackageTypeYpkg); err != nil {
+		return err
+	}
+
+	ChrootEnvironment = SaneEnvironment("root", "/root")
+
+	cmd := fmt.Sprintf("%s --version >/dev/null && %s --help >/dev/null", installCommand, ypkgBuildCommand)
+	if err := ChrootExec(notif, b.RootDir, "update check", cmd); err != nil {
+		return fmt.Errorf("Failed to run the build tools, reason: %w", err)
+	}
+
+	notif.SetActivePID(0)
+
+	return nil
+}
+
+// UpdatePath returns the path of the copy of the image that updates are
+// made to, before it replaces the image.
+func (b *BackingImage) UpdatePath() string {
+	return b.ImagePath + updateSuffix
+}
+
+// prepareUpdate will copy the image to be updated, sharing its blocks where
+// the filesystem supports it, so that builds may continue using the image.
+func (b *BackingImage) prepareUpdate() error {
+	slog.Debug("Copying image to update", "image_path", b.ImagePath, "update_path", b.UpdatePath())
+
+	out, err := exec.Command("cp", "--reflink=auto", "--sparse=always", b.ImagePath, b.UpdatePath()).CombinedOutput()
+	if err != nil {
+		os.Remove(b.UpdatePath())
+
+		return fmt.Errorf("Failed to copy image %s, reason: %w: %s\n", b.ImagePath, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// CommitUpdate will replace the image with the updated copy, once it is no
+// longer mounted. Builds already using the image continue to do so, while
+// new builds use the updated image.
+func (b *BackingImage) CommitUpdate() error {
+	meta, err := b.hashImage(b.UpdatePath())
+	if err != nil {
+		return err
+	}
+
+	if err = b.keepGeneration(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(b.UpdatePath(), b.ImagePath); err != nil {
+		return fmt.Errorf("Failed to replace image %s, reason: %w\n", b.ImagePath, err)
+	}
+
+	return b.writeMetadata(meta)
+}
+
+// AbandonUpdate will remove the updated copy of the image.
+func (b *BackingImage) AbandonUpdate() {
+	if err := os.Remove(b.UpdatePath()); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove abandoned image update", "path", b.UpdatePath(), "err", err)
+	}
+}
+
 // Update will attempt to update the backing image to the latest version
-// internally.
-func (b *BackingImage) Update(notif PidNotifier, pkgManager *EopkgManager) error {
+// internally. The update is made to a copy of the image, which must then be
+// committed with CommitUpdate or removed with AbandonUpdate.
+func (b *BackingImage) Update(notif PidNotifier, pkgManager PackageManager) error {
 	mountMan := disk.GetMountManager()
 
 	slog.Debug("Updating backing image", "name", b.Name)
@@ -76,11 +157,19 @@ func (b *BackingImage) Update(notif PidNotifier, pkgManager *EopkgManager) error
 		slog.Debug("Created root directory", "name", b.Name)
 	}
 
-	slog.Debug("Mounting rootfs", "image_path", b.ImagePath, "root_dir", b.RootDir)
+	if err := b.prepareUpdate(); err != nil {
+		return err
+	}
+
+	slog.Debug("Mounting rootfs", "image_path", b.UpdatePath(), "root_dir", b.RootDir)
 
 	// Mount the rootfs
-	if err := mountMan.Mount(b.ImagePath, b.RootDir, "auto", "loop"); err != nil {
-		return fmt.Errorf("Failed to mount rootfs %s, reason: %w\n", b.ImagePath, err)
+	if err := mountMan.Mount(b.UpdatePath(), b.RootDir, "auto", "loop"); err != nil {
+		return fmt.Errorf("Failed to mount rootfs %s, reason: %w\n", b.UpdatePath(), err)
+	}
+
+	if err := CleanRunDir(b.RootDir); err != nil {
+		return err
 	}
 
 	if err := EnsureEopkgLayout(b.RootDir); err != nil {
@@ -106,6 +195,13 @@ func (b *BackingImage) Update(notif PidNotifier, pkgManager *EopkgManager) error
 		return err
 	}
 
+	// A bad package must not leave the builders unable to build
+	if CheckUpdates {
+		if err := b.checkUpdate(notif); err != nil {
+			return fmt.Errorf("%w, reason: %w", ErrUpdateRejected, err)
+		}
+	}
+
 	slog.Debug("Image successfully updated", "name", b.Name)
 
 	return nil
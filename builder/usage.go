@@ -0,0 +1,225 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/charlievieth/fastwalk"
+
+	"github.com/getsolus/solbuild/builder/source"
+)
+
+// UsageKind identifies what a solbuild-owned location is used for.
+type UsageKind string
+
+const (
+	// UsageOverlay is a build root for a single package.
+	UsageOverlay UsageKind = "overlay"
+
+	// UsageBuildCache is a compiler or build tool cache, e.g. ccache.
+	UsageBuildCache UsageKind = "build-cache"
+
+	// UsagePackages is the shared eopkg package cache.
+	UsagePackages UsageKind = "packages"
+
+	// UsageSources is the tarball source cache.
+	UsageSources UsageKind = "sources"
+
+	// UsageGitSources is the git source cache.
+	UsageGitSources UsageKind = "git-sources"
+
+	// UsageImage is a backing image.
+	UsageImage UsageKind = "image"
+
+	// UsageState is the persistent state of a package.
+	UsageState UsageKind = "state"
+
+	// UsageObsolete is a location no longer used by solbuild.
+	UsageObsolete UsageKind = "obsolete"
+)
+
+// A DiskUsage is the size of a single solbuild-owned location.
+type DiskUsage struct {
+	Path    string    `json:"path"`
+	Kind    UsageKind `json:"kind"`
+	Profile string    `json:"profile,omitempty"`
+	Package string    `json:"package,omitempty"`
+	Size    int64     `json:"size"`
+}
+
+// DirSize returns the disk usage of a directory, or zero if it doesn't exist.
+func DirSize(path string) (int64, error) {
+	// fastwalk invokes the callback concurrently
+	var totalSize atomic.Int64
+
+	// Return nothing if dir doesn't exist
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		slog.Debug("Directory doesn't exist", "path", path)
+		return 0, nil
+	}
+
+	walkConf := fastwalk.Config{
+		Follow: false,
+	}
+
+	// Walk the dir, get size, add to totalSize
+	err := fastwalk.Walk(&walkConf, path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			file, err2 := d.Info()
+			if err2 != nil {
+				return err2
+			}
+
+			totalSize.Add(file.Size())
+		}
+
+		return nil
+	})
+
+	return totalSize.Load(), err
+}
+
+// dirUsage appends a single entry for path.
+func dirUsage(usage []DiskUsage, path string, kind UsageKind) []DiskUsage {
+	size, err := DirSize(path)
+	if err != nil {
+		slog.Warn("Couldn't get directory size", "path", path, "reason", err)
+	}
+
+	return append(usage, DiskUsage{Path: path, Kind: kind, Size: size})
+}
+
+// packageUsage enumerates every package directory under root, which is laid
+// out as $root/$profile/$package.
+func packageUsage(usage []DiskUsage, root string, kind UsageKind) []DiskUsage {
+	profiles, _ := os.ReadDir(root)
+
+	for _, profile := range profiles {
+		if !profile.IsDir() {
+			continue
+		}
+
+		pkgs, _ := os.ReadDir(filepath.Join(root, profile.Name()))
+
+		for _, pkg := range pkgs {
+			if !pkg.IsDir() {
+				continue
+			}
+
+			path := filepath.Join(root, profile.Name(), pkg.Name())
+
+			size, err := DirSize(path)
+			if err != nil {
+				slog.Warn("Couldn't get directory size", "path", path, "reason", err)
+			}
+
+			usage = append(usage, DiskUsage{
+				Path:    path,
+				Kind:    kind,
+				Profile: profile.Name(),
+				Package: pkg.Name(),
+				Size:    size,
+			})
+		}
+	}
+
+	return usage
+}
+
+// imageUsage enumerates every backing image, compressed or not.
+func imageUsage(usage []DiskUsage) []DiskUsage {
+	images, _ := filepath.Glob(filepath.Join(ImagesDir, "*"+ImageSuffix+"*"))
+
+	for _, image := range images {
+		st, err := os.Stat(image)
+		if err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+
+		name := filepath.Base(image)
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ImageCompressedSuffix), ImageSuffix)
+
+		usage = append(usage, DiskUsage{
+			Path:    image,
+			Kind:    UsageImage,
+			Profile: name,
+			Size:    st.Size(),
+		})
+	}
+
+	return usage
+}
+
+// GetDiskUsage will enumerate every solbuild-owned location on disk, sorted
+// by size with the largest first.
+func GetDiskUsage(config *Config) []DiskUsage {
+	var usage []DiskUsage
+
+	usage = packageUsage(usage, config.OverlayRootDir, UsageOverlay)
+	usage = packageUsage(usage, StateDirectory, UsageState)
+
+	for _, cache := range Caches {
+		usage = dirUsage(usage, filepath.Join(CacheDirectory, cache.Name), UsageBuildCache)
+	}
+
+	usage = dirUsage(usage, filepath.Join(CacheDirectory, IsolatedCacheDir), UsageBuildCache)
+
+	usage = dirUsage(usage, PackageCacheDirectory, UsagePackages)
+	usage = dirUsage(usage, source.GitSourceDir, UsageGitSources)
+
+	// Git sources live within the source directory, so don't count them twice
+	sourceSize, err := DirSize(source.SourceDir)
+	if err != nil {
+		slog.Warn("Couldn't get directory size", "path", source.SourceDir, "reason", err)
+	}
+
+	usage = append(usage, DiskUsage{
+		Path: source.SourceDir,
+		Kind: UsageSources,
+		Size: sourceSize - usage[len(usage)-1].Size,
+	})
+
+	usage = imageUsage(usage)
+
+	for _, obsolete := range []string{
+		ObsoleteCcacheDirectory,
+		ObsoleteSccacheDirectory,
+		ObsoleteLegacyCcacheDirectory,
+		ObsoleteLegacySccacheDirectory,
+	} {
+		if PathExists(obsolete) {
+			usage = dirUsage(usage, obsolete, UsageObsolete)
+		}
+	}
+
+	sort.SliceStable(usage, func(i, j int) bool {
+		return usage[i].Size > usage[j].Size
+	})
+
+	return usage
+}
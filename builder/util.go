@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -85,46 +87,25 @@ func (p *Package) DeactivateRoot(overlay *Overlay) {
 // MurderDeathKill will find all processes with a root matching the given root
 // and set about killing them, to assist in clean closing.
 func MurderDeathKill(root string) error {
-	path, err := filepath.EvalSymlinks(root)
+	pids, err := FindRootProcesses(HostProcesses, root)
 	if err != nil {
 		return err
 	}
 
-	var files []os.DirEntry
-
-	if files, err = os.ReadDir("/proc"); err != nil {
-		return err
-	}
-
-	for _, f := range files {
-		fpath := filepath.Join("/proc", f.Name(), "cwd")
-
-		spath, err := filepath.EvalSymlinks(fpath)
-		if err != nil {
-			continue
-		}
+	for _, pid := range pids {
+		slog.Debug("Killing child process in chroot", "pid", pid)
 
-		if spath != path {
+		err := syscall.Kill(pid, syscall.SIGTERM)
+		if err == nil || errors.Is(err, syscall.ESRCH) {
+			// Already gone by the time we got to it
 			continue
 		}
 
-		spid := f.Name()
-
-		var pid int
+		slog.Error("Error terminating process, attempting force kill", "pid", pid)
+		time.Sleep(400 * time.Millisecond)
 
-		if pid, err = strconv.Atoi(spid); err != nil {
-			return fmt.Errorf("POSIX Weeps - broken pid identifier %s, reason: %w\n", spid, err)
-		}
-
-		slog.Debug("Killing child process in chroot", "pid", pid)
-
-		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-			slog.Error("Error terminating process, attempting force kill", "pid", pid)
-			time.Sleep(400 * time.Millisecond)
-
-			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
-				slog.Error("Error killing (-9) process", "pid", pid)
-			}
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			slog.Error("Error killing (-9) process", "pid", pid)
 		}
 	}
 
@@ -132,9 +113,10 @@ func MurderDeathKill(root string) error {
 }
 
 // TouchFile will create the file if it doesn't exist, enabling use of bind
-// mounts.
+// mounts. A symlink in its place is never followed; use SecureTouchFile for
+// paths within a build root.
 func TouchFile(path string) error {
-	w, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0o0644)
+	w, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|syscall.O_NOFOLLOW, 0o0644)
 	if err != nil {
 		return err
 	}
@@ -149,20 +131,29 @@ func TouchFile(path string) error {
 func SaneEnvironment(username, home string) []string {
 	environment := []string{
 		"PATH=/usr/bin:/usr/sbin:/bin/:/sbin",
-		"LANG=en_US.UTF-8",
-		"LC_ALL=en_US.UTF-8",
+		fmt.Sprintf("LANG=%s", BuildLocale),
+		fmt.Sprintf("LC_ALL=%s", BuildLocale),
 		fmt.Sprintf("HOME=%s", home),
 		fmt.Sprintf("USER=%s", username),
 		fmt.Sprintf("USERNAME=%s", username),
 		fmt.Sprintf("CCACHE_DIR=%s", path.Join(BuildUserHome, ".ccache")),
 		fmt.Sprintf("SCCACHE_DIR=%s", path.Join(BuildUserHome, ".cache", "sccache")),
 	}
-	// Consider an option to even filter these out
+
+	switch {
+	case LowMemory:
+		environment = append(environment, fmt.Sprintf("MAKEFLAGS=-j%d", LowMemoryJobs))
+	case len(CPUAffinity) > 0:
+		environment = append(environment, fmt.Sprintf("MAKEFLAGS=-j%d", len(CPUAffinity)))
+	}
+
+	if BuildTimezone != "" {
+		environment = append(environment, fmt.Sprintf("TZ=%s", BuildTimezone))
+	}
+
+	environment = append(environment, Proxy.Environment()...)
+
 	permitted := []string{
-		"http_proxy",
-		"https_proxy",
-		"no_proxy",
-		"ftp_proxy",
 		"TERM",
 	}
 	if !DisableColors {
@@ -192,14 +183,43 @@ func SaneEnvironment(username, home string) []string {
 }
 
 // ChrootExec is a simple wrapper to return a correctly set up chroot command,
-// so that we can store the PID, for long running tasks.
-func ChrootExec(notif PidNotifier, dir, command string) error {
-	slog.Debug("Executing in chroot", "dir", dir, "command", command)
+// so that we can store the PID, for long running tasks. The time taken is
+// recorded in Timings under the given label.
+func ChrootExec(notif PidNotifier, dir, label, command string) error {
+	return chrootExec(notif, dir, label, command, BuildOutput)
+}
+
+// ChrootExecProgress is identical to ChrootExec, except that the output of
+// eopkg is summarised as progress rather than shown in full. The full output
+// is still written to the build log, and the tail of it is shown should the
+// command fail.
+func ChrootExecProgress(notif PidNotifier, dir, label, command string) error {
+	progress := NewEopkgProgressWriter(label, buildLogOutput)
+
+	err := chrootExec(notif, dir, label, command, progress)
+	progress.Flush()
+
+	if err != nil {
+		buildTermOutput.Write(progress.Tail())
+	}
+
+	return err
+}
+
+// chrootExec runs the command within the chroot, sending its output to out.
+func chrootExec(notif PidNotifier, dir, label, command string, out io.Writer) error {
+	slog.Debug("Executing in chroot", "dir", dir, "label", label, "command", command)
+
+	started := time.Now()
+	defer func() { Timings.Record(label, time.Since(started)) }()
+
+	watchdog := NewStallWatchdog(label, out)
+	defer watchdog.Stop()
 
 	args := []string{dir, "/bin/sh", "-c", command}
-	c := exec.Command("chroot", args...)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stdout
+	c := pinnedCommand("chroot", args...)
+	c.Stdout = watchdog
+	c.Stderr = watchdog
 	c.Stdin = nil
 	c.Env = ChrootEnvironment
 	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
@@ -209,15 +229,21 @@ func ChrootExec(notif PidNotifier, dir, command string) error {
 	}
 
 	notif.SetActivePID(c.Process.Pid)
+	watchdog.Watch(c.Process.Pid)
 
-	return c.Wait()
+	err := c.Wait()
+	if watchdog.Stalled() {
+		return fmt.Errorf("%w: %s made no progress for %s", ErrStalled, label, StallKill)
+	}
+
+	return err
 }
 
 // ChrootExecStdin is almost identical to ChrootExec, except it permits a stdin
 // to be associated with the command.
 func ChrootExecStdin(notif PidNotifier, dir, command string) error {
 	args := []string{dir, "/bin/sh", "-c", command}
-	c := exec.Command("chroot", args...)
+	c := pinnedCommand("chroot", args...)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stdout
 	c.Stdin = os.Stdin
@@ -232,7 +258,11 @@ func ChrootExecStdin(notif PidNotifier, dir, command string) error {
 	return c.Wait()
 }
 
-func ChrootShell(notif PidNotifier, dir, command, workdir string) error {
+// ChrootShell will spawn an interactive login shell within the chroot,
+// falling back to FallbackShell if the given shell is missing.
+func ChrootShell(notif PidNotifier, dir, shell, workdir string) error {
+	shell = ResolveShell(dir, shell)
+
 	// Hold an fd for the og root
 	fd, err := os.Open("/")
 	if err != nil {
@@ -260,8 +290,8 @@ func ChrootShell(notif PidNotifier, dir, command, workdir string) error {
 	}
 
 	// Spawn a shell
-	args := []string{"--login"}
-	c := exec.Command("/bin/bash", args...)
+	args := []string{"-l"}
+	c := exec.Command(shell, args...)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stdout
 	c.Stdin = os.Stdin
@@ -300,7 +330,12 @@ CLEANUP:
 func StartSccache(dir string) {
 	var buf bytes.Buffer
 
-	c := exec.Command("chroot", dir, "/bin/su", "root", "-c", "sccache --start-server")
+	start := "sccache --start-server"
+	if LowMemory {
+		start = fmt.Sprintf("ulimit -v %d; %s", LowMemorySccacheLimit, start)
+	}
+
+	c := pinnedCommand("chroot", dir, "/bin/su", "root", "-c", start)
 	c.Stdout = &buf
 	c.Stderr = &buf
 	c.Env = slices.Clone(ChrootEnvironment)
@@ -327,15 +362,17 @@ func AddBuildUser(rootfs string) error {
 		return nil
 	}
 
+	shell := ResolveShell(rootfs, BuildUserShell)
+
 	slog.Debug("Adding build user to system", "user", BuildUser, "uid", BuildUserID, "gid", BuildUserGID,
-		"home", BuildUserHome, "shell", BuildUserShell, "gecos", BuildUserGecos)
+		"home", BuildUserHome, "shell", shell, "gecos", BuildUserGecos)
 
 	// Add the build group
 	if err := commands.AddGroup(rootfs, BuildUser, BuildUserGID); err != nil {
 		return fmt.Errorf("Failed to add build group to system, reason: %w\n", err)
 	}
 
-	if err := commands.AddUser(rootfs, BuildUser, BuildUserGecos, BuildUserHome, BuildUserShell, BuildUserID, BuildUserGID); err != nil {
+	if err := commands.AddUser(rootfs, BuildUser, BuildUserGecos, BuildUserHome, shell, BuildUserID, BuildUserGID); err != nil {
 		return fmt.Errorf("Failed to add build user to system, reason: %w\n", err)
 	}
 
@@ -0,0 +1,41 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"github.com/getsolus/solbuild/util"
+)
+
+// Features lists the optional capabilities compiled into this solbuild.
+func Features() []string {
+	features := []string{"history", "history-file", "secrets", "cache-budget", "transit-manifest"}
+
+	for _, cache := range Caches {
+		features = append(features, "cache:"+cache.Name)
+	}
+
+	return features
+}
+
+// GetVersionInfo returns the build metadata for this solbuild, including the
+// enabled features, for inclusion in bug reports.
+func GetVersionInfo() *util.VersionInfo {
+	info := util.GetVersionInfo()
+	info.Features = Features()
+
+	return info
+}
@@ -0,0 +1,264 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrStalled is returned when a command in the chroot is killed for making no
+// progress.
+var ErrStalled = errors.New("Command stalled")
+
+var (
+	// StallWarn is how long a command in the chroot may go without output or
+	// CPU activity before a warning is shown, 0 to never warn.
+	StallWarn time.Duration
+
+	// StallKill is how long a command in the chroot may go without output or
+	// CPU activity before it is killed, 0 to never kill it.
+	StallKill time.Duration
+)
+
+// maxStallPoll bounds how often stalled commands are checked for.
+const maxStallPoll = 10 * time.Second
+
+// A ProcStat is the state of a process, as read from /proc/$pid/stat.
+type ProcStat struct {
+	PID     int
+	PPID    int
+	Session int
+	State   string
+	Comm    string
+	CPU     uint64 // User and system time, in clock ticks
+}
+
+// ParseProcStat will parse the contents of /proc/$pid/stat.
+func ParseProcStat(data string) (ProcStat, error) {
+	var stat ProcStat
+
+	// The command may itself contain spaces and parentheses
+	open, end := strings.IndexByte(data, '('), strings.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return stat, fmt.Errorf("Invalid process stat: %q", data)
+	}
+
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 13 {
+		return stat, fmt.Errorf("Invalid process stat: %q", data)
+	}
+
+	var err error
+
+	if stat.PID, err = strconv.Atoi(strings.TrimSpace(data[:open])); err != nil {
+		return stat, fmt.Errorf("Invalid process stat, reason: %w", err)
+	}
+
+	stat.Comm = data[open+1 : end]
+	stat.State = fields[0]
+	stat.PPID, _ = strconv.Atoi(fields[1])
+	stat.Session, _ = strconv.Atoi(fields[3])
+
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	stat.CPU = utime + stime
+
+	return stat, nil
+}
+
+// sessionProcesses returns every process within the given session.
+func sessionProcesses(sid int) []ProcStat {
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+
+	var procs []ProcStat
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		if stat, err := ParseProcStat(string(data)); err == nil && stat.Session == sid {
+			procs = append(procs, stat)
+		}
+	}
+
+	return procs
+}
+
+// ProcessTree renders the processes as a tree beneath the given root, to
+// show what a stalled command is waiting on.
+func ProcessTree(procs []ProcStat, root int) string {
+	children := make(map[int][]ProcStat)
+
+	for _, proc := range procs {
+		children[proc.PPID] = append(children[proc.PPID], proc)
+	}
+
+	var sb strings.Builder
+
+	var walk func(proc ProcStat, depth int)
+
+	walk = func(proc ProcStat, depth int) {
+		fmt.Fprintf(&sb, "%s%d %s [%s]\n", strings.Repeat("  ", depth), proc.PID, proc.Comm, proc.State)
+
+		kids := children[proc.PID]
+		sort.Slice(kids, func(i, j int) bool { return kids[i].PID < kids[j].PID })
+
+		for _, kid := range kids {
+			walk(kid, depth+1)
+		}
+	}
+
+	for _, proc := range procs {
+		if proc.PID == root {
+			walk(proc, 0)
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// A StallWatchdog watches a command for output and CPU activity, warning
+// when it makes no progress for StallWarn and killing it after StallKill.
+// This is distinct from a wall-clock timeout, as a long build making
+// progress is never interrupted.
+type StallWatchdog struct {
+	label      string
+	out        io.Writer
+	lastOutput atomic.Int64
+	stalled    atomic.Bool
+	done       chan struct{}
+	stop       sync.Once
+}
+
+// NewStallWatchdog returns a watchdog passing output on to out. It must be
+// used as the output of the command, to see its output.
+func NewStallWatchdog(label string, out io.Writer) *StallWatchdog {
+	w := &StallWatchdog{
+		label: label,
+		out:   out,
+		done:  make(chan struct{}),
+	}
+
+	w.lastOutput.Store(time.Now().UnixNano())
+
+	return w
+}
+
+// Write records the output as activity and passes it on.
+func (w *StallWatchdog) Write(p []byte) (int, error) {
+	w.lastOutput.Store(time.Now().UnixNano())
+
+	return w.out.Write(p)
+}
+
+// Watch will start watching the session led by pid, which must have been
+// started with setsid.
+func (w *StallWatchdog) Watch(pid int) {
+	warn, kill := StallWarn, StallKill
+	if warn == 0 || (kill > 0 && kill < warn) {
+		warn = kill
+	}
+
+	if warn == 0 {
+		return
+	}
+
+	interval := min(warn/4, maxStallPoll)
+	if kill > 0 {
+		interval = min(interval, kill/4)
+	}
+
+	go w.watch(pid, warn, kill, interval)
+}
+
+// watch polls the session for activity until stopped.
+func (w *StallWatchdog) watch(pid int, warn, kill, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastActive := time.Now()
+	lastCPU := uint64(0)
+	warned := false
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			procs := sessionProcesses(pid)
+
+			cpu := uint64(0)
+			for _, proc := range procs {
+				cpu += proc.CPU
+			}
+
+			if cpu != lastCPU {
+				lastCPU = cpu
+				lastActive = now
+			}
+
+			if output := time.Unix(0, w.lastOutput.Load()); output.After(lastActive) {
+				lastActive = output
+			}
+
+			idle := now.Sub(lastActive)
+			if idle < warn {
+				warned = false
+				continue
+			}
+
+			if !warned {
+				slog.Warn("Command has stalled, with no output or CPU activity", "label", w.label,
+					"idle", idle.Round(time.Second), "processes", "\n"+ProcessTree(procs, pid))
+
+				warned = true
+			}
+
+			if kill > 0 && idle >= kill {
+				slog.Error("Killing stalled command", "label", w.label, "idle", idle.Round(time.Second))
+				w.stalled.Store(true)
+				syscall.Kill(-pid, syscall.SIGKILL)
+
+				return
+			}
+		}
+	}
+}
+
+// Stop will stop watching the command.
+func (w *StallWatchdog) Stop() {
+	w.stop.Do(func() { close(w.done) })
+}
+
+// Stalled reports whether the command was killed for stalling.
+func (w *StallWatchdog) Stalled() bool {
+	return w.stalled.Load()
+}
@@ -0,0 +1,86 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package builder_test
+
+import (
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/getsolus/solbuild/builder"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat, err := builder.ParseProcStat("4242 (rustc (main)) S 4200 4100 4100 0 -1 4194560 1 0 0 0 150 25 0 0 20 0 1 0 1 0 0")
+	if err != nil {
+		t.Fatalf("Failed to parse process stat: %v", err)
+	}
+
+	expected := builder.ProcStat{PID: 4242, PPID: 4200, Session: 4100, State: "S", Comm: "rustc (main)", CPU: 175}
+	if stat != expected {
+		t.Fatalf("Expected %v, got: %v", expected, stat)
+	}
+
+	if _, err = builder.ParseProcStat("garbage"); err == nil {
+		t.Fatal("Parsed invalid process stat")
+	}
+}
+
+func TestProcessTree(t *testing.T) {
+	procs := []builder.ProcStat{
+		{PID: 12, PPID: 10, Comm: "cargo", State: "S"},
+		{PID: 10, PPID: 1, Comm: "sh", State: "S"},
+		{PID: 13, PPID: 12, Comm: "rustc", State: "D"},
+	}
+
+	expected := "10 sh [S]\n  12 cargo [S]\n    13 rustc [D]"
+	if tree := builder.ProcessTree(procs, 10); tree != expected {
+		t.Fatalf("Expected tree:\n%s\ngot:\n%s", expected, tree)
+	}
+}
+
+func TestStallWatchdog(t *testing.T) {
+	builder.StallWarn, builder.StallKill = 100*time.Millisecond, 300*time.Millisecond
+	t.Cleanup(func() { builder.StallWarn, builder.StallKill = 0, 0 })
+
+	watchdog := builder.NewStallWatchdog("test", io.Discard)
+	defer watchdog.Stop()
+
+	c := exec.Command("sleep", "30")
+	c.Stdout = watchdog
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+
+	watchdog.Watch(c.Process.Pid)
+
+	started := time.Now()
+	err := c.Wait()
+
+	if !watchdog.Stalled() || err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Fatalf("Expected stalled command to be killed, got: %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("Stalled command took too long to be killed: %s", elapsed)
+	}
+}
@@ -0,0 +1,123 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&ABIReport)
+}
+
+// ABIReport generates the ABI report of an install root or built packages.
+var ABIReport = cmd.Sub{
+	Name:  "abireport",
+	Short: "Generate the ABI report of an install root or .eopkg files",
+	Flags: &ABIReportFlags{},
+	Args:  &ABIReportArgs{},
+	Run:   ABIReportRun,
+}
+
+// ABIReportFlags are flags for the "abireport" sub-command.
+type ABIReportFlags struct {
+	Output string `short:"o" long:"output" desc:"Directory to write the abi_* files into (default: current directory)"`
+}
+
+// ABIReportArgs are args for the "abireport" sub-command.
+type ABIReportArgs struct {
+	Paths []string `desc:"Install root directory, or .eopkg files, to report on"`
+}
+
+// ABIReportRun carries out the "abireport" sub-command.
+func ABIReportRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)    //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ABIReportFlags) //nolint:forcetypeassert // guaranteed by callee.
+	args := s.Args.(*ABIReportArgs)     //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to use abireport")
+	}
+
+	// Paths are bind mounted into the root, so must be absolute
+	paths := make([]string, 0, len(args.Paths))
+
+	for _, path := range args.Paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			log.Panic("Invalid path", "path", path, "err", err)
+		}
+
+		paths = append(paths, abs)
+	}
+
+	output := sFlags.Output
+	if output == "" {
+		output = "."
+	}
+
+	output, err := filepath.Abs(output)
+	if err != nil {
+		log.Panic("Invalid output directory", "err", err)
+	}
+
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	// Safety first...
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	// Set the package
+	if err := manager.SetPackage(&builder.ABIReportPackage); err != nil {
+		if errors.Is(err, builder.ErrProfileNotInstalled) {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+
+		os.Exit(1)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := manager.ABIReport(ctx, paths, output); err != nil {
+		log.Panic("Failed to generate ABI report", "err", err)
+	}
+}
@@ -0,0 +1,105 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Audit)
+}
+
+// Audit lists the audit log, verifying it has not been tampered with.
+var Audit = cmd.Sub{
+	Name:  "audit",
+	Short: "List and verify the audit log of builds, updates and cache deletions",
+	Flags: &AuditFlags{},
+	Run:   AuditRun,
+}
+
+// AuditFlags are flags for the "audit" sub-command.
+type AuditFlags struct {
+	JSON   bool `short:"j" long:"json"   desc:"Print the audit records as JSON"`
+	Repair bool `          long:"repair" desc:"Remove an incomplete final record left by an interrupted write"`
+}
+
+// AuditRun carries out the "audit" sub-command.
+func AuditRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*AuditFlags)  //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if sFlags.Repair {
+		if os.Geteuid() != 0 {
+			log.Panic("You must be root to repair the audit log")
+		}
+
+		removed, err := builder.RepairAudit(builder.AuditLogPath)
+		if err != nil {
+			log.Panic("Failed to repair audit log", "err", err)
+		}
+
+		slog.Info("Repaired audit log", "path", builder.AuditLogPath, "removed_bytes", removed)
+	}
+
+	records, err := builder.ReadAudit(builder.AuditLogPath)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("No audit log found", "path", builder.AuditLogPath)
+		return
+	}
+
+	if err != nil && !errors.Is(err, builder.ErrAuditTampered) && !errors.Is(err, builder.ErrAuditTorn) {
+		log.Panic("Failed to read audit log", "err", err)
+	}
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(records); err != nil {
+			log.Panic("Failed to encode audit records", "err", err)
+		}
+	} else {
+		for _, rec := range records {
+			fmt.Printf("%s  %-12s  %-12s  %-7s  %s %s\n", rec.End.Local().Format("2006-01-02 15:04:05"),
+				rec.User, rec.Operation, rec.Result, rec.Profile, rec.Package)
+		}
+	}
+
+	// Only the records up to the broken link can be trusted
+	if err != nil {
+		slog.Error("Audit log failed verification", "path", builder.AuditLogPath, "err", err)
+		os.Exit(1)
+	}
+}
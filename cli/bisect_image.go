@@ -0,0 +1,181 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&BisectImage)
+}
+
+// BisectImage finds the image update which broke the build of a package.
+var BisectImage = cmd.Sub{
+	Name:  "bisect-image",
+	Short: "Find the image update which broke the build of a package",
+	Flags: &BisectImageFlags{},
+	Args:  &BisectImageArgs{},
+	Run:   BisectImageRun,
+}
+
+// BisectImageFlags are flags for the "bisect-image" sub-command.
+type BisectImageFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the report as JSON"`
+}
+
+// BisectImageArgs are arguments for the "bisect-image" sub-command.
+type BisectImageArgs struct {
+	Path []string `zero:"yes" desc:"Location of [package.yml|pspec.xml] file to build."`
+}
+
+// BisectImageRun carries out the "bisect-image" sub-command.
+func BisectImageRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)      //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*BisectImageFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*BisectImageArgs)    //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	pkgPath := strings.Join(sArgs.Path, "")
+	if len(pkgPath) == 0 {
+		pkgPath = FindLikelyArg()
+	}
+
+	if len(pkgPath) == 0 {
+		log.Panic("No package.yml or pspec.xml file in current directory and no file provided.")
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to bisect images")
+	}
+
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+
+	image := manager.GetImage()
+
+	gens, err := image.Generations()
+	if err != nil {
+		log.Panic("Failed to list image generations", "err", err)
+	}
+
+	if len(gens) == 0 {
+		log.Panic("No image generations are stored to bisect, set image_generations in solbuild.conf(5) to keep them")
+	}
+
+	candidates := make([]string, 0, len(gens)+1)
+	for _, gen := range gens {
+		candidates = append(candidates, gen.ID)
+	}
+
+	candidates = append(candidates, builder.CurrentGeneration)
+
+	outputDir, err := os.MkdirTemp("", "solbuild-bisect-")
+	if err != nil {
+		log.Panic("Failed to create output directory", "err", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	if pkgPath, err = filepath.Abs(pkgPath); err != nil {
+		log.Panic("Failed to find package", "err", err)
+	}
+
+	build, err := builder.BisectBuilder(manager.GetProfile().Name, pkgPath, outputDir, bisectGlobalFlags(rFlags))
+	if err != nil {
+		log.Panic("Failed to bisect image", "err", err)
+	}
+
+	good, bad, err := builder.Bisect(candidates, build)
+	if errors.Is(err, builder.ErrBisectNoFailure) {
+		slog.Info(err.Error())
+		return
+	}
+
+	if err != nil {
+		log.Panic("Failed to bisect image", "err", err)
+	}
+
+	report, err := builder.NewBisectReport(image, candidates[good], candidates[bad])
+	if err != nil {
+		log.Panic("Failed to create bisect report", "err", err)
+	}
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(report); err != nil {
+			log.Panic("Failed to encode bisect report", "err", err)
+		}
+
+		return
+	}
+
+	if err := report.Write(os.Stdout); err != nil {
+		log.Panic("Failed to write bisect report", "err", err)
+	}
+}
+
+// bisectGlobalFlags are the global flags to pass on to each build.
+func bisectGlobalFlags(rFlags *GlobalFlags) (global []string) {
+	if rFlags.Debug {
+		global = append(global, "-d")
+	}
+
+	if rFlags.NoColor {
+		global = append(global, "-n")
+	}
+
+	if rFlags.ProfileDir != "" {
+		global = append(global, "--profile-dir", rFlags.ProfileDir)
+	}
+
+	if rFlags.Eopkg != "" {
+		global = append(global, "--eopkg-bin", rFlags.Eopkg)
+	}
+
+	if rFlags.YPKG != "" {
+		global = append(global, "--ypkg-bin", rFlags.YPKG)
+	}
+
+	return global
+}
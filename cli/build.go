@@ -24,7 +24,6 @@ import (
 	"strings"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
-	login "github.com/coreos/go-systemd/v22/login1"
 
 	"github.com/getsolus/solbuild/builder"
 	"github.com/getsolus/solbuild/cli/log"
@@ -52,6 +51,34 @@ type BuildFlags struct {
 	TransitManifest string `          long:"transit-manifest"   desc:"Create transit manifest for the given target"`
 	ABIReport       bool   `short:"r" long:"disable-abi-report" desc:"Don't generate an ABI report of the completed build"`
 	History         bool   `short:"h" long:"history"            desc:"Enable history generation for this build"`
+	HistoryFile     string `          long:"history-file"       desc:"Use a pre-generated history.xml instead of git history"`
+	Secret          string `          long:"secret"             desc:"Expose secrets to the build, e.g. name=path[,name=path]"`
+	Toolchain       string `          long:"toolchain"          desc:"Mount local tooling over that of the image, e.g. SRC:DEST[,SRC:DEST]"`
+	Locale          string `          long:"locale"             desc:"Set the locale used within the build, e.g. de_DE.UTF-8"`
+	Timezone        string `          long:"timezone"           desc:"Set the timezone used within the build, e.g. Europe/Berlin"`
+	CheckImage      bool   `          long:"check-image"        desc:"Check the image for damage before building"`
+	Locked          bool   `          long:"locked"             desc:"Require floating git refs to be locked in sources.lock"`
+	UpdateLock      bool   `          long:"update-lock"        desc:"Resolve floating git refs again and update sources.lock"`
+	LowMemory       bool   `          long:"lowmem"             desc:"Tune the build for hosts with little memory"`
+	CI              bool   `          long:"ci"                 desc:"Build within a container, such as Docker or Podman in CI"`
+	Verify          bool   `          long:"verify"             desc:"Verify the image against its recorded hash before building"`
+	Force           bool   `          long:"force"              desc:"Build even if the release is not newer than the published one"`
+	AcceptNewHash   bool   `          long:"accept-new-hash"    desc:"Update package.yml when a source no longer matches its hash"`
+	Strict          bool   `          long:"strict"             desc:"Treat warnings that CI should enforce as errors"`
+	DiskQuota       string `          long:"disk-quota"         desc:"Limit the scratch space the build may use, e.g. 100G"`
+	Profiles        string `          long:"profiles"           desc:"Build with each of the profiles, e.g. main-x86_64,unstable-x86_64"`
+	FailFast        bool   `          long:"fail-fast"          desc:"Skip the remaining profiles once a build with --profiles fails"`
+	OutputDir       string `          long:"output-dir"         desc:"Collect the build artifacts into this directory"`
+	ArtifactLayout  string `          long:"artifact-layout"    desc:"Lay out the collected artifacts as flat, profile-dir or profile-suffix"`
+	NoState         bool   `          long:"no-state"           desc:"Ignore the persistent state of the package for a clean build"`
+	IsolateHome     bool   `          long:"isolate-home"       desc:"Give the build user a fresh tmpfs home"`
+	CaptureHome     bool   `          long:"capture-home"       desc:"Archive the home of the build user alongside the log if the build fails"`
+	CPUs            string `          long:"cpus"               desc:"Pin the build to these CPUs, e.g. 0-7,16-23"`
+	NUMANodes       string `          long:"numa-nodes"         desc:"Pin the build to the CPUs of these NUMA nodes, e.g. 1"`
+	RecipeType      string `          long:"recipe-type"        desc:"Treat the recipe as ypkg or legacy instead of detecting it"`
+	Compression     string `          long:"compression"        desc:"Compress the packages with this level: fast, max or 0-9"`
+	Quick           bool   `          long:"quick"              desc:"Skip the upgrade, check stage and ABI report for a fast, non-release build"`
+	ImageGeneration string `          long:"image-generation"   desc:"Build against a previous generation of the image, see bisect-image"`
 }
 
 // BuildArgs are arguments for the "build" sub-command.
@@ -81,6 +108,17 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 		builder.DisableABIReport = true
 	}
 
+	if sFlags.Quick {
+		if sFlags.TransitManifest != "" {
+			log.Panic("Quick builds are not fit for release, and cannot create a transit manifest")
+		}
+
+		slog.Warn("Quick build requested, the packages will not be fit for release")
+
+		builder.QuickBuild = true
+		builder.DisableABIReport = true
+	}
+
 	// Allow loading a build recipe from an arbitrary location
 	// (Convert from []string to string to allow usage of cli-ng's zero (optional) property.)
 	pkgPath := strings.Join(sArgs.Path, "")
@@ -96,6 +134,12 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 	if os.Geteuid() != 0 {
 		log.Panic("You must be root to run build packages")
 	}
+
+	if sFlags.Profiles != "" {
+		buildMatrix(sFlags)
+		return
+	}
+
 	// Initialise the build manager
 	manager, err := builder.NewManager()
 	if err != nil {
@@ -103,22 +147,169 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 	}
 
 	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
 
 	// Safety first...
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
 		os.Exit(1)
 	}
 
+	if sFlags.ImageGeneration != "" {
+		if err = manager.UseImageGeneration(sFlags.ImageGeneration); err != nil {
+			log.Panic("Failed to use image generation", "err", err)
+		}
+	}
+
 	// Enable history generation
 	if sFlags.History {
 		manager.Config.EnableHistory = true
 	}
 
-	pkg, err := builder.NewPackage(pkgPath)
+	if sFlags.CheckImage {
+		manager.Config.CheckImage = true
+	}
+
+	if sFlags.Locked && sFlags.UpdateLock {
+		log.Panic("Cannot update sources.lock in locked mode")
+	}
+
+	if sFlags.Locked {
+		builder.LockedSources = true
+	}
+
+	if sFlags.UpdateLock {
+		builder.UpdateSourceLock = true
+	}
+
+	if sFlags.LowMemory {
+		manager.Config.LowMemory = true
+	}
+
+	if sFlags.Force {
+		builder.ForceRelease = true
+	}
+
+	if sFlags.AcceptNewHash {
+		builder.AcceptNewHash = true
+	}
+
+	if sFlags.Verify {
+		builder.VerifyImage = true
+	}
+
+	if sFlags.NoState {
+		builder.IgnoreState = true
+	}
+
+	if sFlags.Strict {
+		manager.Config.Strict = true
+	}
+
+	if sFlags.IsolateHome {
+		manager.Config.IsolateHome = true
+	}
+
+	if sFlags.CaptureHome {
+		builder.CaptureHome = true
+	}
+
+	if sFlags.CI {
+		manager.Config.ContainerMode = string(builder.ContainerAlways)
+	}
+
+	if sFlags.DiskQuota != "" {
+		if _, err = builder.ParseByteSize(sFlags.DiskQuota); err != nil {
+			log.Panic("Invalid disk quota", "err", err)
+		}
+
+		manager.Config.DiskQuota = sFlags.DiskQuota
+	}
+
+	if sFlags.Locale != "" {
+		if err = builder.ValidateLocale(sFlags.Locale); err != nil {
+			log.Panic("Invalid locale", "err", err)
+		}
+
+		manager.Config.Locale = sFlags.Locale
+	}
+
+	if sFlags.Timezone != "" {
+		if err = builder.ValidateTimezone(sFlags.Timezone); err != nil {
+			log.Panic("Invalid timezone", "err", err)
+		}
+
+		manager.Config.Timezone = sFlags.Timezone
+	}
+
+	if sFlags.ArtifactLayout != "" {
+		if _, err = builder.ParseArtifactLayout(sFlags.ArtifactLayout); err != nil {
+			log.Panic("Invalid artifact layout", "err", err)
+		}
+
+		manager.Config.ArtifactLayout = sFlags.ArtifactLayout
+	}
+
+	if sFlags.Compression != "" {
+		if _, err = builder.ParseCompression(sFlags.Compression); err != nil {
+			log.Panic("Invalid compression", "err", err)
+		}
+
+		manager.Config.Compression = sFlags.Compression
+	}
+
+	if sFlags.CPUs != "" || sFlags.NUMANodes != "" {
+		if sFlags.CPUs != "" {
+			manager.Config.CPUs = sFlags.CPUs
+		}
+
+		if sFlags.NUMANodes != "" {
+			manager.Config.NUMANodes = sFlags.NUMANodes
+		}
+
+		if _, err = builder.ResolveAffinity(manager.Config.CPUs, manager.Config.NUMANodes); err != nil {
+			log.Panic("Invalid CPU affinity", "err", err)
+		}
+	}
+
+	recipeType, err := builder.ParsePackageType(sFlags.RecipeType)
+	if err != nil {
+		log.Panic("Invalid recipe type", "err", err)
+	}
+
+	pkg, err := builder.NewPackageAs(pkgPath, recipeType)
 	if err != nil {
 		log.Panic("Failed to load package", "err", err)
 	}
 
+	if sFlags.HistoryFile != "" {
+		if err = manager.SetHistoryFile(sFlags.HistoryFile); err != nil {
+			log.Panic("Failed to load history file", "err", err)
+		}
+	}
+
+	if sFlags.Secret != "" {
+		var secrets []*builder.Secret
+
+		for _, spec := range strings.Split(sFlags.Secret, ",") {
+			secret, err := builder.ParseSecret(strings.TrimSpace(spec))
+			if err != nil {
+				log.Panic("Failed to load secret", "err", err)
+			}
+
+			secrets = append(secrets, secret)
+		}
+
+		manager.SetSecrets(secrets)
+	}
+
+	if sFlags.Toolchain != "" {
+		manager.SetToolchain(parseToolchain(sFlags.Toolchain))
+	}
+
+	if sFlags.OutputDir != "" {
+		builder.OutputDir = sFlags.OutputDir
+	}
+
 	manager.SetManifestTarget(sFlags.TransitManifest)
 	// Set the package
 	if err = manager.SetPackage(pkg); err != nil {
@@ -129,6 +320,13 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 		os.Exit(1)
 	}
 
+	// Without any given, reuse the settings that worked last time
+	manager.RecallSettings(builder.BuildSettings{
+		EnableTmpfs: sFlags.Tmpfs,
+		TmpfsSize:   sFlags.Memory,
+		LowMemory:   sFlags.LowMemory,
+	})
+
 	// Handle tmpfs and memory size options
 	if sFlags.Tmpfs {
 		switch {
@@ -149,29 +347,79 @@ func BuildRun(r *cmd.Root, s *cmd.Sub) {
 		}
 	}
 
-	// Set a inhibitor lock to prevent system from accidentally going down
-	conn, err := login.New()
-	if err != nil {
-		slog.Error("org.freedesktop.login1: Failed to initialize dbus connection")
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := manager.Build(ctx); err != nil {
+		log.Panic("Failed to build packages", "err", err)
+	}
+
+	slog.Info("Building succeeded")
+}
+
+// buildMatrix builds the package with each of the given profiles in turn,
+// summarising the results.
+func buildMatrix(sFlags *BuildFlags) {
+	var profiles []string
+
+	for _, profile := range strings.Split(sFlags.Profiles, ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
 	}
 
-	if !conn.Connected() {
-		slog.Error("org.freedesktop.login1: Not connected to dbus system bus")
+	outputDir := sFlags.OutputDir
+	if outputDir == "" {
+		outputDir = "."
 	}
 
-	inhibitMsg := fmt.Sprintf("Build in Progress: %s-%s-%d. Please wait for the build to complete",
-		pkg.Name, pkg.Version, pkg.Release)
+	// Each profile is built into its own directory unless asked otherwise
+	layout := builder.LayoutProfileDir
+
+	if sFlags.ArtifactLayout != "" {
+		var err error
+		if layout, err = builder.ParseArtifactLayout(sFlags.ArtifactLayout); err != nil {
+			log.Panic("Invalid artifact layout", "err", err)
+		}
+	}
 
-	fd, err := conn.Inhibit("shutdown:idle:sleep", "solbuild", inhibitMsg, "block")
+	if layout == builder.LayoutFlat {
+		slog.Warn("The artifacts of each profile are collected into the same directory, and may collide")
+	}
+
+	results, err := builder.BuildMatrix(os.Args[1:], profiles, outputDir, layout, sFlags.FailFast)
 	if err != nil {
-		slog.Error("org.freedesktop.login1: Failed to send inhibitor lock")
+		log.Panic("Failed to build matrix", "err", err)
 	}
-	// defer release the inhibitor lock
-	defer fd.Close()
 
-	if err := manager.Build(); err != nil {
-		log.Panic("Failed to build packages", "err", err)
+	if err = builder.WriteMatrixSummary(os.Stdout, results); err != nil {
+		log.Panic("Failed to summarise matrix", "err", err)
 	}
 
-	slog.Info("Building succeeded")
+	switch builder.MatrixExitCode(results) {
+	case builder.MatrixExitFailure:
+		slog.Error("Failed to build with any profile")
+		os.Exit(builder.MatrixExitFailure)
+	case builder.MatrixExitPartial:
+		slog.Error("Failed to build with some profiles")
+		os.Exit(builder.MatrixExitPartial)
+	}
+
+	slog.Info("Building succeeded with all profiles")
+}
+
+// parseToolchain parses the comma separated toolchain mounts of the flag.
+func parseToolchain(spec string) []*builder.ToolchainMount {
+	var mounts []*builder.ToolchainMount
+
+	for _, mount := range strings.Split(spec, ",") {
+		toolchain, err := builder.ParseToolchainMount(strings.TrimSpace(mount))
+		if err != nil {
+			log.Panic("Invalid toolchain mount", "err", err)
+		}
+
+		mounts = append(mounts, toolchain)
+	}
+
+	return mounts
 }
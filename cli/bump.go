@@ -0,0 +1,104 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Bump)
+}
+
+// Bump increments the release of a package.yml, optionally updating its source.
+var Bump = cmd.Sub{
+	Name:  "bump",
+	Short: "Bump the release (and optionally version) of a package.yml",
+	Flags: &BumpFlags{},
+	Args:  &BumpArgs{},
+	Run:   BumpRun,
+}
+
+// BumpFlags are flags for the "bump" sub-command.
+//
+//nolint:tagalign
+type BumpFlags struct {
+	Source  string `short:"s" long:"source"  desc:"Update to the given source URL, recomputing its hash"`
+	Version string `          long:"version" desc:"Version to use with --source, guessed from the URL if unset"`
+	Commit  bool   `short:"c" long:"commit"  desc:"Create a git commit for the change"`
+}
+
+// BumpArgs are arguments for the "bump" sub-command.
+type BumpArgs struct {
+	Path []string `zero:"yes" desc:"Location of the package.yml file to bump."`
+}
+
+// BumpRun carries out the "bump" sub-command.
+func BumpRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*BumpFlags)   //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*BumpArgs)      //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	pkgPath := strings.Join(sArgs.Path, "")
+	if len(pkgPath) == 0 {
+		pkgPath = FindLikelyArg()
+	}
+
+	if !strings.HasSuffix(pkgPath, ".yml") {
+		log.Panic("No package.yml in current directory and no file provided.")
+	}
+
+	if sFlags.Version != "" && sFlags.Source == "" {
+		log.Panic("--version requires --source to be set")
+	}
+
+	res, err := builder.BumpRecipe(pkgPath, &builder.Bump{
+		Source:  sFlags.Source,
+		Version: sFlags.Version,
+	})
+	if err != nil {
+		log.Panic("Failed to bump package", "err", err)
+	}
+
+	slog.Info("Bumped package", "name", res.Package.Name, "version", res.Package.Version,
+		"release", res.Package.Release)
+
+	if !sFlags.Commit {
+		slog.Info("Suggested commit message", "message", res.Message)
+		return
+	}
+
+	if err := builder.CommitRecipe(pkgPath, res.Message); err != nil {
+		log.Panic("Failed to commit package", "err", err)
+	}
+
+	slog.Info("Committed change", "message", res.Message)
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
@@ -37,10 +38,20 @@ func init() {
 var Chroot = cmd.Sub{
 	Name:  "chroot",
 	Short: "Interactively chroot into the package's build environment",
+	Flags: &ChrootFlags{},
 	Args:  &ChrootArgs{},
 	Run:   ChrootRun,
 }
 
+// ChrootFlags are flags for the "chroot" sub-command.
+//
+//nolint:tagalign
+type ChrootFlags struct {
+	Shell      string `short:"s" long:"shell"       desc:"Login shell to spawn within the chroot, e.g. /bin/zsh"`
+	RecipeType string `          long:"recipe-type" desc:"Treat the recipe as ypkg or legacy instead of detecting it"`
+	Toolchain  string `          long:"toolchain"   desc:"Mount local tooling over that of the image, e.g. SRC:DEST[,SRC:DEST]"`
+}
+
 // ChrootArgs are arguments for the "chroot" sub-command.
 type ChrootArgs struct {
 	Path []string `zero:"yes" desc:"Chroot into the environment for a [package.yml|pspec.xml] receipe."`
@@ -49,6 +60,7 @@ type ChrootArgs struct {
 // ChrootRun carries out the "chroot" sub-command.
 func ChrootRun(r *cmd.Root, s *cmd.Sub) {
 	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ChrootFlags) //nolint:forcetypeassert // guaranteed by callee.
 	sArgs := s.Args.(*ChrootArgs)    //nolint:forcetypeassert // guaranteed by callee.
 
 	if rFlags.Debug {
@@ -84,13 +96,31 @@ func ChrootRun(r *cmd.Root, s *cmd.Sub) {
 	}
 
 	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	if sFlags.Shell != "" {
+		if !filepath.IsAbs(sFlags.Shell) {
+			log.Panic("The shell must be an absolute path: %s\n", sFlags.Shell)
+		}
+
+		manager.Config.ChrootShell = sFlags.Shell
+	}
+
+	if sFlags.Toolchain != "" {
+		manager.SetToolchain(parseToolchain(sFlags.Toolchain))
+	}
 
 	// Safety first...
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
 		os.Exit(1)
 	}
 
-	pkg, err := builder.NewPackage(pkgPath)
+	recipeType, err := builder.ParsePackageType(sFlags.RecipeType)
+	if err != nil {
+		log.Panic("Invalid recipe type", "err", err)
+	}
+
+	pkg, err := builder.NewPackageAs(pkgPath, recipeType)
 	if err != nil {
 		log.Panic("Failed to load package: %s\n", err)
 	}
@@ -103,7 +133,10 @@ func ChrootRun(r *cmd.Root, s *cmd.Sub) {
 		os.Exit(1)
 	}
 
-	if err := manager.Chroot(); err != nil {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := manager.Chroot(ctx); err != nil {
 		log.Panic("Chroot failure")
 	}
 
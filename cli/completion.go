@@ -0,0 +1,320 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Completion)
+
+	allSubs = []*cmd.Sub{
+		&ABIReport, &Audit, &BisectImage, &Build, &Bump, &Chroot, &Completion, &Config,
+		&Convert, &DeleteCache, &Deprecations, &Doctor, &ExportOCI, &ExportState, &ImportState,
+		&Index, &Init, &InspectImage, &LegacyStats, &Logs, &MigrateCache, &New, &Pool,
+		&PreloadPackages, &Prune, &Repos, &SelfTest, &ShowCache, &Update, &Version,
+	}
+}
+
+// Completion generates shell completions for solbuild.
+var Completion = cmd.Sub{
+	Name:  "completion",
+	Short: "Generate shell completions for bash, zsh or fish",
+	Args:  &CompletionArgs{},
+	Run:   CompletionRun,
+}
+
+// CompletionArgs are arguments for the "completion" sub-command.
+type CompletionArgs struct {
+	Shell string `desc:"Shell to generate completions for: bash, zsh or fish"`
+}
+
+// recipeCommands take the path of a recipe as their argument.
+var recipeCommands = []string{"build", "bump", "chroot", "convert"}
+
+// profileCommands take the name of a profile as their argument.
+var profileCommands = []string{"export-oci", "init", "inspect-image", "update"}
+
+// A completionFlag is a flag of a sub-command, as declared on its flag struct.
+type completionFlag struct {
+	Short string
+	Long  string
+	Desc  string
+	Value bool // Whether the flag takes a value
+}
+
+// names returns the flag as it may be typed.
+func (f completionFlag) names() (names []string) {
+	if f.Short != "" {
+		names = append(names, "-"+f.Short)
+	}
+
+	if f.Long != "" {
+		names = append(names, "--"+f.Long)
+	}
+
+	return names
+}
+
+// completionFlags finds the flags declared by the tags of a flag struct.
+func completionFlags(flags any) []completionFlag {
+	t := reflect.TypeOf(flags)
+	if t == nil {
+		return nil
+	}
+
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var ret []completionFlag
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+
+		flag := completionFlag{
+			Short: field.Tag.Get("short"),
+			Long:  field.Tag.Get("long"),
+			Desc:  field.Tag.Get("desc"),
+			Value: field.Type.Kind() != reflect.Bool,
+		}
+
+		if flag.Short != "" || flag.Long != "" {
+			ret = append(ret, flag)
+		}
+	}
+
+	return ret
+}
+
+// allSubs are every sub-command, set on init as Completion refers to itself.
+var allSubs []*cmd.Sub
+
+// completionSubs returns every sub-command, sorted by name.
+func completionSubs() []*cmd.Sub {
+	subs := append([]*cmd.Sub(nil), allSubs...)
+
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Name < subs[j].Name
+	})
+
+	return subs
+}
+
+// subNames returns the name of the sub-command followed by its alias.
+func subNames(sub *cmd.Sub) []string {
+	if sub.Alias == "" {
+		return []string{sub.Name}
+	}
+
+	return []string{sub.Name, sub.Alias}
+}
+
+// CompletionRun carries out the "completion" sub-command.
+func CompletionRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)  //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*CompletionArgs) //nolint:forcetypeassert // guaranteed by callee.
+
+	switch sArgs.Shell {
+	case "bash":
+		writeBashCompletion(os.Stdout, false)
+	case "zsh":
+		writeBashCompletion(os.Stdout, true)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	case "profiles":
+		// Used by the completions to list the profiles as they are typed
+		config, err := builder.NewConfig()
+		if err != nil {
+			os.Exit(1)
+		}
+
+		names, err := builder.ProfileNames(config, rFlags.ProfileDir)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		fmt.Println(strings.Join(names, "\n"))
+	default:
+		log.Panic("Unknown shell, expected bash, zsh or fish", "shell", sArgs.Shell)
+	}
+}
+
+// writeBashCompletion writes the completion function for bash, loaded
+// through bashcompinit for zsh.
+func writeBashCompletion(w io.Writer, zsh bool) {
+	var global []string
+	for _, flag := range completionFlags(&GlobalFlags{}) {
+		global = append(global, flag.names()...)
+	}
+
+	var commands []string
+	for _, sub := range completionSubs() {
+		commands = append(commands, subNames(sub)...)
+	}
+
+	if zsh {
+		fmt.Fprintln(w, "#compdef solbuild")
+		fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+	}
+
+	fmt.Fprintln(w, "# Generated by solbuild completion, do not edit")
+	fmt.Fprintf(w, `_solbuild()
+{
+  local cur prev command options
+  COMPREPLY=()
+  cur=${COMP_WORDS[COMP_CWORD]}
+  prev=${COMP_WORDS[COMP_CWORD-1]}
+
+  case "$prev" in
+    -p|--profile)
+      COMPREPLY=($(compgen -W "$(solbuild completion profiles 2> /dev/null)" -- "$cur"))
+      return 0
+      ;;
+    --profile-dir)
+      COMPREPLY=($(compgen -d -- "$cur"))
+      return 0
+      ;;
+  esac
+
+  if [[ $COMP_CWORD -eq 1 ]]; then
+    COMPREPLY=($(compgen -W "%s help --help" -- "$cur"))
+    return 0
+  fi
+
+  command=${COMP_WORDS[1]}
+  options="%s"
+
+  case "$command" in
+`, strings.Join(commands, " "), strings.Join(global, " "))
+
+	for _, sub := range completionSubs() {
+		var names []string
+		for _, flag := range completionFlags(sub.Flags) {
+			names = append(names, flag.names()...)
+		}
+
+		if len(names) > 0 {
+			fmt.Fprintf(w, "    %s)\n      options=\"$options %s\"\n      ;;\n",
+				strings.Join(subNames(sub), "|"), strings.Join(names, " "))
+		}
+	}
+
+	fmt.Fprintf(w, `  esac
+
+  if [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "$options" -- "$cur"))
+    return 0
+  fi
+
+  case "$command" in
+    %s)
+      COMPREPLY=($(compgen -d -- "$cur") $(compgen -f -X '!*.yml' -- "$cur") \
+        $(compgen -f -X '!*.yaml' -- "$cur") $(compgen -f -X '!*.xml' -- "$cur"))
+      ;;
+    %s)
+      COMPREPLY=($(compgen -W "$(solbuild completion profiles 2> /dev/null)" -- "$cur"))
+      ;;
+    *)
+      COMPREPLY=($(compgen -f -- "$cur"))
+      ;;
+  esac
+}
+complete -F _solbuild -o filenames solbuild
+`, strings.Join(recipeCommands, "|"), strings.Join(profileCommands, "|"))
+}
+
+// fishQuote quotes the string for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// fishProfiles lists the profiles as they are typed.
+const fishProfiles = "'(solbuild completion profiles 2> /dev/null)'"
+
+// writeFishFlag writes the completion of a flag, for the condition if any.
+// The value of the flag is completed from args when given.
+func writeFishFlag(w io.Writer, cond string, flag completionFlag, args string) {
+	line := "complete -c solbuild"
+
+	if cond != "" {
+		line += " -n " + fishQuote(cond)
+	}
+
+	if flag.Short != "" {
+		line += " -s " + flag.Short
+	}
+
+	if flag.Long != "" {
+		line += " -l " + flag.Long
+	}
+
+	switch {
+	case args != "":
+		line += " -x -a " + args
+	case flag.Value:
+		line += " -r"
+	}
+
+	fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(flag.Desc))
+}
+
+// writeFishCompletion writes the completions for fish.
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# Generated by solbuild completion, do not edit")
+	fmt.Fprintln(w, "complete -c solbuild -f")
+
+	for _, flag := range completionFlags(&GlobalFlags{}) {
+		args := ""
+		if flag.Long == "profile" {
+			args = fishProfiles
+		}
+
+		writeFishFlag(w, "", flag, args)
+	}
+
+	for _, sub := range completionSubs() {
+		for _, name := range subNames(sub) {
+			fmt.Fprintf(w, "complete -c solbuild -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(sub.Short))
+		}
+
+		cond := "__fish_seen_subcommand_from " + strings.Join(subNames(sub), " ")
+
+		for _, flag := range completionFlags(sub.Flags) {
+			writeFishFlag(w, cond, flag, "")
+		}
+	}
+
+	fmt.Fprintf(w, "complete -c solbuild -n %s -F\n", fishQuote("__fish_seen_subcommand_from "+strings.Join(recipeCommands, " ")))
+	fmt.Fprintf(w, "complete -c solbuild -n %s -x -a %s\n",
+		fishQuote("__fish_seen_subcommand_from "+strings.Join(profileCommands, " ")), fishProfiles)
+}
@@ -0,0 +1,86 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Config)
+}
+
+// Config reports the effective configuration of solbuild.
+var Config = cmd.Sub{
+	Name:  "config",
+	Short: "Export the effective configuration to compare build hosts",
+	Args:  &ConfigArgs{},
+	Run:   ConfigRun,
+}
+
+// ConfigArgs are arguments for the "config" sub-command.
+type ConfigArgs struct {
+	Action string `desc:"Action to perform, only export is supported"`
+}
+
+// ConfigRun carries out the "config" sub-command.
+func ConfigRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*ConfigArgs)    //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if sArgs.Action != "export" {
+		log.Panic("Unknown config action, expected export", "action", sArgs.Action)
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to export the configuration")
+	}
+
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	snapshot, err := manager.ExportConfig()
+	if err != nil {
+		log.Panic("Failed to export configuration", "err", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err = enc.Encode(snapshot); err != nil {
+		log.Panic("Failed to encode configuration", "err", err)
+	}
+}
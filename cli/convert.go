@@ -0,0 +1,91 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Convert)
+}
+
+// Convert generates a package.yml from a legacy pspec.xml.
+var Convert = cmd.Sub{
+	Name:  "convert",
+	Short: "Convert a pspec.xml and actions.py into a package.yml",
+	Flags: &ConvertFlags{},
+	Args:  &ConvertArgs{},
+	Run:   ConvertRun,
+}
+
+// ConvertFlags are flags for the "convert" sub-command.
+type ConvertFlags struct {
+	Output string `short:"o" long:"output" desc:"Directory to write the recipe into (default: alongside the pspec.xml)"`
+}
+
+// ConvertArgs are arguments for the "convert" sub-command.
+type ConvertArgs struct {
+	Path []string `zero:"yes" desc:"Location of the pspec.xml file to convert"`
+}
+
+// ConvertRun carries out the "convert" sub-command.
+func ConvertRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)  //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ConvertFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*ConvertArgs)    //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	pspec := strings.Join(sArgs.Path, "")
+	if pspec == "" {
+		pspec = "pspec.xml"
+	}
+
+	conv, err := builder.ConvertPspec(pspec)
+	if err != nil {
+		log.Panic("Failed to convert pspec.xml", "path", pspec, "err", err)
+	}
+
+	outDir := sFlags.Output
+	if outDir == "" {
+		outDir = filepath.Dir(pspec)
+	}
+
+	if err = conv.Write(outDir); err != nil {
+		log.Panic("Failed to write package.yml", "err", err)
+	}
+
+	for _, todo := range conv.TODOs {
+		slog.Warn("Needs manual conversion", "todo", todo)
+	}
+
+	slog.Info("Generated package.yml, review every TODO before building", "dir", outDir, "todos", len(conv.TODOs))
+}
@@ -22,6 +22,7 @@ import (
 	"log/slog"
 	"math"
 	"os"
+	"time"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
 	"github.com/charlievieth/fastwalk"
@@ -46,7 +47,7 @@ var DeleteCache = cmd.Sub{
 
 // DeleteCacheFlags are the flags for the "delete-cache" sub-command.
 type DeleteCacheFlags struct {
-	All    bool `short:"a" long:"all"    desc:"Additionally delete (s)ccache, packages and sources"`
+	All    bool `short:"a" long:"all"    desc:"Additionally delete (s)ccache, packages, state and sources"`
 	Images bool `short:"i" long:"images" desc:"Additionally delete solbuild images"`
 	Sizes  bool `short:"s" long:"sizes"  desc:"Deprecated: use 'show-cache' instead"`
 }
@@ -75,6 +76,7 @@ func DeleteCacheRun(r *cmd.Root, s *cmd.Sub) {
 
 	// If sizes is requested just print disk usage of caches and return
 	if sFlags.Sizes {
+		builder.WarnDeprecated(builder.DeprecationCacheSizes)
 		showCacheSizes(manager)
 
 		return
@@ -92,6 +94,7 @@ func DeleteCacheRun(r *cmd.Root, s *cmd.Sub) {
 			builder.ObsoleteLegacyCcacheDirectory,
 			builder.ObsoleteLegacySccacheDirectory,
 			builder.PackageCacheDirectory,
+			builder.StateDirectory,
 			source.SourceDir,
 		}...)
 	}
@@ -100,12 +103,19 @@ func DeleteCacheRun(r *cmd.Root, s *cmd.Sub) {
 		nukeDirs = append(nukeDirs, []string{builder.ImagesDir}...)
 	}
 
-	var totalSize int64
+	var (
+		totalSize int64
+		failure   error
+	)
+
+	start := time.Now()
 
 	for _, p := range nukeDirs {
 		size, err := deleteDir(p)
 		if err != nil {
 			slog.Warn(fmt.Sprintf("Failed to remove cache directory '%s', reason: '%s'\n", p, err))
+
+			failure = err
 		}
 
 		slog.Info(fmt.Sprintf("Removed cache directory '%s', of size '%s", p, humanReadableFormat(float64(size))))
@@ -116,6 +126,13 @@ func DeleteCacheRun(r *cmd.Root, s *cmd.Sub) {
 	if totalSize > 0 {
 		slog.Info(fmt.Sprintf("Total restored size: '%s'\n", humanReadableFormat(float64(totalSize))))
 	}
+
+	rec := builder.NewAuditRecord(builder.AuditDeleteCache, start, failure)
+	rec.Paths = nukeDirs
+
+	if err := manager.Audit(rec); err != nil {
+		log.Panic("Failed to audit cache deletion", "err", err)
+	}
 }
 
 func deleteDir(path string) (int64, error) {
@@ -167,42 +184,6 @@ func deleteDir(path string) (int64, error) {
 	return totalSize, err
 }
 
-// getDirSize returns the disk usage of a directory.
-func getDirSize(path string) (int64, error) {
-	var totalSize int64
-
-	// Return nothing if dir doesn't exist
-	_, err := os.Stat(path)
-	if os.IsNotExist(err) {
-		slog.Debug("Directory doesn't exist", "path", path)
-		return 0, nil
-	}
-
-	walkConf := fastwalk.Config{
-		Follow: false,
-	}
-
-	// Walk the dir, get size, add to totalSize
-	err = fastwalk.Walk(&walkConf, path, func(_ string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !d.IsDir() {
-			file, err2 := d.Info()
-			if err2 != nil {
-				return err2
-			}
-
-			totalSize += file.Size()
-		}
-
-		return err
-	})
-
-	return totalSize, err
-}
-
 // humanReadableFormat pretty prints a float64 input into a human friendly string in IEC format.
 func humanReadableFormat(i float64) string {
 	if i <= 0 {
@@ -0,0 +1,102 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Deprecations)
+}
+
+// Deprecations lists the deprecated flags, configuration and paths.
+var Deprecations = cmd.Sub{
+	Name:  "deprecations",
+	Short: "List deprecated behaviour and what replaces it",
+	Flags: &DeprecationsFlags{},
+	Run:   DeprecationsRun,
+}
+
+// DeprecationsFlags are the flags for the "deprecations" sub-command.
+type DeprecationsFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the deprecations as JSON"`
+}
+
+// deprecationEntry is a deprecation, and whether it is in use on this host.
+type deprecationEntry struct {
+	builder.Deprecation
+	InUse bool `json:"in_use"`
+}
+
+// DeprecationsRun carries out the "deprecations" sub-command.
+func DeprecationsRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)       //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*DeprecationsFlags) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	active := make(map[string]bool)
+	for _, dep := range builder.ActiveDeprecations() {
+		active[dep.ID] = true
+	}
+
+	entries := make([]deprecationEntry, 0, len(builder.Deprecations))
+	for _, dep := range builder.Deprecations {
+		entries = append(entries, deprecationEntry{dep, active[dep.ID]})
+	}
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(entries); err != nil {
+			log.Panic("Failed to encode deprecations", "err", err)
+		}
+
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tSUBJECT\tREPLACEMENT\tIN USE")
+
+	for _, entry := range entries {
+		inUse := "no"
+		if entry.InUse {
+			inUse = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.ID, entry.Kind, entry.Subject, entry.Replacement, inUse)
+	}
+
+	tw.Flush()
+}
@@ -0,0 +1,100 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Doctor)
+}
+
+// Doctor reports the features of the host kernel used by solbuild, and any
+// deprecated behaviour still in use on the host.
+var Doctor = cmd.Sub{
+	Name:  "doctor",
+	Short: "Check the host kernel supports everything solbuild needs",
+	Flags: &DoctorFlags{},
+	Run:   DoctorRun,
+}
+
+// DoctorFlags are the flags for the "doctor" sub-command.
+type DoctorFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the host features as JSON"`
+}
+
+// DoctorRun carries out the "doctor" sub-command.
+func DoctorRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*DoctorFlags) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	features := builder.Probe()
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(features); err != nil {
+			log.Panic("Failed to encode host features", "err", err)
+		}
+
+		return
+	}
+
+	fmt.Printf("%-22s %s\n", "Kernel", features.Kernel)
+	fmt.Printf("%-22s %t\n", "Overlayfs", features.Overlay)
+	fmt.Printf("%-22s %t\n", "Overlayfs metacopy", features.OverlayMetacopy)
+	fmt.Printf("%-22s %t\n", "Overlayfs redirect_dir", features.OverlayRedirectDir)
+	fmt.Printf("%-22s %t\n", "User namespaces", features.UserNamespaces)
+	fmt.Printf("%-22s %t\n", "Idmapped mounts", features.IDMappedMounts)
+	fmt.Printf("%-22s %t\n", "Loop devices", features.LoopDevices)
+	fmt.Printf("%-22s %d\n", "Cgroup version", features.CgroupVersion)
+	fmt.Printf("%-22s %t\n", "Container", builder.InContainer())
+
+	active := builder.ActiveDeprecations()
+	fmt.Printf("%-22s %d\n", "Deprecations in use", len(active))
+
+	for _, dep := range active {
+		builder.WarnDeprecated(dep.ID)
+	}
+
+	problems := features.Problems()
+	for _, problem := range problems {
+		slog.Error(problem)
+	}
+
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,111 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&ExportOCI)
+}
+
+// ExportOCI writes a profile's backing image as an OCI image archive.
+var ExportOCI = cmd.Sub{
+	Name:  "export-oci",
+	Short: "Export a profile's image as an OCI image for podman or docker",
+	Flags: &ExportOCIFlags{},
+	Args:  &ExportOCIArgs{},
+	Run:   ExportOCIRun,
+}
+
+// ExportOCIFlags are flags for the "export-oci" sub-command.
+type ExportOCIFlags struct {
+	Output string `short:"o" long:"output" desc:"Write the image to this file (default: [profile].oci.tar)"`
+}
+
+// ExportOCIArgs are arguments for the "export-oci" sub-command.
+type ExportOCIArgs struct {
+	Profile []string `zero:"yes" desc:"Profile whose image is exported"`
+}
+
+// ExportOCIRun carries out the "export-oci" sub-command.
+func ExportOCIRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)    //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ExportOCIFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*ExportOCIArgs)    //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to export images")
+	}
+
+	if len(sArgs.Profile) > 1 {
+		log.Panic("Only one profile may be exported at a time")
+	}
+
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	profile := rFlags.Profile
+	if len(sArgs.Profile) == 1 {
+		profile = sArgs.Profile[0]
+	}
+
+	if err = manager.SetProfile(profile); err != nil {
+		os.Exit(1)
+	}
+
+	output := sFlags.Output
+	if output == "" {
+		output = manager.GetProfile().Name + ".oci.tar"
+	}
+
+	if output, err = filepath.Abs(output); err != nil {
+		log.Panic("Invalid output file", "err", err)
+	}
+
+	if err = manager.ExportOCI(output); err != nil {
+		if errors.Is(err, builder.ErrProfileNotInstalled) {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+
+		log.Panic("Failed to export image", "err", err)
+	}
+
+	slog.Info("Exported image", "path", output)
+}
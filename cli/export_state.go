@@ -0,0 +1,81 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&ExportState)
+}
+
+// ExportState bundles the solbuild state to seed another builder.
+var ExportState = cmd.Sub{
+	Name:  "export-state",
+	Short: "Bundle images, caches, packages and sources to seed another builder",
+	Flags: &ExportStateFlags{},
+	Args:  &ExportStateArgs{},
+	Run:   ExportStateRun,
+}
+
+// ExportStateFlags are the flags for the "export-state" sub-command.
+type ExportStateFlags struct {
+	Parts string `short:"p" long:"parts" desc:"Comma separated parts to export: caches, images, packages, sources (default: all)"`
+}
+
+// ExportStateArgs are arguments for the "export-state" sub-command.
+type ExportStateArgs struct {
+	Dest string `desc:"Directory, or .tar archive, to export the state to"`
+}
+
+// ExportStateRun carries out the "export-state" sub-command.
+func ExportStateRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)      //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ExportStateFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*ExportStateArgs)    //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to export state")
+	}
+
+	parts, err := builder.ParseBundleParts(builder.BundleRoot, sFlags.Parts)
+	if err != nil {
+		log.Panic("Invalid parts", "err", err)
+	}
+
+	manifest, err := builder.ExportState(builder.BundleRoot, sArgs.Dest, parts)
+	if err != nil {
+		log.Panic("Failed to export state", "err", err)
+	}
+
+	slog.Info("Exported state", "files", len(manifest.Files), "dest", sArgs.Dest)
+}
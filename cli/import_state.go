@@ -0,0 +1,69 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&ImportState)
+}
+
+// ImportState seeds this builder from a bundle created by "export-state".
+var ImportState = cmd.Sub{
+	Name:  "import-state",
+	Short: "Verify and import a state bundle created by export-state",
+	Args:  &ImportStateArgs{},
+	Run:   ImportStateRun,
+}
+
+// ImportStateArgs are arguments for the "import-state" sub-command.
+type ImportStateArgs struct {
+	Src string `desc:"Directory, or .tar archive, to import the state from"`
+}
+
+// ImportStateRun carries out the "import-state" sub-command.
+func ImportStateRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)   //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*ImportStateArgs) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to import state")
+	}
+
+	imported, err := builder.ImportState(builder.BundleRoot, sArgs.Src)
+	if err != nil {
+		log.Panic("Failed to import state", "err", err)
+	}
+
+	slog.Info("Imported state", "files", imported)
+}
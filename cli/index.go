@@ -76,6 +76,7 @@ func IndexRun(r *cmd.Root, s *cmd.Sub) {
 	}
 
 	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
 
 	// Safety first...
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
@@ -92,7 +93,10 @@ func IndexRun(r *cmd.Root, s *cmd.Sub) {
 
 	manager.SetTmpfs(sFlags.Tmpfs, sFlags.Memory)
 
-	if err := manager.Index(args.Dir); err != nil {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := manager.Index(ctx, args.Dir); err != nil {
 		log.Panic("Index failure")
 	}
 
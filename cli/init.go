@@ -17,15 +17,11 @@
 package cli
 
 import (
-	"errors"
-	"fmt"
-	"io"
+	"context"
 	"log/slog"
-	"net/http"
 	"os"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
-	"github.com/cheggaaa/pb/v3"
 	"github.com/getsolus/libosdev/commands"
 
 	"github.com/getsolus/solbuild/builder"
@@ -76,6 +72,7 @@ func InitRun(r *cmd.Root, s *cmd.Sub) {
 	}
 
 	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
 
 	// Safety first...
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
@@ -83,16 +80,19 @@ func InitRun(r *cmd.Root, s *cmd.Sub) {
 		panic(err)
 	}
 
-	doInit(manager)
+	ctx, stop := interruptContext()
+	defer stop()
+
+	doInit(ctx, manager)
 
 	if sFlags.AutoUpdate {
-		doUpdate(manager)
+		doUpdate(ctx, manager)
 	}
 }
 
-func doInit(manager *builder.Manager) {
+func doInit(ctx context.Context, manager *builder.Manager) {
 	prof := manager.GetProfile()
-	bk := builder.NewBackingImage(prof.Image)
+	bk := manager.GetImage()
 
 	if bk.IsInstalled() {
 		slog.Warn("Image has already been initialised", "name", prof.Name)
@@ -109,9 +109,9 @@ func doInit(manager *builder.Manager) {
 
 		slog.Debug("Created images directory", "path", imgDir)
 	}
-	// Now ensure we actually have said image
+	// Now ensure we actually have said image, resuming any partial download
 	if !bk.IsFetched() {
-		if err := downloadImage(bk); err != nil {
+		if err := bk.Fetch(ctx); err != nil {
 			slog.Error("Failed to download image", "err", err)
 			panic(err)
 		}
@@ -119,7 +119,7 @@ func doInit(manager *builder.Manager) {
 	// Decompress the image
 	slog.Debug("Decompressing backing image", "source", bk.ImagePathXZ, "target", bk.ImagePath)
 
-	if err := commands.ExecStdoutArgsDir(builder.ImagesDir, "unxz", []string{"-T0", bk.ImagePathXZ}); err != nil {
+	if err := bk.Decompress(); err != nil {
 		slog.Error("Failed to decompress image", "source", bk.ImagePathXZ, "err", err)
 		panic(err)
 	}
@@ -127,57 +127,9 @@ func doInit(manager *builder.Manager) {
 	slog.Info("Profile successfully initialised")
 }
 
-// Downloads an image using net/http.
-func downloadImage(bk *builder.BackingImage) (err error) {
-	file, err := os.Create(bk.ImagePathXZ)
-	if err != nil {
-		return fmt.Errorf("failed to create file '%s', reason: '%w'", bk.ImagePathXZ, err)
-	}
-
-	defer func() {
-		if err != nil {
-			os.Remove(bk.ImagePathXZ)
-		}
-	}()
-	defer file.Close()
-
-	resp, err := http.Get(bk.ImageURI)
-	if err != nil {
-		return fmt.Errorf("failed to fetch image '%s', reason: '%w'", bk.ImageURI, err)
-	}
-
-	defer resp.Body.Close()
-	bar := pb.New64(resp.ContentLength).Set(pb.Bytes, true)
-	reader := bar.NewProxyReader(resp.Body)
-	bar.Start()
-
-	defer bar.Finish()
-
-	bytesRemaining := resp.ContentLength
-	done := false
-	buf := make([]byte, 32*1024)
-
-	for !done {
-		bytesRead, err := reader.Read(buf)
-		if errors.Is(err, io.EOF) {
-			done = true
-		} else if err != nil {
-			return fmt.Errorf("failed to fetch image '%s', reason: '%w'", bk.ImageURI, err)
-		}
-
-		if _, err = file.Write(buf[:bytesRead]); err != nil {
-			return fmt.Errorf("failed to write image '%s', reason: '%w'", bk.ImagePathXZ, err)
-		}
-
-		bytesRemaining -= int64(bytesRead)
-	}
-
-	return nil
-}
-
 // doUpdate will perform an update to the image after the initial init stage.
-func doUpdate(manager *builder.Manager) {
-	if err := manager.Update(); err != nil {
+func doUpdate(ctx context.Context, manager *builder.Manager) {
+	if err := manager.Update(ctx); err != nil {
 		slog.Error("Update failed", "reason", err)
 	}
 }
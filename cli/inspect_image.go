@@ -0,0 +1,112 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&InspectImage)
+}
+
+// InspectImage looks inside a profile's backing image without a chroot.
+var InspectImage = cmd.Sub{
+	Name:  "inspect-image",
+	Short: "Mount a profile's image read-only to look inside it",
+	Args:  &InspectImageArgs{},
+	Run:   InspectImageRun,
+}
+
+// InspectImageArgs are arguments for the "inspect-image" sub-command.
+type InspectImageArgs struct {
+	Args []string `zero:"yes" desc:"[profile] followed by absolute paths within the image to list or print"`
+}
+
+// InspectImageRun carries out the "inspect-image" sub-command.
+func InspectImageRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)    //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*InspectImageArgs) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to inspect images")
+	}
+
+	// Paths within the image are absolute, so anything else is a profile
+	profile := rFlags.Profile
+	paths := sArgs.Args
+
+	if len(paths) > 0 && !strings.HasPrefix(paths[0], "/") {
+		profile = paths[0]
+		paths = paths[1:]
+	}
+
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	if err = manager.SetProfile(profile); err != nil {
+		os.Exit(1)
+	}
+
+	err = manager.InspectImage(func(root string) error {
+		if len(paths) == 0 {
+			fmt.Printf("Image mounted read-only at %s\nPress Enter to unmount it\n", root)
+
+			// Any input, or stdin closing, ends the inspection
+			bufio.NewReader(os.Stdin).ReadString('\n')
+
+			return nil
+		}
+
+		for _, path := range paths {
+			if err := builder.InspectPath(os.Stdout, root, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, builder.ErrProfileNotInstalled) {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+
+		log.Panic("Failed to inspect image", "err", err)
+	}
+}
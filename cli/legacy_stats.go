@@ -0,0 +1,86 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&LegacyStats)
+}
+
+// LegacyStats shows how often legacy pspec.xml packages are still built.
+var LegacyStats = cmd.Sub{
+	Name:  "legacy-stats",
+	Short: "Show the legacy pspec.xml packages built on this host",
+	Flags: &LegacyStatsFlags{},
+	Run:   LegacyStatsRun,
+}
+
+// LegacyStatsFlags are the flags for the "legacy-stats" sub-command.
+type LegacyStatsFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the legacy builds as JSON"`
+}
+
+// LegacyStatsRun carries out the "legacy-stats" sub-command.
+func LegacyStatsRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)      //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*LegacyStatsFlags) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	packages, err := builder.SortedLegacyStats()
+	if err != nil {
+		log.Panic("Failed to load legacy build stats", "err", err)
+	}
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err = enc.Encode(packages); err != nil {
+			log.Panic("Failed to encode legacy build stats", "err", err)
+		}
+
+		return
+	}
+
+	if len(packages) == 0 {
+		slog.Info("No legacy pspec.xml packages have been built")
+		return
+	}
+
+	for _, pkg := range packages {
+		fmt.Printf("%-32s %5d built %5d refused, last %s\n", pkg.Name, pkg.Builds, pkg.Refused,
+			pkg.LastBuild.Local().Format("2006-01-02 15:04"))
+	}
+}
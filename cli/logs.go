@@ -0,0 +1,111 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Logs)
+}
+
+// Logs lists and shows the logs of past builds.
+var Logs = cmd.Sub{
+	Name:  "logs",
+	Alias: "cat-log",
+	Short: "List or show the logs of past builds",
+	Flags: &LogsFlags{},
+	Args:  &LogsArgs{},
+	Run:   LogsRun,
+}
+
+// LogsFlags are flags for the "logs" sub-command.
+//
+//nolint:tagalign
+type LogsFlags struct {
+	Cat bool `short:"c" long:"cat" desc:"Print the most recent log of the package"`
+}
+
+// LogsArgs are arguments for the "logs" sub-command.
+type LogsArgs struct {
+	Package []string `zero:"yes" desc:"Only list the logs of this package"`
+}
+
+// LogsRun carries out the "logs" sub-command.
+func LogsRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*LogsFlags)   //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*LogsArgs)      //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	name := strings.Join(sArgs.Package, "")
+
+	logs, err := builder.ListBuildLogs(name)
+	if err != nil {
+		log.Panic("Failed to list build logs", "err", err)
+	}
+
+	if len(logs) == 0 {
+		slog.Info("No build logs found", "dir", builder.BuildLogDir)
+		return
+	}
+
+	if sFlags.Cat {
+		if name == "" {
+			log.Panic("A package name is required to show its log")
+		}
+
+		catLog(logs[0].Path)
+
+		return
+	}
+
+	for _, entry := range logs {
+		fmt.Printf("%s  %8s  %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+			humanReadableFormat(float64(entry.Size)), entry.Path)
+	}
+}
+
+// catLog writes the contents of the log to stdout.
+func catLog(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Panic("Failed to open build log", "err", err)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(os.Stdout, f); err != nil {
+		log.Panic("Failed to read build log", "err", err)
+	}
+}
@@ -0,0 +1,83 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&MigrateCache)
+}
+
+// MigrateCache moves obsolete caches into the current layout.
+var MigrateCache = cmd.Sub{
+	Name:  "migrate-cache",
+	Alias: "mc",
+	Short: "Move the contents of obsolete cache directories into the current layout",
+	Run:   MigrateCacheRun,
+}
+
+// MigrateCacheRun carries out the "migrate-cache" sub-command.
+func MigrateCacheRun(r *cmd.Root, _ *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to migrate caches")
+	}
+
+	var (
+		moved int
+		size  int64
+	)
+
+	for _, migration := range builder.CacheMigrations {
+		res, err := migration.Migrate()
+		if err != nil {
+			log.Panic("Failed to migrate cache directory %s: %s\n", migration.From, err)
+		}
+
+		if res.Moved+res.Skipped > 0 {
+			slog.Info("Migrated cache directory", "from", migration.From, "to", migration.To,
+				"moved", res.Moved, "skipped", res.Skipped)
+		}
+
+		moved += res.Moved
+		size += res.Size
+	}
+
+	if moved == 0 {
+		slog.Info("No cache entries to migrate")
+		return
+	}
+
+	slog.Info("Migration complete", "entries", moved, "size", humanReadableFormat(float64(size)))
+}
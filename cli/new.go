@@ -0,0 +1,93 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"log/slog"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&New)
+}
+
+// New generates a starting package.yml from an upstream source archive.
+var New = cmd.Sub{
+	Name:  "new",
+	Short: "Generate a new package.yml from a source URL",
+	Flags: &NewFlags{},
+	Args:  &NewArgs{},
+	Run:   NewRun,
+}
+
+// NewFlags are flags for the "new" sub-command.
+//
+//nolint:tagalign
+type NewFlags struct {
+	Name    string `          long:"name"    desc:"Override the guessed package name"`
+	Version string `          long:"version" desc:"Override the guessed package version"`
+	Output  string `short:"o" long:"output"  desc:"Directory to write the recipe into (default: current directory)"`
+}
+
+// NewArgs are arguments for the "new" sub-command.
+type NewArgs struct {
+	URL string `desc:"URL of the upstream source archive"`
+}
+
+// NewRun carries out the "new" sub-command.
+func NewRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*NewFlags)    //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*NewArgs)       //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	scaffold, err := builder.NewScaffold(sArgs.URL)
+	if err != nil {
+		log.Panic("Failed to inspect source", "err", err)
+	}
+
+	if sFlags.Name != "" {
+		scaffold.Name = sFlags.Name
+	}
+
+	if sFlags.Version != "" {
+		scaffold.Version = sFlags.Version
+	}
+
+	outDir := sFlags.Output
+	if outDir == "" {
+		outDir = "."
+	}
+
+	if err := scaffold.Write(outDir); err != nil {
+		log.Panic("Failed to write package.yml", "err", err)
+	}
+
+	slog.Info("Generated package.yml", "name", scaffold.Name, "version", scaffold.Version,
+		"build_type", scaffold.BuildType)
+}
@@ -0,0 +1,100 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Pool)
+}
+
+// Pool keeps pre-provisioned roots ready for builds.
+var Pool = cmd.Sub{
+	Name:  "pool",
+	Short: "Provision roots ready for instant builds",
+	Flags: &PoolFlags{},
+	Run:   PoolRun,
+}
+
+// PoolFlags are flags for the "pool" sub-command.
+type PoolFlags struct {
+	Size int `short:"s" long:"size" desc:"Number of roots to keep ready, overriding pool_size"`
+}
+
+// PoolRun carries out the "pool" sub-command.
+func PoolRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*PoolFlags)   //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+
+		builder.DisableColors = true
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to use pool")
+	}
+
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	// Safety first...
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		if errors.Is(err, builder.ErrProfileNotInstalled) {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+
+		os.Exit(1)
+	}
+
+	size := sFlags.Size
+	if size == 0 {
+		size = manager.Config.PoolSize
+	}
+
+	if size < 1 {
+		log.Panic("No pool size given, set pool_size in solbuild.conf or pass --size")
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := manager.FillPool(ctx, size); err != nil {
+		log.Panic("Failed to fill the pool: %s\n", err)
+	}
+}
@@ -0,0 +1,139 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&PreloadPackages)
+}
+
+// PreloadPackages seeds the package cache from a directory or list of packages.
+var PreloadPackages = cmd.Sub{
+	Name:  "preload-packages",
+	Short: "Verify and copy packages into the package cache ahead of builds",
+	Flags: &PreloadPackagesFlags{},
+	Args:  &PreloadPackagesArgs{},
+	Run:   PreloadPackagesRun,
+}
+
+// PreloadPackagesFlags are flags for the "preload-packages" sub-command.
+type PreloadPackagesFlags struct {
+	Index    string `short:"i" long:"index"     desc:"Verify against these repo indexes instead of those of the profile"`
+	NoVerify bool   `short:"n" long:"no-verify" desc:"Don't verify the packages against any repo index"`
+}
+
+// PreloadPackagesArgs are arguments for the "preload-packages" sub-command.
+type PreloadPackagesArgs struct {
+	Src string `desc:"Directory of packages, or file listing package paths or URLs"`
+}
+
+// PreloadPackagesRun carries out the "preload-packages" sub-command.
+func PreloadPackagesRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags)          //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*PreloadPackagesFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*PreloadPackagesArgs)    //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to preload packages")
+	}
+
+	sources, err := builder.PreloadSources(sArgs.Src)
+	if err != nil {
+		log.Panic("Failed to find packages to preload", "err", err)
+	}
+
+	var index builder.PackageIndex
+
+	switch {
+	case sFlags.NoVerify:
+	case sFlags.Index != "":
+		index = make(builder.PackageIndex)
+
+		for _, uri := range strings.Split(sFlags.Index, ",") {
+			repoIndex, err := builder.LoadPackageIndex(strings.TrimSpace(uri))
+			if err != nil {
+				log.Panic("Failed to load repo index", "err", err)
+			}
+
+			index.Merge(repoIndex)
+		}
+	default:
+		index = profileIndex(rFlags)
+	}
+
+	result, err := builder.PreloadPackages(sources, index, builder.PackageCacheDirectory)
+	if err != nil {
+		log.Panic("Failed to preload packages", "err", err)
+	}
+
+	slog.Info("Preloaded packages", "added", result.Added, "existing", result.Existing,
+		"unverified", result.Unverified, "rejected", result.Rejected)
+
+	if result.Rejected > 0 {
+		log.Panic("Some packages were rejected", "count", result.Rejected)
+	}
+}
+
+// profileIndex will read the repo indexes of the profile, or return nil to
+// skip verification if its image is not installed.
+func profileIndex(rFlags *GlobalFlags) builder.PackageIndex {
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+
+	index, err := manager.ReadPackageIndex()
+	if errors.Is(err, builder.ErrProfileNotInstalled) {
+		slog.Warn("Profile is not installed, the packages cannot be verified against its repos")
+		return nil
+	}
+
+	if err != nil {
+		log.Panic("Failed to read the repo indexes of the profile", "err", err)
+	}
+
+	if len(index) == 0 {
+		slog.Warn("No repo indexes found, the packages cannot be verified")
+	}
+
+	return index
+}
@@ -0,0 +1,140 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Prune)
+}
+
+// Prune reclaims space from the build roots, sources and packages cached by
+// solbuild.
+var Prune = cmd.Sub{
+	Name:  "prune",
+	Short: "Remove cached build roots, sources and packages by age or size budget",
+	Flags: &PruneFlags{},
+	Run:   PruneRun,
+}
+
+// PruneFlags are the flags for the "prune" sub-command.
+//
+//nolint:tagalign
+type PruneFlags struct {
+	OlderThan int    `          long:"older-than" desc:"Remove anything unused for this many days"`
+	Budget    string `          long:"budget"     desc:"Remove the least recently used until usage is within this size, e.g. 200G"`
+	Orphans   bool   `          long:"orphans"    desc:"Remove legacy source links whose source is gone"`
+	DryRun    bool   `          long:"dry-run"    desc:"Only list what would be removed"`
+	JSON      bool   `short:"j" long:"json"       desc:"Print what was removed as JSON"`
+}
+
+// PruneRun carries out the "prune" sub-command.
+func PruneRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*PruneFlags)  //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to prune caches")
+	}
+
+	policy := builder.PrunePolicy{
+		OlderThan: time.Duration(sFlags.OlderThan) * 24 * time.Hour,
+		Orphans:   sFlags.Orphans,
+		DryRun:    sFlags.DryRun,
+	}
+
+	if sFlags.Budget != "" {
+		budget, err := builder.ParseByteSize(sFlags.Budget)
+		if err != nil {
+			log.Panic("Invalid budget", "err", err)
+		}
+
+		policy.Budget = budget
+	}
+
+	if policy.OlderThan <= 0 && policy.Budget <= 0 && !policy.Orphans {
+		log.Panic("Nothing to prune, pass --older-than, --budget or --orphans")
+	}
+
+	manager, err := builder.NewManager()
+	if err != nil {
+		log.Panic("Failed to create new Manager: %e\n", err)
+	}
+
+	start := time.Now()
+	results, err := builder.Prune(manager.Config, policy)
+
+	if !policy.DryRun {
+		rec := builder.NewAuditRecord(builder.AuditPrune, start, err)
+		for _, result := range results {
+			rec.Paths = append(rec.Paths, result.Path)
+		}
+
+		if err := manager.Audit(rec); err != nil {
+			log.Panic("Failed to audit pruning", "err", err)
+		}
+	}
+
+	if err != nil {
+		log.Panic("Failed to prune caches", "err", err)
+	}
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(results); err != nil {
+			log.Panic("Failed to encode pruned caches", "err", err)
+		}
+
+		return
+	}
+
+	var total int64
+
+	for _, result := range results {
+		fmt.Printf("%s  %-8s  %8s  %s\n", result.LastUsed.Local().Format("2006-01-02 15:04:05"), result.Kind,
+			humanReadableFormat(float64(result.Size)), result.Path)
+
+		total += result.Size
+	}
+
+	if policy.DryRun {
+		slog.Info("Would remove", "count", len(results), "size", humanReadableFormat(float64(total)))
+	} else {
+		slog.Info("Removed", "count", len(results), "size", humanReadableFormat(float64(total)))
+	}
+}
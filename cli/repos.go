@@ -0,0 +1,137 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&Repos)
+}
+
+// Repos inspects the repos used by a solbuild profile.
+var Repos = cmd.Sub{
+	Name:  "repos",
+	Short: "Show the repo changes a profile would make to its image",
+	Flags: &ReposFlags{},
+	Args:  &ReposArgs{},
+	Run:   ReposRun,
+}
+
+// ReposFlags are flags for the "repos" sub-command.
+type ReposFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the repo changes as JSON"`
+}
+
+// ReposArgs are arguments for the "repos" sub-command.
+type ReposArgs struct {
+	Action  string   `desc:"Action to perform, only diff is supported"`
+	Package []string `zero:"yes" desc:"Package to evaluate conditional repos for, defaults to the current recipe"`
+}
+
+// repoChangeSymbols prefix each change in the diff output.
+var repoChangeSymbols = map[builder.RepoAction]string{
+	builder.RepoKeep:   " ",
+	builder.RepoRemove: "-",
+	builder.RepoAdd:    "+",
+}
+
+// ReposRun carries out the "repos" sub-command.
+func ReposRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ReposFlags)  //nolint:forcetypeassert // guaranteed by callee.
+	sArgs := s.Args.(*ReposArgs)     //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if sArgs.Action != "diff" {
+		log.Panic("Unknown repos action, expected diff", "action", sArgs.Action)
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to inspect images")
+	}
+
+	name := strings.Join(sArgs.Package, "")
+	if name == "" {
+		if pkgPath := FindLikelyArg(); pkgPath != "" {
+			pkg, err := builder.NewPackage(pkgPath)
+			if err != nil {
+				log.Panic("Failed to load package", "path", pkgPath, "err", err)
+			}
+
+			name = pkg.Name
+		}
+	}
+
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+
+	changes, err := manager.DiffRepos(name)
+	if err != nil {
+		if errors.Is(err, builder.ErrProfileNotInstalled) {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+
+		log.Panic("Failed to evaluate repo changes", "err", err)
+	}
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err = enc.Encode(changes); err != nil {
+			log.Panic("Failed to encode repo changes", "err", err)
+		}
+
+		return
+	}
+
+	for _, change := range changes {
+		line := fmt.Sprintf("%s %s (%s)", repoChangeSymbols[change.Action], change.Name, change.URI)
+		if change.Conditional {
+			line += " [conditional]"
+		}
+
+		fmt.Println(line)
+	}
+}
@@ -17,7 +17,10 @@
 package cli
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
 )
@@ -38,11 +41,18 @@ var Root = cmd.Root{
 //
 //nolint:tagalign // asks for weird alignment
 type GlobalFlags struct {
-	Debug   bool   `short:"d" long:"debug"     desc:"Enable debug message"`
-	NoColor bool   `short:"n" long:"no-color"  desc:"Disable color output"`
-	Profile string `short:"p" long:"profile"   desc:"Build profile to use"`
-	Eopkg   string `          long:"eopkg-bin" desc:"eopkg binary to use"`
-	YPKG    string `          long:"ypkg-bin"  desc:"ypkg binary to use"`
+	Debug      bool   `short:"d" long:"debug"       desc:"Enable debug message"`
+	NoColor    bool   `short:"n" long:"no-color"    desc:"Disable color output"`
+	Profile    string `short:"p" long:"profile"     desc:"Build profile to use"`
+	ProfileDir string `          long:"profile-dir" desc:"Extra directories to load profiles from, separated by colons"`
+	Eopkg      string `          long:"eopkg-bin"   desc:"eopkg binary to use"`
+	YPKG       string `          long:"ypkg-bin"    desc:"ypkg binary to use"`
+}
+
+// interruptContext returns a context that is cancelled once solbuild is
+// interrupted, so that the operation in progress can clean up after itself.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 }
 
 // FindLikelyArg will look in the current directory to see if common path names exist,
@@ -0,0 +1,111 @@
+//
+// Copyright © 2016-2021 Solus Project <copyright@getsol.us>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/DataDrake/cli-ng/v2/cmd"
+
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
+)
+
+func init() {
+	cmd.Register(&SelfTest)
+}
+
+// SelfTest checks that the sandbox of the build root still holds.
+var SelfTest = cmd.Sub{
+	Name:  "selftest",
+	Short: "Check the sandbox holds by probing it from within a build root",
+	Run:   SelfTestRun,
+}
+
+// SelfTestRun carries out the "selftest" sub-command.
+func SelfTestRun(r *cmd.Root, s *cmd.Sub) {
+	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+
+	if rFlags.Debug {
+		log.Level.Set(slog.LevelDebug)
+	}
+
+	if rFlags.NoColor {
+		log.SetUncoloredLogger()
+	}
+
+	if os.Geteuid() != 0 {
+		log.Panic("You must be root to run the self test")
+	}
+
+	// Initialise the build manager
+	manager, err := builder.NewManager()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
+
+	// Safety first...
+	if err = manager.SetProfile(rFlags.Profile); err != nil {
+		os.Exit(1)
+	}
+	// Set the package
+	if err := manager.SetPackage(&builder.SelfTestPackage); err != nil {
+		if errors.Is(err, builder.ErrProfileNotInstalled) {
+			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
+		}
+
+		os.Exit(1)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	results, err := manager.SelfTest(ctx)
+	if err != nil {
+		log.Panic("Failed to run the self test", "err", err)
+	}
+
+	for _, result := range results {
+		status := "PASS"
+
+		switch {
+		case result.Err != nil:
+			status = "ERROR"
+		case result.Held:
+		case result.Probe.Required:
+			status = "FAIL"
+		default:
+			status = "WARN"
+		}
+
+		fmt.Printf("%-6s %-16s %s\n", status, result.Probe.Name, result.Probe.Desc)
+
+		if result.Err != nil {
+			slog.Error("Failed to run probe", "probe", result.Probe.Name, "err", result.Err)
+		}
+	}
+
+	if builder.SelfTestFailed(results) {
+		os.Exit(1)
+	}
+}
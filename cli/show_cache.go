@@ -1,13 +1,15 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
+	"sort"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
 
 	"github.com/getsolus/solbuild/builder"
-	"github.com/getsolus/solbuild/builder/source"
 	"github.com/getsolus/solbuild/cli/log"
 )
 
@@ -20,11 +22,25 @@ var ShowCache = cmd.Sub{
 	Name:  "show-cache",
 	Alias: "sc",
 	Short: "Show the size of assets stored on disk by solbuild",
+	Flags: &ShowCacheFlags{},
 	Run:   ShowCacheRun,
 }
 
+// ShowCacheFlags are the flags for the "show-cache" sub-command.
+type ShowCacheFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the disk usage as JSON"`
+}
+
+// cacheReport is the JSON form of the "show-cache" output.
+type cacheReport struct {
+	Entries  []builder.DiskUsage `json:"entries"`
+	Profiles map[string]int64    `json:"profiles"`
+	Total    int64               `json:"total"`
+}
+
 func ShowCacheRun(r *cmd.Root, s *cmd.Sub) {
-	rFlags := r.Flags.(*GlobalFlags) //nolint:forcetypeassert // guaranteed by callee.
+	rFlags := r.Flags.(*GlobalFlags)    //nolint:forcetypeassert // guaranteed by callee.
+	sFlags := s.Flags.(*ShowCacheFlags) //nolint:forcetypeassert // guaranteed by callee.
 
 	if rFlags.Debug {
 		log.Level.Set(slog.LevelDebug)
@@ -39,33 +55,66 @@ func ShowCacheRun(r *cmd.Root, s *cmd.Sub) {
 		log.Panic("Failed to create new Manager: %e\n", err)
 	}
 
+	if sFlags.JSON {
+		showCacheJSON(manager)
+		return
+	}
+
 	showCacheSizes(manager)
 }
 
-func showCacheSizes(manager *builder.Manager) {
-	sizeDirs := []string{
-		manager.Config.OverlayRootDir,
-		builder.CacheDirectory,
-		builder.ObsoleteCcacheDirectory,
-		builder.ObsoleteSccacheDirectory,
-		builder.ObsoleteLegacyCcacheDirectory,
-		builder.ObsoleteLegacySccacheDirectory,
-		builder.PackageCacheDirectory,
-		source.SourceDir,
+// newCacheReport gathers the disk usage with per-profile totals.
+func newCacheReport(manager *builder.Manager) *cacheReport {
+	report := &cacheReport{
+		Entries:  builder.GetDiskUsage(manager.Config),
+		Profiles: make(map[string]int64),
+	}
+
+	for _, entry := range report.Entries {
+		report.Total += entry.Size
+
+		if entry.Profile != "" {
+			report.Profiles[entry.Profile] += entry.Size
+		}
 	}
 
-	var totalSize int64
+	return report
+}
+
+func showCacheJSON(manager *builder.Manager) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(newCacheReport(manager)); err != nil {
+		log.Panic("Failed to encode disk usage", "err", err)
+	}
+}
 
-	for _, p := range sizeDirs {
-		size, err := getDirSize(p)
-		totalSize += size
+func showCacheSizes(manager *builder.Manager) {
+	report := newCacheReport(manager)
 
-		if err != nil {
-			slog.Warn("Couldn't get directory size", "reason", err)
+	for _, entry := range report.Entries {
+		if entry.Size == 0 {
+			continue
 		}
 
-		slog.Info(fmt.Sprintf("Size of '%s' is '%s'", p, humanReadableFormat(float64(size))))
+		slog.Info(fmt.Sprintf("Size of '%s' is '%s'", entry.Path, humanReadableFormat(float64(entry.Size))),
+			"kind", entry.Kind)
+	}
+
+	profiles := make([]string, 0, len(report.Profiles))
+	for profile := range report.Profiles {
+		profiles = append(profiles, profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return report.Profiles[profiles[i]] > report.Profiles[profiles[j]]
+	})
+
+	for _, profile := range profiles {
+		slog.Info(fmt.Sprintf("Size of profile '%s' is '%s'", profile,
+			humanReadableFormat(float64(report.Profiles[profile]))))
 	}
 
-	slog.Info(fmt.Sprintf("Total size: '%s'", humanReadableFormat(float64(totalSize))))
+	slog.Info(fmt.Sprintf("Total size: '%s'", humanReadableFormat(float64(report.Total))))
 }
@@ -61,6 +61,7 @@ func UpdateRun(r *cmd.Root, c *cmd.Sub) {
 	}
 
 	manager.SetCommands(rFlags.Eopkg, rFlags.YPKG)
+	manager.SetProfileDirs(rFlags.ProfileDir)
 
 	// Safety first...
 	if err = manager.SetProfile(rFlags.Profile); err != nil {
@@ -71,11 +72,18 @@ func UpdateRun(r *cmd.Root, c *cmd.Sub) {
 		os.Exit(1)
 	}
 
-	if err := manager.Update(); err != nil {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if err := manager.Update(ctx); err != nil {
 		if errors.Is(err, builder.ErrProfileNotInstalled) {
 			fmt.Fprintf(os.Stderr, "%v: Did you forget to init?\n", err)
 		}
 
+		if errors.Is(err, builder.ErrUpdateRejected) {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+
 		os.Exit(1)
 	}
 }
@@ -17,11 +17,15 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/DataDrake/cli-ng/v2/cmd"
 
-	"github.com/getsolus/solbuild/util"
+	"github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/cli/log"
 )
 
 func init() {
@@ -32,13 +36,46 @@ func init() {
 var Version = cmd.Sub{
 	Name:  "version",
 	Short: "Print the solbuild version and exit",
+	Flags: &VersionFlags{},
 	Run:   VersionRun,
 }
 
+// VersionFlags are flags for the "version" sub-command.
+type VersionFlags struct {
+	JSON bool `short:"j" long:"json" desc:"Print the version information as JSON"`
+}
+
 // VersionRun carries out the "version" sub-command.
 //
 //nolint:forbidigo // the point of this function is to print the version
-func VersionRun(_ *cmd.Root, _ *cmd.Sub) {
-	fmt.Printf("solbuild version %v\n\nCopyright © 2016-2021 Solus Project\n", util.SolbuildVersion)
+func VersionRun(_ *cmd.Root, s *cmd.Sub) {
+	sFlags := s.Flags.(*VersionFlags) //nolint:forcetypeassert // guaranteed by callee.
+
+	info := builder.GetVersionInfo()
+
+	if sFlags.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(info); err != nil {
+			log.Panic("Failed to encode version information", "err", err)
+		}
+
+		return
+	}
+
+	fmt.Printf("solbuild version %v\n\n", info.Version)
+
+	if info.GitCommit != "" {
+		fmt.Printf("Git commit: %s\n", info.GitCommit)
+	}
+
+	if info.BuildDate != "" {
+		fmt.Printf("Build date: %s\n", info.BuildDate)
+	}
+
+	fmt.Printf("Go version: %s (%s)\n", info.GoVersion, info.Platform)
+	fmt.Printf("Features:   %s\n\n", strings.Join(info.Features, ", "))
+	fmt.Println("Copyright © 2016-2021 Solus Project")
 	fmt.Println("Licensed under the Apache License, Version 2.0")
 }
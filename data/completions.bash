@@ -5,9 +5,9 @@ _solbuild()
   COMPREPLY=()
   cur=${COMP_WORDS[COMP_CWORD]}
 
-  commands="build chroot delete-cache help index init update version"
+  commands="abireport audit bisect-image build bump chroot completion config convert delete-cache deprecations doctor export-oci export-state help import-state index init inspect-image legacy-stats logs migrate-cache new pool preload-packages prune repos selftest show-cache update version"
 
-  options="-d --debug -n --no-color -p --profile"
+  options="-d --debug -n --no-color -p --profile --profile-dir"
   recipes=""
   files=""
 
@@ -44,24 +44,75 @@ _solbuild()
     # Completion for subcommand specific args
     if [[ "$cur" == -* ]]; then
         case $command in
+          @(abireport))
+            options="${options} --output"
+            ;;
           @(build))
-            options="${options} --tmpfs --memory --transit-manifest --disable-abi-report"
+            options="${options} --tmpfs --memory --transit-manifest --disable-abi-report --history --history-file --secret --toolchain --locale --timezone --check-image --locked --update-lock --lowmem --ci --verify --force --accept-new-hash --strict --disk-quota --profiles --fail-fast --output-dir --artifact-layout --no-state --isolate-home --capture-home --cpus --numa-nodes --recipe-type --compression --quick --image-generation"
+            ;;
+          @(bump))
+            options="${options} --source --version --commit"
+            ;;
+          @(chroot))
+            options="${options} --shell --recipe-type --toolchain"
+            ;;
+          @(convert))
+            options="${options} --output"
             ;;
           @(delete-cache|dc))
             options="${options} --all --images --sizes"
             ;;
+          @(audit))
+            options="${options} --json --repair"
+            ;;
+          @(bisect-image|deprecations|doctor))
+            options="${options} --json"
+            ;;
+          @(export-oci))
+            options="${options} --output"
+            ;;
+          @(export-state))
+            options="${options} --parts"
+            ;;
           @(index))
             options="${options} --tmpfs --memory"
             ;;
           @(init))
             options="${options} --update"
             ;;
+          @(pool))
+            options="${options} --size"
+            ;;
+          @(preload-packages))
+            options="${options} --index --no-verify"
+            ;;
+          @(prune))
+            options="${options} --older-than --budget --orphans --dry-run --json"
+            ;;
+          @(repos))
+            options="${options} --json"
+            ;;
+          @(legacy-stats))
+            options="${options} --json"
+            ;;
+          @(show-cache|sc))
+            options="${options} --json"
+            ;;
+          @(logs|cat-log))
+            options="${options} --cat"
+            ;;
+          @(new))
+            options="${options} --name --version --output"
+            ;;
+          @(version))
+            options="${options} --json"
+            ;;
         esac
         COMPREPLY=($(compgen -W "$options" -- $cur))
         return 0;
     else
         case $command in
-          @(build|chroot))
+          @(build|bump|chroot))
             if [ `ls package.yml 2> /dev/null | wc -l` -gt 0 ]; then
               recipes="package.yml"
             elif [ `ls pspec.xml 2> /dev/null | wc -l` -gt 0 ]; then
@@ -72,6 +123,10 @@ _solbuild()
             COMPREPLY=($(compgen -W "$recipes" -- $cur))
             return 0;
             ;;
+          @(convert))
+            COMPREPLY=($(compgen -W "$(ls pspec.xml 2> /dev/null)" -- $cur))
+            return 0;
+            ;;
         esac
         COMPREPLY=($(compgen -f -- $cur))
         return 0;
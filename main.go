@@ -19,7 +19,7 @@ package main
 import (
 	"os"
 
-	_ "github.com/getsolus/solbuild/builder"
+	"github.com/getsolus/solbuild/builder"
 	"github.com/getsolus/solbuild/cli"
 	"github.com/getsolus/solbuild/cli/log"
 )
@@ -36,5 +36,11 @@ func main() {
 	defer exit()
 
 	log.SetLogger()
+
+	// Every command must agree on where the state of solbuild is kept
+	if err := builder.LoadDirectories(); err != nil {
+		log.Panic("Failed to load solbuild configuration", "err", err)
+	}
+
 	cli.Root.Run()
 }
@@ -16,4 +16,64 @@
 
 package util
 
-var SolbuildVersion = "development"
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// SolbuildVersion is the release version, set at link time.
+	SolbuildVersion = "development"
+
+	// GitCommit is the commit solbuild was built from, set at link time.
+	GitCommit = ""
+
+	// BuildDate is when solbuild was built, set at link time.
+	BuildDate = ""
+)
+
+// VersionInfo describes the exact provenance of a solbuild binary.
+type VersionInfo struct {
+	Version   string   `json:"version"`
+	GitCommit string   `json:"git_commit,omitempty"`
+	BuildDate string   `json:"build_date,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Features  []string `json:"features,omitempty"`
+}
+
+// GetVersionInfo returns the build metadata for this binary. When not set at
+// link time, the commit and date are taken from the embedded VCS information.
+func GetVersionInfo() *VersionInfo {
+	info := &VersionInfo{
+		Version:   SolbuildVersion,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.GitCommit == "" {
+				info.GitCommit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = setting.Value
+			}
+		case "vcs.modified":
+			if setting.Value == "true" && info.GitCommit != "" && GitCommit == "" {
+				info.GitCommit += "-dirty"
+			}
+		}
+	}
+
+	return info
+}